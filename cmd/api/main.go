@@ -2,14 +2,19 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/danielllmuniz/devices-api/internal/api"
+	"github.com/danielllmuniz/devices-api/internal/auth"
 	"github.com/danielllmuniz/devices-api/internal/services"
 	"github.com/danielllmuniz/devices-api/internal/store/pgstore"
+	"github.com/danielllmuniz/devices-api/internal/store/pgstore/migrations"
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
@@ -20,17 +25,28 @@ func main() {
 		panic(err)
 	}
 
+	autoMigrate := flag.Bool("migrate", os.Getenv("AUTO_MIGRATE") == "true", "apply pending migrations before serving (default $AUTO_MIGRATE)")
+	flag.Parse()
+
 	// LOAD CONTEXT
 	ctx := context.Background()
 
+	// MIGRATIONS
+	// They run before the pool exists: its connections load the custom types,
+	// which the migrations may create.
+	if *autoMigrate {
+		if err := migrate(ctx); err != nil {
+			panic(err)
+		}
+	}
+
 	// DATABASE CONNECTION
-	pool, err := pgxpool.New(ctx, fmt.Sprintf("user=%s password=%s host=%s port=%s dbname=%s",
-		os.Getenv("DATABASE_USER"),
-		os.Getenv("DATABASE_PASSWORD"),
-		os.Getenv("DATABASE_HOST"),
-		os.Getenv("DATABASE_PORT"),
-		os.Getenv("DATABASE_NAME"),
-	))
+	config, err := pgxpool.ParseConfig(pgstore.AppConnStringFromEnv())
+	if err != nil {
+		panic(err)
+	}
+	config.AfterConnect = pgstore.RegisterTypes
+	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		panic(err)
 	}
@@ -39,10 +55,87 @@ func main() {
 		panic(err)
 	}
 
+	// DEVICE SERVICE
+	deviceService := services.NewDeviceService(pgstore.NewPGDeviceStore(pool))
+	if path := os.Getenv("DEVICE_TRANSITIONS_FILE"); path != "" {
+		transitions, err := services.LoadTransitionsFile(path)
+		if err != nil {
+			panic(err)
+		}
+		deviceService.Transitions = transitions
+	}
+
+	// PURGE SOFT DELETED DEVICES
+	if value := os.Getenv("DEVICE_RETENTION"); value != "" {
+		retention, err := time.ParseDuration(value)
+		if err != nil {
+			panic(err)
+		}
+		interval := time.Hour
+		if value := os.Getenv("DEVICE_PURGE_INTERVAL"); value != "" {
+			if interval, err = time.ParseDuration(value); err != nil {
+				panic(err)
+			}
+		}
+		go deviceService.RunPurger(ctx, retention, interval)
+	}
+
+	// RESERVATIONS
+	reservationInterval := 30 * time.Second
+	if value := os.Getenv("RESERVATION_SCHEDULER_INTERVAL"); value != "" {
+		if reservationInterval, err = time.ParseDuration(value); err != nil {
+			panic(err)
+		}
+	}
+	go deviceService.RunReservationScheduler(ctx, reservationInterval)
+
+	// IDEMPOTENCY KEYS
+	idempotencyService := services.NewIdempotencyService(pgstore.NewPGIdempotencyStore(pool))
+	if value := os.Getenv("IDEMPOTENCY_KEY_TTL"); value != "" {
+		if idempotencyService.TTL, err = time.ParseDuration(value); err != nil {
+			panic(err)
+		}
+	}
+	if value := os.Getenv("IDEMPOTENCY_KEY_LEASE"); value != "" {
+		if idempotencyService.Lease, err = time.ParseDuration(value); err != nil {
+			panic(err)
+		}
+	}
+	go idempotencyService.RunPurger(ctx, time.Hour)
+
+	// ACCESS CONTROL
+	// Roles and grants can be managed before RBAC_ENABLED makes DeviceService
+	// enforce them.
+	accessService := services.NewAccessService(pgstore.NewPGAccessStore(pool))
+	if os.Getenv("RBAC_ENABLED") == "true" {
+		deviceService.Access = accessService
+	}
+
+	// AUTHENTICATION
+	var authenticator auth.Authenticator
+	if os.Getenv("AUTH_DISABLED") == "true" {
+		fmt.Println("Authentication is disabled, anyone reaching the server can change devices")
+	} else {
+		chain := auth.Chain{auth.NewAPIKeyAuthenticator(pgstore.NewPGAPIKeyStore(pool))}
+		if path := os.Getenv("AUTH_JWKS_FILE"); path != "" {
+			jwtAuthenticator, err := auth.LoadJWTAuthenticator(path)
+			if err != nil {
+				panic(err)
+			}
+			jwtAuthenticator.Issuer = os.Getenv("AUTH_JWT_ISSUER")
+			jwtAuthenticator.Audience = os.Getenv("AUTH_JWT_AUDIENCE")
+			chain = append(chain, jwtAuthenticator)
+		}
+		authenticator = chain
+	}
+
 	// START SERVER
 	app := api.Api{
-		Router:        chi.NewMux(),
-		DeviceService: services.NewDeviceService(pgstore.NewPGDeviceStore(pool)),
+		Router:             chi.NewMux(),
+		DeviceService:      deviceService,
+		IdempotencyService: idempotencyService,
+		AccessService:      accessService,
+		Authenticator:      authenticator,
 	}
 
 	app.BindRoutes()
@@ -60,3 +153,19 @@ func main() {
 	fmt.Printf("Press CTRL+C to stop\n")
 	select {}
 }
+
+// migrate applies the pending migrations. Replicas starting together wait on
+// the runner's advisory lock, so only the first one does the work.
+func migrate(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, pgstore.ConnStringFromEnv())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	runner, err := migrations.NewRunner(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return runner.Up(ctx)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/danielllmuniz/devices-api/internal/auth"
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/danielllmuniz/devices-api/internal/store/pgstore"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: apikeys command
+
+Commands:
+  create TENANT NAME SCOPE...   create a key granting the scopes in the tenant and print it
+  list TENANT                   list the keys of the tenant
+  revoke TENANT ID              revoke a key of the tenant
+
+Scopes: devices:read, devices:write, devices:delete, admin`
+
+func main() {
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		panic(err)
+	}
+
+	if err := run(context.Background(), os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return errors.New("missing command")
+	}
+
+	pool, err := pgxpool.New(ctx, pgstore.ConnStringFromEnv())
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	keys := pgstore.NewPGAPIKeyStore(pool)
+
+	switch command := args[0]; {
+	case command == "create" && len(args) >= 4:
+		return create(ctx, keys, args[1], args[2], args[3:])
+	case command == "list" && len(args) == 2:
+		return list(ctx, keys, args[1])
+	case command == "revoke" && len(args) == 3:
+		id, err := strconv.ParseInt(args[2], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid key id %q", args[2])
+		}
+		if err := keys.RevokeAPIKey(ctx, args[1], int32(id)); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return fmt.Errorf("no active key with id %d", id)
+			}
+			return err
+		}
+		fmt.Printf("Revoked key %d\n", id)
+		return nil
+	}
+	fmt.Fprintln(os.Stderr, usage)
+	return fmt.Errorf("invalid command %q", strings.Join(args, " "))
+}
+
+func create(ctx context.Context, keys store.APIKeyStore, tenantID, name string, scopes []string) error {
+	secret, key, err := auth.NewAPIKey(tenantID, name, scopes)
+	if err != nil {
+		return err
+	}
+	key, err = keys.CreateAPIKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created key %d %q of tenant %s with scopes %s\n", key.ID, key.Name, key.TenantID, strings.Join(key.Scopes, ", "))
+	fmt.Println("Store it now, it cannot be shown again:")
+	fmt.Println(secret)
+	return nil
+}
+
+func list(ctx context.Context, keys store.APIKeyStore, tenantID string) error {
+	all, err := keys.ListAPIKeys(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tCREATED\tREVOKED")
+	for _, key := range all {
+		revoked := ""
+		if key.Revoked() {
+			revoked = key.RevokedAt.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%d\t%s\tdk_%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Prefix, strings.Join(key.Scopes, ","), key.CreatedAt.Format("2006-01-02 15:04"), revoked)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/pkg/client"
+)
+
+// filterFlags adds the list filters to fs; the returned function builds the
+// filter once fs is parsed.
+func filterFlags(fs *flag.FlagSet) func() (client.DeviceFilter, error) {
+	brand := fs.String("brand", "", "comma separated brands")
+	state := fs.String("state", "", "comma separated states")
+	name := fs.String("name", "", "substring of the name")
+	createdAfter := fs.String("created-after", "", "RFC 3339 timestamp")
+	createdBefore := fs.String("created-before", "", "RFC 3339 timestamp")
+	sort := fs.String("sort", "", "comma separated fields, prefixed with '-' for descending order")
+	includeDeleted := fs.Bool("include-deleted", false, "also list deleted devices")
+
+	return func() (client.DeviceFilter, error) {
+		filter := client.DeviceFilter{
+			NameContains:   *name,
+			Sort:           *sort,
+			IncludeDeleted: *includeDeleted,
+		}
+		if *brand != "" {
+			filter.Brands = strings.Split(*brand, ",")
+		}
+		if *state != "" {
+			for _, s := range strings.Split(*state, ",") {
+				filter.States = append(filter.States, client.DeviceState(s))
+			}
+		}
+		var err error
+		if filter.CreatedAfter, err = parseTimeFlag("created-after", *createdAfter); err != nil {
+			return client.DeviceFilter{}, err
+		}
+		if filter.CreatedBefore, err = parseTimeFlag("created-before", *createdBefore); err != nil {
+			return client.DeviceFilter{}, err
+		}
+		return filter, nil
+	}
+}
+
+func parseTimeFlag(name, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("--%s must be an RFC 3339 timestamp", name)
+	}
+	return &t, nil
+}
+
+func runList(ctx context.Context, cli *cli, args []string) error {
+	fs := cli.flagSet()
+	filter := filterFlags(fs)
+	pageSize := fs.Int("page-size", 100, "devices fetched per request")
+	cli.watchFlags(fs)
+	if _, err := cli.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	f.Limit = int32(*pageSize)
+
+	c, err := cli.client()
+	if err != nil {
+		return err
+	}
+	return cli.show(ctx, func() (any, error) {
+		devices := []client.Device{}
+		for page, err := range c.ListDevices(ctx, f) {
+			if err != nil {
+				return nil, err
+			}
+			devices = append(devices, page...)
+		}
+		return devices, nil
+	})
+}
+
+func runGet(ctx context.Context, cli *cli, args []string) error {
+	fs := cli.flagSet()
+	cli.watchFlags(fs)
+	positional, err := cli.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID(positional[0])
+	if err != nil {
+		return err
+	}
+
+	c, err := cli.client()
+	if err != nil {
+		return err
+	}
+	return cli.show(ctx, func() (any, error) {
+		return c.GetDevice(ctx, id)
+	})
+}
+
+// deviceFlags adds the device fields to fs.
+func deviceFlags(fs *flag.FlagSet) (name, brand, state *string) {
+	return fs.String("name", "", "device name"),
+		fs.String("brand", "", "device brand"),
+		fs.String("state", "", "available, in-use or inactive")
+}
+
+// versionFlag adds --version, the version the change must apply to.
+func versionFlag(fs *flag.FlagSet) func() []client.CallOption {
+	version := fs.Int("version", 0, "only apply the change if the device is still at this version")
+	return func() []client.CallOption {
+		if *version <= 0 {
+			return nil
+		}
+		return []client.CallOption{client.IfVersion(int32(*version))}
+	}
+}
+
+func runCreate(ctx context.Context, cli *cli, args []string) error {
+	fs := cli.flagSet()
+	name, brand, state := deviceFlags(fs)
+	file := fs.String("file", "", "JSON file with the device, '-' for stdin")
+	key := fs.String("idempotency-key", "", "key that makes repeating this command safe")
+	if _, err := cli.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	req := client.CreateDeviceRequest{Name: *name, Brand: *brand, State: client.DeviceState(*state)}
+	if *file != "" {
+		if err := cli.readJSON(*file, &req); err != nil {
+			return err
+		}
+	}
+
+	var opts []client.CallOption
+	if *key != "" {
+		opts = append(opts, client.IdempotencyKey(*key))
+	}
+
+	c, err := cli.client()
+	if err != nil {
+		return err
+	}
+	device, err := c.CreateDevice(ctx, req, opts...)
+	if err != nil {
+		return err
+	}
+	return render(cli.stdout, cli.output, device)
+}
+
+func runUpdate(ctx context.Context, cli *cli, args []string) error {
+	fs := cli.flagSet()
+	name, brand, state := deviceFlags(fs)
+	version := versionFlag(fs)
+	positional, err := cli.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID(positional[0])
+	if err != nil {
+		return err
+	}
+
+	c, err := cli.client()
+	if err != nil {
+		return err
+	}
+	device, err := c.UpdateDevice(ctx, id, client.UpdateDeviceRequest{Name: *name, Brand: *brand, State: client.DeviceState(*state)}, version()...)
+	if err != nil {
+		return err
+	}
+	return render(cli.stdout, cli.output, device)
+}
+
+func runPatch(ctx context.Context, cli *cli, args []string) error {
+	fs := cli.flagSet()
+	name, brand, state := deviceFlags(fs)
+	version := versionFlag(fs)
+	positional, err := cli.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID(positional[0])
+	if err != nil {
+		return err
+	}
+
+	// Only the flags given are patched, so a field can be set to "".
+	var patch client.DevicePatch
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			patch.Name = name
+		case "brand":
+			patch.Brand = brand
+		case "state":
+			s := client.DeviceState(*state)
+			patch.State = &s
+		}
+	})
+	if patch.IsEmpty() {
+		return fmt.Errorf("patch: at least one of --name, --brand or --state is required")
+	}
+
+	c, err := cli.client()
+	if err != nil {
+		return err
+	}
+	device, err := c.PatchDevice(ctx, id, patch, version()...)
+	if err != nil {
+		return err
+	}
+	return render(cli.stdout, cli.output, device)
+}
+
+func runDelete(ctx context.Context, cli *cli, args []string) error {
+	fs := cli.flagSet()
+	positional, err := cli.parse(fs, args, 1, -1)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int32, len(positional))
+	for i, arg := range positional {
+		if ids[i], err = parseID(arg); err != nil {
+			return err
+		}
+	}
+
+	c, err := cli.client()
+	if err != nil {
+		return err
+	}
+
+	// Devices deleted before a failure are still reported.
+	var results []deleteResult
+	for _, id := range ids {
+		if err = c.DeleteDevice(ctx, id); err != nil {
+			err = fmt.Errorf("delete device %d: %w", id, err)
+			break
+		}
+		results = append(results, deleteResult{DeviceID: id, Deleted: true})
+	}
+	if len(results) > 0 {
+		if renderErr := render(cli.stdout, cli.output, results); renderErr != nil {
+			return renderErr
+		}
+	}
+	return err
+}
+
+func runImport(ctx context.Context, cli *cli, args []string) error {
+	fs := cli.flagSet()
+	dryRun := fs.Bool("dry-run", false, "only validate the file")
+	positional, err := cli.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	in, err := cli.open(positional[0])
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	c, err := cli.client()
+	if err != nil {
+		return err
+	}
+	report, err := c.ImportDevices(ctx, in, *dryRun)
+	if err != nil {
+		return err
+	}
+	return render(cli.stdout, cli.output, report)
+}
+
+func runExport(ctx context.Context, cli *cli, args []string) error {
+	fs := cli.flagSet()
+	filter := filterFlags(fs)
+	format := fs.String("format", "csv", "csv, ndjson or xlsx")
+	file := fs.String("file", "", "write to FILE instead of stdout")
+	if _, err := cli.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+
+	c, err := cli.client()
+	if err != nil {
+		return err
+	}
+	body, err := c.ExportDevices(ctx, *format, f)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	out := cli.stdout
+	if *file != "" {
+		outFile, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+
+	// A download cut short by the server ends in an error here.
+	if _, err := io.Copy(out, body); err != nil {
+		return fmt.Errorf("export interrupted: %w", err)
+	}
+	return nil
+}
+
+// open opens a file argument, where "-" means stdin.
+func (cli *cli) open(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(cli.stdin), nil
+	}
+	return os.Open(path)
+}
+
+// readJSON decodes the JSON file at path into v, rejecting unknown fields as
+// the API does.
+func (cli *cli) readJSON(path string, v any) error {
+	in, err := cli.open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dec := json.NewDecoder(in)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultServer = "http://localhost:8000"
+
+// profile is where and as whom devicesctl talks to the API.
+type profile struct {
+	Server string `yaml:"server"`
+	Actor  string `yaml:"actor"`
+	Token  string `yaml:"token"`
+	// Tenant is sent as X-Tenant-ID, for API keys, which belong to no
+	// tenant.
+	Tenant string `yaml:"tenant"`
+}
+
+// config is the file holding the profiles, e.g.
+//
+//	current_profile: staging
+//	profiles:
+//	  staging:
+//	    server: https://devices.staging.example.com
+//	    actor: jane
+//	    token: ...
+type config struct {
+	CurrentProfile string             `yaml:"current_profile"`
+	Profiles       map[string]profile `yaml:"profiles"`
+}
+
+// configPath returns $DEVICESCTL_CONFIG, or config.yaml in the devicesctl
+// directory of the user config directory.
+func configPath(getenv func(string) string) (string, error) {
+	if path := getenv("DEVICESCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "devicesctl", "config.yaml"), nil
+}
+
+// loadProfile reads the profile called name from the config file at path.
+// Without a name it falls back to $DEVICESCTL_PROFILE, the current profile of
+// the file and then "default". A missing file or default profile yields the
+// local server; a profile asked for by name must exist.
+func loadProfile(path, name string, getenv func(string) string) (profile, error) {
+	var cfg config
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return profile{}, fmt.Errorf("read config: %w", err)
+	default:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return profile{}, fmt.Errorf("parse config %s: %w", path, err)
+		}
+	}
+
+	explicit := true
+	if name == "" {
+		name = getenv("DEVICESCTL_PROFILE")
+	}
+	if name == "" {
+		name = cfg.CurrentProfile
+	}
+	if name == "" {
+		name, explicit = "default", false
+	}
+
+	p, ok := cfg.Profiles[name]
+	if !ok && explicit {
+		return profile{}, fmt.Errorf("profile %q not found in %s", name, path)
+	}
+	if p.Server == "" {
+		p.Server = defaultServer
+	}
+	if token := getenv("DEVICESCTL_TOKEN"); token != "" {
+		p.Token = token
+	}
+	if tenant := getenv("DEVICESCTL_TENANT"); tenant != "" {
+		p.Tenant = tenant
+	}
+	return p, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/pkg/client"
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, cli *cli, args []string) error
+}
+
+var commands = []command{
+	{"list", "[flags]", "List devices", runList},
+	{"get", "ID [flags]", "Show a device", runGet},
+	{"create", "--name NAME --brand BRAND --state STATE | --file FILE", "Create a device", runCreate},
+	{"update", "ID --name NAME --brand BRAND --state STATE [--version N]", "Replace a device", runUpdate},
+	{"patch", "ID [--name NAME] [--brand BRAND] [--state STATE] [--version N]", "Change some fields of a device", runPatch},
+	{"delete", "ID...", "Delete devices", runDelete},
+	{"import", "FILE.csv [--dry-run]", "Create devices from a CSV file", runImport},
+	{"export", "[--format csv|ndjson|xlsx] [--file FILE] [flags]", "Download devices", runExport},
+}
+
+// cli holds what every command shares: where it reads and writes, and the
+// flags common to all of them.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+	// command is the command being run.
+	command command
+
+	configPath  string
+	profileName string
+	server      string
+	output      string
+	watch       bool
+	interval    time.Duration
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr, getenv: os.Getenv}
+	if err := c.run(ctx, os.Args[1:]); err != nil {
+		printError(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func (cli *cli) run(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		cli.usage()
+		return nil
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			cli.command = cmd
+			err := cmd.run(ctx, cli, args[1:])
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return err
+		}
+	}
+	cli.usage()
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func (cli *cli) usage() {
+	fmt.Fprintln(cli.stderr, "Usage: devicesctl COMMAND [ARGS] [flags]")
+	fmt.Fprintln(cli.stderr)
+	fmt.Fprintln(cli.stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(cli.stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(cli.stderr)
+	fmt.Fprintln(cli.stderr, "Run 'devicesctl COMMAND -h' for the flags of a command.")
+}
+
+// flagSet returns the flags of the command being run, starting with the
+// common ones.
+func (cli *cli) flagSet() *flag.FlagSet {
+	cmd := cli.command
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(cli.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(cli.stderr, "Usage: devicesctl %s %s\n\n%s.\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&cli.configPath, "config", "", "config file (default $DEVICESCTL_CONFIG or devicesctl/config.yaml in the user config directory)")
+	fs.StringVar(&cli.profileName, "profile", "", "config profile to use (default $DEVICESCTL_PROFILE or current_profile)")
+	fs.StringVar(&cli.server, "server", "", "API URL, overriding the profile")
+	fs.StringVar(&cli.output, "output", "table", "output format: table, json or yaml")
+	fs.StringVar(&cli.output, "o", "table", "shorthand for --output")
+	return fs
+}
+
+// watchFlags adds --watch to a command that reads devices.
+func (cli *cli) watchFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&cli.watch, "watch", false, "keep running and print again whenever the result changes")
+	fs.BoolVar(&cli.watch, "w", false, "shorthand for --watch")
+	fs.DurationVar(&cli.interval, "interval", 2*time.Second, "how often --watch polls the API")
+}
+
+// parse parses args, which may mix flags and positional arguments, and
+// checks the number of positional ones against min and max (-1 for any).
+func (cli *cli) parse(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) < min || (max >= 0 && len(positional) > max) {
+		fs.Usage()
+		return nil, fmt.Errorf("%s: wrong number of arguments", fs.Name())
+	}
+	if !slices.Contains(outputFormats, cli.output) {
+		return nil, fmt.Errorf("output must be one of %s", strings.Join(outputFormats, ", "))
+	}
+	return positional, nil
+}
+
+// client returns an API client for the selected profile.
+func (cli *cli) client() (*client.Client, error) {
+	path := cli.configPath
+	if path == "" {
+		var err error
+		if path, err = configPath(cli.getenv); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := loadProfile(path, cli.profileName, cli.getenv)
+	if err != nil {
+		return nil, err
+	}
+	if cli.server != "" {
+		p.Server = cli.server
+	}
+
+	var opts []client.Option
+	if p.Actor != "" {
+		opts = append(opts, client.WithActor(p.Actor))
+	}
+	if p.Token != "" {
+		opts = append(opts, client.WithToken(p.Token))
+	}
+	if p.Tenant != "" {
+		opts = append(opts, client.WithTenant(p.Tenant))
+	}
+	return client.New(p.Server, opts...)
+}
+
+// show renders what fetch returns. With --watch it polls until ctx is done
+// and renders again each time the result changes; tables redraw the screen,
+// JSON and YAML append a new document.
+func (cli *cli) show(ctx context.Context, fetch func() (any, error)) error {
+	var last []byte
+	for {
+		v, err := fetch()
+		if err != nil {
+			if !cli.watch || ctx.Err() != nil {
+				return ignoreCanceled(ctx, err)
+			}
+			printError(cli.stderr, err)
+		} else {
+			var buf bytes.Buffer
+			if err := render(&buf, cli.output, v); err != nil {
+				return err
+			}
+			if !bytes.Equal(buf.Bytes(), last) {
+				if cli.watch && cli.output == "table" {
+					fmt.Fprint(cli.stdout, "\033[H\033[2J")
+				} else if cli.watch && cli.output == "yaml" && last != nil {
+					fmt.Fprintln(cli.stdout, "---")
+				}
+				cli.stdout.Write(buf.Bytes())
+				last = buf.Bytes()
+			}
+		}
+
+		if !cli.watch {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(cli.interval):
+		}
+	}
+}
+
+// ignoreCanceled treats an interrupted watch as a normal exit.
+func ignoreCanceled(ctx context.Context, err error) error {
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return nil
+	}
+	return err
+}
+
+func parseID(arg string) (int32, error) {
+	id, err := strconv.ParseInt(arg, 10, 32)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid device id %q", arg)
+	}
+	return int32(id), nil
+}
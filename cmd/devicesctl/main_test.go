@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/api"
+	"github.com/danielllmuniz/devices-api/internal/services"
+	"github.com/danielllmuniz/devices-api/internal/store/mockstore"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCLI returns a cli whose config has a "test" profile pointing at an
+// API over the mock stores.
+func newTestCLI(t *testing.T) *cli {
+	app := api.Api{
+		Router:             chi.NewMux(),
+		DeviceService:      services.NewDeviceService(mockstore.NewMockDeviceStore()),
+		IdempotencyService: services.NewIdempotencyService(mockstore.NewMockIdempotencyStore()),
+	}
+	app.BindRoutes()
+	server := httptest.NewServer(app.Router)
+	t.Cleanup(server.Close)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := "current_profile: test\nprofiles:\n  test:\n    server: " + server.URL + "\n    actor: jane\n"
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+
+	env := map[string]string{"DEVICESCTL_CONFIG": path}
+	return &cli{getenv: func(key string) string { return env[key] }}
+}
+
+// exec runs a command line on a fresh cli sharing the environment of base.
+func exec(t *testing.T, base *cli, line string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdin: strings.NewReader(""), stdout: &stdout, stderr: &stderr, getenv: base.getenv}
+	err := c.run(context.Background(), strings.Fields(line))
+	return stdout.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	base := newTestCLI(t)
+
+	out, err := exec(t, base, "create --name Phone --brand Acme --state available -o json")
+	require.NoError(t, err)
+	var created map[string]any
+	require.NoError(t, json.Unmarshal([]byte(out), &created))
+	assert.Equal(t, "Phone", created["name"])
+
+	_, err = exec(t, base, "create --name Tablet --brand Acme --state in-use")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		line         string
+		wantErr      string
+		wantResponse []string
+	}{
+		{
+			name:         "Get as table",
+			line:         "get 1",
+			wantResponse: []string{"ID", "NAME", "Phone", "Acme", "available"},
+		},
+		{
+			name:         "Get as YAML with flags after the id",
+			line:         "get 1 -o yaml",
+			wantResponse: []string{"name: Phone", "state: available"},
+		},
+		{
+			name:         "List with a filter",
+			line:         "list --state in-use --page-size 1",
+			wantResponse: []string{"Tablet"},
+		},
+		{
+			name:         "Patch only the given flags",
+			line:         "patch 1 --brand Globex -o json",
+			wantResponse: []string{`"name": "Phone"`, `"brand": "Globex"`},
+		},
+		{
+			name:    "Patch at a stale version",
+			line:    "patch 1 --name Phone2 --version 1",
+			wantErr: "version does not match",
+		},
+		{
+			name:         "Update",
+			line:         "update 1 --name Phone --brand Initech --state inactive",
+			wantResponse: []string{"Initech", "inactive"},
+		},
+		{
+			name:    "Validation problem",
+			line:    "create --name P --brand Acme --state available",
+			wantErr: "Validation failed",
+		},
+		{
+			name:    "Delete a device in use",
+			line:    "delete 2",
+			wantErr: "in use",
+		},
+		{
+			name:         "Export as NDJSON",
+			line:         "export --format ndjson",
+			wantResponse: []string{`"name":"Phone"`, `"name":"Tablet"`},
+		},
+		{
+			name:         "Delete",
+			line:         "delete 1",
+			wantResponse: []string{"Device 1 deleted"},
+		},
+		{
+			name:    "Unknown profile",
+			line:    "list --profile prod",
+			wantErr: `profile "prod" not found`,
+		},
+		{
+			name:    "Unknown output",
+			line:    "list -o xml",
+			wantErr: "output must be one of",
+		},
+		{
+			name:    "Invalid id",
+			line:    "get abc",
+			wantErr: `invalid device id "abc"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exec(t, base, tt.line)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			for _, want := range tt.wantResponse {
+				assert.Contains(t, out, want)
+			}
+		})
+	}
+}
+
+func TestImportCommand(t *testing.T) {
+	base := newTestCLI(t)
+	path := filepath.Join(t.TempDir(), "devices.csv")
+	require.NoError(t, os.WriteFile(path, []byte("name,brand,state\nPhone,Acme,available\nX,Acme,broken\n"), 0o600))
+
+	out, err := exec(t, base, "import --dry-run "+path)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Would import 1 devices, rejected 1 rows")
+	assert.Contains(t, out, "name")
+	assert.Contains(t, out, "state")
+
+	out, err = exec(t, base, "import "+path+" -o json")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"imported": 1`)
+
+	out, err = exec(t, base, "list")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Phone")
+}
+
+func TestWatch(t *testing.T) {
+	base := newTestCLI(t)
+	_, err := exec(t, base, "create --name Phone --brand Acme --state available")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	c := &cli{stdout: &stdout, stderr: &bytes.Buffer{}, getenv: base.getenv}
+	require.NoError(t, c.run(ctx, strings.Fields("get 1 --watch --interval 10ms -o json")))
+
+	// The device did not change, so it is printed once.
+	assert.Equal(t, 1, strings.Count(stdout.String(), `"name": "Phone"`))
+}
+
+func TestLoadProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := "current_profile: staging\nprofiles:\n  staging:\n    server: https://staging.example.com\n    token: secret\n  prod:\n    server: https://prod.example.com\n"
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+	noEnv := func(string) string { return "" }
+
+	p, err := loadProfile(path, "", noEnv)
+	require.NoError(t, err)
+	assert.Equal(t, profile{Server: "https://staging.example.com", Token: "secret"}, p)
+
+	p, err = loadProfile(path, "", func(key string) string {
+		return map[string]string{"DEVICESCTL_PROFILE": "prod", "DEVICESCTL_TOKEN": "from-env"}[key]
+	})
+	require.NoError(t, err)
+	assert.Equal(t, profile{Server: "https://prod.example.com", Token: "from-env"}, p)
+
+	p, err = loadProfile(filepath.Join(t.TempDir(), "missing.yaml"), "", noEnv)
+	require.NoError(t, err)
+	assert.Equal(t, defaultServer, p.Server)
+
+	_, err = loadProfile(path, "dev", noEnv)
+	assert.Error(t, err)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/jsonutils"
+	"github.com/danielllmuniz/devices-api/pkg/client"
+)
+
+var outputFormats = []string{"table", "json", "yaml"}
+
+// deleteResult is what delete prints for each device.
+type deleteResult struct {
+	DeviceID int32 `json:"device_id"`
+	Deleted  bool  `json:"deleted"`
+}
+
+// render writes v in the output format. JSON and YAML carry the fields of the
+// API responses; tables are for people.
+func render(w io.Writer, output string, v any) error {
+	switch output {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		data, err := jsonutils.YAML.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	switch v := v.(type) {
+	case client.Device:
+		writeDeviceTable(tw, []client.Device{v})
+	case []client.Device:
+		writeDeviceTable(tw, v)
+	case []deleteResult:
+		for _, result := range v {
+			fmt.Fprintf(tw, "Device %d deleted\n", result.DeviceID)
+		}
+	case client.ImportReport:
+		verb, count := "Imported", v.Imported
+		if v.DryRun {
+			verb, count = "Would import", v.Valid
+		}
+		fmt.Fprintf(tw, "%s %d devices, rejected %d rows\n", verb, count, v.Rejected)
+		if len(v.Problems) > 0 {
+			fmt.Fprintln(tw, "ROW\tFIELD\tERROR")
+			for _, problem := range v.Problems {
+				for _, field := range slices.Sorted(maps.Keys(problem.Errors)) {
+					fmt.Fprintf(tw, "%d\t%s\t%s\n", problem.Row, field, problem.Errors[field])
+				}
+			}
+		}
+	default:
+		return render(w, "json", v)
+	}
+	return tw.Flush()
+}
+
+func writeDeviceTable(w io.Writer, devices []client.Device) {
+	fmt.Fprintln(w, "ID\tNAME\tBRAND\tSTATE\tVERSION\tCREATED")
+	for _, device := range devices {
+		state := string(device.State)
+		if device.DeletedAt != nil {
+			state += " (deleted)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\n", device.ID, tableCell(device.Name), tableCell(device.Brand), state, device.Version, device.CreatedAt.Local().Format(time.DateTime))
+	}
+}
+
+// tableCell keeps a value on one line and in its column.
+func tableCell(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+// printError explains a failed command, listing the fields a validation
+// problem names.
+func printError(w io.Writer, err error) {
+	fmt.Fprintln(w, "devicesctl:", err)
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		return
+	}
+	for _, field := range slices.Sorted(maps.Keys(apiErr.Errors)) {
+		fmt.Fprintf(w, "  %s: %s\n", field, apiErr.Errors[field])
+	}
+	if len(apiErr.Allowed) > 0 {
+		allowed := make([]string, len(apiErr.Allowed))
+		for i, state := range apiErr.Allowed {
+			allowed[i] = string(state)
+		}
+		fmt.Fprintf(w, "  allowed states: %s\n", strings.Join(allowed, ", "))
+	}
+}
@@ -1,49 +1,122 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
+	"strconv"
 	"strings"
 
+	"github.com/danielllmuniz/devices-api/internal/store/pgstore"
+	"github.com/danielllmuniz/devices-api/internal/store/pgstore/migrations"
+	"github.com/jackc/pgx/v5"
 	"github.com/joho/godotenv"
 )
 
+const usage = `Usage: terndotenv [command]
+
+Commands:
+  up         apply every pending migration (default)
+  down N     revert the last N migrations
+  goto V     migrate up or down to version V
+  status     list the migrations and which are applied
+  redo       revert the last migration and apply it again`
+
 func main() {
-	if err := godotenv.Load(); err != nil {
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
 		panic(err)
 	}
 
-	args := []string{
-		"migrate",
+	if err := run(context.Background(), os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Migration failed:", err)
+		os.Exit(1)
 	}
+}
 
-	// Check for a custom steps argument like steps=1
-	for _, arg := range os.Args[1:] {
-		if strings.HasPrefix(arg, "steps=") {
-			// You can customize this destination flag as needed
-			args = []string{
-				"migrate",
-				"--destination", "-1",
-			}
-			break
-		}
+func run(ctx context.Context, args []string) error {
+	command, arg, err := parseArgs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, usage)
+		return err
 	}
 
-	// Add common flags
-	args = append(args,
-		"--migrations", "./internal/store/pgstore/migrations",
-		"--config", "./internal/store/pgstore/migrations/tern.conf",
-	)
+	conn, err := pgx.Connect(ctx, pgstore.ConnStringFromEnv())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
 
-	cmd := exec.Command("tern", args...)
+	runner, err := migrations.NewRunner(ctx, conn)
+	if err != nil {
+		return err
+	}
 
-	output, err := cmd.CombinedOutput()
+	switch command {
+	case "up":
+		err = runner.Up(ctx)
+	case "down":
+		err = runner.Down(ctx, arg)
+	case "goto":
+		err = runner.Goto(ctx, arg)
+	case "redo":
+		err = runner.Redo(ctx)
+	case "status":
+		var s migrations.Status
+		if s, err = runner.Status(ctx); err == nil {
+			printStatus(s)
+		}
+		return err
+	}
 	if err != nil {
-		fmt.Println("Command execution failed: ", err)
-		fmt.Println("Output: ", string(output))
-		panic(err)
+		return err
+	}
+
+	s, err := runner.Status(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database at version %d of %d\n", s.Current, s.Latest)
+	return nil
+}
+
+// parseArgs reads the command and its number. The steps=N argument of the
+// tern wrapper this replaced still means down N.
+func parseArgs(args []string) (command string, arg int32, err error) {
+	if len(args) == 0 {
+		return "up", 0, nil
+	}
+
+	command = args[0]
+	if steps, ok := strings.CutPrefix(command, "steps="); ok {
+		command, args = "down", []string{"down", steps}
+	}
+
+	switch command {
+	case "up", "status", "redo":
+		if len(args) != 1 {
+			return "", 0, fmt.Errorf("%s takes no arguments", command)
+		}
+		return command, 0, nil
+	case "down", "goto":
+		if len(args) != 2 {
+			return "", 0, fmt.Errorf("%s takes one number", command)
+		}
+		n, err := strconv.ParseInt(args[1], 10, 32)
+		if err != nil {
+			return "", 0, fmt.Errorf("%s: %q is not a number", command, args[1])
+		}
+		return command, int32(n), nil
 	}
+	return "", 0, fmt.Errorf("unknown command %q", command)
+}
 
-	fmt.Println("Command executed successfully:", string(output))
+func printStatus(s migrations.Status) {
+	fmt.Printf("Database at version %d of %d\n\n", s.Current, s.Latest)
+	for _, migration := range s.Migrations {
+		mark := " "
+		if migration.Applied {
+			mark = "x"
+		}
+		fmt.Printf("[%s] %s\n", mark, migration.Name)
+	}
 }
@@ -0,0 +1,13 @@
+#!/bin/sh
+# Creates the role the API logs in as when the database volume is first
+# initialized. Migration 013 grants devices_app what the API needs; the login
+# role only inherits it, so row level security applies to the API.
+set -e
+
+psql -v ON_ERROR_STOP=1 \
+	-v app_user="$DATABASE_APP_USER" \
+	-v app_password="$DATABASE_APP_PASSWORD" \
+	--username "$POSTGRES_USER" --dbname "$POSTGRES_DB" <<'EOSQL'
+CREATE ROLE devices_app NOLOGIN NOBYPASSRLS;
+CREATE ROLE :"app_user" LOGIN NOSUPERUSER NOBYPASSRLS PASSWORD :'app_password' IN ROLE devices_app;
+EOSQL
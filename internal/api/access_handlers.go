@@ -0,0 +1,148 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/danielllmuniz/devices-api/internal/jsonutils"
+	"github.com/danielllmuniz/devices-api/internal/store"
+	accessValidator "github.com/danielllmuniz/devices-api/internal/validator/access"
+	"github.com/go-chi/chi/v5"
+)
+
+// pathID reads the integer id in the URL parameter name, writing the problem
+// and returning false when it is not one.
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int32, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 32)
+	if err != nil {
+		writeProblem(w, r, newProblem(http.StatusBadRequest, CodeInvalidID, "Invalid id", name+" must be an integer"))
+		return 0, false
+	}
+	return int32(id), true
+}
+
+func (api *Api) handleListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := api.AccessService.ListRoles(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if roles == nil {
+		roles = []store.Role{}
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"roles": roles,
+	})
+}
+
+func (api *Api) handleCreateRole(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := jsonutils.DecodeValid[accessValidator.CreateRoleReq](r, decodeOptions(w)...)
+	if err != nil {
+		writeDecodeError(w, r, problems, err)
+		return
+	}
+
+	role, err := api.AccessService.CreateRole(r.Context(), data.Name, data.Permissions)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	jsonutils.Encode(w, r, http.StatusCreated, map[string]any{
+		"message": "role created successfully",
+		"role":    role,
+	})
+}
+
+func (api *Api) handleUpdateRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "role_id")
+	if !ok {
+		return
+	}
+
+	data, problems, err := jsonutils.DecodeValid[accessValidator.UpdateRoleReq](r, decodeOptions(w)...)
+	if err != nil {
+		writeDecodeError(w, r, problems, err)
+		return
+	}
+
+	role, err := api.AccessService.UpdateRole(r.Context(), id, data.Permissions)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"message": "role updated successfully",
+		"role":    role,
+	})
+}
+
+func (api *Api) handleDeleteRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "role_id")
+	if !ok {
+		return
+	}
+
+	if err := api.AccessService.DeleteRole(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"message": "role deleted successfully",
+		"role_id": id,
+	})
+}
+
+func (api *Api) handleListGrants(w http.ResponseWriter, r *http.Request) {
+	grants, err := api.AccessService.ListGrants(r.Context(), r.URL.Query().Get("subject"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if grants == nil {
+		grants = []store.Grant{}
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"grants": grants,
+	})
+}
+
+func (api *Api) handleCreateGrant(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := jsonutils.DecodeValid[accessValidator.CreateGrantReq](r, decodeOptions(w)...)
+	if err != nil {
+		writeDecodeError(w, r, problems, err)
+		return
+	}
+
+	grant, err := api.AccessService.CreateGrant(r.Context(), data.Subject, data.RoleID, data.Brand)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	jsonutils.Encode(w, r, http.StatusCreated, map[string]any{
+		"message": "grant created successfully",
+		"grant":   grant,
+	})
+}
+
+func (api *Api) handleDeleteGrant(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "grant_id")
+	if !ok {
+		return
+	}
+
+	if err := api.AccessService.DeleteGrant(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"message":  "grant deleted successfully",
+		"grant_id": id,
+	})
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"github.com/danielllmuniz/devices-api/internal/auth"
 	"github.com/danielllmuniz/devices-api/internal/services"
 	"github.com/go-chi/chi/v5"
 )
@@ -8,4 +9,13 @@ import (
 type Api struct {
 	Router        *chi.Mux
 	DeviceService *services.DeviceService
+	// IdempotencyService backs Idempotency-Key support; without it the header
+	// is ignored.
+	IdempotencyService *services.IdempotencyService
+	// AccessService backs the role and grant endpoints under /api/v1/admin,
+	// which are only bound when it is set.
+	AccessService *services.AccessService
+	// Authenticator checks the credentials of every /api/v1 request; without
+	// it authentication is off and scopes are not enforced.
+	Authenticator auth.Authenticator
 }
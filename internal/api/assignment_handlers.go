@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/danielllmuniz/devices-api/internal/jsonutils"
+	"github.com/danielllmuniz/devices-api/internal/services"
+	"github.com/danielllmuniz/devices-api/internal/store"
+	deviceValidator "github.com/danielllmuniz/devices-api/internal/validator/device"
+	"github.com/go-chi/chi/v5"
+)
+
+func (api *Api) handleCheckoutDevice(w http.ResponseWriter, r *http.Request) {
+	strDeviceID := chi.URLParam(r, "device_id")
+
+	intDeviceID, err := strconv.Atoi(strDeviceID)
+	if err != nil {
+		writeInvalidDeviceID(w, r)
+		return
+	}
+
+	data, problems, err := jsonutils.DecodeValid[deviceValidator.CheckoutDeviceReq](r, decodeOptions(w)...)
+	if err != nil {
+		writeDecodeError(w, r, problems, err)
+		return
+	}
+
+	device, assignment, err := api.DeviceService.CheckoutDevice(r.Context(), int32(intDeviceID), services.Checkout{
+		Assignee: data.Assignee,
+		DueAt:    data.DueAt,
+		Note:     data.Note,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, device)
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"message": "device checked out successfully",
+		"device": map[string]any{
+			"id":         device.ID,
+			"name":       device.Name,
+			"brand":      device.Brand,
+			"state":      device.State,
+			"created_at": device.CreatedAt,
+			"version":    device.Version,
+		},
+		"assignment": assignment,
+	})
+}
+
+func (api *Api) handleCheckinDevice(w http.ResponseWriter, r *http.Request) {
+	strDeviceID := chi.URLParam(r, "device_id")
+
+	intDeviceID, err := strconv.Atoi(strDeviceID)
+	if err != nil {
+		writeInvalidDeviceID(w, r)
+		return
+	}
+
+	device, assignment, err := api.DeviceService.CheckinDevice(r.Context(), int32(intDeviceID))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, device)
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"message": "device checked in successfully",
+		"device": map[string]any{
+			"id":         device.ID,
+			"name":       device.Name,
+			"brand":      device.Brand,
+			"state":      device.State,
+			"created_at": device.CreatedAt,
+			"version":    device.Version,
+		},
+		"assignment": assignment,
+	})
+}
+
+func (api *Api) handleListAssignments(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseAssignmentsQuery(w, r)
+	if !ok {
+		return
+	}
+	api.writeAssignments(w, r, filter)
+}
+
+// handleGetAssigneeDevices lists the devices an assignee holds right now,
+// with the assignment of each.
+func (api *Api) handleGetAssigneeDevices(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseAssignmentsQuery(w, r)
+	if !ok {
+		return
+	}
+	filter.Assignee = chi.URLParam(r, "assignee_id")
+	filter.Open = true
+	api.writeAssignments(w, r, filter)
+}
+
+func parseAssignmentsQuery(w http.ResponseWriter, r *http.Request) (store.AssignmentFilter, bool) {
+	filter, problems := deviceValidator.ParseListAssignmentsQuery(r.URL.Query())
+	if len(problems) > 0 {
+		problem := newProblem(http.StatusBadRequest, CodeInvalidQuery, "Invalid query", "one or more query parameters are invalid")
+		problem.Errors = problems
+		writeProblem(w, r, problem)
+		return store.AssignmentFilter{}, false
+	}
+	return filter, true
+}
+
+func (api *Api) writeAssignments(w http.ResponseWriter, r *http.Request, filter store.AssignmentFilter) {
+	assignments, err := api.DeviceService.ListAssignments(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if assignments.Assignments == nil {
+		assignments.Assignments = []store.Assignment{}
+	}
+
+	var nextCursor *string
+	if assignments.NextCursor != nil {
+		encoded := assignments.NextCursor.Encode()
+		nextCursor = &encoded
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"assignments": assignments.Assignments,
+		"next_cursor": nextCursor,
+	})
+}
@@ -1,11 +1,13 @@
 package api
 
 import (
-	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
 
+	"github.com/danielllmuniz/devices-api/internal/auth"
 	"github.com/danielllmuniz/devices-api/internal/jsonutils"
 	"github.com/danielllmuniz/devices-api/internal/services"
 	"github.com/danielllmuniz/devices-api/internal/store"
@@ -13,19 +15,24 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+// maxBodyBytes caps the size of JSON request bodies; batches of
+// MaxBatchOperations devices fit well within it.
+const maxBodyBytes = 1 << 20
+
+// decodeOptions makes request decoding strict, so that a misspelled field is
+// reported instead of silently ignored, and caps the body read for w.
+func decodeOptions(w http.ResponseWriter) []jsonutils.DecodeOption {
+	return []jsonutils.DecodeOption{
+		jsonutils.DisallowUnknownFields(),
+		jsonutils.DisallowTrailingData(),
+		jsonutils.MaxBytes(w, maxBodyBytes),
+	}
+}
+
 func (api *Api) handleCreateDevice(w http.ResponseWriter, r *http.Request) {
-	data, problems, err := jsonutils.DecodeValidJson[deviceValidator.CreateDeviceReq](r)
+	data, problems, err := jsonutils.DecodeValid[deviceValidator.CreateDeviceReq](r, decodeOptions(w)...)
 	if err != nil {
-		fmt.Println(err.Error())
-		fmt.Println(problems)
-		if problems == nil {
-			jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
-				"error": "invalid request",
-			})
-			return
-		}
-
-		jsonutils.EncodeJson(w, r, http.StatusUnprocessableEntity, problems)
+		writeDecodeError(w, r, problems, err)
 		return
 	}
 
@@ -36,14 +43,12 @@ func (api *Api) handleCreateDevice(w http.ResponseWriter, r *http.Request) {
 		data.State,
 	)
 	if err != nil {
-		fmt.Println(err.Error())
-		jsonutils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
-			"error": "failed to create device, try again later",
-		})
+		writeError(w, r, err)
 		return
 	}
 
-	jsonutils.EncodeJson(w, r, http.StatusCreated, map[string]any{
+	setETag(w, device)
+	jsonutils.Encode(w, r, http.StatusCreated, map[string]any{
 		"message": "device created successfully",
 		"device": map[string]any{
 			"id":         device.ID,
@@ -51,6 +56,7 @@ func (api *Api) handleCreateDevice(w http.ResponseWriter, r *http.Request) {
 			"brand":      device.Brand,
 			"state":      device.State,
 			"created_at": device.CreatedAt,
+			"version":    device.Version,
 		},
 	})
 }
@@ -60,108 +66,229 @@ func (api *Api) handleGetDevice(w http.ResponseWriter, r *http.Request) {
 
 	intDeviceID, err := strconv.Atoi(strDeviceID)
 	if err != nil {
-		fmt.Println(err.Error())
-		jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
-			"error": "invalid device id",
-		})
+		writeInvalidDeviceID(w, r)
 		return
 	}
 
 	device, err := api.DeviceService.GetDeviceByID(r.Context(), int32(intDeviceID))
 	if err != nil {
-		fmt.Println(err.Error())
-		jsonutils.EncodeJson(w, r, http.StatusNotFound, map[string]any{
-			"error": "device not found",
-		})
+		writeError(w, r, err)
 		return
 	}
 
-	jsonutils.EncodeJson(w, r, http.StatusOK, map[string]any{
+	setETag(w, device)
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
 		"device": map[string]any{
 			"id":         device.ID,
 			"name":       device.Name,
 			"brand":      device.Brand,
 			"state":      device.State,
 			"created_at": device.CreatedAt,
+			"version":    device.Version,
 		},
 	})
 }
 
-func (api *Api) handleGetAllDevices(w http.ResponseWriter, r *http.Request) {
-	queryParams := r.URL.Query()
-	brand := queryParams.Get("brand")
-	state := queryParams.Get("state")
+func (api *Api) handleGetDeviceTransitions(w http.ResponseWriter, r *http.Request) {
+	strDeviceID := chi.URLParam(r, "device_id")
+
+	intDeviceID, err := strconv.Atoi(strDeviceID)
+	if err != nil {
+		writeInvalidDeviceID(w, r)
+		return
+	}
 
-	devices, err := api.DeviceService.GetAllDevices(r.Context(), brand, store.DeviceState(state))
+	device, transitions, err := api.DeviceService.GetDeviceTransitions(r.Context(), int32(intDeviceID))
 	if err != nil {
-		fmt.Println(err.Error())
-		jsonutils.EncodeJson(w, r, http.StatusNotFound, map[string]any{
-			"error": "no devices found",
-		})
+		writeError(w, r, err)
 		return
 	}
 
-	jsonutils.EncodeJson(w, r, http.StatusOK, map[string]any{
-		"devices": devices,
+	if transitions == nil {
+		transitions = []store.DeviceState{}
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"device_id":   device.ID,
+		"state":       device.State,
+		"transitions": transitions,
 	})
 }
 
-func (api *Api) handleUpdateDevice(w http.ResponseWriter, r *http.Request) {
+func (api *Api) handleGetDeviceHistory(w http.ResponseWriter, r *http.Request) {
 	strDeviceID := chi.URLParam(r, "device_id")
 
 	intDeviceID, err := strconv.Atoi(strDeviceID)
 	if err != nil {
-		fmt.Println(err.Error())
-		jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
-			"error": "invalid device id",
-		})
+		writeInvalidDeviceID(w, r)
+		return
+	}
+
+	filter, problems := deviceValidator.ParseListDeviceEventsQuery(int32(intDeviceID), r.URL.Query())
+	if len(problems) > 0 {
+		problem := newProblem(http.StatusBadRequest, CodeInvalidQuery, "Invalid query", "one or more query parameters are invalid")
+		problem.Errors = problems
+		writeProblem(w, r, problem)
+		return
+	}
+
+	events, err := api.DeviceService.ListDeviceEvents(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var nextCursor *string
+	if events.NextCursor != nil {
+		encoded := events.NextCursor.Encode()
+		nextCursor = &encoded
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"events":      events.Events,
+		"next_cursor": nextCursor,
+	})
+}
+
+func (api *Api) handleGetAllDevices(w http.ResponseWriter, r *http.Request) {
+	filter, problems := deviceValidator.ParseListDevicesQuery(r.URL.Query())
+	if len(problems) > 0 {
+		problem := newProblem(http.StatusBadRequest, CodeInvalidQuery, "Invalid query", "one or more query parameters are invalid")
+		problem.Errors = problems
+		writeProblem(w, r, problem)
+		return
+	}
+	if filter.IncludeDeleted && !api.authorize(w, r, auth.ScopeAdmin) {
 		return
 	}
 
-	data, problems, err := jsonutils.DecodeValidJson[deviceValidator.UpdateDeviceReq](r)
+	devices, err := api.DeviceService.ListDevices(r.Context(), filter)
 	if err != nil {
-		fmt.Println(err.Error())
-		fmt.Println(problems)
-		if problems == nil {
-			jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
-				"error": "invalid request",
-			})
+		writeError(w, r, err)
+		return
+	}
+
+	var nextCursor *string
+	if devices.NextCursor != nil {
+		encoded := devices.NextCursor.Encode()
+		nextCursor = &encoded
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"devices":     devices.Devices,
+		"next_cursor": nextCursor,
+	})
+}
+
+// handleExportDevices streams the devices matching the list filters in the
+// requested format. Once the first row is out the status can no longer
+// change, so a failure past that point aborts the response instead.
+func (api *Api) handleExportDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	formatName := query.Get("format")
+	if formatName == "" {
+		formatName = "csv"
+	}
+	format, ok := exportFormats[formatName]
+
+	filter, problems := deviceValidator.ParseListDevicesQuery(query)
+	if !ok {
+		problems.AddFieldError("format", "format must be 'csv', 'ndjson' or 'xlsx'")
+	}
+	if len(problems) > 0 {
+		problem := newProblem(http.StatusBadRequest, CodeInvalidQuery, "Invalid query", "one or more query parameters are invalid")
+		problem.Errors = problems
+		writeProblem(w, r, problem)
+		return
+	}
+	if filter.IncludeDeleted && !api.authorize(w, r, auth.ScopeAdmin) {
+		return
+	}
+
+	var exporter deviceExporter
+	defer func() {
+		if exporter != nil {
+			exporter.Close()
+		}
+	}()
+
+	started := false
+	start := func() error {
+		w.Header().Set("Content-Type", format.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="devices.%s"`, formatName))
+		w.WriteHeader(http.StatusOK)
+		started = true
+
+		var err error
+		exporter, err = format.newExporter(w)
+		return err
+	}
+
+	rows := 0
+	err := api.DeviceService.ExportDevices(r.Context(), filter, func(device store.Device) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := exporter.Write(device); err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushEvery == 0 {
+			http.NewResponseController(w).Flush()
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = exporter.Finish()
+	}
+	if err != nil {
+		if !started {
+			writeError(w, r, err)
 			return
 		}
+		logError(r, "export devices", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (api *Api) handleUpdateDevice(w http.ResponseWriter, r *http.Request) {
+	strDeviceID := chi.URLParam(r, "device_id")
 
-		jsonutils.EncodeJson(w, r, http.StatusUnprocessableEntity, problems)
+	intDeviceID, err := strconv.Atoi(strDeviceID)
+	if err != nil {
+		writeInvalidDeviceID(w, r)
 		return
 	}
 
+	data, problems, err := jsonutils.DecodeValid[deviceValidator.UpdateDeviceReq](r, decodeOptions(w)...)
+	if err != nil {
+		writeDecodeError(w, r, problems, err)
+		return
+	}
+
+	versions := ifMatchVersions(r)
 	device, err := api.DeviceService.UpdateDevice(
 		r.Context(),
 		int32(intDeviceID),
+		versions,
 		data.Name,
 		data.Brand,
 		store.DeviceState(data.State),
 	)
 	if err != nil {
-		fmt.Println(err.Error())
-		if errors.Is(err, services.ErrDeviceInUse) {
-			jsonutils.EncodeJson(w, r, http.StatusUnprocessableEntity, map[string]any{
-				"error": "device is in use, cannot update name or brand",
-			})
-			return
-		}
-
-		if errors.Is(err, services.ErrDeviceNotFound) {
-			jsonutils.EncodeJson(w, r, http.StatusNotFound, map[string]any{
-				"error": "device not found",
-			})
-			return
-		}
-		jsonutils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
-			"error": "failed to update device, try again later",
-		})
+		writeConditionalError(w, r, err, versions)
 		return
 	}
 
-	jsonutils.EncodeJson(w, r, http.StatusOK, map[string]any{
+	setETag(w, device)
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
 		"message": "device updated successfully",
 		"device": map[string]any{
 			"id":         device.ID,
@@ -169,65 +296,47 @@ func (api *Api) handleUpdateDevice(w http.ResponseWriter, r *http.Request) {
 			"brand":      device.Brand,
 			"state":      device.State,
 			"created_at": device.CreatedAt,
+			"version":    device.Version,
 		},
 	})
 }
 
+// jsonPatchMediaType selects RFC 6902 patches; any other JSON body, such as
+// application/merge-patch+json, is a merge patch.
+const jsonPatchMediaType = "application/json-patch+json"
+
 func (api *Api) handlePatchDevice(w http.ResponseWriter, r *http.Request) {
 	strDeviceID := chi.URLParam(r, "device_id")
 
 	intDeviceID, err := strconv.Atoi(strDeviceID)
 	if err != nil {
-		fmt.Println(err.Error())
-		jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
-			"error": "invalid device id",
-		})
+		writeInvalidDeviceID(w, r)
 		return
 	}
 
-	data, problems, err := jsonutils.DecodeValidJson[deviceValidator.PatchDeviceReq](r)
-	if err != nil {
-		fmt.Println(err.Error())
-		fmt.Println(problems)
-		if problems == nil {
-			jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
-				"error": "invalid request",
-			})
+	var device store.Device
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == jsonPatchMediaType {
+		var ok bool
+		if device, ok = api.applyJSONPatch(w, r, int32(intDeviceID)); !ok {
 			return
 		}
-		jsonutils.EncodeJson(w, r, http.StatusUnprocessableEntity, problems)
-		return
-	}
-
-	device, err := api.DeviceService.PatchDevice(
-		r.Context(),
-		int32(intDeviceID),
-		data.Name,
-		data.Brand,
-		store.DeviceState(data.State),
-	)
-	if err != nil {
-		fmt.Println(err.Error())
-		if errors.Is(err, services.ErrDeviceInUse) {
-			jsonutils.EncodeJson(w, r, http.StatusUnprocessableEntity, map[string]any{
-				"error": "device is in use, cannot update name or brand",
-			})
+	} else {
+		data, problems, err := jsonutils.DecodeValid[deviceValidator.PatchDeviceReq](r, decodeOptions(w)...)
+		if err != nil {
+			writeDecodeError(w, r, problems, err)
 			return
 		}
 
-		if errors.Is(err, services.ErrDeviceNotFound) {
-			jsonutils.EncodeJson(w, r, http.StatusNotFound, map[string]any{
-				"error": "device not found",
-			})
+		versions := ifMatchVersions(r)
+		device, err = api.DeviceService.PatchDevice(r.Context(), int32(intDeviceID), versions, data.Patch())
+		if err != nil {
+			writeConditionalError(w, r, err, versions)
 			return
 		}
-		jsonutils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
-			"error": "failed to update device, try again later",
-		})
-		return
 	}
 
-	jsonutils.EncodeJson(w, r, http.StatusOK, map[string]any{
+	setETag(w, device)
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
 		"message": "device patched successfully",
 		"device": map[string]any{
 			"id":         device.ID,
@@ -235,46 +344,233 @@ func (api *Api) handlePatchDevice(w http.ResponseWriter, r *http.Request) {
 			"brand":      device.Brand,
 			"state":      device.State,
 			"created_at": device.CreatedAt,
+			"version":    device.Version,
 		},
 	})
 }
 
+// applyJSONPatch applies an RFC 6902 patch to the device as locked for the
+// write, so test operations see the state being changed. It writes the
+// problem and returns false on failure.
+func (api *Api) applyJSONPatch(w http.ResponseWriter, r *http.Request, id int32) (store.Device, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		writeBodyError(w, r, err)
+		return store.Device{}, false
+	}
+
+	patch, err := deviceValidator.ParseJSONPatch(body)
+	if err != nil {
+		writeProblem(w, r, newProblem(http.StatusBadRequest, CodeInvalidRequest, "Invalid request", err.Error()))
+		return store.Device{}, false
+	}
+
+	var problems map[string]string
+	versions := ifMatchVersions(r)
+	device, err := api.DeviceService.PatchDeviceFunc(r.Context(), id, versions, func(device store.Device) (store.DevicePatch, error) {
+		devicePatch, eval, err := deviceValidator.ApplyJSONPatch(r.Context(), patch, device)
+		if len(eval) > 0 {
+			problems = eval
+			return store.DevicePatch{}, errInvalidPatch
+		}
+		return devicePatch, err
+	})
+	if problems != nil {
+		writeDecodeError(w, r, problems, err)
+		return store.Device{}, false
+	}
+	if err != nil {
+		writeConditionalError(w, r, err, versions)
+		return store.Device{}, false
+	}
+	return device, true
+}
+
 func (api *Api) handleDeleteDevice(w http.ResponseWriter, r *http.Request) {
 	strDeviceID := chi.URLParam(r, "device_id")
 
 	intDeviceID, err := strconv.Atoi(strDeviceID)
 	if err != nil {
-		fmt.Println(err.Error())
-		jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
-			"error": "invalid device id",
-		})
+		writeInvalidDeviceID(w, r)
 		return
 	}
 
 	id, err := api.DeviceService.DeleteDevice(r.Context(), int32(intDeviceID))
 	if err != nil {
-		fmt.Println(err.Error())
-		if errors.Is(err, services.ErrDeviceInUse) {
-			jsonutils.EncodeJson(w, r, http.StatusUnprocessableEntity, map[string]any{
-				"error": "device is in use, cannot update name or brand",
-			})
+		writeError(w, r, err)
+		return
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"message":   "device deleted successfully",
+		"device_id": id,
+	})
+}
+
+func (api *Api) handleRestoreDevice(w http.ResponseWriter, r *http.Request) {
+	strDeviceID := chi.URLParam(r, "device_id")
+
+	intDeviceID, err := strconv.Atoi(strDeviceID)
+	if err != nil {
+		writeInvalidDeviceID(w, r)
+		return
+	}
+
+	device, err := api.DeviceService.RestoreDevice(r.Context(), int32(intDeviceID))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, device)
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"message": "device restored successfully",
+		"device": map[string]any{
+			"id":         device.ID,
+			"name":       device.Name,
+			"brand":      device.Brand,
+			"state":      device.State,
+			"created_at": device.CreatedAt,
+			"version":    device.Version,
+		},
+	})
+}
+
+// handleBatchDevices runs several operations in one request and answers 207
+// with the status of each one, in the order they were sent.
+func (api *Api) handleBatchDevices(w http.ResponseWriter, r *http.Request) {
+	var atomic bool
+	if strAtomic := r.URL.Query().Get("atomic"); strAtomic != "" {
+		var err error
+		if atomic, err = strconv.ParseBool(strAtomic); err != nil {
+			problem := newProblem(http.StatusBadRequest, CodeInvalidQuery, "Invalid query", "one or more query parameters are invalid")
+			problem.Errors = map[string]string{"atomic": "atomic must be true or false"}
+			writeProblem(w, r, problem)
 			return
 		}
+	}
+
+	data, problems, err := jsonutils.DecodeValid[deviceValidator.BatchDevicesReq](r, decodeOptions(w)...)
+	if err != nil {
+		writeDecodeError(w, r, problems, err)
+		return
+	}
+
+	results := make([]map[string]any, len(data.Operations))
+	var (
+		ops     []services.BatchOperation
+		indexes []int
+	)
+	for i, item := range data.Operations {
+		op, problems := item.Operation(r.Context())
+		if len(problems) > 0 {
+			problem := newProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "Validation failed", "one or more fields are invalid")
+			problem.Errors = problems
+			results[i] = map[string]any{"status": problem.Status, "problem": problem}
+			continue
+		}
+		ops = append(ops, op)
+		indexes = append(indexes, i)
+	}
+
+	// The route requires devices:write; deleting needs devices:delete too.
+	for _, op := range ops {
+		if op.Op == services.BatchDelete {
+			if !api.authorize(w, r, auth.ScopeDevicesDelete) {
+				return
+			}
+			break
+		}
+	}
 
-		if errors.Is(err, services.ErrDeviceNotFound) {
-			jsonutils.EncodeJson(w, r, http.StatusNotFound, map[string]any{
-				"error": "device not found",
-			})
+	committed := false
+	if atomic && len(ops) < len(data.Operations) {
+		// An invalid item fails an atomic batch before anything runs.
+		for _, i := range indexes {
+			problem := problemFromError(r, services.ErrBatchRolledBack, false)
+			results[i] = map[string]any{"status": problem.Status, "problem": problem}
+		}
+	} else {
+		var batchResults []services.BatchResult
+		batchResults, committed = api.DeviceService.RunBatch(r.Context(), ops, atomic)
+		for j, result := range batchResults {
+			results[indexes[j]] = batchResultResponse(r, ops[j], result)
+		}
+	}
+
+	jsonutils.Encode(w, r, http.StatusMultiStatus, map[string]any{
+		"committed": committed,
+		"results":   results,
+	})
+}
+
+// batchResultResponse reports the result of op. An item with a version is
+// conditioned on it like a single write with If-Match, so a mismatch answers
+// 412 in both.
+func batchResultResponse(r *http.Request, op services.BatchOperation, result services.BatchResult) map[string]any {
+	switch {
+	case result.Err != nil:
+		problem := problemFromError(r, result.Err, op.Version != 0)
+		return map[string]any{"status": problem.Status, "problem": problem}
+	case op.Op == services.BatchDelete:
+		return map[string]any{"status": http.StatusOK, "device_id": result.DeletedID}
+	case op.Op == services.BatchCreate:
+		return map[string]any{"status": http.StatusCreated, "device": result.Device}
+	default:
+		return map[string]any{"status": http.StatusOK, "device": result.Device}
+	}
+}
+
+// maxImportBytes caps the size of an imported CSV file.
+const maxImportBytes = 10 << 20
+
+func (api *Api) handleImportDevices(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "text/csv" {
+		writeProblem(w, r, newProblem(http.StatusUnsupportedMediaType, CodeUnsupportedMedia, "Unsupported media type", "devices must be imported as text/csv"))
+		return
+	}
+
+	var dryRun bool
+	if strDryRun := r.URL.Query().Get("dry_run"); strDryRun != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(strDryRun); err != nil {
+			problem := newProblem(http.StatusBadRequest, CodeInvalidQuery, "Invalid query", "one or more query parameters are invalid")
+			problem.Errors = map[string]string{"dry_run": "dry_run must be true or false"}
+			writeProblem(w, r, problem)
 			return
 		}
-		jsonutils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
-			"error": "failed to update device, try again later",
-		})
+	}
+
+	rows, problems, err := deviceValidator.ParseDevicesCSV(r.Context(), http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		writeBodyError(w, r, err)
 		return
 	}
+	if problems == nil {
+		problems = []deviceValidator.RowProblem{}
+	}
 
-	jsonutils.EncodeJson(w, r, http.StatusOK, map[string]any{
-		"message":   "device deleted successfully",
-		"device_id": id,
+	imported := 0
+	if !dryRun && len(rows) > 0 {
+		devices := make([]store.Device, len(rows))
+		for i, row := range rows {
+			devices[i] = store.Device{Name: row.Name, Brand: row.Brand, State: row.State}
+		}
+
+		created, err := api.DeviceService.ImportDevices(r.Context(), devices)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		imported = len(created)
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"dry_run":  dryRun,
+		"valid":    len(rows),
+		"imported": imported,
+		"rejected": len(problems),
+		"problems": problems,
 	})
 }
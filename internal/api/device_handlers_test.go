@@ -1,16 +1,28 @@
 package api
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/danielllmuniz/devices-api/internal/auth"
 	"github.com/danielllmuniz/devices-api/internal/services"
+	"github.com/danielllmuniz/devices-api/internal/store"
 	"github.com/danielllmuniz/devices-api/internal/store/mockstore"
+	"github.com/danielllmuniz/devices-api/internal/validator"
+	deviceValidator "github.com/danielllmuniz/devices-api/internal/validator/device"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/xuri/excelize/v2"
 )
 
 func TestHandleCreateDevice(t *testing.T) {
@@ -47,43 +59,67 @@ func TestHandleCreateDevice(t *testing.T) {
 			name:         "Empty fields",
 			payload:      `{"name": "", "brand": "", "state": ""}`,
 			wantStatus:   http.StatusUnprocessableEntity,
-			wantResponse: `{"brand":"Brand is required","name":"Name is required","state":"State is required"}`,
+			wantResponse: `"errors":{"brand":"Brand is required","name":"Name is required","state":"State is required"}`,
 		},
 		{
 			name:         "Empty payload",
 			payload:      "",
 			wantStatus:   http.StatusBadRequest,
-			wantResponse: `{"error":"invalid request"}`,
+			wantResponse: `"code":"invalid_request"`,
 		},
 		{
 			name:         "Invalid JSON",
 			payload:      `{"name":`,
 			wantStatus:   http.StatusBadRequest,
-			wantResponse: `{"error":"invalid request"}`,
+			wantResponse: `"code":"invalid_request"`,
+		},
+		{
+			name:         "Unknown field",
+			payload:      `{"name": "Device A", "brand": "BrandX", "stat": "in-use"}`,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"errors":{"stat":"unknown field"},"offset":40`,
+		},
+		{
+			name:         "Trailing data",
+			payload:      `{"name": "Device A", "brand": "BrandX", "state": "in-use"} {}`,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"detail":"body must contain a single JSON value at byte 60"`,
+		},
+		{
+			name:         "Wrong type",
+			payload:      `{"name": 42, "brand": "BrandX", "state": "in-use"}`,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"errors":{"name":"value must be a string, not a number"}`,
+		},
+		{
+			name:         "Body too large",
+			payload:      `{"name": "` + strings.Repeat("a", maxBodyBytes) + `"}`,
+			wantStatus:   http.StatusRequestEntityTooLarge,
+			wantResponse: `"code":"request_too_large"`,
 		},
 		{
 			name:         "Missing name",
 			payload:      `{"brand":"BrandX","state":"in-use"}`,
 			wantStatus:   http.StatusUnprocessableEntity,
-			wantResponse: `{"name":"Name is required"}`,
+			wantResponse: `"errors":{"name":"Name is required"}`,
 		},
 		{
 			name:         "Missing brand",
 			payload:      `{"name":"Device A","state":"in-use"}`,
 			wantStatus:   http.StatusUnprocessableEntity,
-			wantResponse: `{"brand":"Brand is required"}`,
+			wantResponse: `"errors":{"brand":"Brand is required"}`,
 		},
 		{
 			name:         "Missing state",
 			payload:      `{"name":"Device A","brand":"BrandX"}`,
 			wantStatus:   http.StatusUnprocessableEntity,
-			wantResponse: `{"state":"State is required"}`,
+			wantResponse: `"errors":{"state":"State is required"}`,
 		},
 		{
 			name:         "Invalid state value",
 			payload:      `{"name":"Device A","brand":"BrandX","state":"unknown-state"}`,
 			wantStatus:   http.StatusUnprocessableEntity,
-			wantResponse: `{"state":"State must be 'available', 'in-use' or 'inactive'"}`,
+			wantResponse: `"errors":{"state":"State must be 'available', 'in-use' or 'inactive'"}`,
 		},
 	}
 
@@ -93,7 +129,7 @@ func TestHandleCreateDevice(t *testing.T) {
 			req.Header.Set("Content-Type", "application/json")
 
 			rec := httptest.NewRecorder()
-			handler := http.HandlerFunc(api.handleCreateDevice)
+			handler := api.resolveTenant(http.HandlerFunc(api.handleCreateDevice))
 			handler.ServeHTTP(rec, req)
 
 			if rec.Code != tt.wantStatus {
@@ -115,8 +151,8 @@ func TestHandleGetDevice(t *testing.T) {
 	}
 	ctx := context.Background()
 
-	mock.CreateDevice(ctx, "Device A", "BrandX", "in-use")
-	mock.CreateDevice(ctx, "Device A", "BrandX", "in-use")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "in-use")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "in-use")
 
 	tests := []struct {
 		name         string
@@ -134,19 +170,20 @@ func TestHandleGetDevice(t *testing.T) {
 			name:         "Invalid device ID",
 			deviceID:     "invalid",
 			wantStatus:   http.StatusBadRequest,
-			wantResponse: `{"error":"invalid device id"}`,
+			wantResponse: `"code":"invalid_device_id"`,
 		},
 		{
 			name:         "Device not found",
 			deviceID:     "3",
 			wantStatus:   http.StatusNotFound,
-			wantResponse: `{"error":"device not found"}`,
+			wantResponse: `"code":"device_not_found"`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			handler := chi.NewRouter()
+			handler.Use(api.resolveTenant)
 			handler.Get("/api/v1/devices/{device_id}", api.handleGetDevice)
 			req := httptest.NewRequest("GET", "/api/v1/devices/"+tt.deviceID, nil)
 			req.Header.Set("Content-Type", "application/json")
@@ -174,9 +211,9 @@ func TestHandleGetAllDevices(t *testing.T) {
 	}
 	ctx := context.Background()
 
-	mock.CreateDevice(ctx, "Device A", "BrandX", "in-use")
-	mock.CreateDevice(ctx, "Device B", "BrandY", "available")
-	mock.CreateDevice(ctx, "Device C", "BrandZ", "inactive")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "in-use")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device B", "BrandY", "available")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device C", "BrandZ", "inactive")
 
 	tests := []struct {
 		name         string
@@ -238,7 +275,7 @@ func TestHandleGetAllDevices(t *testing.T) {
 			req := httptest.NewRequest("GET", "/api/v1/devices?", nil)
 
 			rec := httptest.NewRecorder()
-			handler := http.HandlerFunc(api.handleGetAllDevices)
+			handler := api.resolveTenant(http.HandlerFunc(api.handleGetAllDevices))
 			handler.ServeHTTP(rec, req)
 
 			if rec.Code != tt.wantStatus {
@@ -252,6 +289,106 @@ func TestHandleGetAllDevices(t *testing.T) {
 	}
 }
 
+func TestHandleGetAllDevicesQuery(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	api := Api{
+		DeviceService: services.NewDeviceService(mock),
+	}
+	ctx := context.Background()
+
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "in-use")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device B", "BrandY", "available")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device C", "BrandZ", "inactive")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device D", "BrandZ", "inactive")
+	mock.DeleteDevice(ctx, store.DefaultTenant, 4)
+
+	tests := []struct {
+		name         string
+		query        string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "First page",
+			query:        "limit=2",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"next_cursor":"`,
+		},
+		{
+			name:         "Last page",
+			query:        "limit=3",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"next_cursor":null`,
+		},
+		{
+			name:         "Invalid limit",
+			query:        "limit=0",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"errors":{"limit":"limit must be between 1 and 500"}`,
+		},
+		{
+			name:         "Invalid cursor",
+			query:        "cursor=not-a-cursor",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"errors":{"cursor":"invalid cursor"}`,
+		},
+		{
+			name:         "Several states",
+			query:        "state=in-use,available&sort=-created_at,name",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"Device B"`,
+		},
+		{
+			name:         "Invalid state",
+			query:        "state=in-use,broken",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"errors":{"state":"State must be 'available', 'in-use' or 'inactive'"}`,
+		},
+		{
+			name:         "Invalid sort",
+			query:        "sort=-id",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"sort":`,
+		},
+		{
+			name:         "Invalid created range",
+			query:        "created_after=yesterday",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"errors":{"created_after":"created_after must be an RFC 3339 timestamp"}`,
+		},
+		{
+			name:         "Include deleted",
+			query:        "include_deleted=true",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"Device D"`,
+		},
+		{
+			name:         "Invalid include deleted",
+			query:        "include_deleted=maybe",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"errors":{"include_deleted":"include_deleted must be true or false"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/devices?"+tt.query, nil)
+
+			rec := httptest.NewRecorder()
+			handler := api.resolveTenant(http.HandlerFunc(api.handleGetAllDevices))
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+}
+
 func TestHandleUpdateDevice(t *testing.T) {
 	mock := mockstore.NewMockDeviceStore()
 	api := Api{
@@ -259,9 +396,9 @@ func TestHandleUpdateDevice(t *testing.T) {
 	}
 	ctx := context.Background()
 
-	mock.CreateDevice(ctx, "Device A", "BrandX", "available")
-	mock.CreateDevice(ctx, "Device B", "BrandY", "in-use")
-	mock.CreateDevice(ctx, "Device C", "BrandZ", "inactive")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "available")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device B", "BrandY", "in-use")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device C", "BrandZ", "inactive")
 
 	tests := []struct {
 		name         string
@@ -282,55 +419,56 @@ func TestHandleUpdateDevice(t *testing.T) {
 			deviceID:     "1",
 			payload:      "",
 			wantStatus:   http.StatusBadRequest,
-			wantResponse: `{"error":"invalid request"}`,
+			wantResponse: `"code":"invalid_request"`,
 		},
 		{
 			name:         "Invalid JSON",
 			deviceID:     "1",
 			payload:      `{"name":`,
 			wantStatus:   http.StatusBadRequest,
-			wantResponse: `{"error":"invalid request"}`,
+			wantResponse: `"code":"invalid_request"`,
 		},
 		{
 			name:         "Invalid state value",
 			deviceID:     "1",
 			payload:      `{"name": "Device A updated", "brand": "BrandX updated", "state": "unknown-state"}`,
 			wantStatus:   http.StatusUnprocessableEntity,
-			wantResponse: `{"state":"State must be 'available', 'in-use' or 'inactive'"}`,
+			wantResponse: `"errors":{"state":"State must be 'available', 'in-use' or 'inactive'"}`,
 		},
 		{
 			name:         "Empty fields",
 			deviceID:     "1",
 			payload:      `{"name": "", "brand": "", "state": ""}`,
 			wantStatus:   http.StatusUnprocessableEntity,
-			wantResponse: `{"brand":"Brand is required","name":"Name is required","state":"State is required"}`,
+			wantResponse: `"errors":{"brand":"Brand is required","name":"Name is required","state":"State is required"}`,
 		},
 		{
 			name:         "Invalid device ID",
 			deviceID:     "invalid",
 			payload:      `{"name": "Device A updated", "brand": "BrandX updated", "state": "in-use"}`,
 			wantStatus:   http.StatusBadRequest,
-			wantResponse: `{"error":"invalid device id"}`,
+			wantResponse: `"code":"invalid_device_id"`,
 		},
 		{
 			name:         "Device not found",
 			deviceID:     "5",
 			payload:      `{"name": "Device A updated", "brand": "BrandX updated", "state": "in-use"}`,
 			wantStatus:   http.StatusNotFound,
-			wantResponse: `{"error":"device not found"}`,
+			wantResponse: `"code":"device_not_found"`,
 		},
 		{
 			name:         "Device in use",
 			deviceID:     "2",
 			payload:      `{"name": "Device A updated", "brand": "BrandX updated", "state": "available"}`,
 			wantStatus:   http.StatusUnprocessableEntity,
-			wantResponse: `{"error":"device is in use, cannot update name or brand"}`,
+			wantResponse: `"code":"device_in_use"`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			handler := chi.NewRouter()
+			handler.Use(api.resolveTenant)
 			handler.Put("/api/v1/devices/{device_id}", api.handleUpdateDevice)
 			req := httptest.NewRequest("PUT", "/api/v1/devices/"+tt.deviceID, strings.NewReader(tt.payload))
 			req.Header.Set("Content-Type", "application/json")
@@ -350,6 +488,117 @@ func TestHandleUpdateDevice(t *testing.T) {
 	}
 }
 
+func TestHandleDeviceConditionalRequests(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	api := Api{
+		DeviceService: services.NewDeviceService(mock),
+	}
+	ctx := context.Background()
+
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "available")
+
+	handler := chi.NewRouter()
+	handler.Use(api.resolveTenant)
+	handler.Get("/api/v1/devices/{device_id}", api.handleGetDevice)
+	handler.Put("/api/v1/devices/{device_id}", api.handleUpdateDevice)
+	handler.Patch("/api/v1/devices/{device_id}", api.handlePatchDevice)
+
+	req := httptest.NewRequest("GET", "/api/v1/devices/1", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if etag := rec.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("Expected ETag '\"1\"', got '%s'", etag)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		ifMatch    string
+		payload    string
+		wantStatus int
+		wantETag   string
+	}{
+		{
+			name:       "Stale If-Match",
+			method:     "PUT",
+			ifMatch:    `"2"`,
+			payload:    `{"name": "Device A", "brand": "BrandX", "state": "inactive"}`,
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "Weak If-Match",
+			method:     "PATCH",
+			ifMatch:    `W/"1"`,
+			payload:    `{"state": "inactive"}`,
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "Matching If-Match",
+			method:     "PUT",
+			ifMatch:    `"1"`,
+			payload:    `{"name": "Device A", "brand": "BrandX", "state": "inactive"}`,
+			wantStatus: http.StatusOK,
+			wantETag:   `"2"`,
+		},
+		{
+			name:       "Wildcard If-Match",
+			method:     "PATCH",
+			ifMatch:    `*`,
+			payload:    `{"state": "available"}`,
+			wantStatus: http.StatusOK,
+			wantETag:   `"3"`,
+		},
+		{
+			name:       "Reused If-Match",
+			method:     "PATCH",
+			ifMatch:    `"1"`,
+			payload:    `{"state": "inactive"}`,
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "Listed If-Match",
+			method:     "PATCH",
+			ifMatch:    `"2", "3"`,
+			payload:    `{"state": "inactive"}`,
+			wantStatus: http.StatusOK,
+			wantETag:   `"4"`,
+		},
+		{
+			name:       "Weak tag in list",
+			method:     "PATCH",
+			ifMatch:    `"1", W/"4"`,
+			payload:    `{"state": "available"}`,
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "Malformed If-Match",
+			method:     "PATCH",
+			ifMatch:    `"4`,
+			payload:    `{"state": "available"}`,
+			wantStatus: http.StatusPreconditionFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/devices/1", strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("If-Match", tt.ifMatch)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if etag := rec.Header().Get("ETag"); etag != tt.wantETag {
+				t.Errorf("Expected ETag '%s', got '%s'", tt.wantETag, etag)
+			}
+		})
+	}
+}
+
 func TestHandlePatchDevice(t *testing.T) {
 	mock := mockstore.NewMockDeviceStore()
 	api := Api{
@@ -357,13 +606,14 @@ func TestHandlePatchDevice(t *testing.T) {
 	}
 	ctx := context.Background()
 
-	mock.CreateDevice(ctx, "Device A", "BrandX", "available")
-	mock.CreateDevice(ctx, "Device B", "BrandY", "in-use")
-	mock.CreateDevice(ctx, "Device C", "BrandZ", "inactive")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "available")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device B", "BrandY", "in-use")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device C", "BrandZ", "inactive")
 
 	tests := []struct {
 		name         string
 		deviceID     string
+		contentType  string
 		payload      string
 		wantStatus   int
 		wantResponse string
@@ -380,58 +630,165 @@ func TestHandlePatchDevice(t *testing.T) {
 			deviceID:     "1",
 			payload:      "",
 			wantStatus:   http.StatusBadRequest,
-			wantResponse: `{"error":"invalid request"}`,
+			wantResponse: `"code":"invalid_request"`,
 		},
 		{
 			name:         "Invalid JSON",
 			deviceID:     "1",
 			payload:      `{"name":`,
 			wantStatus:   http.StatusBadRequest,
-			wantResponse: `{"error":"invalid request"}`,
+			wantResponse: `"code":"invalid_request"`,
 		},
 		{
 			name:         "Invalid state value",
 			deviceID:     "1",
 			payload:      `{"name": "Device A updated", "brand": "BrandX updated", "state": "unknown-state"}`,
 			wantStatus:   http.StatusUnprocessableEntity,
-			wantResponse: `{"state":"State must be 'available', 'in-use' or 'inactive"}`,
+			wantResponse: `"errors":{"state":"State must be 'available', 'in-use' or 'inactive'"}`,
+		},
+		{
+			name:         "No fields",
+			deviceID:     "1",
+			payload:      `{}`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"errors":{"brand":"At least one field must be informed","name":"At least one field must be informed","state":"At least one field must be informed"}`,
 		},
 		{
 			name:         "Empty fields",
 			deviceID:     "1",
 			payload:      `{"name": "", "brand": "", "state": ""}`,
 			wantStatus:   http.StatusUnprocessableEntity,
-			wantResponse: `{"brand":"At least one field must be informed","name":"At least one field must be informed","state":"At least one field must be informed"}`,
+			wantResponse: `"errors":{"brand":"Brand must be between 3 and 255 characters","name":"Name must be between 3 and 255 characters","state":"State must be 'available', 'in-use' or 'inactive'"}`,
+		},
+		{
+			name:         "Merge patch",
+			deviceID:     "3",
+			contentType:  "application/merge-patch+json",
+			payload:      `{"brand": "BrandW"}`,
+			wantStatus:   http.StatusOK,
+			wantResponse: `"brand":"BrandW","created_at"`,
+		},
+		{
+			name:         "Merge patch removing a field",
+			deviceID:     "3",
+			contentType:  "application/merge-patch+json",
+			payload:      `{"name": null}`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"errors":{"name":"Name cannot be removed"}`,
+		},
+		{
+			name:         "JSON patch",
+			deviceID:     "3",
+			contentType:  "application/json-patch+json",
+			payload:      `[{"op": "test", "path": "/state", "value": "inactive"}, {"op": "replace", "path": "/name", "value": "Device C2"}]`,
+			wantStatus:   http.StatusOK,
+			wantResponse: `"name":"Device C2"`,
+		},
+		{
+			name:         "JSON patch with only tests",
+			deviceID:     "3",
+			contentType:  "application/json-patch+json",
+			payload:      `[{"op": "test", "path": "/name", "value": "Device C2"}]`,
+			wantStatus:   http.StatusOK,
+			wantResponse: `"version":3`,
+		},
+		{
+			name:         "JSON patch test failed",
+			deviceID:     "3",
+			contentType:  "application/json-patch+json",
+			payload:      `[{"op": "test", "path": "/version", "value": 1}, {"op": "replace", "path": "/name", "value": "Device C3"}]`,
+			wantStatus:   http.StatusConflict,
+			wantResponse: `"code":"patch_test_failed"`,
+		},
+		{
+			name:         "JSON patch removing a field",
+			deviceID:     "3",
+			contentType:  "application/json-patch+json",
+			payload:      `[{"op": "remove", "path": "/brand"}]`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"errors":{"brand":"Brand cannot be removed"}`,
+		},
+		{
+			name:         "JSON patch changing a read-only field",
+			deviceID:     "3",
+			contentType:  "application/json-patch+json",
+			payload:      `[{"op": "replace", "path": "/id", "value": 9}]`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"errors":{"id":"Id cannot be changed"}`,
+		},
+		{
+			name:         "JSON patch adding an unknown field",
+			deviceID:     "3",
+			contentType:  "application/json-patch+json",
+			payload:      `[{"op": "add", "path": "/stat", "value": "in-use"}]`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"errors":{"stat":"Unknown field"}`,
+		},
+		{
+			name:         "JSON patch with a missing path",
+			deviceID:     "3",
+			contentType:  "application/json-patch+json",
+			payload:      `[{"op": "remove", "path": "/owner"}]`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"code":"invalid_patch"`,
+		},
+		{
+			name:         "JSON patch with an unknown op",
+			deviceID:     "3",
+			contentType:  "application/json-patch+json",
+			payload:      `[{"op": "rename", "path": "/name", "value": "Device C3"}]`,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"code":"invalid_request"`,
+		},
+		{
+			name:         "JSON patch that is not an array",
+			deviceID:     "3",
+			contentType:  "application/json-patch+json",
+			payload:      `{"op": "replace", "path": "/name", "value": "Device C3"}`,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"code":"invalid_request"`,
 		},
 		{
 			name:         "Invalid device ID",
 			deviceID:     "invalid",
 			payload:      `{"name": "Device A updated", "brand": "BrandX updated", "state": "in-use"}`,
 			wantStatus:   http.StatusBadRequest,
-			wantResponse: `{"error":"invalid device id"}`,
+			wantResponse: `"code":"invalid_device_id"`,
 		},
 		{
 			name:         "Device not found",
 			deviceID:     "4",
 			payload:      `{"name": "Device A updated", "brand": "BrandX updated", "state": "in-use"}`,
 			wantStatus:   http.StatusNotFound,
-			wantResponse: `{"error":"device not found"}`,
+			wantResponse: `"code":"device_not_found"`,
 		},
 		{
 			name:         "Device in use",
 			deviceID:     "2",
 			payload:      `{"name": "Device A updated", "brand": "BrandX updated", "state": "available"}`,
 			wantStatus:   http.StatusUnprocessableEntity,
-			wantResponse: `{"error":"device is in use, cannot update name or brand"}`,
+			wantResponse: `"code":"device_in_use"`,
+		},
+		{
+			name:         "State only on device in use",
+			deviceID:     "2",
+			payload:      `{"state": "available"}`,
+			wantStatus:   http.StatusOK,
+			wantResponse: `"state":"available"`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			handler := chi.NewRouter()
+			handler.Use(api.resolveTenant)
 			handler.Patch("/api/v1/devices/{device_id}", api.handlePatchDevice)
 			req := httptest.NewRequest("PATCH", "/api/v1/devices/"+tt.deviceID, strings.NewReader(tt.payload))
-			req.Header.Set("Content-Type", "application/json")
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			req.Header.Set("Content-Type", contentType)
 
 			rec := httptest.NewRecorder()
 			handler.ServeHTTP(rec, req)
@@ -440,7 +797,7 @@ func TestHandlePatchDevice(t *testing.T) {
 				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
 			}
 
-			if tt.wantStatus != http.StatusOK && !strings.Contains(rec.Body.String(), tt.wantResponse) {
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
 				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
 			}
 
@@ -455,9 +812,9 @@ func TestHandleDeleteDevice(t *testing.T) {
 	}
 	ctx := context.Background()
 
-	mock.CreateDevice(ctx, "Device A", "BrandX", "available")
-	mock.CreateDevice(ctx, "Device B", "BrandY", "in-use")
-	mock.CreateDevice(ctx, "Device C", "BrandZ", "inactive")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "available")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device B", "BrandY", "in-use")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device C", "BrandZ", "inactive")
 
 	tests := []struct {
 		name         string
@@ -475,25 +832,26 @@ func TestHandleDeleteDevice(t *testing.T) {
 			name:         "Invalid device ID",
 			deviceID:     "invalid",
 			wantStatus:   http.StatusBadRequest,
-			wantResponse: `{"error":"invalid device id"}`,
+			wantResponse: `"code":"invalid_device_id"`,
 		},
 		{
 			name:         "Device not found",
 			deviceID:     "4",
 			wantStatus:   http.StatusNotFound,
-			wantResponse: `{"error":"device not found"}`,
+			wantResponse: `"code":"device_not_found"`,
 		},
 		{
 			name:         "Device in use",
 			deviceID:     "2",
 			wantStatus:   http.StatusUnprocessableEntity,
-			wantResponse: `{"error":"device is in use, cannot update name or brand"}`,
+			wantResponse: `"code":"device_in_use"`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			handle := chi.NewRouter()
+			handle.Use(api.resolveTenant)
 			handle.Delete("/api/v1/devices/{device_id}", api.handleDeleteDevice)
 			req := httptest.NewRequest("DELETE", "/api/v1/devices/"+tt.deviceID, nil)
 			req.Header.Set("Content-Type", "application/json")
@@ -511,3 +869,1930 @@ func TestHandleDeleteDevice(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleRestoreDevice(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	api := Api{
+		DeviceService: services.NewDeviceService(mock),
+	}
+	ctx := context.Background()
+
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "available")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device B", "BrandY", "available")
+	mock.DeleteDevice(ctx, store.DefaultTenant, 1)
+
+	tests := []struct {
+		name         string
+		deviceID     string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "Happy path",
+			deviceID:     "1",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"message":"device restored successfully"`,
+		},
+		{
+			name:         "Device not deleted",
+			deviceID:     "2",
+			wantStatus:   http.StatusConflict,
+			wantResponse: `"code":"device_not_deleted"`,
+		},
+		{
+			name:         "Device not found",
+			deviceID:     "3",
+			wantStatus:   http.StatusNotFound,
+			wantResponse: `"code":"device_not_found"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handle := chi.NewRouter()
+			handle.Use(api.resolveTenant)
+			handle.Post("/api/v1/devices/{device_id}/restore", api.handleRestoreDevice)
+			req := httptest.NewRequest("POST", "/api/v1/devices/"+tt.deviceID+"/restore", nil)
+
+			rec := httptest.NewRecorder()
+			handle.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandleCheckoutDevice(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	api := Api{
+		Router:        chi.NewMux(),
+		DeviceService: services.NewDeviceService(mock),
+	}
+	api.BindRoutes()
+	ctx := context.Background()
+
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "available")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device B", "BrandY", "inactive")
+	past := time.Now().Add(-time.Hour)
+	mock.CreateAssignment(ctx, store.DefaultTenant, store.Assignment{DeviceID: 2, Assignee: "bob", DueAt: &past})
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "Checkout without assignee",
+			method:       "POST",
+			path:         "/api/v1/devices/1/checkout",
+			body:         `{"note": "for the demo"}`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"assignee":"Assignee is required"`,
+		},
+		{
+			name:         "Checkout due in the past",
+			method:       "POST",
+			path:         "/api/v1/devices/1/checkout",
+			body:         `{"assignee": "alice", "due_at": "2020-01-01T00:00:00Z"}`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"due_at":"Due date must be in the future"`,
+		},
+		{
+			name:         "Checkout",
+			method:       "POST",
+			path:         "/api/v1/devices/1/checkout",
+			body:         `{"assignee": "alice", "note": "for the demo"}`,
+			wantStatus:   http.StatusOK,
+			wantResponse: `"state":"in-use"`,
+		},
+		{
+			name:         "Checkout of a device in use",
+			method:       "POST",
+			path:         "/api/v1/devices/1/checkout",
+			body:         `{"assignee": "bob"}`,
+			wantStatus:   http.StatusConflict,
+			wantResponse: `"code":"device_not_available"`,
+		},
+		{
+			name:         "Checkout of a missing device",
+			method:       "POST",
+			path:         "/api/v1/devices/3/checkout",
+			body:         `{"assignee": "bob"}`,
+			wantStatus:   http.StatusNotFound,
+			wantResponse: `"code":"device_not_found"`,
+		},
+		{
+			name:         "State change of a checked out device",
+			method:       "PUT",
+			path:         "/api/v1/devices/1",
+			body:         `{"name": "Device A", "brand": "BrandX", "state": "available"}`,
+			wantStatus:   http.StatusConflict,
+			wantResponse: `"code":"device_checked_out"`,
+		},
+		{
+			name:         "Devices of an assignee",
+			method:       "GET",
+			path:         "/api/v1/assignees/alice/devices",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"assignee":"alice"`,
+		},
+		{
+			name:         "Overdue assignments",
+			method:       "GET",
+			path:         "/api/v1/assignments?overdue=true",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"assignments":[{"id":1,"device_id":2,"assignee":"bob"`,
+		},
+		{
+			name:         "Invalid assignment query",
+			method:       "GET",
+			path:         "/api/v1/assignments?open=maybe",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"open":"open must be true or false"`,
+		},
+		{
+			name:         "Checkin",
+			method:       "POST",
+			path:         "/api/v1/devices/1/checkin",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"message":"device checked in successfully"`,
+		},
+		{
+			name:         "Checkin of a device not checked out",
+			method:       "POST",
+			path:         "/api/v1/devices/1/checkin",
+			wantStatus:   http.StatusConflict,
+			wantResponse: `"code":"device_not_checked_out"`,
+		},
+		{
+			name:         "Devices of an assignee after the checkin",
+			method:       "GET",
+			path:         "/api/v1/assignees/alice/devices",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"assignments":[]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			rec := httptest.NewRecorder()
+			api.Router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandleReservations(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	api := Api{
+		Router:        chi.NewMux(),
+		DeviceService: services.NewDeviceService(mock),
+	}
+	api.BindRoutes()
+	ctx := context.Background()
+
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "available")
+	start := time.Now().Add(time.Hour).UTC()
+	slot := func(from, to time.Duration) string {
+		return fmt.Sprintf(`{"starts_at": %q, "ends_at": %q}`, start.Add(from).Format(time.RFC3339), start.Add(to).Format(time.RFC3339))
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "Reservation without a slot",
+			method:       "POST",
+			path:         "/api/v1/devices/1/reservations",
+			body:         `{"note": "for the demo"}`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"starts_at":"Start is required"`,
+		},
+		{
+			name:         "Reservation ending before it starts",
+			method:       "POST",
+			path:         "/api/v1/devices/1/reservations",
+			body:         slot(time.Hour, 0),
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"ends_at":"End must be after the start"`,
+		},
+		{
+			name:         "Reservation",
+			method:       "POST",
+			path:         "/api/v1/devices/1/reservations",
+			body:         slot(0, time.Hour),
+			wantStatus:   http.StatusCreated,
+			wantResponse: `"status":"scheduled"`,
+		},
+		{
+			name:         "Overlapping reservation",
+			method:       "POST",
+			path:         "/api/v1/devices/1/reservations",
+			body:         slot(30*time.Minute, 2*time.Hour),
+			wantStatus:   http.StatusConflict,
+			wantResponse: `"code":"reservation_conflict"`,
+		},
+		{
+			name:         "Reservation of a missing device",
+			method:       "POST",
+			path:         "/api/v1/devices/2/reservations",
+			body:         slot(0, time.Hour),
+			wantStatus:   http.StatusNotFound,
+			wantResponse: `"code":"device_not_found"`,
+		},
+		{
+			name:         "Reservations of a device",
+			method:       "GET",
+			path:         "/api/v1/devices/1/reservations?status=scheduled,active",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"reservations":[{"id":1,"device_id":1`,
+		},
+		{
+			name:         "Invalid reservation query",
+			method:       "GET",
+			path:         "/api/v1/devices/1/reservations?status=pending",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"code":"invalid_query"`,
+		},
+		{
+			name:         "Cancellation",
+			method:       "DELETE",
+			path:         "/api/v1/devices/1/reservations/1",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"status":"canceled"`,
+		},
+		{
+			name:         "Cancellation of a canceled reservation",
+			method:       "DELETE",
+			path:         "/api/v1/devices/1/reservations/1",
+			wantStatus:   http.StatusConflict,
+			wantResponse: `"code":"reservation_ended"`,
+		},
+		{
+			name:         "Cancellation of a missing reservation",
+			method:       "DELETE",
+			path:         "/api/v1/devices/1/reservations/9",
+			wantStatus:   http.StatusNotFound,
+			wantResponse: `"code":"reservation_not_found"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			rec := httptest.NewRecorder()
+			api.Router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandleBatchDevices(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		payload      string
+		wantStatus   int
+		wantResponse []string
+	}{
+		{
+			name:       "Mixed results",
+			payload:    `{"operations": [{"op": "create", "device": {"name": "Device B", "brand": "BrandY", "state": "available"}}, {"op": "delete", "id": 1}, {"op": "patch", "id": 9, "device": {"state": "inactive"}}]}`,
+			wantStatus: http.StatusMultiStatus,
+			wantResponse: []string{
+				`"committed":true`,
+				`{"device":{"id":2,`,
+				`"status":201`,
+				`"code":"device_in_use"`,
+				`"code":"device_not_found"`,
+			},
+		},
+		{
+			name:       "Invalid item",
+			payload:    `{"operations": [{"op": "create", "device": {"name": "D"}}, {"op": "move", "id": 1}]}`,
+			wantStatus: http.StatusMultiStatus,
+			wantResponse: []string{
+				`"errors":{"brand":"Brand is required","name":"Name must be between 3 and 255 characters","state":"State is required"}`,
+				`"errors":{"op":"Op must be 'create', 'update', 'patch' or 'delete'"}`,
+			},
+		},
+		{
+			name:       "Stale item version",
+			payload:    `{"operations": [{"op": "patch", "id": 1, "version": 2, "device": {"name": "Device C"}}]}`,
+			wantStatus: http.StatusMultiStatus,
+			wantResponse: []string{
+				`"status":412`,
+				`"code":"version_mismatch"`,
+			},
+		},
+		{
+			name:         "Unknown field in item",
+			payload:      `{"operations": [{"op": "patch", "id": 1, "device": {"stat": "inactive"}}]}`,
+			wantStatus:   http.StatusMultiStatus,
+			wantResponse: []string{`"errors":{"device.stat":"Unknown field"}`},
+		},
+		{
+			name:       "Atomic rolled back",
+			query:      "?atomic=true",
+			payload:    `{"operations": [{"op": "create", "device": {"name": "Device B", "brand": "BrandY", "state": "available"}}, {"op": "delete", "id": 1}]}`,
+			wantStatus: http.StatusMultiStatus,
+			wantResponse: []string{
+				`"committed":false`,
+				`"code":"batch_rolled_back"`,
+				`"code":"device_in_use"`,
+			},
+		},
+		{
+			name:       "Atomic with invalid item",
+			query:      "?atomic=true",
+			payload:    `{"operations": [{"op": "create", "device": {"name": "Device B", "brand": "BrandY", "state": "available"}}, {"op": "update"}]}`,
+			wantStatus: http.StatusMultiStatus,
+			wantResponse: []string{
+				`"committed":false`,
+				`"code":"batch_rolled_back"`,
+				`"id":"Id is required"`,
+			},
+		},
+		{
+			name:         "Empty batch",
+			payload:      `{"operations": []}`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: []string{`"errors":{"operations":"At least one operation must be informed"}`},
+		},
+		{
+			name:         "Invalid atomic",
+			query:        "?atomic=sometimes",
+			payload:      `{"operations": []}`,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: []string{`"errors":{"atomic":"atomic must be true or false"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockstore.NewMockDeviceStore()
+			api := Api{
+				Router:        chi.NewMux(),
+				DeviceService: services.NewDeviceService(mock),
+			}
+			api.BindRoutes()
+			mock.CreateDevice(context.Background(), store.DefaultTenant, "Device A", "BrandX", "in-use")
+
+			req := httptest.NewRequest("POST", "/api/v1/devices:batch"+tt.query, strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			rec := httptest.NewRecorder()
+			api.Router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			for _, want := range tt.wantResponse {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("Expected response to contain '%s', got '%s'", want, rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleImportDevices(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		contentType  string
+		payload      string
+		wantStatus   int
+		wantResponse string
+		wantDevices  int
+	}{
+		{
+			name:         "Happy path",
+			contentType:  "text/csv",
+			payload:      "name,brand,state\nDevice A,BrandX,available\nDevice B,BrandY,in-use\n",
+			wantStatus:   http.StatusOK,
+			wantResponse: `{"dry_run":false,"imported":2,"problems":[],"rejected":0,"valid":2}`,
+			wantDevices:  2,
+		},
+		{
+			name:         "Columns in any order with invalid rows",
+			contentType:  "text/csv; charset=utf-8",
+			payload:      "State,Name,Brand\navailable,Device A,BrandX\nbroken,D,BrandY\nin-use,Device C\n",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"problems":[{"row":3,"errors":{"name":"Name must be between 3 and 255 characters","state":"State must be 'available', 'in-use' or 'inactive'"}},{"row":4,"errors":{"row":"Row must have 3 fields"}}],"rejected":2,"valid":1`,
+			wantDevices:  1,
+		},
+		{
+			name:         "Dry run",
+			query:        "?dry_run=true",
+			contentType:  "text/csv",
+			payload:      "name,brand,state\nDevice A,BrandX,available\n",
+			wantStatus:   http.StatusOK,
+			wantResponse: `{"dry_run":true,"imported":0,"problems":[],"rejected":0,"valid":1}`,
+		},
+		{
+			name:         "Missing column",
+			contentType:  "text/csv",
+			payload:      "name,brand\nDevice A,BrandX\n",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"detail":"csv header must have the columns name, brand, state"`,
+		},
+		{
+			name:         "Not a CSV",
+			contentType:  "application/json",
+			payload:      `[]`,
+			wantStatus:   http.StatusUnsupportedMediaType,
+			wantResponse: `"code":"unsupported_media_type"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockstore.NewMockDeviceStore()
+			api := Api{
+				Router:        chi.NewMux(),
+				DeviceService: services.NewDeviceService(mock),
+			}
+			api.BindRoutes()
+
+			req := httptest.NewRequest("POST", "/api/v1/devices/import"+tt.query, strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			rec := httptest.NewRecorder()
+			api.Router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+
+			devices, _ := mock.ListDevices(context.Background(), store.DefaultTenant, store.DeviceFilter{Limit: 10})
+			if len(devices.Devices) != tt.wantDevices {
+				t.Errorf("Expected %d devices, got %d", tt.wantDevices, len(devices.Devices))
+			}
+		})
+	}
+}
+
+func TestHandleExportDevices(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	api := Api{
+		DeviceService: services.NewDeviceService(mock),
+	}
+	ctx := context.Background()
+
+	deviceA, _ := mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "in-use")
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device B", "BrandY", "available")
+
+	tests := []struct {
+		name            string
+		query           string
+		wantStatus      int
+		wantContentType string
+		wantResponse    string
+	}{
+		{
+			name:            "CSV by default",
+			query:           "sort=name",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv",
+			wantResponse:    "id,name,brand,state,created_at,version\n1,Device A,BrandX,in-use," + deviceA.CreatedAt.Format(time.RFC3339Nano) + ",1\n2,Device B,",
+		},
+		{
+			name:            "NDJSON with filters",
+			query:           "format=ndjson&brand=brandy",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/x-ndjson",
+			wantResponse:    `{"id":2,"name":"Device B","brand":"BrandY","state":"available",`,
+		},
+		{
+			name:            "Empty export",
+			query:           "state=inactive",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv",
+			wantResponse:    "id,name,brand,state,created_at,version\n",
+		},
+		{
+			name:            "Unknown format",
+			query:           "format=pdf",
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: "application/problem+json",
+			wantResponse:    `"errors":{"format":"format must be 'csv', 'ndjson' or 'xlsx'"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/devices/export?"+tt.query, nil)
+
+			rec := httptest.NewRecorder()
+			handler := api.resolveTenant(http.HandlerFunc(api.handleExportDevices))
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if contentType := rec.Header().Get("Content-Type"); contentType != tt.wantContentType {
+				t.Errorf("Expected content type %q, got %q", tt.wantContentType, contentType)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+
+	t.Run("XLSX", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/v1/devices/export?format=xlsx&sort=name", nil)
+
+		rec := httptest.NewRecorder()
+		api.resolveTenant(http.HandlerFunc(api.handleExportDevices)).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+		}
+
+		file, err := excelize.OpenReader(rec.Body)
+		if err != nil {
+			t.Fatalf("Expected a workbook, got %v", err)
+		}
+		defer file.Close()
+
+		rows, err := file.GetRows("Sheet1")
+		if err != nil {
+			t.Fatalf("Expected rows, got %v", err)
+		}
+		if len(rows) != 3 || rows[1][1] != "Device A" || rows[2][1] != "Device B" {
+			t.Errorf("Unexpected rows %v", rows)
+		}
+	})
+
+	t.Run("Formulas are escaped", func(t *testing.T) {
+		mock.CreateDevice(ctx, store.DefaultTenant, `=HYPERLINK("http://evil.example")`, "@BrandZ", "available")
+
+		req := httptest.NewRequest("GET", "/api/v1/devices/export?brand=@brandz", nil)
+		rec := httptest.NewRecorder()
+		api.resolveTenant(http.HandlerFunc(api.handleExportDevices)).ServeHTTP(rec, req)
+
+		if want := `3,"'=HYPERLINK(""http://evil.example"")",'@BrandZ,available,`; !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Expected response to contain '%s', got '%s'", want, rec.Body)
+		}
+
+		req = httptest.NewRequest("GET", "/api/v1/devices/export?format=xlsx&brand=@brandz", nil)
+		rec = httptest.NewRecorder()
+		api.resolveTenant(http.HandlerFunc(api.handleExportDevices)).ServeHTTP(rec, req)
+
+		file, err := excelize.OpenReader(rec.Body)
+		if err != nil {
+			t.Fatalf("Expected a workbook, got %v", err)
+		}
+		defer file.Close()
+
+		rows, err := file.GetRows("Sheet1")
+		if err != nil {
+			t.Fatalf("Expected rows, got %v", err)
+		}
+		if len(rows) != 2 || rows[1][1] != `'=HYPERLINK("http://evil.example")` || rows[1][2] != "'@BrandZ" {
+			t.Errorf("Unexpected rows %v", rows)
+		}
+	})
+
+	t.Run("Store unavailable", func(t *testing.T) {
+		mock.FailWith(store.ErrUnavailable)
+		defer mock.FailWith(nil)
+
+		req := httptest.NewRequest("GET", "/api/v1/devices/export", nil)
+
+		rec := httptest.NewRecorder()
+		api.resolveTenant(http.HandlerFunc(api.handleExportDevices)).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, rec.Code)
+		}
+	})
+}
+
+func TestHandleGetDeviceTransitions(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	api := Api{
+		DeviceService: services.NewDeviceService(mock),
+	}
+	ctx := context.Background()
+
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "inactive")
+
+	handler := chi.NewRouter()
+	handler.Use(api.resolveTenant)
+	handler.Get("/api/v1/devices/{device_id}/transitions", api.handleGetDeviceTransitions)
+	handler.Patch("/api/v1/devices/{device_id}", api.handlePatchDevice)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		payload      string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "Transitions of inactive device",
+			method:       "GET",
+			path:         "/api/v1/devices/1/transitions",
+			wantStatus:   http.StatusOK,
+			wantResponse: `{"device_id":1,"state":"inactive","transitions":["available"]}`,
+		},
+		{
+			name:         "Device not found",
+			method:       "GET",
+			path:         "/api/v1/devices/2/transitions",
+			wantStatus:   http.StatusNotFound,
+			wantResponse: `"code":"device_not_found"`,
+		},
+		{
+			name:         "Illegal transition",
+			method:       "PATCH",
+			path:         "/api/v1/devices/1",
+			payload:      `{"state": "in-use"}`,
+			wantStatus:   http.StatusConflict,
+			wantResponse: `"allowed":["available"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandleGetDeviceHistory(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	api := Api{
+		Router:        chi.NewMux(),
+		DeviceService: services.NewDeviceService(mock),
+	}
+	api.BindRoutes()
+
+	req := httptest.NewRequest("POST", "/api/v1/devices", strings.NewReader(`{"name": "Device A", "brand": "BrandX", "state": "available"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Actor", "alice")
+	req.Header.Set("X-Request-Id", "req-1")
+	api.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("PATCH", "/api/v1/devices/1", strings.NewReader(`{"state": "in-use"}`))
+	req.Header.Set("Content-Type", "application/json")
+	api.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "Latest change first",
+			path:         "/api/v1/devices/1/history?limit=1",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"type":"patched"`,
+		},
+		{
+			name:         "Actor and request id recorded",
+			path:         "/api/v1/devices/1/history",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"actor":"alice","request_id":"req-1"`,
+		},
+		{
+			name:         "Last page",
+			path:         "/api/v1/devices/1/history",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"next_cursor":null`,
+		},
+		{
+			name:         "Invalid limit",
+			path:         "/api/v1/devices/1/history?limit=0",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"code":"invalid_query"`,
+		},
+		{
+			name:         "Device not found",
+			path:         "/api/v1/devices/2/history",
+			wantStatus:   http.StatusNotFound,
+			wantResponse: `"code":"device_not_found"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+
+			rec := httptest.NewRecorder()
+			api.Router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	api := Api{
+		Router:        chi.NewMux(),
+		DeviceService: services.NewDeviceService(mock),
+	}
+	api.BindRoutes()
+	mock.CreateDevice(context.Background(), store.DefaultTenant, "Device A", "BrandX", "available")
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		contentType     string
+		accept          string
+		payload         string
+		wantStatus      int
+		wantContentType string
+		wantResponse    string
+	}{
+		{
+			name:            "XML response",
+			method:          "GET",
+			path:            "/api/v1/devices/1",
+			accept:          "application/xml",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/xml",
+			wantResponse:    "<brand>BrandX</brand>",
+		},
+		{
+			name:            "YAML request and response",
+			method:          "POST",
+			path:            "/api/v1/devices",
+			contentType:     "application/yaml",
+			accept:          "application/yaml",
+			payload:         "name: Device B\nbrand: BrandY\nstate: in-use\n",
+			wantStatus:      http.StatusCreated,
+			wantContentType: "application/yaml",
+			wantResponse:    "name: Device B",
+		},
+		{
+			name:            "XML request",
+			method:          "PATCH",
+			path:            "/api/v1/devices/1",
+			contentType:     "application/xml",
+			payload:         "<device><state>inactive</state></device>",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantResponse:    `"state":"inactive"`,
+		},
+		{
+			name:            "Problem as XML",
+			method:          "GET",
+			path:            "/api/v1/devices/9",
+			accept:          "application/xml",
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/problem+xml",
+			wantResponse:    "<code>device_not_found</code>",
+		},
+		{
+			name:            "Unsupported media type",
+			method:          "PUT",
+			path:            "/api/v1/devices/1",
+			contentType:     "text/plain",
+			payload:         "name=Device A",
+			wantStatus:      http.StatusUnsupportedMediaType,
+			wantContentType: "application/problem+json",
+			wantResponse:    `"code":"unsupported_media_type"`,
+		},
+		{
+			name:            "Not acceptable",
+			method:          "GET",
+			path:            "/api/v1/devices",
+			accept:          "text/html",
+			wantStatus:      http.StatusNotAcceptable,
+			wantContentType: "application/problem+json",
+			wantResponse:    `"code":"not_acceptable"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.payload))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			rec := httptest.NewRecorder()
+			api.Router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if contentType := rec.Header().Get("Content-Type"); contentType != tt.wantContentType {
+				t.Errorf("Expected content type %q, got %q", tt.wantContentType, contentType)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	api := Api{
+		DeviceService: services.NewDeviceService(mock),
+	}
+	ctx := context.Background()
+
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "in-use")
+
+	handler := chi.NewRouter()
+	handler.Use(api.resolveTenant)
+	handler.Use(middleware.RequestID)
+	handler.Delete("/api/v1/devices/{device_id}", api.handleDeleteDevice)
+
+	req := httptest.NewRequest("DELETE", "/api/v1/devices/1", nil)
+	req.Header.Set("X-Request-Id", "req-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnprocessableEntity, rec.Code)
+	}
+
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Errorf("Expected content type 'application/problem+json', got '%s'", contentType)
+	}
+
+	var problem Problem
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+		t.Fatalf("Expected a problem body, got error %v", err)
+	}
+
+	want := Problem{
+		Type:     "urn:devices-api:problem:device_in_use",
+		Title:    "Device is in use",
+		Status:   http.StatusUnprocessableEntity,
+		Detail:   services.ErrDeviceInUse.Error(),
+		Instance: "req-123",
+		Code:     CodeDeviceInUse,
+	}
+	if !reflect.DeepEqual(problem, want) {
+		t.Errorf("Expected problem %+v, got %+v", want, problem)
+	}
+}
+
+func TestStoreErrorResponses(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	api := Api{
+		DeviceService: services.NewDeviceService(mock),
+	}
+	ctx := context.Background()
+
+	mock.CreateDevice(ctx, store.DefaultTenant, "Device A", "BrandX", "available")
+
+	tests := []struct {
+		name         string
+		err          error
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "Not found",
+			err:          store.ErrNotFound,
+			wantStatus:   http.StatusNotFound,
+			wantResponse: `"code":"device_not_found"`,
+		},
+		{
+			name:         "Conflict",
+			err:          store.ErrConflict,
+			wantStatus:   http.StatusConflict,
+			wantResponse: `"code":"conflict"`,
+		},
+		{
+			name:         "Unavailable",
+			err:          fmt.Errorf("%w: connection refused", store.ErrUnavailable),
+			wantStatus:   http.StatusServiceUnavailable,
+			wantResponse: `"detail":"the database is unavailable, try again later"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock.FailWith(tt.err)
+			defer mock.FailWith(nil)
+
+			handler := chi.NewRouter()
+			handler.Use(api.resolveTenant)
+			handler.Get("/api/v1/devices/{device_id}", api.handleGetDevice)
+			req := httptest.NewRequest("GET", "/api/v1/devices/1", nil)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	idempotencyStore := mockstore.NewMockIdempotencyStore()
+	api := Api{
+		Router:             chi.NewMux(),
+		DeviceService:      services.NewDeviceService(mock),
+		IdempotencyService: services.NewIdempotencyService(idempotencyStore),
+	}
+	api.BindRoutes()
+
+	const payload = `{"name": "Device A", "brand": "BrandX", "state": "available"}`
+	inProgress := httptest.NewRequest("POST", "/api/v1/devices", nil)
+	inProgress.Header.Set("Content-Type", "application/json")
+	idempotencyStore.ClaimIdempotencyKey(context.Background(), store.DefaultTenant+"/key-4", requestFingerprint(inProgress, []byte(payload)), time.Now().Add(time.Hour))
+
+	// The steps run in order against the same stores.
+	tests := []struct {
+		name         string
+		key          string
+		tenant       string
+		accept       string
+		payload      string
+		failStore    bool
+		wantStatus   int
+		wantReplayed bool
+		wantResponse string
+	}{
+		{
+			name:         "First request",
+			key:          "key-1",
+			payload:      payload,
+			wantStatus:   http.StatusCreated,
+			wantResponse: `"id":1`,
+		},
+		{
+			name:         "Retry is replayed",
+			key:          "key-1",
+			payload:      payload,
+			wantStatus:   http.StatusCreated,
+			wantReplayed: true,
+			wantResponse: `"id":1`,
+		},
+		{
+			name:         "Key reused with another payload",
+			key:          "key-1",
+			payload:      `{"name": "Device B", "brand": "BrandX", "state": "available"}`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"code":"idempotency_key_reused"`,
+		},
+		{
+			name:         "Key reused asking for another format",
+			key:          "key-1",
+			accept:       "application/xml",
+			payload:      payload,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `<code>idempotency_key_reused</code>`,
+		},
+		{
+			name:         "Key reused with the same format spelled differently",
+			key:          "key-1",
+			accept:       "application/json; q=0.9, text/plain; q=0.1",
+			payload:      payload,
+			wantStatus:   http.StatusCreated,
+			wantReplayed: true,
+			wantResponse: `"id":1`,
+		},
+		{
+			name:         "Client errors are replayed",
+			key:          "key-2",
+			payload:      `{"name": "Device B"}`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"code":"validation_failed"`,
+		},
+		{
+			name:         "Client errors are replayed again",
+			key:          "key-2",
+			payload:      `{"name": "Device B"}`,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantReplayed: true,
+			wantResponse: `"code":"validation_failed"`,
+		},
+		{
+			name:         "Server errors are not stored",
+			key:          "key-3",
+			payload:      payload,
+			failStore:    true,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantResponse: `"code":"service_unavailable"`,
+		},
+		{
+			name:         "Retry after a server error runs",
+			key:          "key-3",
+			payload:      payload,
+			wantStatus:   http.StatusCreated,
+			wantResponse: `"id":2`,
+		},
+		{
+			name:         "Request in progress",
+			key:          "key-4",
+			payload:      payload,
+			wantStatus:   http.StatusConflict,
+			wantResponse: `"code":"idempotency_key_in_progress"`,
+		},
+		{
+			name:         "Key of another tenant",
+			key:          "key-1",
+			tenant:       "globex",
+			payload:      payload,
+			wantStatus:   http.StatusCreated,
+			wantResponse: `"id":3`,
+		},
+		{
+			name:         "Key too long",
+			key:          strings.Repeat("k", 256),
+			payload:      payload,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"code":"invalid_idempotency_key"`,
+		},
+		{
+			name:         "Without key",
+			payload:      payload,
+			wantStatus:   http.StatusCreated,
+			wantResponse: `"id":4`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.failStore {
+				mock.FailWith(store.ErrUnavailable)
+				defer mock.FailWith(nil)
+			}
+
+			req := httptest.NewRequest("POST", "/api/v1/devices", strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.key != "" {
+				req.Header.Set("Idempotency-Key", tt.key)
+			}
+			if tt.tenant != "" {
+				req.Header.Set("X-Tenant-ID", tt.tenant)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			rec := httptest.NewRecorder()
+			api.Router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.wantReplayed {
+				t.Errorf("Expected replayed %t, got %t", tt.wantReplayed, replayed)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	api := Api{
+		Router:        chi.NewMux(),
+		DeviceService: services.NewDeviceService(mockstore.NewMockDeviceStore()),
+		AccessService: services.NewAccessService(mockstore.NewMockAccessStore()),
+	}
+	api.BindRoutes()
+
+	doc, err := api.buildOpenAPI()
+	if err != nil {
+		t.Fatalf("Expected the spec to cover every route, got %v", err)
+	}
+
+	// Entries for routes that no longer exist are stale.
+	for key := range operations {
+		method, route, _ := strings.Cut(key, " ")
+		if doc.Paths[route][strings.ToLower(method)] == nil {
+			t.Errorf("Expected operation %s to match a route", key)
+		}
+	}
+
+	api.Router.Get("/api/v1/undocumented", api.handleGetAllDevices)
+	if _, err := api.buildOpenAPI(); err == nil || !strings.Contains(err.Error(), "GET /api/v1/undocumented") {
+		t.Errorf("Expected an error for the undocumented route, got %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		path            string
+		wantContentType string
+		wantResponse    string
+	}{
+		{
+			name:            "Spec",
+			path:            "/api/openapi.json",
+			wantContentType: "application/json",
+			wantResponse:    `"openapi":"3.1.0"`,
+		},
+		{
+			name:            "Docs",
+			path:            "/api/docs",
+			wantContentType: "text/html; charset=utf-8",
+			wantResponse:    `<script src="/api/docs/redoc.standalone.js">`,
+		},
+		{
+			name:            "Docs script",
+			path:            "/api/docs/redoc.standalone.js",
+			wantContentType: "text/javascript; charset=utf-8",
+			wantResponse:    `Redoc`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := Api{
+				Router:        chi.NewMux(),
+				DeviceService: services.NewDeviceService(mockstore.NewMockDeviceStore()),
+			}
+			api.BindRoutes()
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			rec := httptest.NewRecorder()
+			api.Router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			if contentType := rec.Header().Get("Content-Type"); contentType != tt.wantContentType {
+				t.Errorf("Expected content type '%s', got '%s'", tt.wantContentType, contentType)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+}
+
+// TestOpenAPIEnums checks that the spec lists every value the responses can
+// carry.
+func TestOpenAPIEnums(t *testing.T) {
+	api := Api{
+		Router:        chi.NewMux(),
+		DeviceService: services.NewDeviceService(mockstore.NewMockDeviceStore()),
+		AccessService: services.NewAccessService(mockstore.NewMockAccessStore()),
+	}
+	api.BindRoutes()
+
+	doc, err := api.buildOpenAPI()
+	if err != nil {
+		t.Fatalf("Expected the spec to build, got %v", err)
+	}
+
+	tests := []struct {
+		schema   string
+		property string
+		values   []string
+	}{
+		{
+			schema:   "DeviceEvent",
+			property: "type",
+			values: []string{
+				string(store.DeviceEventCreated), string(store.DeviceEventUpdated), string(store.DeviceEventPatched),
+				string(store.DeviceEventDeleted), string(store.DeviceEventRestored), string(store.DeviceEventCheckedOut),
+				string(store.DeviceEventCheckedIn), string(store.DeviceEventReservationStarted), string(store.DeviceEventReservationEnded),
+			},
+		},
+		{
+			schema:   "Reservation",
+			property: "status",
+			values: []string{
+				string(store.ReservationScheduled), string(store.ReservationDelayed), string(store.ReservationActive), string(store.ReservationCompleted),
+				string(store.ReservationCanceled), string(store.ReservationExpired),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schema+" "+tt.property, func(t *testing.T) {
+			schema := doc.Components.Schemas[tt.schema]
+			if schema == nil || schema.Properties[tt.property] == nil {
+				t.Fatalf("Expected schema %s to have a %s property", tt.schema, tt.property)
+			}
+
+			enum := schema.Properties[tt.property].Enum
+			for _, value := range tt.values {
+				if !slices.Contains(enum, value) {
+					t.Errorf("Expected %s.%s to list '%s', got %v", tt.schema, tt.property, value, enum)
+				}
+			}
+		})
+	}
+}
+
+// TestOpenAPIConstraints checks that the documented constraints of the
+// request bodies agree with their validators, probing each bound.
+func TestOpenAPIConstraints(t *testing.T) {
+	valid := map[string]any{"name": "Device A", "brand": "BrandX", "state": "available"}
+	type validatable interface {
+		Valid(context.Context) validator.Evaluator
+	}
+	type probe struct {
+		value any
+		ok    bool
+	}
+	requests := map[string]validatable{
+		"CreateDeviceReq": &deviceValidator.CreateDeviceReq{},
+		"UpdateDeviceReq": &deviceValidator.UpdateDeviceReq{},
+		"PatchDeviceReq":  &deviceValidator.PatchDeviceReq{},
+	}
+
+	generator := &schemaGenerator{components: map[string]*openAPISchema{}}
+	for name, req := range requests {
+		generator.schemaOf(reflect.TypeOf(req).Elem())
+		schema := generator.components[name]
+
+		for field, property := range schema.Properties {
+			var probes []probe
+			add := func(value any, ok bool) {
+				probes = append(probes, probe{value, ok})
+			}
+			if property.MinLength != nil {
+				add(strings.Repeat("a", *property.MinLength), true)
+				add(strings.Repeat("a", *property.MinLength-1), false)
+			}
+			if property.MaxLength != nil {
+				add(strings.Repeat("a", *property.MaxLength), true)
+				add(strings.Repeat("a", *property.MaxLength+1), false)
+			}
+			for _, value := range property.Enum {
+				add(value, true)
+			}
+			if property.Enum != nil {
+				add("not-in-enum", false)
+			}
+
+			for _, probe := range probes {
+				t.Run(fmt.Sprintf("%s %s=%.10v", name, field, probe.value), func(t *testing.T) {
+					body := map[string]any{}
+					for k, v := range valid {
+						body[k] = v
+					}
+					body[field] = probe.value
+					data, _ := json.Marshal(body)
+
+					target := reflect.New(reflect.TypeOf(req).Elem()).Interface().(interface {
+						Valid(context.Context) validator.Evaluator
+					})
+					if err := json.Unmarshal(data, target); err != nil {
+						t.Fatalf("Expected body to decode, got %v", err)
+					}
+
+					_, failed := target.Valid(context.Background())[field]
+					if failed == probe.ok {
+						t.Errorf("Expected valid %t for %v, got %t", probe.ok, probe.value, !failed)
+					}
+				})
+			}
+		}
+
+		for _, field := range schema.Required {
+			t.Run(fmt.Sprintf("%s without %s", name, field), func(t *testing.T) {
+				body := map[string]any{}
+				for k, v := range valid {
+					if k != field {
+						body[k] = v
+					}
+				}
+				data, _ := json.Marshal(body)
+
+				target := reflect.New(reflect.TypeOf(req).Elem()).Interface().(validatable)
+				json.Unmarshal(data, target)
+
+				if _, failed := target.Valid(context.Background())[field]; !failed {
+					t.Errorf("Expected missing %s to be invalid", field)
+				}
+			})
+		}
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	keys := mockstore.NewMockAPIKeyStore()
+	newKey := func(name string, scopes ...string) string {
+		secret, key, err := auth.NewAPIKey("acme", name, scopes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := keys.CreateAPIKey(context.Background(), key); err != nil {
+			t.Fatal(err)
+		}
+		return secret
+	}
+	reader := newKey("reader", auth.ScopeDevicesRead)
+	writer := newKey("writer", auth.ScopeDevicesRead, auth.ScopeDevicesWrite)
+	admin := newKey("admin", auth.Scopes...)
+
+	mock := mockstore.NewMockDeviceStore()
+	api := Api{
+		Router:        chi.NewMux(),
+		DeviceService: services.NewDeviceService(mock),
+		Authenticator: auth.Chain{auth.NewAPIKeyAuthenticator(keys)},
+	}
+	api.BindRoutes()
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		body          string
+		key           string
+		wantStatus    int
+		wantResponse  string
+		wantChallenge string
+	}{
+		{
+			name:          "No credentials",
+			method:        "GET",
+			path:          "/api/v1/devices",
+			wantStatus:    http.StatusUnauthorized,
+			wantResponse:  `"code":"unauthenticated"`,
+			wantChallenge: `Bearer realm="devices-api"`,
+		},
+		{
+			name:          "Invalid key",
+			method:        "GET",
+			path:          "/api/v1/devices",
+			key:           "dk_000000000000_secret",
+			wantStatus:    http.StatusUnauthorized,
+			wantResponse:  `"code":"invalid_credentials"`,
+			wantChallenge: `Bearer realm="devices-api"`,
+		},
+		{
+			name:          "Create without devices:write",
+			method:        "POST",
+			path:          "/api/v1/devices",
+			body:          `{"name": "Device A", "brand": "BrandX", "state": "available"}`,
+			key:           reader,
+			wantStatus:    http.StatusForbidden,
+			wantResponse:  `"detail":"insufficient scope: devices:write is required"`,
+			wantChallenge: `error="insufficient_scope", scope="devices:write"`,
+		},
+		{
+			name:         "Create with devices:write",
+			method:       "POST",
+			path:         "/api/v1/devices",
+			body:         `{"name": "Device A", "brand": "BrandX", "state": "available"}`,
+			key:          writer,
+			wantStatus:   http.StatusCreated,
+			wantResponse: `"name":"Device A"`,
+		},
+		{
+			name:         "Read with devices:read",
+			method:       "GET",
+			path:         "/api/v1/devices/1",
+			key:          reader,
+			wantStatus:   http.StatusOK,
+			wantResponse: `"name":"Device A"`,
+		},
+		{
+			name:         "Principal recorded as the actor",
+			method:       "GET",
+			path:         "/api/v1/devices/1/history",
+			key:          reader,
+			wantStatus:   http.StatusOK,
+			wantResponse: `"actor":"api-key:writer"`,
+		},
+		{
+			name:         "Delete without devices:delete",
+			method:       "DELETE",
+			path:         "/api/v1/devices/1",
+			key:          writer,
+			wantStatus:   http.StatusForbidden,
+			wantResponse: `"code":"insufficient_scope"`,
+		},
+		{
+			name:         "Batch delete without devices:delete",
+			method:       "POST",
+			path:         "/api/v1/devices:batch",
+			body:         `{"operations": [{"op": "delete", "id": 1}]}`,
+			key:          writer,
+			wantStatus:   http.StatusForbidden,
+			wantResponse: `"code":"insufficient_scope"`,
+		},
+		{
+			name:         "Export without devices:read",
+			method:       "GET",
+			path:         "/api/v1/devices/export",
+			key:          newKey("deleter", auth.ScopeDevicesDelete),
+			wantStatus:   http.StatusForbidden,
+			wantResponse: `"code":"insufficient_scope"`,
+		},
+		{
+			name:         "Delete with devices:delete",
+			method:       "DELETE",
+			path:         "/api/v1/devices/1",
+			key:          admin,
+			wantStatus:   http.StatusOK,
+			wantResponse: `"device_id":1`,
+		},
+		{
+			name:          "Deleted devices without admin",
+			method:        "GET",
+			path:          "/api/v1/devices?include_deleted=true",
+			key:           reader,
+			wantStatus:    http.StatusForbidden,
+			wantResponse:  `"detail":"insufficient scope: admin is required"`,
+			wantChallenge: `error="insufficient_scope", scope="admin"`,
+		},
+		{
+			name:         "Deleted devices exported without admin",
+			method:       "GET",
+			path:         "/api/v1/devices/export?include_deleted=true",
+			key:          reader,
+			wantStatus:   http.StatusForbidden,
+			wantResponse: `"code":"insufficient_scope"`,
+		},
+		{
+			name:         "Deleted devices with admin",
+			method:       "GET",
+			path:         "/api/v1/devices?include_deleted=true",
+			key:          admin,
+			wantStatus:   http.StatusOK,
+			wantResponse: `"deleted_at":`,
+		},
+		{
+			name:         "Documentation is public",
+			method:       "GET",
+			path:         "/api/openapi.json",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"securitySchemes"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Actor", "mallory")
+			req.Header.Set("X-Tenant-ID", "acme")
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+
+			rec := httptest.NewRecorder()
+			api.Router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+
+			if challenge := rec.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, tt.wantChallenge) {
+				t.Errorf("Expected WWW-Authenticate to contain '%s', got '%s'", tt.wantChallenge, challenge)
+			}
+		})
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	keys := mockstore.NewMockAPIKeyStore()
+	newKey := func(tenant, name string, scopes ...string) string {
+		secret, key, err := auth.NewAPIKey(tenant, name, scopes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := keys.CreateAPIKey(context.Background(), key); err != nil {
+			t.Fatal(err)
+		}
+		return secret
+	}
+	admin := newKey("acme", "admin", auth.Scopes...)
+	contractor := newKey("acme", "contractor", auth.ScopeDevicesRead, auth.ScopeDevicesWrite)
+	globexAdmin := newKey("globex", "admin", auth.Scopes...)
+
+	mock := mockstore.NewMockDeviceStore()
+	mock.CreateDevice(context.Background(), "acme", "Phone", "Acme", store.DeviceStateAvailable)
+	mock.CreateDevice(context.Background(), "acme", "Tablet", "Globex", store.DeviceStateAvailable)
+
+	access := services.NewAccessService(mockstore.NewMockAccessStore())
+	deviceService := services.NewDeviceService(mock)
+	deviceService.Access = access
+	api := Api{
+		Router:        chi.NewMux(),
+		DeviceService: deviceService,
+		AccessService: access,
+		Authenticator: auth.Chain{auth.NewAPIKeyAuthenticator(keys)},
+	}
+	api.BindRoutes()
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		key          string
+		tenant       string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "Admin endpoints need the admin scope",
+			method:       "GET",
+			path:         "/api/v1/admin/roles",
+			key:          contractor,
+			wantStatus:   http.StatusForbidden,
+			wantResponse: `"code":"insufficient_scope"`,
+		},
+		{
+			name:         "Create role with an unknown permission",
+			method:       "POST",
+			path:         "/api/v1/admin/roles",
+			body:         `{"name": "repairer", "permissions": ["devices:fly"]}`,
+			key:          admin,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantResponse: `"permissions"`,
+		},
+		{
+			name:         "Create role",
+			method:       "POST",
+			path:         "/api/v1/admin/roles",
+			body:         `{"name": "repairer", "permissions": ["devices:read", "devices:write"]}`,
+			key:          admin,
+			wantStatus:   http.StatusCreated,
+			wantResponse: `"name":"repairer"`,
+		},
+		{
+			name:         "Create duplicate role",
+			method:       "POST",
+			path:         "/api/v1/admin/roles",
+			body:         `{"name": "repairer", "permissions": ["devices:read"]}`,
+			key:          admin,
+			wantStatus:   http.StatusConflict,
+			wantResponse: `"code":"role_exists"`,
+		},
+		{
+			name:         "Grant a missing role",
+			method:       "POST",
+			path:         "/api/v1/admin/grants",
+			body:         `{"subject": "api-key:contractor", "role_id": 99, "brand": "Acme"}`,
+			key:          admin,
+			wantStatus:   http.StatusNotFound,
+			wantResponse: `"code":"role_not_found"`,
+		},
+		{
+			name:         "Grant the role on a brand",
+			method:       "POST",
+			path:         "/api/v1/admin/grants",
+			body:         `{"subject": "api-key:contractor", "role_id": 1, "brand": "Acme"}`,
+			key:          admin,
+			wantStatus:   http.StatusCreated,
+			wantResponse: `"role":"repairer"`,
+		},
+		{
+			name:         "List grants of a subject",
+			method:       "GET",
+			path:         "/api/v1/admin/grants?subject=api-key:contractor",
+			key:          admin,
+			wantStatus:   http.StatusOK,
+			wantResponse: `"brand":"Acme"`,
+		},
+		{
+			name:         "List the roles of another tenant",
+			method:       "GET",
+			path:         "/api/v1/admin/roles",
+			key:          globexAdmin,
+			tenant:       "globex",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"roles":[]`,
+		},
+		{
+			name:         "List only granted brands",
+			method:       "GET",
+			path:         "/api/v1/devices",
+			key:          contractor,
+			wantStatus:   http.StatusOK,
+			wantResponse: `"devices":[{"id":1,`,
+		},
+		{
+			name:         "Read a device of another brand",
+			method:       "GET",
+			path:         "/api/v1/devices/2",
+			key:          contractor,
+			wantStatus:   http.StatusNotFound,
+			wantResponse: `"code":"device_not_found"`,
+		},
+		{
+			name:         "Create a device of another brand",
+			method:       "POST",
+			path:         "/api/v1/devices",
+			body:         `{"name": "Laptop", "brand": "Globex", "state": "available"}`,
+			key:          contractor,
+			wantStatus:   http.StatusForbidden,
+			wantResponse: `"code":"forbidden"`,
+		},
+		{
+			name:         "Create a device of a granted brand",
+			method:       "POST",
+			path:         "/api/v1/devices",
+			body:         `{"name": "Laptop", "brand": "Acme", "state": "available"}`,
+			key:          contractor,
+			wantStatus:   http.StatusCreated,
+			wantResponse: `"brand":"Acme"`,
+		},
+		{
+			name:         "Invalid role id",
+			method:       "DELETE",
+			path:         "/api/v1/admin/roles/abc",
+			key:          admin,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"code":"invalid_id"`,
+		},
+		{
+			name:         "Delete role",
+			method:       "DELETE",
+			path:         "/api/v1/admin/roles/1",
+			key:          admin,
+			wantStatus:   http.StatusOK,
+			wantResponse: `"role_id":1`,
+		},
+		{
+			name:         "Delete missing grant",
+			method:       "DELETE",
+			path:         "/api/v1/admin/grants/1",
+			key:          admin,
+			wantStatus:   http.StatusNotFound,
+			wantResponse: `"code":"grant_not_found"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			req.Header.Set("X-Tenant-ID", cmp.Or(tt.tenant, "acme"))
+
+			rec := httptest.NewRecorder()
+			api.Router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+}
+
+// principals authenticates the bearer token as the principal it names.
+type principals map[string]auth.Principal
+
+func (p principals) Authenticate(r *http.Request) (auth.Principal, error) {
+	principal, ok := p[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	if !ok {
+		return auth.Principal{}, auth.ErrNoCredentials
+	}
+	return principal, nil
+}
+
+func TestTenantResolution(t *testing.T) {
+	mock := mockstore.NewMockDeviceStore()
+	mock.CreateDevice(context.Background(), "acme", "Phone", "Acme", store.DeviceStateAvailable)
+	mock.CreateDevice(context.Background(), "globex", "Tablet", "Globex", store.DeviceStateAvailable)
+	mock.CreateDevice(context.Background(), store.DefaultTenant, "Laptop", "Initech", store.DeviceStateAvailable)
+
+	keys := mockstore.NewMockAPIKeyStore()
+	serviceKey, key, err := auth.NewAPIKey("globex", "service", auth.Scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.CreateAPIKey(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+
+	api := Api{
+		Router:        chi.NewMux(),
+		DeviceService: services.NewDeviceService(mock),
+		Authenticator: auth.Chain{
+			auth.NewAPIKeyAuthenticator(keys),
+			principals{
+				"acme-user": {Subject: "alice", Scopes: auth.Scopes, Method: auth.MethodJWT, Tenant: "acme"},
+				"no-tenant": {Subject: "bob", Scopes: auth.Scopes, Method: auth.MethodJWT},
+			},
+		},
+	}
+	api.BindRoutes()
+	unauthenticated := Api{
+		Router:        chi.NewMux(),
+		DeviceService: services.NewDeviceService(mock),
+	}
+	unauthenticated.BindRoutes()
+
+	tests := []struct {
+		name         string
+		path         string
+		token        string
+		tenant       string
+		authDisabled bool
+		wantStatus   int
+		wantTenant   string
+		wantResponse string
+	}{
+		{
+			name:         "Tenant of the token",
+			path:         "/api/v1/devices/1",
+			token:        "acme-user",
+			wantStatus:   http.StatusOK,
+			wantTenant:   "acme",
+			wantResponse: `"name":"Phone"`,
+		},
+		{
+			name:         "Header repeating the tenant of the token",
+			path:         "/api/v1/devices/1",
+			token:        "acme-user",
+			tenant:       "acme",
+			wantStatus:   http.StatusOK,
+			wantTenant:   "acme",
+			wantResponse: `"name":"Phone"`,
+		},
+		{
+			name:         "Header naming another tenant than the token",
+			path:         "/api/v1/devices/2",
+			token:        "acme-user",
+			tenant:       "globex",
+			wantStatus:   http.StatusForbidden,
+			wantResponse: `"detail":"X-Tenant-ID does not match the tenant of the credentials"`,
+		},
+		{
+			name:         "Device of another tenant",
+			path:         "/api/v1/devices/2",
+			token:        "acme-user",
+			wantStatus:   http.StatusNotFound,
+			wantTenant:   "acme",
+			wantResponse: `"code":"device_not_found"`,
+		},
+		{
+			name:         "Token without a tenant",
+			path:         "/api/v1/devices",
+			token:        "no-tenant",
+			wantStatus:   http.StatusForbidden,
+			wantResponse: `"detail":"the token has no tenant_id claim"`,
+		},
+		{
+			name:         "API key without the header",
+			path:         "/api/v1/devices/2",
+			token:        serviceKey,
+			wantStatus:   http.StatusOK,
+			wantTenant:   "globex",
+			wantResponse: `"name":"Tablet"`,
+		},
+		{
+			name:         "API key with the header of its tenant",
+			path:         "/api/v1/devices/2",
+			token:        serviceKey,
+			tenant:       "globex",
+			wantStatus:   http.StatusOK,
+			wantTenant:   "globex",
+			wantResponse: `"name":"Tablet"`,
+		},
+		{
+			name:         "API key with the header of another tenant",
+			path:         "/api/v1/devices/1",
+			token:        serviceKey,
+			tenant:       "acme",
+			wantStatus:   http.StatusForbidden,
+			wantResponse: `"detail":"X-Tenant-ID does not match the tenant of the credentials"`,
+		},
+		{
+			name:         "Invalid header",
+			path:         "/api/v1/devices",
+			token:        serviceKey,
+			tenant:       "acme/../globex",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"code":"invalid_tenant"`,
+		},
+		{
+			name:         "Authentication off without the header",
+			path:         "/api/v1/devices/3",
+			authDisabled: true,
+			wantStatus:   http.StatusOK,
+			wantTenant:   store.DefaultTenant,
+			wantResponse: `"name":"Laptop"`,
+		},
+		{
+			name:         "Authentication off with the header",
+			path:         "/api/v1/devices/1",
+			tenant:       "acme",
+			authDisabled: true,
+			wantStatus:   http.StatusOK,
+			wantTenant:   "acme",
+			wantResponse: `"name":"Phone"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.tenant != "" {
+				req.Header.Set("X-Tenant-ID", tt.tenant)
+			}
+
+			rec := httptest.NewRecorder()
+			if tt.authDisabled {
+				unauthenticated.Router.ServeHTTP(rec, req)
+			} else {
+				api.Router.ServeHTTP(rec, req)
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if tenant := rec.Header().Get("X-Tenant-ID"); tenant != tt.wantTenant {
+				t.Errorf("Expected X-Tenant-ID '%s', got '%s'", tt.wantTenant, tenant)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("Expected response to contain '%s', got '%s'", tt.wantResponse, rec.Body)
+			}
+		})
+	}
+}
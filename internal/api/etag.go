@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+// setETag exposes the device version as a strong entity tag.
+func setETag(w http.ResponseWriter, device store.Device) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(int(device.Version))))
+}
+
+// ifMatchVersions returns the versions the If-Match header accepts, as RFC
+// 9110 reads it: nil when there is no precondition, either because the header
+// is missing or because it is "*", and otherwise the versions of its strong
+// tags. If-Match compares strongly, so weak tags, tags that are not ours and
+// a malformed header never match, leaving an empty list.
+func ifMatchVersions(r *http.Request) []int32 {
+	ifMatch := strings.TrimSpace(strings.Join(r.Header.Values("If-Match"), ","))
+	if ifMatch == "" || ifMatch == "*" {
+		return nil
+	}
+
+	versions := []int32{}
+	for rest := ifMatch; ; {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			return versions
+		}
+
+		weak := strings.HasPrefix(rest, "W/")
+		rest = strings.TrimPrefix(rest, "W/")
+		if !strings.HasPrefix(rest, `"`) {
+			return []int32{}
+		}
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return []int32{}
+		}
+		tag := rest[1 : end+1]
+		rest = rest[end+2:]
+		if weak {
+			continue
+		}
+
+		if version, err := strconv.ParseInt(tag, 10, 32); err == nil && version >= 1 {
+			versions = append(versions, int32(version))
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/xuri/excelize/v2"
+)
+
+// exportFlushEvery is the number of rows written between two flushes of the
+// response, so text exports reach the client while they are produced.
+const exportFlushEvery = 500
+
+var exportHeader = []string{"id", "name", "brand", "state", "created_at", "version"}
+
+// deviceExporter writes devices in one export format. Finish completes the
+// document; Close releases the exporter and must be called whether or not the
+// export finished.
+type deviceExporter interface {
+	Write(device store.Device) error
+	Finish() error
+	Close() error
+}
+
+var exportFormats = map[string]struct {
+	contentType string
+	newExporter func(w io.Writer) (deviceExporter, error)
+}{
+	"csv":    {"text/csv", newCSVExporter},
+	"ndjson": {"application/x-ndjson", newNDJSONExporter},
+	"xlsx":   {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", newXLSXExporter},
+}
+
+// escapeFormula keeps spreadsheets from evaluating a text cell as a formula,
+// by prefixing the characters that start one with a quote.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func exportRow(device store.Device) []string {
+	return []string{
+		strconv.Itoa(int(device.ID)),
+		escapeFormula(device.Name),
+		escapeFormula(device.Brand),
+		string(device.State),
+		device.CreatedAt.Format(time.RFC3339Nano),
+		strconv.Itoa(int(device.Version)),
+	}
+}
+
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func newCSVExporter(w io.Writer) (deviceExporter, error) {
+	e := &csvExporter{w: csv.NewWriter(w)}
+	return e, e.w.Write(exportHeader)
+}
+
+func (e *csvExporter) Write(device store.Device) error {
+	return e.w.Write(exportRow(device))
+}
+
+func (e *csvExporter) Finish() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExporter) Close() error {
+	return nil
+}
+
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func newNDJSONExporter(w io.Writer) (deviceExporter, error) {
+	return &ndjsonExporter{enc: json.NewEncoder(w)}, nil
+}
+
+func (e *ndjsonExporter) Write(device store.Device) error {
+	return e.enc.Encode(device)
+}
+
+func (e *ndjsonExporter) Finish() error {
+	return nil
+}
+
+func (e *ndjsonExporter) Close() error {
+	return nil
+}
+
+// xlsxExporter uses excelize's stream writer, which spills rows to a
+// temporary file instead of memory. A workbook is a zip archive that can only
+// be written once complete, so nothing reaches the client before Finish.
+// Close removes the temporary file.
+type xlsxExporter struct {
+	w      io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+func newXLSXExporter(w io.Writer) (deviceExporter, error) {
+	file := excelize.NewFile()
+	stream, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	e := &xlsxExporter{w: w, file: file, stream: stream, row: 1}
+	header := make([]any, len(exportHeader))
+	for i, column := range exportHeader {
+		header[i] = column
+	}
+	return e, e.writeRow(header)
+}
+
+func (e *xlsxExporter) Write(device store.Device) error {
+	return e.writeRow([]any{device.ID, escapeFormula(device.Name), escapeFormula(device.Brand), string(device.State), device.CreatedAt, device.Version})
+}
+
+func (e *xlsxExporter) writeRow(values []any) error {
+	cell, err := excelize.CoordinatesToCellName(1, e.row)
+	if err != nil {
+		return err
+	}
+	e.row++
+	return e.stream.SetRow(cell, values)
+}
+
+func (e *xlsxExporter) Finish() error {
+	if err := e.stream.Flush(); err != nil {
+		return err
+	}
+	return e.file.Write(e.w)
+}
+
+func (e *xlsxExporter) Close() error {
+	return e.file.Close()
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/danielllmuniz/devices-api/internal/auth"
+	"github.com/danielllmuniz/devices-api/internal/jsonutils"
+	"github.com/danielllmuniz/devices-api/internal/services"
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// auditContext tags the request context with the actor and request id that
+// the service records on device events. The actor is whatever the client
+// sends in X-Actor, until authenticate replaces it with the principal.
+func auditContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := services.WithActor(r.Context(), r.Header.Get("X-Actor"))
+		ctx = services.WithRequestID(ctx, middleware.GetReqID(ctx))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticationChallenge is the WWW-Authenticate header of 401 responses.
+const authenticationChallenge = `Bearer realm="devices-api"`
+
+// authenticate turns away requests without valid credentials and puts the
+// principal in the context, as the actor of the audit trail too.
+func (api *Api) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if api.Authenticator == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, err := api.Authenticator.Authenticate(r)
+		if err != nil {
+			if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+				w.Header().Set("WWW-Authenticate", authenticationChallenge)
+			}
+			writeError(w, r, err)
+			return
+		}
+
+		ctx := auth.WithPrincipal(r.Context(), principal)
+		ctx = services.WithActor(ctx, principal.Subject)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// maxTenantLength bounds the X-Tenant-ID header.
+const maxTenantLength = 63
+
+// resolveTenant confines the calls of the request to one tenant. A JWT names
+// it in its tenant_id claim and an API key acts for the tenant it was created
+// in; X-Tenant-ID may only repeat it. With authentication off the header is
+// optional and defaults to store.DefaultTenant. The tenant is echoed in the
+// X-Tenant-ID response header, so that a client relying on the default can
+// tell which tenant it got.
+func (api *Api) resolveTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("X-Tenant-ID")
+		if header != "" && !validTenant(header) {
+			writeProblem(w, r, newProblem(http.StatusBadRequest, CodeInvalidTenant, "Invalid tenant", fmt.Sprintf("X-Tenant-ID must be 1 to %d letters, digits, '.', '_' or '-'", maxTenantLength)))
+			return
+		}
+
+		tenant := header
+		principal, authenticated := auth.PrincipalFrom(r.Context())
+		switch {
+		case !authenticated:
+			if tenant == "" {
+				tenant = store.DefaultTenant
+			}
+		case principal.Tenant == "":
+			writeProblem(w, r, newProblem(http.StatusForbidden, CodeForbidden, "Forbidden", "the token has no tenant_id claim"))
+			return
+		case header != "" && header != principal.Tenant:
+			writeProblem(w, r, newProblem(http.StatusForbidden, CodeForbidden, "Forbidden", "X-Tenant-ID does not match the tenant of the credentials"))
+			return
+		default:
+			tenant = principal.Tenant
+		}
+
+		w.Header().Set("X-Tenant-ID", tenant)
+		next.ServeHTTP(w, r.WithContext(services.WithTenant(r.Context(), tenant)))
+	})
+}
+
+func validTenant(tenant string) bool {
+	if len(tenant) > maxTenantLength {
+		return false
+	}
+	for _, c := range tenant {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// requireScope turns away principals that were not granted scope. With
+// authentication off there is no principal and every request goes through.
+func (api *Api) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !api.authorize(w, r, scope) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authorize checks that the principal of r was granted scope. Otherwise it
+// writes the problem and returns false.
+func (api *Api) authorize(w http.ResponseWriter, r *http.Request, scope string) bool {
+	if api.Authenticator == nil {
+		return true
+	}
+
+	principal, _ := auth.PrincipalFrom(r.Context())
+	if err := principal.Require(scope); err != nil {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="devices-api", error="insufficient_scope", scope=%q`, scope))
+		writeError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// negotiate turns away requests whose Accept header matches none of the
+// formats jsonutils can write, before any work is done.
+func negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := jsonutils.Negotiate(r.Header.Get("Accept")); !ok {
+			writeProblem(w, r, newProblem(http.StatusNotAcceptable, CodeNotAcceptable, "Not acceptable", "responses are available as JSON, XML, MessagePack, CBOR or YAML"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// idempotent makes a mutating endpoint safe to retry. A request sent with an
+// Idempotency-Key header runs once; repeating it replays the stored status
+// and body, and reusing the key for a different request is rejected. Server
+// errors are not stored, so that the request can be retried.
+func (api *Api) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || api.IdempotencyService == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeProblem(w, r, newProblem(http.StatusBadRequest, CodeInvalidIdempotencyKey, "Invalid idempotency key", fmt.Sprintf("Idempotency-Key must not exceed %d characters", maxIdempotencyKeyLength)))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		if err != nil {
+			writeBodyError(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are only unique within a tenant, so a replay never hands one
+		// tenant the response to another.
+		key = services.TenantFrom(r.Context()) + "/" + key
+
+		stored, err := api.IdempotencyService.Begin(r.Context(), key, requestFingerprint(r, body))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if stored != nil {
+			w.Header().Set("Content-Type", stored.ContentType)
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.StatusCode)
+			w.Write(stored.Body)
+			return
+		}
+
+		// A client that timed out is the reason for the key, so its going
+		// away must not keep the response from being stored.
+		ctx := context.WithoutCancel(r.Context())
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := api.IdempotencyService.Release(ctx, key); err != nil {
+				logError(r, "release idempotency key", err)
+			}
+		}()
+
+		var response bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&response)
+		next.ServeHTTP(ww, r)
+
+		if status := ww.Status(); status != 0 && status < http.StatusInternalServerError {
+			if err := api.IdempotencyService.Complete(ctx, key, status, ww.Header().Get("Content-Type"), response.Bytes()); err != nil {
+				logError(r, "store idempotent response", err)
+				return
+			}
+			completed = true
+		}
+	})
+}
+
+// requestFingerprint identifies a request by its method, target, body and
+// media types. A replay sends back the stored body as it was encoded, so the
+// same body sent in or asking for another format is another request.
+func requestFingerprint(r *http.Request, body []byte) string {
+	contentType := jsonutils.JSON.MediaType
+	if header := r.Header.Get("Content-Type"); header != "" {
+		contentType = header
+		if mediaType, _, err := mime.ParseMediaType(header); err == nil {
+			contentType = mediaType
+		}
+	}
+	accept := ""
+	if format, ok := jsonutils.Negotiate(r.Header.Get("Accept")); ok {
+		accept = format.MediaType
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n%s %s\n", r.Method, r.URL.RequestURI(), contentType, accept)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,799 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/auth"
+	"github.com/danielllmuniz/devices-api/internal/jsonutils"
+	"github.com/danielllmuniz/devices-api/internal/store"
+	accessValidator "github.com/danielllmuniz/devices-api/internal/validator/access"
+	deviceValidator "github.com/danielllmuniz/devices-api/internal/validator/device"
+	"github.com/go-chi/chi/v5"
+)
+
+// The OpenAPI document is generated: paths come from the routes bound on the
+// router, each described by an entry in operations, and schemas are reflected
+// from the request and store types. Request constraints are read from the
+// schema struct tag of the validator requests, e.g.
+// `schema:"required,minLength=3,maxLength=255"` or `schema:"enum=a|b"`.
+
+//go:embed openapi_docs.html
+var openAPIDocsPage []byte
+
+// redocBundle renders the documentation page. It is vendored, see
+// redoc/LICENSE, so the page works without access to a CDN.
+//
+//go:embed redoc/redoc.standalone.js
+var redocBundle []byte
+
+type openAPISchema struct {
+	Ref         string                    `json:"$ref,omitempty"`
+	Type        any                       `json:"type,omitempty"`
+	Format      string                    `json:"format,omitempty"`
+	Description string                    `json:"description,omitempty"`
+	Enum        []string                  `json:"enum,omitempty"`
+	MinLength   *int                      `json:"minLength,omitempty"`
+	MaxLength   *int                      `json:"maxLength,omitempty"`
+	MinItems    *int                      `json:"minItems,omitempty"`
+	MaxItems    *int                      `json:"maxItems,omitempty"`
+	Items       *openAPISchema            `json:"items,omitempty"`
+	Properties  map[string]*openAPISchema `json:"properties,omitempty"`
+	Required    []string                  `json:"required,omitempty"`
+	OneOf       []*openAPISchema          `json:"oneOf,omitempty"`
+	// AdditionalProperties describes the values of maps.
+	AdditionalProperties *openAPISchema `json:"additionalProperties,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+}
+
+type openAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       map[string]string                       `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+// schemaRef points at a schema under components.
+func schemaRef(name string) *openAPISchema {
+	return &openAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+func objectSchema(properties map[string]*openAPISchema, required ...string) *openAPISchema {
+	return &openAPISchema{Type: "object", Properties: properties, Required: required}
+}
+
+func arraySchema(items *openAPISchema) *openAPISchema {
+	return &openAPISchema{Type: "array", Items: items}
+}
+
+func typeSchema(typ, format string) *openAPISchema {
+	return &openAPISchema{Type: typ, Format: format}
+}
+
+func nullable(schema *openAPISchema) *openAPISchema {
+	if schema.Ref != "" {
+		return &openAPISchema{OneOf: []*openAPISchema{schema, {Type: "null"}}}
+	}
+	nullableSchema := *schema
+	nullableSchema.Type = []any{schema.Type, "null"}
+	return &nullableSchema
+}
+
+// schemaGenerator reflects Go types into schemas, collecting named structs as
+// components.
+type schemaGenerator struct {
+	components map[string]*openAPISchema
+}
+
+// schemaValuer is implemented by field types that stand for another type on
+// the wire.
+type schemaValuer interface {
+	SchemaValue() any
+}
+
+var (
+	timeType         = reflect.TypeOf(time.Time{})
+	rawMessageType   = reflect.TypeOf(json.RawMessage(nil))
+	schemaValuerType = reflect.TypeOf((*schemaValuer)(nil)).Elem()
+)
+
+// knownEnums lists the values of the string types used in responses.
+var knownEnums = map[reflect.Type][]string{
+	reflect.TypeOf(store.DeviceState("")):       {string(store.DeviceStateAvailable), string(store.DeviceStateInUse), string(store.DeviceStateInactive)},
+	reflect.TypeOf(store.DeviceEventType("")):   enumValues(store.DeviceEventTypes),
+	reflect.TypeOf(store.ReservationStatus("")): enumValues(store.ReservationStatuses),
+}
+
+func enumValues[T ~string](values []T) []string {
+	enum := make([]string, len(values))
+	for i, value := range values {
+		enum[i] = string(value)
+	}
+	return enum
+}
+
+func (g *schemaGenerator) schemaFor(v any) *openAPISchema {
+	return g.schemaOf(reflect.TypeOf(v))
+}
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) *openAPISchema {
+	if t.Implements(schemaValuerType) {
+		return g.schemaOf(reflect.TypeOf(reflect.Zero(t).Interface().(schemaValuer).SchemaValue()))
+	}
+	if enum, ok := knownEnums[t]; ok {
+		return &openAPISchema{Type: "string", Enum: enum}
+	}
+
+	switch {
+	case t == timeType:
+		return typeSchema("string", "date-time")
+	case t == rawMessageType:
+		return &openAPISchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(g.schemaOf(t.Elem()))
+	case reflect.Bool:
+		return typeSchema("boolean", "")
+	case reflect.Int32, reflect.Uint16, reflect.Int16, reflect.Int8, reflect.Uint8:
+		return typeSchema("integer", "int32")
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return typeSchema("integer", "int64")
+	case reflect.Float32, reflect.Float64:
+		return typeSchema("number", "")
+	case reflect.String:
+		return typeSchema("string", "")
+	case reflect.Slice, reflect.Array:
+		return arraySchema(g.schemaOf(t.Elem()))
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := g.components[name]; !ok {
+			g.components[name] = nil // guards against recursive types
+			g.components[name] = g.structSchema(t)
+		}
+		return schemaRef(name)
+	default:
+		return &openAPISchema{}
+	}
+}
+
+// structSchema describes a struct by its json fields. Without schema tags,
+// every field that is not omitempty is required.
+func (g *schemaGenerator) structSchema(t reflect.Type) *openAPISchema {
+	schema := objectSchema(map[string]*openAPISchema{})
+
+	tagged := false
+	for i := range t.NumField() {
+		if _, ok := t.Field(i).Tag.Lookup("schema"); ok {
+			tagged = true
+		}
+	}
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldSchema := g.schemaOf(field.Type)
+		required := !tagged && !strings.Contains(options, "omitempty")
+		if tag, ok := field.Tag.Lookup("schema"); ok {
+			fieldSchema, required = applySchemaTag(fieldSchema, tag)
+		}
+
+		schema.Properties[name] = fieldSchema
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+// applySchemaTag adds the constraints of a schema struct tag to a copy of
+// schema.
+func applySchemaTag(schema *openAPISchema, tag string) (*openAPISchema, bool) {
+	constrained := *schema
+	required := false
+	for _, option := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(option, "=")
+		number, _ := strconv.Atoi(value)
+		switch key {
+		case "required":
+			required = true
+		case "minLength":
+			constrained.MinLength = &number
+		case "maxLength":
+			constrained.MaxLength = &number
+		case "minItems":
+			constrained.MinItems = &number
+		case "maxItems":
+			constrained.MaxItems = &number
+		case "enum":
+			constrained.Enum = strings.Split(value, "|")
+		}
+	}
+	return &constrained, required
+}
+
+// openAPIRoute describes one route; keys of operations are "METHOD pattern"
+// as bound on the router.
+type openAPIRoute struct {
+	summary string
+	tag     string
+	// scope is the scope the route requires, if any.
+	scope  string
+	params []openAPIParameter
+	// request maps content types to the request body, a Go value to reflect
+	// or an *openAPISchema.
+	request map[string]any
+	// responses maps status codes to a description and the JSON response, a
+	// Go value to reflect, an *openAPISchema or a map of content types for
+	// other formats.
+	responses map[int]openAPIRouteResponse
+}
+
+type openAPIRouteResponse struct {
+	description string
+	body        any
+}
+
+var (
+	deviceIDParam = openAPIParameter{Name: "device_id", In: "path", Required: true, Schema: typeSchema("integer", "int32")}
+	limitParam    = openAPIParameter{Name: "limit", In: "query", Description: "Page size, up to 500", Schema: typeSchema("integer", "int32")}
+	cursorParam   = openAPIParameter{Name: "cursor", In: "query", Description: "next_cursor of the previous page", Schema: typeSchema("string", "")}
+	ifMatchParam  = openAPIParameter{Name: "If-Match", In: "header", Description: "ETag of the device the change is based on", Schema: typeSchema("string", "")}
+	tenantParam   = openAPIParameter{Name: "X-Tenant-ID", In: "header", Description: "Tenant of the request when authentication is off; API keys and JWTs carry their own, which it may only repeat", Schema: &openAPISchema{Type: "string", MaxLength: ptrTo(maxTenantLength)}}
+	filterParams  = []openAPIParameter{
+		{Name: "brand", In: "query", Description: "Comma separated brands, case insensitive", Schema: typeSchema("string", "")},
+		{Name: "state", In: "query", Description: "Comma separated states", Schema: typeSchema("string", "")},
+		{Name: "name", In: "query", Description: "Substring of the name, case insensitive", Schema: typeSchema("string", "")},
+		{Name: "created_after", In: "query", Schema: typeSchema("string", "date-time")},
+		{Name: "created_before", In: "query", Schema: typeSchema("string", "date-time")},
+		{Name: "sort", In: "query", Description: "Comma separated list of " + strings.Join(store.SortableFields, ", ") + ", optionally prefixed with '-'", Schema: typeSchema("string", "")},
+		{Name: "include_deleted", In: "query", Description: "Also list deleted devices; requires the admin scope", Schema: typeSchema("boolean", "")},
+	}
+)
+
+func deviceResponse(description string, message bool) openAPIRouteResponse {
+	properties := map[string]*openAPISchema{"device": schemaRef("Device")}
+	required := []string{"device"}
+	if message {
+		properties["message"] = typeSchema("string", "")
+		required = append(required, "message")
+	}
+	return openAPIRouteResponse{description, objectSchema(properties, required...)}
+}
+
+func pageResponse(description, items string) openAPIRouteResponse {
+	return openAPIRouteResponse{description, objectSchema(map[string]*openAPISchema{
+		items:         arraySchema(schemaRef(strings.TrimSuffix(strings.ToUpper(items[:1])+items[1:], "s"))),
+		"next_cursor": nullable(typeSchema("string", "")),
+	}, items, "next_cursor")}
+}
+
+var jsonPatchSchema = arraySchema(objectSchema(map[string]*openAPISchema{
+	"op":    {Type: "string", Enum: []string{"add", "remove", "replace", "move", "copy", "test"}},
+	"path":  typeSchema("string", "json-pointer"),
+	"from":  typeSchema("string", "json-pointer"),
+	"value": {},
+}, "op", "path"))
+
+var operations = map[string]openAPIRoute{
+	"GET /api/openapi.json": {
+		summary:   "Get this OpenAPI document",
+		tag:       "docs",
+		responses: map[int]openAPIRouteResponse{http.StatusOK: {"The OpenAPI document", &openAPISchema{Type: "object"}}},
+	},
+	"GET /api/docs": {
+		summary:   "Browse the API documentation",
+		tag:       "docs",
+		responses: map[int]openAPIRouteResponse{http.StatusOK: {"An HTML page rendering the OpenAPI document", map[string]*openAPISchema{"text/html": typeSchema("string", "")}}},
+	},
+	"GET /api/docs/redoc.standalone.js": {
+		summary:   "Get the script of the documentation page",
+		tag:       "docs",
+		responses: map[int]openAPIRouteResponse{http.StatusOK: {"The Redoc bundle", map[string]*openAPISchema{"text/javascript": typeSchema("string", "")}}},
+	},
+	"GET /api/v1/devices/export": {
+		summary: "Export devices",
+		scope:   auth.ScopeDevicesRead,
+		params: append([]openAPIParameter{
+			{Name: "format", In: "query", Schema: &openAPISchema{Type: "string", Enum: []string{"csv", "ndjson", "xlsx"}}},
+		}, filterParams...),
+		responses: map[int]openAPIRouteResponse{http.StatusOK: {"Every matching device, streamed", map[string]*openAPISchema{
+			"text/csv":             typeSchema("string", ""),
+			"application/x-ndjson": typeSchema("string", ""),
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": typeSchema("string", "binary"),
+		}}},
+	},
+	"POST /api/v1/devices": {
+		summary: "Create a device",
+		scope:   auth.ScopeDevicesWrite,
+		params:  []openAPIParameter{{Name: "Idempotency-Key", In: "header", Description: "Makes retries replay the first response", Schema: &openAPISchema{Type: "string", MaxLength: ptrTo(maxIdempotencyKeyLength)}}},
+		request: map[string]any{"application/json": deviceValidator.CreateDeviceReq{}},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusCreated: deviceResponse("The created device", true),
+		},
+	},
+	"POST /api/v1/devices:batch": {
+		summary: "Run several operations at once",
+		scope:   auth.ScopeDevicesWrite,
+		params:  []openAPIParameter{{Name: "atomic", In: "query", Description: "Commit all operations or none", Schema: typeSchema("boolean", "")}},
+		request: map[string]any{"application/json": deviceValidator.BatchDevicesReq{}},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusMultiStatus: {"The result of every operation, in order", objectSchema(map[string]*openAPISchema{
+				"committed": typeSchema("boolean", ""),
+				"results": arraySchema(objectSchema(map[string]*openAPISchema{
+					"status":    typeSchema("integer", "int32"),
+					"device":    schemaRef("Device"),
+					"device_id": typeSchema("integer", "int32"),
+					"problem":   schemaRef("Problem"),
+				}, "status")),
+			}, "committed", "results")},
+		},
+	},
+	"POST /api/v1/devices/import": {
+		summary: "Import devices from CSV",
+		scope:   auth.ScopeDevicesWrite,
+		params:  []openAPIParameter{{Name: "dry_run", In: "query", Description: "Only validate the file", Schema: typeSchema("boolean", "")}},
+		request: map[string]any{"text/csv": typeSchema("string", "")},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: {"The import report", objectSchema(map[string]*openAPISchema{
+				"dry_run":  typeSchema("boolean", ""),
+				"valid":    typeSchema("integer", "int64"),
+				"imported": typeSchema("integer", "int64"),
+				"rejected": typeSchema("integer", "int64"),
+				"problems": arraySchema(schemaRef("RowProblem")),
+			}, "dry_run", "valid", "imported", "rejected", "problems")},
+		},
+	},
+	"GET /api/v1/devices": {
+		summary: "List devices",
+		scope:   auth.ScopeDevicesRead,
+		params:  append(slices.Clone(filterParams), limitParam, cursorParam),
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: pageResponse("A page of devices", "devices"),
+		},
+	},
+	"GET /api/v1/devices/{device_id}": {
+		summary:   "Get a device",
+		scope:     auth.ScopeDevicesRead,
+		params:    []openAPIParameter{deviceIDParam},
+		responses: map[int]openAPIRouteResponse{http.StatusOK: deviceResponse("The device", false)},
+	},
+	"GET /api/v1/devices/{device_id}/transitions": {
+		summary: "List the states a device can move to",
+		scope:   auth.ScopeDevicesRead,
+		params:  []openAPIParameter{deviceIDParam},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: {"The current state and the allowed next ones", objectSchema(map[string]*openAPISchema{
+				"device_id":   typeSchema("integer", "int32"),
+				"state":       schemaRef("DeviceState"),
+				"transitions": arraySchema(schemaRef("DeviceState")),
+			}, "device_id", "state", "transitions")},
+		},
+	},
+	"GET /api/v1/devices/{device_id}/history": {
+		summary: "List the changes of a device, newest first",
+		scope:   auth.ScopeDevicesRead,
+		params:  []openAPIParameter{deviceIDParam, limitParam, cursorParam},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: pageResponse("A page of events", "events"),
+		},
+	},
+	"PATCH /api/v1/devices/{device_id}": {
+		summary: "Patch a device",
+		scope:   auth.ScopeDevicesWrite,
+		params:  []openAPIParameter{deviceIDParam, ifMatchParam},
+		request: map[string]any{
+			"application/merge-patch+json": deviceValidator.PatchDeviceReq{},
+			"application/json":             deviceValidator.PatchDeviceReq{},
+			jsonPatchMediaType:             jsonPatchSchema,
+		},
+		responses: map[int]openAPIRouteResponse{http.StatusOK: deviceResponse("The patched device", true)},
+	},
+	"DELETE /api/v1/devices/{device_id}": {
+		summary: "Delete a device",
+		scope:   auth.ScopeDevicesDelete,
+		params:  []openAPIParameter{deviceIDParam},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: {"The device was deleted", objectSchema(map[string]*openAPISchema{
+				"message":   typeSchema("string", ""),
+				"device_id": typeSchema("integer", "int32"),
+			}, "message", "device_id")},
+		},
+	},
+	"PUT /api/v1/devices/{device_id}": {
+		summary:   "Replace a device",
+		scope:     auth.ScopeDevicesWrite,
+		params:    []openAPIParameter{deviceIDParam, ifMatchParam},
+		request:   map[string]any{"application/json": deviceValidator.UpdateDeviceReq{}},
+		responses: map[int]openAPIRouteResponse{http.StatusOK: deviceResponse("The updated device", true)},
+	},
+	"POST /api/v1/devices/{device_id}/restore": {
+		summary:   "Restore a deleted device",
+		scope:     auth.ScopeDevicesWrite,
+		params:    []openAPIParameter{deviceIDParam},
+		responses: map[int]openAPIRouteResponse{http.StatusOK: deviceResponse("The restored device", true)},
+	},
+	"POST /api/v1/devices/{device_id}/checkout": {
+		summary:   "Check a device out to an assignee",
+		scope:     auth.ScopeDevicesWrite,
+		params:    []openAPIParameter{deviceIDParam},
+		request:   map[string]any{"application/json": deviceValidator.CheckoutDeviceReq{}},
+		responses: map[int]openAPIRouteResponse{http.StatusOK: assignmentResponse("The device, now in use, and its assignment")},
+	},
+	"POST /api/v1/devices/{device_id}/checkin": {
+		summary:   "Check a device back in",
+		scope:     auth.ScopeDevicesWrite,
+		params:    []openAPIParameter{deviceIDParam},
+		responses: map[int]openAPIRouteResponse{http.StatusOK: assignmentResponse("The device, available again, and its closed assignment")},
+	},
+	"POST /api/v1/devices/{device_id}/reservations": {
+		summary: "Reserve a device for a time slot",
+		scope:   auth.ScopeDevicesWrite,
+		params:  []openAPIParameter{deviceIDParam},
+		request: map[string]any{"application/json": deviceValidator.ReserveDeviceReq{}},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusCreated: reservationResponse("The created reservation"),
+		},
+	},
+	"GET /api/v1/devices/{device_id}/reservations": {
+		summary: "List the reservations of a device, earliest slot first",
+		scope:   auth.ScopeDevicesRead,
+		params: []openAPIParameter{
+			deviceIDParam,
+			{Name: "status", In: "query", Description: "Comma separated statuses", Schema: typeSchema("string", "")},
+			{Name: "reserved_by", In: "query", Schema: typeSchema("string", "")},
+			limitParam,
+			cursorParam,
+		},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: pageResponse("A page of reservations", "reservations"),
+		},
+	},
+	"DELETE /api/v1/devices/{device_id}/reservations/{reservation_id}": {
+		summary: "Cancel a reservation",
+		scope:   auth.ScopeDevicesWrite,
+		params: []openAPIParameter{
+			deviceIDParam,
+			{Name: "reservation_id", In: "path", Required: true, Schema: typeSchema("integer", "int32")},
+		},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: reservationResponse("The canceled reservation"),
+		},
+	},
+	"GET /api/v1/assignments": {
+		summary: "List assignments, latest checkout first",
+		scope:   auth.ScopeDevicesRead,
+		params: append([]openAPIParameter{
+			{Name: "assignee", In: "query", Schema: typeSchema("string", "")},
+			{Name: "open", In: "query", Description: "Only the devices still checked out", Schema: typeSchema("boolean", "")},
+		}, assignmentParams...),
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: pageResponse("A page of assignments", "assignments"),
+		},
+	},
+	"GET /api/v1/assignees/{assignee_id}/devices": {
+		summary: "List the devices an assignee holds",
+		scope:   auth.ScopeDevicesRead,
+		params: append([]openAPIParameter{
+			{Name: "assignee_id", In: "path", Required: true, Schema: typeSchema("string", "")},
+		}, assignmentParams...),
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: pageResponse("A page of the open assignments of the assignee, with their device", "assignments"),
+		},
+	},
+	"GET /api/v1/admin/roles": {
+		summary: "List roles",
+		tag:     "admin",
+		scope:   auth.ScopeAdmin,
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: {"Every role", objectSchema(map[string]*openAPISchema{"roles": arraySchema(schemaRef("Role"))}, "roles")},
+		},
+	},
+	"POST /api/v1/admin/roles": {
+		summary:   "Create a role",
+		tag:       "admin",
+		scope:     auth.ScopeAdmin,
+		request:   map[string]any{"application/json": accessValidator.CreateRoleReq{}},
+		responses: map[int]openAPIRouteResponse{http.StatusCreated: roleResponse("The created role")},
+	},
+	"PUT /api/v1/admin/roles/{role_id}": {
+		summary:   "Replace the permissions of a role",
+		tag:       "admin",
+		scope:     auth.ScopeAdmin,
+		params:    []openAPIParameter{roleIDParam},
+		request:   map[string]any{"application/json": accessValidator.UpdateRoleReq{}},
+		responses: map[int]openAPIRouteResponse{http.StatusOK: roleResponse("The updated role")},
+	},
+	"DELETE /api/v1/admin/roles/{role_id}": {
+		summary: "Delete a role and its grants",
+		tag:     "admin",
+		scope:   auth.ScopeAdmin,
+		params:  []openAPIParameter{roleIDParam},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: {"The role was deleted", objectSchema(map[string]*openAPISchema{
+				"message": typeSchema("string", ""),
+				"role_id": typeSchema("integer", "int32"),
+			}, "message", "role_id")},
+		},
+	},
+	"GET /api/v1/admin/grants": {
+		summary: "List grants",
+		tag:     "admin",
+		scope:   auth.ScopeAdmin,
+		params:  []openAPIParameter{{Name: "subject", In: "query", Description: "Only the grants of this subject", Schema: typeSchema("string", "")}},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: {"The grants", objectSchema(map[string]*openAPISchema{"grants": arraySchema(schemaRef("Grant"))}, "grants")},
+		},
+	},
+	"POST /api/v1/admin/grants": {
+		summary: "Give a subject a role, on one brand or on all of them",
+		tag:     "admin",
+		scope:   auth.ScopeAdmin,
+		request: map[string]any{"application/json": accessValidator.CreateGrantReq{}},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusCreated: {"The created grant", objectSchema(map[string]*openAPISchema{
+				"message": typeSchema("string", ""),
+				"grant":   schemaRef("Grant"),
+			}, "message", "grant")},
+		},
+	},
+	"DELETE /api/v1/admin/grants/{grant_id}": {
+		summary: "Delete a grant",
+		tag:     "admin",
+		scope:   auth.ScopeAdmin,
+		params:  []openAPIParameter{{Name: "grant_id", In: "path", Required: true, Schema: typeSchema("integer", "int32")}},
+		responses: map[int]openAPIRouteResponse{
+			http.StatusOK: {"The grant was deleted", objectSchema(map[string]*openAPISchema{
+				"message":  typeSchema("string", ""),
+				"grant_id": typeSchema("integer", "int32"),
+			}, "message", "grant_id")},
+		},
+	},
+}
+
+var assignmentParams = []openAPIParameter{
+	{Name: "overdue", In: "query", Description: "Only the devices still out past their due date", Schema: typeSchema("boolean", "")},
+	{Name: "brand", In: "query", Description: "Comma separated brands, case insensitive", Schema: typeSchema("string", "")},
+	limitParam,
+	cursorParam,
+}
+
+func assignmentResponse(description string) openAPIRouteResponse {
+	return openAPIRouteResponse{description, objectSchema(map[string]*openAPISchema{
+		"message":    typeSchema("string", ""),
+		"device":     schemaRef("Device"),
+		"assignment": schemaRef("Assignment"),
+	}, "message", "device", "assignment")}
+}
+
+func reservationResponse(description string) openAPIRouteResponse {
+	return openAPIRouteResponse{description, objectSchema(map[string]*openAPISchema{
+		"message":     typeSchema("string", ""),
+		"reservation": schemaRef("Reservation"),
+	}, "message", "reservation")}
+}
+
+var roleIDParam = openAPIParameter{Name: "role_id", In: "path", Required: true, Schema: typeSchema("integer", "int32")}
+
+func roleResponse(description string) openAPIRouteResponse {
+	return openAPIRouteResponse{description, objectSchema(map[string]*openAPISchema{
+		"message": typeSchema("string", ""),
+		"role":    schemaRef("Role"),
+	}, "message", "role")}
+}
+
+// securitySchemes are the ways to authenticate.
+var securitySchemes = map[string]openAPISecurityScheme{
+	"apiKey": {
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "X-API-Key",
+		Description: "An API key, also accepted as a bearer token",
+	},
+	"bearer": {
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "A JWT signed with HS256 or RS256; scopes are read from the scope or scp claim",
+	},
+}
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
+
+// buildOpenAPI describes every route bound on the router. It fails on a route
+// without an entry in operations, so none can go undocumented.
+func (api *Api) buildOpenAPI() (*openAPIDocument, error) {
+	generator := &schemaGenerator{components: map[string]*openAPISchema{}}
+	generator.schemaFor(store.Device{})
+	generator.schemaFor(store.DeviceEvent{})
+	generator.schemaFor(store.Assignment{})
+	generator.schemaFor(store.Reservation{})
+	generator.schemaFor(deviceValidator.RowProblem{})
+	generator.schemaFor(Problem{})
+	generator.schemaFor(store.Role{})
+	generator.schemaFor(store.Grant{})
+	generator.components["DeviceState"] = generator.schemaFor(store.DeviceState(""))
+
+	doc := &openAPIDocument{
+		OpenAPI: "3.1.0",
+		Info: map[string]string{
+			"title":   "Devices API",
+			"version": "1.0.0",
+		},
+		Paths: map[string]map[string]*openAPIOperation{},
+		Components: openAPIComponents{
+			Schemas:         generator.components,
+			SecuritySchemes: securitySchemes,
+		},
+	}
+
+	err := chi.Walk(api.Router, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		spec, ok := operations[method+" "+route]
+		if !ok {
+			return fmt.Errorf("route %s %s has no OpenAPI operation", method, route)
+		}
+		if doc.Paths[route] == nil {
+			doc.Paths[route] = map[string]*openAPIOperation{}
+		}
+		doc.Paths[route][strings.ToLower(method)] = generator.operation(method, route, spec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (g *schemaGenerator) operation(method, route string, spec openAPIRoute) *openAPIOperation {
+	tag := spec.tag
+	params := spec.params
+	if tag == "" {
+		tag = "devices"
+	}
+	if tag != "docs" {
+		params = append(append([]openAPIParameter{}, params...), tenantParam)
+	}
+	operation := &openAPIOperation{
+		OperationID: operationID(method, route),
+		Summary:     spec.summary,
+		Tags:        []string{tag},
+		Parameters:  params,
+		Responses:   map[string]openAPIResponse{},
+	}
+
+	if len(spec.request) > 0 {
+		operation.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{}}
+		for contentType, body := range spec.request {
+			operation.RequestBody.Content[contentType] = openAPIMediaType{g.bodySchema(body)}
+		}
+	}
+
+	for status, response := range spec.responses {
+		content := map[string]openAPIMediaType{}
+		if types, ok := response.body.(map[string]*openAPISchema); ok {
+			for contentType, schema := range types {
+				content[contentType] = openAPIMediaType{schema}
+			}
+		} else {
+			// Every negotiated format carries the same fields.
+			for _, format := range jsonutils.Formats {
+				content[format.MediaType] = openAPIMediaType{g.bodySchema(response.body)}
+			}
+		}
+		operation.Responses[strconv.Itoa(status)] = openAPIResponse{Description: response.description, Content: content}
+	}
+
+	if spec.scope != "" {
+		// Either scheme will do.
+		operation.Security = []map[string][]string{{"apiKey": {spec.scope}}, {"bearer": {spec.scope}}}
+	}
+
+	problem := openAPIMediaType{schemaRef("Problem")}
+	operation.Responses["default"] = openAPIResponse{
+		Description: "An RFC 7807 problem",
+		Content:     map[string]openAPIMediaType{"application/problem+json": problem, "application/problem+xml": problem},
+	}
+	return operation
+}
+
+func (g *schemaGenerator) bodySchema(body any) *openAPISchema {
+	if schema, ok := body.(*openAPISchema); ok {
+		return schema
+	}
+	return g.schemaFor(body)
+}
+
+// operationID derives an id like "patch_devices_device_id" from the route.
+func operationID(method, route string) string {
+	route = strings.TrimPrefix(strings.TrimPrefix(route, "/api/v1"), "/api")
+	id := strings.NewReplacer("/", "_", ":", "_", ".", "_", "{", "", "}", "").Replace(route)
+	return strings.ToLower(method) + id
+}
+
+func (api *Api) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc, err := api.buildOpenAPI()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+func (api *Api) handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(openAPIDocsPage)
+}
+
+func (api *Api) handleDocsScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(redocBundle)
+}
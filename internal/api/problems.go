@@ -0,0 +1,249 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/danielllmuniz/devices-api/internal/auth"
+	"github.com/danielllmuniz/devices-api/internal/jsonutils"
+	"github.com/danielllmuniz/devices-api/internal/services"
+	"github.com/danielllmuniz/devices-api/internal/store"
+	deviceValidator "github.com/danielllmuniz/devices-api/internal/validator/device"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// errInvalidPatch aborts a patch whose result failed validation; the
+// problems are reported instead.
+var errInvalidPatch = errors.New("invalid patch")
+
+// Stable, machine-readable problem codes. Clients should branch on these
+// rather than on titles or details.
+const (
+	CodeUnauthenticated          = "unauthenticated"
+	CodeInvalidCredentials       = "invalid_credentials"
+	CodeInsufficientScope        = "insufficient_scope"
+	CodeForbidden                = "forbidden"
+	CodeTenantRequired           = "tenant_required"
+	CodeInvalidTenant            = "invalid_tenant"
+	CodeInvalidRequest           = "invalid_request"
+	CodeUnsupportedMedia         = "unsupported_media_type"
+	CodeRequestTooLarge          = "request_too_large"
+	CodeNotAcceptable            = "not_acceptable"
+	CodeInvalidDeviceID          = "invalid_device_id"
+	CodeInvalidID                = "invalid_id"
+	CodeInvalidQuery             = "invalid_query"
+	CodeInvalidCursor            = "invalid_cursor"
+	CodeValidationFailed         = "validation_failed"
+	CodeDeviceNotFound           = "device_not_found"
+	CodeDeviceInUse              = "device_in_use"
+	CodeDeviceNotDeleted         = "device_not_deleted"
+	CodeDeviceNotAvailable       = "device_not_available"
+	CodeDeviceNotCheckedOut      = "device_not_checked_out"
+	CodeDeviceCheckedOut         = "device_checked_out"
+	CodeDeviceReserved           = "device_reserved"
+	CodeReservationConflict      = "reservation_conflict"
+	CodeReservationNotFound      = "reservation_not_found"
+	CodeReservationEnded         = "reservation_ended"
+	CodeVersionMismatch          = "version_mismatch"
+	CodeIllegalTransition        = "illegal_transition"
+	CodePatchTestFailed          = "patch_test_failed"
+	CodeInvalidPatch             = "invalid_patch"
+	CodeBatchRolledBack          = "batch_rolled_back"
+	CodeInvalidIdempotencyKey    = "invalid_idempotency_key"
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+	CodeRoleNotFound             = "role_not_found"
+	CodeRoleExists               = "role_exists"
+	CodeGrantNotFound            = "grant_not_found"
+	CodeGrantExists              = "grant_exists"
+	CodeConflict                 = "conflict"
+	CodeUnavailable              = "service_unavailable"
+	CodeInternalError            = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details object. Errors holds per-field
+// messages for validation problems.
+type Problem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Code     string            `json:"code"`
+	Errors   map[string]string `json:"errors,omitempty"`
+	// Allowed lists the states the device can move to, for illegal
+	// transitions.
+	Allowed []store.DeviceState `json:"allowed,omitempty"`
+	// Offset is the byte offset in the request body where decoding failed.
+	Offset *int64 `json:"offset,omitempty"`
+}
+
+func newProblem(status int, code, title, detail string) Problem {
+	return Problem{
+		Type:   "urn:devices-api:problem:" + code,
+		Title:  title,
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// errorProblems maps service and store sentinel errors to their problem.
+// When detail is set it replaces the error message, which then only goes to
+// the logs; store errors wrap driver errors that clients should not see.
+var errorProblems = []struct {
+	err    error
+	status int
+	code   string
+	title  string
+	detail string
+}{
+	{auth.ErrNoCredentials, http.StatusUnauthorized, CodeUnauthenticated, "Authentication required", "send an API key or a bearer token"},
+	{auth.ErrInvalidCredentials, http.StatusUnauthorized, CodeInvalidCredentials, "Invalid credentials", "the API key or token is invalid, expired or revoked"},
+	{auth.ErrInsufficientScope, http.StatusForbidden, CodeInsufficientScope, "Insufficient scope", ""},
+	{services.ErrForbidden, http.StatusForbidden, CodeForbidden, "Forbidden", ""},
+	{services.ErrTenantRequired, http.StatusBadRequest, CodeTenantRequired, "Tenant required", "the request is not bound to a tenant"},
+	{services.ErrDeviceNotFound, http.StatusNotFound, CodeDeviceNotFound, "Device not found", ""},
+	{services.ErrDeviceInUse, http.StatusUnprocessableEntity, CodeDeviceInUse, "Device is in use", ""},
+	{services.ErrDeviceNotDeleted, http.StatusConflict, CodeDeviceNotDeleted, "Device is not deleted", ""},
+	{services.ErrDeviceNotAvailable, http.StatusConflict, CodeDeviceNotAvailable, "Device is not available", ""},
+	{services.ErrDeviceNotCheckedOut, http.StatusConflict, CodeDeviceNotCheckedOut, "Device is not checked out", ""},
+	{services.ErrDeviceCheckedOut, http.StatusConflict, CodeDeviceCheckedOut, "Device is checked out", ""},
+	{services.ErrDeviceReserved, http.StatusConflict, CodeDeviceReserved, "Device is reserved", ""},
+	{services.ErrReservationConflict, http.StatusConflict, CodeReservationConflict, "Reservation conflict", ""},
+	{services.ErrReservationNotFound, http.StatusNotFound, CodeReservationNotFound, "Reservation not found", ""},
+	{services.ErrReservationEnded, http.StatusConflict, CodeReservationEnded, "Reservation has ended", ""},
+	{services.ErrVersionMismatch, http.StatusPreconditionFailed, CodeVersionMismatch, "Device version does not match", ""},
+	{services.ErrIllegalTransition, http.StatusConflict, CodeIllegalTransition, "Illegal state transition", ""},
+	{deviceValidator.ErrPatchTestFailed, http.StatusConflict, CodePatchTestFailed, "Patch test failed", ""},
+	{deviceValidator.ErrPatchNotApplicable, http.StatusUnprocessableEntity, CodeInvalidPatch, "Patch cannot be applied", ""},
+	{services.ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, CodeIdempotencyKeyReused, "Idempotency key reused", ""},
+	{services.ErrIdempotencyKeyInProgress, http.StatusConflict, CodeIdempotencyKeyInProgress, "Idempotency key in progress", ""},
+	{services.ErrBatchRolledBack, http.StatusFailedDependency, CodeBatchRolledBack, "Batch rolled back", ""},
+	{services.ErrRoleNotFound, http.StatusNotFound, CodeRoleNotFound, "Role not found", ""},
+	{services.ErrRoleExists, http.StatusConflict, CodeRoleExists, "Role already exists", ""},
+	{services.ErrGrantNotFound, http.StatusNotFound, CodeGrantNotFound, "Grant not found", ""},
+	{services.ErrGrantExists, http.StatusConflict, CodeGrantExists, "Grant already exists", ""},
+	{store.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidCursor, "Invalid cursor", ""},
+	{store.ErrConflict, http.StatusConflict, CodeConflict, "Conflict", "the request conflicts with a concurrent change, try again"},
+	{store.ErrUnavailable, http.StatusServiceUnavailable, CodeUnavailable, "Service unavailable", "the database is unavailable, try again later"},
+}
+
+// ErrorForCode returns the sentinel error a problem code stands for, or nil
+// when the code has none. Clients use it to turn problems back into errors.
+func ErrorForCode(code string) error {
+	for _, known := range errorProblems {
+		if known.code == code {
+			return known.err
+		}
+	}
+	return nil
+}
+
+// problemFromError maps err to the problem sent to the client. Unknown
+// errors are logged and reported as a generic internal error. conditional
+// tells whether the write that failed was made on a version, from If-Match or
+// from the version of a batch item.
+func problemFromError(r *http.Request, err error, conditional bool) Problem {
+	for _, known := range errorProblems {
+		if !errors.Is(err, known.err) {
+			continue
+		}
+
+		detail := err.Error()
+		if known.detail != "" {
+			logError(r, known.title, err)
+			detail = known.detail
+		}
+
+		problem := newProblem(known.status, known.code, known.title, detail)
+		var illegal *services.IllegalTransitionError
+		if errors.As(err, &illegal) {
+			problem.Allowed = illegal.Allowed
+		}
+
+		// Without a version the client had no precondition to fail; the
+		// device simply changed under it.
+		if known.err == services.ErrVersionMismatch && !conditional {
+			problem.Status = http.StatusConflict
+		}
+		return problem
+	}
+
+	logError(r, "internal error", err)
+	return newProblem(http.StatusInternalServerError, CodeInternalError, "Internal server error", "something went wrong, try again later")
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, problem Problem) {
+	problem.Instance = middleware.GetReqID(r.Context())
+	jsonutils.EncodeProblem(w, r, problem.Status, problem)
+}
+
+// logError logs err alongside the request log, tagged with the request id
+// the problem reports as its instance.
+func logError(r *http.Request, msg string, err error) {
+	log.Printf("[%s] %s: %v", middleware.GetReqID(r.Context()), msg, err)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, r, problemFromError(r, err, false))
+}
+
+// writeConditionalError is writeError for a write made on the versions of
+// If-Match, nil when there were none.
+func writeConditionalError(w http.ResponseWriter, r *http.Request, err error, versions []int32) {
+	writeProblem(w, r, problemFromError(r, err, versions != nil))
+}
+
+// writeBodyError reports a body that could not be read or parsed, with 413
+// when it hit the http.MaxBytesReader cap.
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeProblem(w, r, newProblem(http.StatusRequestEntityTooLarge, CodeRequestTooLarge, "Request too large", fmt.Sprintf("body must not exceed %d bytes", tooLarge.Limit)))
+		return
+	}
+	writeProblem(w, r, newProblem(http.StatusBadRequest, CodeInvalidRequest, "Invalid request", err.Error()))
+}
+
+// writeDecodeError reports a body that could not be decoded, or decoded into
+// a request that failed validation.
+func writeDecodeError(w http.ResponseWriter, r *http.Request, problems map[string]string, err error) {
+	if errors.Is(err, jsonutils.ErrUnsupportedMediaType) {
+		writeProblem(w, r, newProblem(http.StatusUnsupportedMediaType, CodeUnsupportedMedia, "Unsupported media type", err.Error()))
+		return
+	}
+
+	var decodeErr *jsonutils.DecodeError
+	if errors.As(err, &decodeErr) {
+		if errors.Is(err, jsonutils.ErrBodyTooLarge) {
+			writeProblem(w, r, newProblem(http.StatusRequestEntityTooLarge, CodeRequestTooLarge, "Request too large", decodeErr.Reason))
+			return
+		}
+
+		problem := newProblem(http.StatusBadRequest, CodeInvalidRequest, "Invalid request", decodeErr.Error())
+		if decodeErr.Field != "" {
+			problem.Errors = map[string]string{decodeErr.Field: decodeErr.Reason}
+		}
+		if decodeErr.Offset >= 0 {
+			problem.Offset = &decodeErr.Offset
+		}
+		writeProblem(w, r, problem)
+		return
+	}
+
+	if problems == nil {
+		writeProblem(w, r, newProblem(http.StatusBadRequest, CodeInvalidRequest, "Invalid request", err.Error()))
+		return
+	}
+
+	problem := newProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "Validation failed", "one or more fields are invalid")
+	problem.Errors = problems
+	writeProblem(w, r, problem)
+}
+
+func writeInvalidDeviceID(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, newProblem(http.StatusBadRequest, CodeInvalidDeviceID, "Invalid device id", "device id must be an integer"))
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/danielllmuniz/devices-api/internal/jsonutils"
+	"github.com/danielllmuniz/devices-api/internal/store"
+	deviceValidator "github.com/danielllmuniz/devices-api/internal/validator/device"
+	"github.com/go-chi/chi/v5"
+)
+
+func (api *Api) handleCreateReservation(w http.ResponseWriter, r *http.Request) {
+	strDeviceID := chi.URLParam(r, "device_id")
+
+	intDeviceID, err := strconv.Atoi(strDeviceID)
+	if err != nil {
+		writeInvalidDeviceID(w, r)
+		return
+	}
+
+	data, problems, err := jsonutils.DecodeValid[deviceValidator.ReserveDeviceReq](r, decodeOptions(w)...)
+	if err != nil {
+		writeDecodeError(w, r, problems, err)
+		return
+	}
+
+	reservation, err := api.DeviceService.CreateReservation(r.Context(), int32(intDeviceID), store.Reservation{
+		StartsAt: data.StartsAt,
+		EndsAt:   data.EndsAt,
+		Note:     data.Note,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	jsonutils.Encode(w, r, http.StatusCreated, map[string]any{
+		"message":     "reservation created successfully",
+		"reservation": reservation,
+	})
+}
+
+func (api *Api) handleListReservations(w http.ResponseWriter, r *http.Request) {
+	strDeviceID := chi.URLParam(r, "device_id")
+
+	intDeviceID, err := strconv.Atoi(strDeviceID)
+	if err != nil {
+		writeInvalidDeviceID(w, r)
+		return
+	}
+
+	filter, problems := deviceValidator.ParseListReservationsQuery(int32(intDeviceID), r.URL.Query())
+	if len(problems) > 0 {
+		problem := newProblem(http.StatusBadRequest, CodeInvalidQuery, "Invalid query", "one or more query parameters are invalid")
+		problem.Errors = problems
+		writeProblem(w, r, problem)
+		return
+	}
+
+	reservations, err := api.DeviceService.ListReservations(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if reservations.Reservations == nil {
+		reservations.Reservations = []store.Reservation{}
+	}
+
+	var nextCursor *string
+	if reservations.NextCursor != nil {
+		encoded := reservations.NextCursor.Encode()
+		nextCursor = &encoded
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"reservations": reservations.Reservations,
+		"next_cursor":  nextCursor,
+	})
+}
+
+func (api *Api) handleCancelReservation(w http.ResponseWriter, r *http.Request) {
+	strDeviceID := chi.URLParam(r, "device_id")
+
+	intDeviceID, err := strconv.Atoi(strDeviceID)
+	if err != nil {
+		writeInvalidDeviceID(w, r)
+		return
+	}
+
+	id, ok := pathID(w, r, "reservation_id")
+	if !ok {
+		return
+	}
+
+	reservation, err := api.DeviceService.CancelReservation(r.Context(), int32(intDeviceID), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	jsonutils.Encode(w, r, http.StatusOK, map[string]any{
+		"message":     "reservation canceled successfully",
+		"reservation": reservation,
+	})
+}
@@ -1,21 +1,68 @@
 package api
 
 import (
+	"github.com/danielllmuniz/devices-api/internal/auth"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
 func (api *Api) BindRoutes() {
-	api.Router.Use(middleware.RequestID, middleware.Logger, middleware.Recoverer)
+	api.Router.Use(middleware.RequestID, middleware.Logger, middleware.Recoverer, auditContext)
 
 	api.Router.Route("/api", func(r chi.Router) {
+		r.Get("/openapi.json", api.handleOpenAPI)
+		r.Get("/docs", api.handleDocs)
+		r.Get("/docs/redoc.standalone.js", api.handleDocsScript)
+
 		r.Route("/v1", func(r chi.Router) {
-			r.Post("/devices", api.handleCreateDevice)
-			r.Get("/devices", api.handleGetAllDevices)
-			r.Get("/devices/{device_id}", api.handleGetDevice)
-			r.Patch("/devices/{device_id}", api.handlePatchDevice)
-			r.Delete("/devices/{device_id}", api.handleDeleteDevice)
-			r.Put("/devices/{device_id}", api.handleUpdateDevice)
+			r.Use(api.authenticate)
+			read := api.requireScope(auth.ScopeDevicesRead)
+			write := api.requireScope(auth.ScopeDevicesWrite)
+			remove := api.requireScope(auth.ScopeDevicesDelete)
+
+			r.Group(func(r chi.Router) {
+				r.Use(api.resolveTenant)
+
+				// Exports pick their format from the query string, not Accept.
+				r.With(read).Get("/devices/export", api.handleExportDevices)
+
+				r.Group(func(r chi.Router) {
+					r.Use(negotiate)
+
+					r.With(write, api.idempotent).Post("/devices", api.handleCreateDevice)
+					r.With(write).Post("/devices:batch", api.handleBatchDevices)
+					r.With(write).Post("/devices/import", api.handleImportDevices)
+					r.With(read).Get("/devices", api.handleGetAllDevices)
+					r.With(read).Get("/devices/{device_id}", api.handleGetDevice)
+					r.With(read).Get("/devices/{device_id}/transitions", api.handleGetDeviceTransitions)
+					r.With(read).Get("/devices/{device_id}/history", api.handleGetDeviceHistory)
+					r.With(write).Patch("/devices/{device_id}", api.handlePatchDevice)
+					r.With(remove).Delete("/devices/{device_id}", api.handleDeleteDevice)
+					r.With(write).Put("/devices/{device_id}", api.handleUpdateDevice)
+					r.With(write).Post("/devices/{device_id}/restore", api.handleRestoreDevice)
+					r.With(write).Post("/devices/{device_id}/checkout", api.handleCheckoutDevice)
+					r.With(write).Post("/devices/{device_id}/checkin", api.handleCheckinDevice)
+					r.With(write).Post("/devices/{device_id}/reservations", api.handleCreateReservation)
+					r.With(read).Get("/devices/{device_id}/reservations", api.handleListReservations)
+					r.With(write).Delete("/devices/{device_id}/reservations/{reservation_id}", api.handleCancelReservation)
+					r.With(read).Get("/assignments", api.handleListAssignments)
+					r.With(read).Get("/assignees/{assignee_id}/devices", api.handleGetAssigneeDevices)
+				})
+			})
+
+			if api.AccessService != nil {
+				r.Route("/admin", func(r chi.Router) {
+					r.Use(api.resolveTenant, api.requireScope(auth.ScopeAdmin), negotiate)
+
+					r.Get("/roles", api.handleListRoles)
+					r.Post("/roles", api.handleCreateRole)
+					r.Put("/roles/{role_id}", api.handleUpdateRole)
+					r.Delete("/roles/{role_id}", api.handleDeleteRole)
+					r.Get("/grants", api.handleListGrants)
+					r.Post("/grants", api.handleCreateGrant)
+					r.Delete("/grants/{grant_id}", api.handleDeleteGrant)
+				})
+			}
 		})
 	})
 }
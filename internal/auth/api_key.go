@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+// API keys look like dk_<prefix>_<secret>. The prefix finds the stored key,
+// whose hash the secret must match.
+const apiKeyTag = "dk_"
+
+// NewAPIKey generates a key named name granting scopes in tenantID. It
+// returns the key to hand to the client, which is not stored, and the record
+// to store.
+func NewAPIKey(tenantID, name string, scopes []string) (string, store.APIKey, error) {
+	if tenantID == "" {
+		return "", store.APIKey{}, errors.New("an API key needs a tenant")
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return "", store.APIKey{}, err
+	}
+
+	prefix := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(prefix); err != nil {
+		return "", store.APIKey{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", store.APIKey{}, err
+	}
+
+	key := store.APIKey{
+		TenantID: tenantID,
+		Name:     name,
+		Prefix:   hex.EncodeToString(prefix),
+		Scopes:   scopes,
+	}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	key.Hash = hashSecret(encodedSecret)
+	return apiKeyTag + key.Prefix + "_" + encodedSecret, key, nil
+}
+
+func hashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// APIKeyAuthenticator accepts the API keys in Store, sent in an X-API-Key
+// header or as a bearer token.
+type APIKeyAuthenticator struct {
+	Store store.APIKeyStore
+}
+
+func NewAPIKeyAuthenticator(store store.APIKeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{Store: store}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	token := r.Header.Get("X-API-Key")
+	if token == "" {
+		token = bearerToken(r)
+		if !strings.HasPrefix(token, apiKeyTag) {
+			return Principal{}, ErrNoCredentials
+		}
+	}
+
+	rest, tagged := strings.CutPrefix(token, apiKeyTag)
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !tagged || !ok {
+		return Principal{}, fmt.Errorf("%w: malformed API key", ErrInvalidCredentials)
+	}
+
+	key, err := a.Store.GetAPIKeyByPrefix(r.Context(), prefix)
+	if errors.Is(err, store.ErrNotFound) {
+		return Principal{}, fmt.Errorf("%w: unknown API key %s", ErrInvalidCredentials, prefix)
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	if subtle.ConstantTimeCompare(hashSecret(secret), key.Hash) != 1 {
+		return Principal{}, fmt.Errorf("%w: wrong secret for API key %s", ErrInvalidCredentials, prefix)
+	}
+	if key.Revoked() {
+		return Principal{}, fmt.Errorf("%w: API key %s is revoked", ErrInvalidCredentials, prefix)
+	}
+
+	return Principal{
+		Subject: "api-key:" + key.Name,
+		Scopes:  key.Scopes,
+		Method:  MethodAPIKey,
+		Tenant:  key.TenantID,
+	}, nil
+}
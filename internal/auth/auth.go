@@ -0,0 +1,116 @@
+// Package auth authenticates API requests and carries the authenticated
+// principal in the request context.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// The scopes API keys and tokens can grant.
+const (
+	ScopeDevicesRead   = "devices:read"
+	ScopeDevicesWrite  = "devices:write"
+	ScopeDevicesDelete = "devices:delete"
+	// ScopeAdmin allows managing roles and grants.
+	ScopeAdmin = "admin"
+)
+
+var Scopes = []string{ScopeDevicesRead, ScopeDevicesWrite, ScopeDevicesDelete, ScopeAdmin}
+
+var (
+	// ErrNoCredentials means the request carries no credentials the
+	// authenticator understands; another one may.
+	ErrNoCredentials      = errors.New("authentication required")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInsufficientScope  = errors.New("insufficient scope")
+)
+
+// How a principal authenticated.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// Principal is who a request is authenticated as.
+type Principal struct {
+	Subject string
+	Scopes  []string
+	Method  string
+	// Tenant is the tenant the principal acts for: the tenant_id claim of a
+	// JWT or the tenant an API key was created in.
+	Tenant string
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// Require returns an error wrapping ErrInsufficientScope unless p was
+// granted scope.
+func (p Principal) Require(scope string) error {
+	if !p.HasScope(scope) {
+		return fmt.Errorf("%w: %s is required", ErrInsufficientScope, scope)
+	}
+	return nil
+}
+
+type Authenticator interface {
+	// Authenticate returns the principal r is authenticated as. It returns
+	// ErrNoCredentials when r has no credentials for this authenticator, and
+	// an error wrapping ErrInvalidCredentials when they do not check out.
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// Chain tries each authenticator in turn until one finds credentials it
+// understands.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (Principal, error) {
+	for _, authenticator := range c {
+		principal, err := authenticator.Authenticate(r)
+		if !errors.Is(err, ErrNoCredentials) {
+			return principal, err
+		}
+	}
+	return Principal{}, ErrNoCredentials
+}
+
+// ValidateScopes checks that every scope is one of Scopes.
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("unknown scope %q, must be one of %s", scope, strings.Join(Scopes, ", "))
+		}
+	}
+	return nil
+}
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+// WithPrincipal returns a context carrying the authenticated principal.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFrom returns the principal of ctx; ok is false when the request
+// was not authenticated.
+func PrincipalFrom(ctx context.Context) (principal Principal, ok bool) {
+	principal, ok = ctx.Value(principalKey).(Principal)
+	return principal, ok
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
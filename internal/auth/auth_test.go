@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/danielllmuniz/devices-api/internal/store/mockstore"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requestWith(header, value string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/devices", nil)
+	if header != "" {
+		r.Header.Set(header, value)
+	}
+	return r
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	keys := mockstore.NewMockAPIKeyStore()
+	secret, key, err := NewAPIKey("acme", "ci", []string{ScopeDevicesRead})
+	require.NoError(t, err)
+	key, err = keys.CreateAPIKey(context.Background(), key)
+	require.NoError(t, err)
+
+	revokedSecret, revoked, err := NewAPIKey("acme", "old", []string{ScopeDevicesWrite})
+	require.NoError(t, err)
+	revoked, err = keys.CreateAPIKey(context.Background(), revoked)
+	require.NoError(t, err)
+	require.NoError(t, keys.RevokeAPIKey(context.Background(), "acme", revoked.ID))
+
+	a := NewAPIKeyAuthenticator(keys)
+
+	principal, err := a.Authenticate(requestWith("X-API-Key", secret))
+	require.NoError(t, err)
+	assert.Equal(t, Principal{Subject: "api-key:ci", Scopes: []string{ScopeDevicesRead}, Method: MethodAPIKey, Tenant: "acme"}, principal)
+
+	principal, err = a.Authenticate(requestWith("Authorization", "Bearer "+secret))
+	require.NoError(t, err)
+	assert.True(t, principal.HasScope(ScopeDevicesRead))
+	assert.ErrorIs(t, principal.Require(ScopeDevicesWrite), ErrInsufficientScope)
+
+	tests := []struct {
+		name          string
+		header, value string
+		wantErr       error
+	}{
+		{"No header", "", "", ErrNoCredentials},
+		{"Bearer token that is not a key", "Authorization", "Bearer eyJhbGciOi", ErrNoCredentials},
+		{"Wrong secret", "X-API-Key", "dk_" + key.Prefix + "_wrong", ErrInvalidCredentials},
+		{"Unknown prefix", "X-API-Key", "dk_000000000000_secret", ErrInvalidCredentials},
+		{"Malformed", "X-API-Key", "secret", ErrInvalidCredentials},
+		{"Revoked", "X-API-Key", revokedSecret, ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.Authenticate(requestWith(tt.header, tt.value))
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	keys.FailWith(store.ErrUnavailable)
+	_, err = a.Authenticate(requestWith("X-API-Key", secret))
+	assert.ErrorIs(t, err, store.ErrUnavailable)
+}
+
+func TestNewAPIKeyRejectsUnknownScopes(t *testing.T) {
+	_, _, err := NewAPIKey("acme", "ci", []string{"devices:admin"})
+	assert.ErrorContains(t, err, `unknown scope "devices:admin"`)
+}
+
+func TestNewAPIKeyRequiresATenant(t *testing.T) {
+	_, _, err := NewAPIKey("", "ci", []string{ScopeDevicesRead})
+	assert.ErrorContains(t, err, "needs a tenant")
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	hmacSecret := []byte("a secret that is long enough for HS256")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "oct", "kid": "shared", "k": encode(hmacSecret)},
+		{"kty": "RSA", "kid": "idp", "alg": "RS256", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+	}})
+	require.NoError(t, err)
+	a, err := NewJWTAuthenticator(jwks)
+	require.NoError(t, err)
+	a.Issuer = "https://idp.example.com"
+
+	sign := func(method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"sub": "jane", "iss": "https://idp.example.com", "exp": time.Now().Add(time.Hour).Unix()}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	principal, err := a.Authenticate(requestWith("Authorization", "Bearer "+sign(jwt.SigningMethodHS256, "shared", hmacSecret, claims(jwt.MapClaims{"scope": "devices:read devices:write", "tenant_id": "acme"}))))
+	require.NoError(t, err)
+	assert.Equal(t, Principal{Subject: "jane", Scopes: []string{ScopeDevicesRead, ScopeDevicesWrite}, Method: MethodJWT, Tenant: "acme"}, principal)
+
+	principal, err = a.Authenticate(requestWith("Authorization", "Bearer "+sign(jwt.SigningMethodRS256, "idp", rsaKey, claims(jwt.MapClaims{"scp": []string{"devices:delete"}}))))
+	require.NoError(t, err)
+	assert.Equal(t, []string{ScopeDevicesDelete}, principal.Scopes)
+
+	// An RSA public key must not verify an HMAC token signed with it.
+	publicKeyAsSecret := rsaKey.PublicKey.N.Bytes()
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"No token", "", ErrNoCredentials},
+		{"API key", "dk_abc_def", ErrNoCredentials},
+		{"Expired", sign(jwt.SigningMethodHS256, "shared", hmacSecret, claims(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})), ErrInvalidCredentials},
+		{"No expiry", sign(jwt.SigningMethodHS256, "shared", hmacSecret, jwt.MapClaims{"sub": "jane", "iss": "https://idp.example.com"}), ErrInvalidCredentials},
+		{"No subject", sign(jwt.SigningMethodHS256, "shared", hmacSecret, claims(jwt.MapClaims{"sub": ""})), ErrInvalidCredentials},
+		{"Wrong issuer", sign(jwt.SigningMethodHS256, "shared", hmacSecret, claims(jwt.MapClaims{"iss": "https://evil.example.com"})), ErrInvalidCredentials},
+		{"Wrong secret", sign(jwt.SigningMethodHS256, "shared", []byte("another secret of some length"), claims(nil)), ErrInvalidCredentials},
+		{"Unknown kid", sign(jwt.SigningMethodHS256, "other", hmacSecret, claims(nil)), ErrInvalidCredentials},
+		{"Algorithm confusion", sign(jwt.SigningMethodHS256, "idp", publicKeyAsSecret, claims(nil)), ErrInvalidCredentials},
+		{"Unsupported algorithm", sign(jwt.SigningMethodHS512, "shared", hmacSecret, claims(nil)), ErrInvalidCredentials},
+		{"Garbage", "not.a.jwt", ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := ""
+			if tt.token != "" {
+				header = "Authorization"
+			}
+			_, err := a.Authenticate(requestWith(header, "Bearer "+tt.token))
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestNewJWTAuthenticatorRejectsInvalidKeySets(t *testing.T) {
+	tests := []struct {
+		name string
+		jwks string
+	}{
+		{"Not JSON", `{`},
+		{"No keys", `{"keys": []}`},
+		{"Unsupported key type", `{"keys": [{"kty": "EC", "kid": "a"}]}`},
+		{"HMAC key for another algorithm", `{"keys": [{"kty": "oct", "alg": "HS512", "k": "c2VjcmV0"}]}`},
+		{"Several keys without kid", `{"keys": [{"kty": "oct", "k": "c2VjcmV0"}, {"kty": "oct", "kid": "b", "k": "c2VjcmV0"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJWTAuthenticator([]byte(tt.jwks))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	keys := mockstore.NewMockAPIKeyStore()
+	secret, key, err := NewAPIKey("acme", "ci", []string{ScopeDevicesRead})
+	require.NoError(t, err)
+	_, err = keys.CreateAPIKey(context.Background(), key)
+	require.NoError(t, err)
+	jwtAuthenticator, err := NewJWTAuthenticator([]byte(`{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`))
+	require.NoError(t, err)
+
+	chain := Chain{NewAPIKeyAuthenticator(keys), jwtAuthenticator}
+
+	principal, err := chain.Authenticate(requestWith("Authorization", "Bearer "+secret))
+	require.NoError(t, err)
+	assert.Equal(t, MethodAPIKey, principal.Method)
+
+	_, err = chain.Authenticate(requestWith("Authorization", "Bearer not.a.jwt"))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = chain.Authenticate(requestWith("", ""))
+	assert.ErrorIs(t, err, ErrNoCredentials)
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtLeeway absorbs clock skew between the issuer and this server.
+const jwtLeeway = 30 * time.Second
+
+// jsonWebKey holds the members of a JWK used by HS256 and RS256 keys.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// verificationKey is a key of the set with the algorithm it verifies.
+type verificationKey struct {
+	alg string
+	key any
+}
+
+// JWTAuthenticator accepts bearer JWTs signed with HS256 or RS256 by a key of
+// a JSON Web Key Set. Tokens must carry sub and exp; scopes come from the
+// space separated scope claim or the scp claim and the tenant from the
+// tenant_id claim.
+type JWTAuthenticator struct {
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+
+	keys map[string]verificationKey
+}
+
+// LoadJWTAuthenticator reads the key set from the JWKS file at path.
+func LoadJWTAuthenticator(path string) (*JWTAuthenticator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	a, err := NewJWTAuthenticator(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return a, nil
+}
+
+// NewJWTAuthenticator parses a JSON Web Key Set. Signing keys only meant for
+// encryption are skipped; with more than one key, each needs a kid.
+func NewJWTAuthenticator(jwks []byte) (*JWTAuthenticator, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(jwks, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	a := &JWTAuthenticator{keys: map[string]verificationKey{}}
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(jwk)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		if _, ok := a.keys[jwk.Kid]; ok {
+			return nil, fmt.Errorf("key %d: duplicate kid %q", i, jwk.Kid)
+		}
+		a.keys[jwk.Kid] = key
+	}
+	if len(a.keys) == 0 {
+		return nil, errors.New("JWKS has no signing keys")
+	}
+	if _, ok := a.keys[""]; ok && len(a.keys) > 1 {
+		return nil, errors.New("every key needs a kid when the JWKS has several")
+	}
+	return a, nil
+}
+
+func parseJWK(jwk jsonWebKey) (verificationKey, error) {
+	switch jwk.Kty {
+	case "oct":
+		if jwk.Alg != "" && jwk.Alg != "HS256" {
+			return verificationKey{}, fmt.Errorf("unsupported alg %q for an oct key", jwk.Alg)
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil || len(secret) == 0 {
+			return verificationKey{}, errors.New("invalid k")
+		}
+		return verificationKey{alg: "HS256", key: secret}, nil
+	case "RSA":
+		if jwk.Alg != "" && jwk.Alg != "RS256" {
+			return verificationKey{}, fmt.Errorf("unsupported alg %q for an RSA key", jwk.Alg)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil || len(n) == 0 {
+			return verificationKey{}, errors.New("invalid n")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return verificationKey{}, errors.New("invalid e")
+		}
+		key := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		return verificationKey{alg: "RS256", key: key}, nil
+	}
+	return verificationKey{}, fmt.Errorf("unsupported kty %q", jwk.Kty)
+}
+
+// scopeList is the scp claim, which issuers send as an array or as a space
+// separated string.
+type scopeList []string
+
+func (s *scopeList) UnmarshalJSON(data []byte) error {
+	var scope string
+	if err := json.Unmarshal(data, &scope); err == nil {
+		*s = strings.Fields(scope)
+		return nil
+	}
+	var scopes []string
+	if err := json.Unmarshal(data, &scopes); err != nil {
+		return err
+	}
+	*s = scopes
+	return nil
+}
+
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Scope    string    `json:"scope"`
+	Scp      scopeList `json:"scp"`
+	TenantID string    `json:"tenant_id"`
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	token := bearerToken(r)
+	if token == "" || strings.HasPrefix(token, apiKeyTag) {
+		return Principal{}, ErrNoCredentials
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if a.Issuer != "" {
+		options = append(options, jwt.WithIssuer(a.Issuer))
+	}
+	if a.Audience != "" {
+		options = append(options, jwt.WithAudience(a.Audience))
+	}
+
+	var claims jwtClaims
+	if _, err := jwt.ParseWithClaims(token, &claims, a.keyFor, options...); err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	if claims.Subject == "" {
+		return Principal{}, fmt.Errorf("%w: token has no sub claim", ErrInvalidCredentials)
+	}
+
+	scopes := append(strings.Fields(claims.Scope), claims.Scp...)
+	return Principal{Subject: claims.Subject, Scopes: scopes, Method: MethodJWT, Tenant: claims.TenantID}, nil
+}
+
+// keyFor picks the key named by the kid header, or the only key of a set
+// without kids. The key must be meant for the token's algorithm, so an RSA
+// public key is never used as an HMAC secret.
+func (a *JWTAuthenticator) keyFor(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := a.keys[kid]
+	if !ok {
+		key, ok = a.keys[""]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if key.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("key %q is not a %s key", kid, token.Method.Alg())
+	}
+	return key.key, nil
+}
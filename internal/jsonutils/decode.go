@@ -0,0 +1,174 @@
+package jsonutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// DecodeError describes why a request body could not be decoded. Field is the
+// dotted path of the offending field and Offset the byte offset in the body
+// where decoding stopped; they are empty and -1 when unknown.
+type DecodeError struct {
+	Field  string
+	Offset int64
+	Reason string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	var msg strings.Builder
+	msg.WriteString(e.Reason)
+	if e.Field != "" {
+		fmt.Fprintf(&msg, " (field %q)", e.Field)
+	}
+	if e.Offset >= 0 {
+		fmt.Fprintf(&msg, " at byte %d", e.Offset)
+	}
+	return msg.String()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+type decodeOptions struct {
+	disallowUnknownFields bool
+	disallowTrailingData  bool
+	w                     http.ResponseWriter
+	maxBytes              int64
+}
+
+// DecodeOption tunes DecodeValid.
+type DecodeOption func(*decodeOptions)
+
+// DisallowUnknownFields rejects bodies with fields the request type does not
+// have, instead of ignoring them.
+func DisallowUnknownFields() DecodeOption {
+	return func(o *decodeOptions) {
+		o.disallowUnknownFields = true
+	}
+}
+
+// DisallowTrailingData rejects JSON bodies with anything but whitespace after
+// the first value.
+func DisallowTrailingData() DecodeOption {
+	return func(o *decodeOptions) {
+		o.disallowTrailingData = true
+	}
+}
+
+// MaxBytes caps the size of the body with http.MaxBytesReader, which tells w
+// to close the connection once the cap is hit; larger bodies fail with
+// ErrBodyTooLarge.
+func MaxBytes(w http.ResponseWriter, n int64) DecodeOption {
+	return func(o *decodeOptions) {
+		o.w = w
+		o.maxBytes = n
+	}
+}
+
+// decodeJSON decodes a single JSON value from body into data, following the
+// options. offsets tells whether byte offsets refer to what the client sent.
+func decodeJSON(body []byte, data any, options decodeOptions, offsets bool) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if options.disallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+
+	err := dec.Decode(data)
+	if err == nil && options.disallowTrailingData {
+		if _, tokenErr := dec.Token(); !errors.Is(tokenErr, io.EOF) {
+			err = &DecodeError{Offset: dec.InputOffset(), Reason: "body must contain a single JSON value", Err: tokenErr}
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	decodeErr := jsonDecodeError(err, body)
+	if !offsets {
+		decodeErr.Offset = -1
+	}
+	return decodeErr
+}
+
+func jsonDecodeError(err error, body []byte) *DecodeError {
+	var (
+		decodeErr   *DecodeError
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+		maxBytesErr *http.MaxBytesError
+	)
+	switch {
+	case errors.As(err, &decodeErr):
+		return decodeErr
+	case errors.As(err, &maxBytesErr):
+		return &DecodeError{Offset: -1, Reason: fmt.Sprintf("body must not exceed %d bytes", maxBytesErr.Limit), Err: ErrBodyTooLarge}
+	case errors.As(err, &syntaxErr):
+		return &DecodeError{Offset: syntaxErr.Offset, Reason: "malformed JSON: " + syntaxErr.Error(), Err: err}
+	case errors.As(err, &typeErr):
+		return &DecodeError{Field: typeErr.Field, Offset: typeErr.Offset, Reason: fmt.Sprintf("value must be a %s, not a %s", typeErr.Type, typeErr.Value), Err: err}
+	case errors.Is(err, io.EOF):
+		return &DecodeError{Offset: 0, Reason: "body must not be empty", Err: err}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &DecodeError{Offset: int64(len(body)), Reason: "body ends in the middle of a JSON value", Err: err}
+	}
+
+	// The decoder reports unknown fields with a plain error only.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field, _ = strconv.Unquote(field)
+		return &DecodeError{Field: field, Offset: keyOffset(body, field), Reason: "unknown field", Err: err}
+	}
+	return &DecodeError{Offset: -1, Reason: err.Error(), Err: err}
+}
+
+// keyOffset returns the offset of the first object key named key in body, or
+// -1.
+func keyOffset(body []byte, key string) int64 {
+	type frame struct {
+		object  bool
+		wantKey bool
+	}
+	var stack []frame
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for {
+		start := dec.InputOffset()
+		token, err := dec.Token()
+		if err != nil {
+			return -1
+		}
+
+		if n := len(stack); n > 0 && stack[n-1].wantKey {
+			if name, ok := token.(string); ok {
+				if name == key {
+					// start is where the previous token ended; skip the
+					// separator and whitespace before the key.
+					return start + int64(bytes.IndexByte(body[start:], '"'))
+				}
+				stack[n-1].wantKey = false
+				continue
+			}
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			stack = append(stack, frame{object: token == json.Delim('{'), wantKey: token == json.Delim('{')})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+		}
+		// A value just ended; in an object a key comes next.
+		if n := len(stack); n > 0 && stack[n-1].object {
+			stack[n-1].wantKey = true
+		}
+	}
+}
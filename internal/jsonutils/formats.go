@@ -0,0 +1,214 @@
+package jsonutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a wire format the API speaks. Every format other than JSON works
+// on the generic value a JSON round trip produces (maps, slices, strings,
+// numbers and booleans), so all of them honor the json struct tags and render
+// the same fields.
+type Format struct {
+	MediaType string
+	// ProblemType is the media type of problem details, when the format has
+	// one of its own.
+	ProblemType string
+	aliases     []string
+	suffix      string
+	marshal     func(v any, root string) ([]byte, error)
+	// unmarshal decodes a body into a generic value. target is the type the
+	// value ends up in, for formats that cannot tell strings from numbers.
+	unmarshal func(body []byte, target reflect.Type) (any, error)
+}
+
+var cborDecMode, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+
+var (
+	JSON = &Format{
+		MediaType:   "application/json",
+		ProblemType: "application/problem+json",
+		suffix:      "+json",
+	}
+	XML = &Format{
+		MediaType:   "application/xml",
+		ProblemType: "application/problem+xml",
+		aliases:     []string{"text/xml"},
+		suffix:      "+xml",
+		marshal:     marshalXML,
+		unmarshal:   unmarshalXML,
+	}
+	MessagePack = &Format{
+		MediaType: "application/msgpack",
+		aliases:   []string{"application/x-msgpack", "application/vnd.msgpack"},
+		marshal: func(v any, _ string) ([]byte, error) {
+			return msgpack.Marshal(v)
+		},
+		unmarshal: func(body []byte, _ reflect.Type) (any, error) {
+			var v any
+			err := msgpack.Unmarshal(body, &v)
+			return v, err
+		},
+	}
+	CBOR = &Format{
+		MediaType: "application/cbor",
+		suffix:    "+cbor",
+		marshal: func(v any, _ string) ([]byte, error) {
+			return cbor.Marshal(v)
+		},
+		unmarshal: func(body []byte, _ reflect.Type) (any, error) {
+			var v any
+			err := cborDecMode.Unmarshal(body, &v)
+			return v, err
+		},
+	}
+	YAML = &Format{
+		MediaType: "application/yaml",
+		aliases:   []string{"application/x-yaml", "text/yaml", "text/x-yaml"},
+		suffix:    "+yaml",
+		marshal: func(v any, _ string) ([]byte, error) {
+			return yaml.Marshal(v)
+		},
+		unmarshal: func(body []byte, _ reflect.Type) (any, error) {
+			var v any
+			err := yaml.Unmarshal(body, &v)
+			return v, err
+		},
+	}
+)
+
+// Formats lists the supported formats; the first one is the default.
+var Formats = []*Format{JSON, XML, MessagePack, CBOR, YAML}
+
+// Marshal encodes v the way responses are encoded, outside of a request.
+func (f *Format) Marshal(v any) ([]byte, error) {
+	if f == JSON {
+		return json.Marshal(v)
+	}
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	return f.marshal(generic, "response")
+}
+
+func (f *Format) matches(mediaType string) bool {
+	return f.is(mediaType) || (f.suffix != "" && strings.HasSuffix(mediaType, f.suffix))
+}
+
+// is reports whether mediaType names the format or its problem type, leaving
+// out the structured syntax suffixes of other types built on it.
+func (f *Format) is(mediaType string) bool {
+	return mediaType == f.MediaType || (f.ProblemType != "" && mediaType == f.ProblemType) || slices.Contains(f.aliases, mediaType)
+}
+
+func formatFor(mediaType string) *Format {
+	for _, format := range Formats {
+		if format.matches(mediaType) {
+			return format
+		}
+	}
+	return nil
+}
+
+// Negotiate picks the response format from the Accept header, honoring
+// quality values. A missing header or a wildcard gets JSON. ok is false when
+// the client accepts none of the formats.
+func Negotiate(accept string) (format *Format, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		return JSON, true
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mediaType, q})
+		}
+	}
+	slices.SortStableFunc(ranges, func(a, b mediaRange) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+
+	for _, r := range ranges {
+		if r.mediaType == "*/*" || r.mediaType == "application/*" {
+			return JSON, true
+		}
+		if r.mediaType == "text/*" {
+			return XML, true
+		}
+		// Only exact types count: browsers accept application/xhtml+xml,
+		// which is not a request for XML responses.
+		for _, format := range Formats {
+			if format.is(r.mediaType) {
+				return format, true
+			}
+		}
+	}
+	return JSON, false
+}
+
+// toGeneric converts v to the value a JSON decoder would produce for its JSON
+// encoding, with integers kept as int64.
+func toGeneric(v any) (any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return normalizeNumbers(generic), nil
+}
+
+func normalizeNumbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = normalizeNumbers(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = normalizeNumbers(value)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
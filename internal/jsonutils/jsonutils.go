@@ -2,26 +2,92 @@ package jsonutils
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"reflect"
 
 	"github.com/danielllmuniz/devices-api/internal/validator"
 )
 
-func EncodeJson[T any](w http.ResponseWriter, r *http.Request, statusCode int, data T) error {
-	w.Header().Set("Content-Type", "Application/json")
-	w.WriteHeader(statusCode)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		return fmt.Errorf("failed to encode json %w", err)
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// Encode writes data in the format negotiated from the Accept header. Callers
+// are expected to have turned unacceptable requests away already; they get
+// JSON.
+func Encode[T any](w http.ResponseWriter, r *http.Request, statusCode int, data T) error {
+	format, _ := Negotiate(r.Header.Get("Accept"))
+	return encode(w, format, format.MediaType, "response", statusCode, data)
+}
+
+// EncodeProblem is Encode for RFC 7807 problem details, which have media
+// types of their own in JSON and XML.
+func EncodeProblem[T any](w http.ResponseWriter, r *http.Request, statusCode int, problem T) error {
+	format, _ := Negotiate(r.Header.Get("Accept"))
+	contentType := format.ProblemType
+	if contentType == "" {
+		contentType = format.MediaType
+	}
+	return encode(w, format, contentType, "problem", statusCode, problem)
+}
+
+func encode(w http.ResponseWriter, format *Format, contentType, root string, statusCode int, data any) error {
+	w.Header().Set("Content-Type", contentType)
+
+	if format == JSON {
+		w.WriteHeader(statusCode)
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			return fmt.Errorf("failed to encode json %w", err)
+		}
+		return nil
 	}
 
-	return nil
+	generic, err := toGeneric(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s %w", format.MediaType, err)
+	}
+	body, err := format.marshal(generic, root)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s %w", format.MediaType, err)
+	}
+	w.WriteHeader(statusCode)
+	_, err = w.Write(body)
+	return err
 }
 
-func DecodeValidJson[T validator.Validator](r *http.Request) (T, map[string]string, error) {
+// DecodeValid decodes the request body in the format named by its
+// Content-Type, JSON when there is none, and validates it. It returns
+// ErrUnsupportedMediaType for a format it does not speak and a *DecodeError
+// for a body it cannot decode. Without options unknown fields and trailing
+// data are ignored and the body size is not limited.
+func DecodeValid[T validator.Validator](r *http.Request, opts ...DecodeOption) (T, map[string]string, error) {
 	var data T
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		return data, nil, fmt.Errorf("decode json %w", err)
+
+	var options decodeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	format := JSON
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return data, nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, contentType)
+		}
+		if format = formatFor(mediaType); format == nil {
+			return data, nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+		}
+	}
+
+	var body io.Reader = r.Body
+	if options.maxBytes > 0 {
+		body = http.MaxBytesReader(options.w, r.Body, options.maxBytes)
+	}
+
+	if err := decode(body, format, &data, options); err != nil {
+		return data, nil, err
 	}
 
 	if problems := data.Valid(r.Context()); len(problems) > 0 {
@@ -30,3 +96,30 @@ func DecodeValidJson[T validator.Validator](r *http.Request) (T, map[string]stri
 
 	return data, nil, nil
 }
+
+func decode[T any](body io.Reader, format *Format, data *T, options decodeOptions) error {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return jsonDecodeError(err, nil)
+	}
+	if format == JSON {
+		return decodeJSON(raw, data, options, true)
+	}
+
+	if len(raw) == 0 {
+		return &DecodeError{Offset: 0, Reason: "body must not be empty", Err: io.EOF}
+	}
+	generic, err := format.unmarshal(raw, reflect.TypeOf(data).Elem())
+	if err != nil {
+		return &DecodeError{Offset: -1, Reason: fmt.Sprintf("malformed %s: %s", format.MediaType, err), Err: err}
+	}
+
+	// Going through JSON applies the json struct tags and the JSON decoding
+	// rules whatever the original format. Offsets into that JSON would mean
+	// nothing to the client.
+	raw, err = json.Marshal(generic)
+	if err != nil {
+		return fmt.Errorf("decode %s %w", format.MediaType, err)
+	}
+	return decodeJSON(raw, data, options, false)
+}
@@ -0,0 +1,181 @@
+package jsonutils
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danielllmuniz/devices-api/internal/validator"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type testReq struct {
+	Name  string   `json:"name"`
+	Count int32    `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+func (req testReq) Valid(ctx context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+	eval.CheckField(validator.NotBlank(req.Name), "name", "Name is required")
+	return eval
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept     string
+		wantFormat *Format
+		wantOK     bool
+	}{
+		{"", JSON, true},
+		{"*/*", JSON, true},
+		{"application/xml", XML, true},
+		{"text/html, application/yaml;q=0.5, application/cbor;q=0.9", CBOR, true},
+		{"application/problem+json", JSON, true},
+		{"application/x-msgpack", MessagePack, true},
+		{"application/json;q=0, application/xml", XML, true},
+		{"text/html", JSON, false},
+		{"text/xml", XML, true},
+		{"application/xhtml+xml", JSON, false},
+		{"application/atom+xml, application/json;q=0.5", JSON, true},
+		{"text/html,application/xhtml+xml,image/avif,*/*;q=0.8", JSON, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			format, ok := Negotiate(tt.accept)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantFormat.MediaType, format.MediaType)
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	data := map[string]any{"device": map[string]any{"id": 1, "name": "Device A"}, "tags": []string{"a", "b"}}
+
+	t.Run("XML", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", "application/xml")
+		rec := httptest.NewRecorder()
+
+		assert.NoError(t, Encode(rec, req, 200, data))
+		assert.Equal(t, "application/xml", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), "<response><device><id>1</id><name>Device A</name></device><tags><item>a</item><item>b</item></tags></response>")
+	})
+
+	t.Run("Problem as XML", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", "application/xml")
+		rec := httptest.NewRecorder()
+
+		assert.NoError(t, EncodeProblem(rec, req, 404, map[string]any{"code": "device_not_found"}))
+		assert.Equal(t, "application/problem+xml", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), "<problem><code>device_not_found</code></problem>")
+	})
+
+	t.Run("MessagePack", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", "application/msgpack")
+		rec := httptest.NewRecorder()
+
+		assert.NoError(t, Encode(rec, req, 200, data))
+		var decoded map[string]any
+		assert.NoError(t, msgpack.Unmarshal(rec.Body.Bytes(), &decoded))
+		assert.Equal(t, "Device A", decoded["device"].(map[string]any)["name"])
+	})
+}
+
+func TestDecodeValid(t *testing.T) {
+	msgpackBody, _ := msgpack.Marshal(map[string]any{"name": "Device A", "count": 2, "tags": []string{"a"}})
+	cborBody, _ := cbor.Marshal(map[string]any{"name": "Device A", "count": 2, "tags": []string{"a"}})
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     error
+	}{
+		{"JSON", "application/json", `{"name": "Device A", "count": 2, "tags": ["a"]}`, nil},
+		{"No content type", "", `{"name": "Device A", "count": 2, "tags": ["a"]}`, nil},
+		{"XML", "application/xml; charset=utf-8", `<request><name>Device A</name><count>2</count><tags><item>a</item></tags></request>`, nil},
+		{"YAML", "application/yaml", "name: Device A\ncount: 2\ntags: [a]\n", nil},
+		{"MessagePack", "application/msgpack", string(msgpackBody), nil},
+		{"CBOR", "application/cbor", string(cborBody), nil},
+		{"Unsupported", "text/plain", "name=Device A", ErrUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			data, problems, err := DecodeValid[testReq](req)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Nil(t, problems)
+			assert.Equal(t, testReq{Name: "Device A", Count: 2, Tags: []string{"a"}}, data)
+		})
+	}
+}
+
+func TestDecodeValidStrict(t *testing.T) {
+	strict := []DecodeOption{DisallowUnknownFields(), DisallowTrailingData(), MaxBytes(httptest.NewRecorder(), 64)}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		opts        []DecodeOption
+		wantErr     *DecodeError
+		wantTooBig  bool
+	}{
+		{"Lenient ignores unknown fields", "", `{"name": "Device A", "stat": "in-use"}`, nil, nil, false},
+		{"Lenient ignores trailing data", "", `{"name": "Device A"} {}`, nil, nil, false},
+		{"Strict", "", `{"name": "Device A"}` + "\n", strict, nil, false},
+		{"Unknown field", "", `{"name": "Device A", "stat": "in-use"}`, strict, &DecodeError{Field: "stat", Offset: 21, Reason: "unknown field"}, false},
+		{"Unknown field in YAML", "application/yaml", "name: Device A\nstat: in-use\n", strict, &DecodeError{Field: "stat", Offset: -1, Reason: "unknown field"}, false},
+		{"Trailing data", "", `{"name": "Device A"} {}`, strict, &DecodeError{Offset: 22, Reason: "body must contain a single JSON value"}, false},
+		{"Wrong type", "", `{"name": "Device A", "count": "2"}`, strict, &DecodeError{Field: "count", Offset: 33, Reason: "value must be a int32, not a string"}, false},
+		{"Syntax error", "", `{"name": "Device A",}`, strict, &DecodeError{Offset: 21}, false},
+		{"Empty body", "", ``, strict, &DecodeError{Offset: 0, Reason: "body must not be empty"}, false},
+		{"Truncated body", "", `{"name": "Devi`, strict, &DecodeError{Offset: 14, Reason: "body ends in the middle of a JSON value"}, false},
+		{"Too large", "", `{"name": "` + strings.Repeat("a", 100) + `"}`, strict, nil, true},
+		{"Too large YAML", "application/yaml", "name: " + strings.Repeat("a", 100), strict, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			_, _, err := DecodeValid[testReq](req, tt.opts...)
+			if tt.wantTooBig {
+				assert.ErrorIs(t, err, ErrBodyTooLarge)
+				return
+			}
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var decodeErr *DecodeError
+			if assert.ErrorAs(t, err, &decodeErr) {
+				assert.Equal(t, tt.wantErr.Field, decodeErr.Field)
+				assert.Equal(t, tt.wantErr.Offset, decodeErr.Offset)
+				if tt.wantErr.Reason != "" {
+					assert.Equal(t, tt.wantErr.Reason, decodeErr.Reason)
+				}
+			}
+		})
+	}
+}
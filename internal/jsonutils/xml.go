@@ -0,0 +1,196 @@
+package jsonutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// xmlItem names the elements of a list, which have no name of their own.
+const xmlItem = "item"
+
+// marshalXML renders a generic value as elements named after the map keys,
+// under a root element.
+func marshalXML(v any, root string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	if err := encodeXMLValue(enc, root, v); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func encodeXMLValue(enc *xml.Encoder, name string, v any) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	switch v := v.(type) {
+	case map[string]any:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if err := encodeXMLValue(enc, key, v[key]); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case []any:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, item := range v {
+			if err := encodeXMLValue(enc, xmlItem, item); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case nil:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		return enc.EncodeToken(start.End())
+	default:
+		return enc.EncodeElement(fmt.Sprint(v), start)
+	}
+}
+
+// xmlNode is an element read back from a request body.
+type xmlNode struct {
+	name     string
+	text     string
+	children []*xmlNode
+}
+
+// unmarshalXML reads the children of the root element. XML has no types, so
+// target decides whether a value is a string, a number, a boolean, an object
+// or a list; values without a known target are kept as strings.
+func unmarshalXML(body []byte, target reflect.Type) (any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: token.Name.Local}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			} else {
+				return nil, errors.New("xml must have a single root element")
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(token)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("xml has no root element")
+	}
+	return xmlValue(root, target)
+}
+
+// Types that decode their own JSON, like json.RawMessage, get the untyped
+// value.
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+func xmlValue(node *xmlNode, target reflect.Type) (any, error) {
+	for target != nil && target.Kind() == reflect.Pointer {
+		target = target.Elem()
+	}
+
+	if target == nil || target.Kind() == reflect.Interface || reflect.PointerTo(target).Implements(unmarshalerType) {
+		if len(node.children) == 0 {
+			return strings.TrimSpace(node.text), nil
+		}
+		return xmlObject(node, nil)
+	}
+
+	text := strings.TrimSpace(node.text)
+	switch target.Kind() {
+	case reflect.Struct:
+		return xmlObject(node, target)
+	case reflect.Map:
+		return xmlObject(node, nil)
+	case reflect.Slice, reflect.Array:
+		items := make([]any, 0, len(node.children))
+		for _, child := range node.children {
+			item, err := xmlValue(child, target.Elem())
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case reflect.Bool:
+		return strconv.ParseBool(text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(text, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(text, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(text, 64)
+	default:
+		return text, nil
+	}
+}
+
+// xmlObject turns the children of node into a map keyed by element name,
+// typing each value after the struct field with the same json name.
+func xmlObject(node *xmlNode, target reflect.Type) (map[string]any, error) {
+	object := make(map[string]any, len(node.children))
+	for _, child := range node.children {
+		var fieldType reflect.Type
+		if target != nil {
+			fieldType = jsonFieldType(target, child.name)
+		}
+		value, err := xmlValue(child, fieldType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", child.name, err)
+		}
+		object[child.name] = value
+	}
+	return object, nil
+}
+
+func jsonFieldType(target reflect.Type, name string) reflect.Type {
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == name || (tag == "" && strings.EqualFold(field.Name, name)) {
+			return field.Type
+		}
+	}
+	return nil
+}
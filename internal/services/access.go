@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/danielllmuniz/devices-api/internal/auth"
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+var (
+	ErrForbidden     = errors.New("forbidden")
+	ErrRoleNotFound  = errors.New("role not found")
+	ErrRoleExists    = errors.New("a role with this name already exists")
+	ErrGrantNotFound = errors.New("grant not found")
+	ErrGrantExists   = errors.New("the subject already has this role on this brand")
+)
+
+// Permissions are what roles grant. They are named after the scopes that
+// allow the same calls: a request needs both the scope and the permission.
+var Permissions = []string{auth.ScopeDevicesRead, auth.ScopeDevicesWrite, auth.ScopeDevicesDelete}
+
+// AccessService manages roles and brand scoped grants, and tells
+// DeviceService which devices the caller may touch.
+type AccessService struct {
+	Store store.AccessStore
+}
+
+func NewAccessService(store store.AccessStore) *AccessService {
+	return &AccessService{Store: store}
+}
+
+func (s *AccessService) CreateRole(ctx context.Context, name string, permissions []string) (store.Role, error) {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.Role{}, err
+	}
+	role, err := s.Store.CreateRole(ctx, tenantID, name, permissions)
+	if errors.Is(err, store.ErrConflict) {
+		return store.Role{}, ErrRoleExists
+	}
+	return role, err
+}
+
+func (s *AccessService) ListRoles(ctx context.Context) ([]store.Role, error) {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.ListRoles(ctx, tenantID)
+}
+
+func (s *AccessService) UpdateRole(ctx context.Context, id int32, permissions []string) (store.Role, error) {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.Role{}, err
+	}
+	role, err := s.Store.UpdateRole(ctx, tenantID, id, permissions)
+	if errors.Is(err, store.ErrNotFound) {
+		return store.Role{}, ErrRoleNotFound
+	}
+	return role, err
+}
+
+// DeleteRole removes the role along with its grants.
+func (s *AccessService) DeleteRole(ctx context.Context, id int32) error {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	err = s.Store.DeleteRole(ctx, tenantID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrRoleNotFound
+	}
+	return err
+}
+
+// CreateGrant gives subject the role on brand, or on every brand when brand
+// is empty.
+func (s *AccessService) CreateGrant(ctx context.Context, subject string, roleID int32, brand string) (store.Grant, error) {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.Grant{}, err
+	}
+	grant, err := s.Store.CreateGrant(ctx, tenantID, subject, roleID, brand)
+	if errors.Is(err, store.ErrNotFound) {
+		return store.Grant{}, ErrRoleNotFound
+	}
+	if errors.Is(err, store.ErrConflict) {
+		return store.Grant{}, ErrGrantExists
+	}
+	return grant, err
+}
+
+func (s *AccessService) ListGrants(ctx context.Context, subject string) ([]store.Grant, error) {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.ListGrants(ctx, tenantID, subject)
+}
+
+func (s *AccessService) DeleteGrant(ctx context.Context, id int32) error {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	err = s.Store.DeleteGrant(ctx, tenantID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrGrantNotFound
+	}
+	return err
+}
+
+// BrandAccess returns the brands on which the principal of ctx holds
+// permission in the tenant of ctx. Without a principal, when authentication
+// is off or for background jobs, nothing is restricted.
+func (s *AccessService) BrandAccess(ctx context.Context, permission string) (store.BrandAccess, error) {
+	principal, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return store.BrandAccess{All: true}, nil
+	}
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.BrandAccess{}, err
+	}
+	return s.Store.GetBrandAccess(ctx, tenantID, principal.Subject, permission)
+}
+
+// brandAccess returns where the caller holds permission; without an
+// AccessService every device is accessible.
+func (s *DeviceService) brandAccess(ctx context.Context, permission string) (store.BrandAccess, error) {
+	if s.Access == nil {
+		return store.BrandAccess{All: true}, nil
+	}
+	return s.Access.BrandAccess(ctx, permission)
+}
+
+// authorize returns an error wrapping ErrForbidden unless the caller holds
+// permission on every one of brands.
+func (s *DeviceService) authorize(ctx context.Context, permission string, brands ...string) error {
+	access, err := s.brandAccess(ctx, permission)
+	if err != nil {
+		return err
+	}
+	for _, brand := range brands {
+		if !allowsBrand(access, brand) {
+			return fmt.Errorf("%w: no grant of %s on brand %q", ErrForbidden, permission, brand)
+		}
+	}
+	return nil
+}
+
+// canRead reports whether the caller may read device. Devices it may not
+// read are reported as not found, so their existence does not leak.
+func (s *DeviceService) canRead(ctx context.Context, device store.Device) error {
+	err := s.authorize(ctx, auth.ScopeDevicesRead, device.Brand)
+	if errors.Is(err, ErrForbidden) {
+		return ErrDeviceNotFound
+	}
+	return err
+}
+
+// restrictToReadable narrows the brands of filter to those the caller may
+// read. It returns false when none is left, so that nothing can match.
+func (s *DeviceService) restrictToReadable(ctx context.Context, filter *store.DeviceFilter) (bool, error) {
+	access, err := s.brandAccess(ctx, auth.ScopeDevicesRead)
+	if err != nil || access.All {
+		return err == nil, err
+	}
+
+	if len(filter.Brands) == 0 {
+		filter.Brands = access.Brands
+	} else {
+		filter.Brands = slices.DeleteFunc(slices.Clone(filter.Brands), func(brand string) bool {
+			return !allowsBrand(access, brand)
+		})
+	}
+	return len(filter.Brands) > 0, nil
+}
+
+func allowsBrand(access store.BrandAccess, brand string) bool {
+	return access.All || slices.ContainsFunc(access.Brands, func(granted string) bool {
+		return strings.EqualFold(granted, brand)
+	})
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/auth"
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+var (
+	ErrDeviceNotAvailable  = errors.New("device is not available for checkout")
+	ErrDeviceNotCheckedOut = errors.New("device is not checked out")
+	ErrDeviceCheckedOut    = errors.New("device is checked out, check it in to change its state")
+)
+
+// Checkout describes who takes a device and until when. A nil DueAt leaves
+// the checkout open-ended.
+type Checkout struct {
+	Assignee string
+	DueAt    *time.Time
+	Note     string
+}
+
+// CheckoutDevice hands an available device to an assignee: it moves the
+// device to in-use and opens an assignment, both or neither. A checkout
+// cannot run into a reservation of the device, so an open-ended one is
+// refused while any is scheduled.
+func (s *DeviceService) CheckoutDevice(ctx context.Context, id int32, checkout Checkout) (store.Device, store.Assignment, error) {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.Device{}, store.Assignment{}, err
+	}
+
+	var (
+		deviceUpdated store.Device
+		assignment    store.Assignment
+	)
+	err = s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		device, err := tx.GetDeviceByIDForUpdate(ctx, tenantID, id)
+		if err != nil {
+			return deviceError(err)
+		}
+
+		if err := s.authorize(ctx, auth.ScopeDevicesWrite, device.Brand); err != nil {
+			return err
+		}
+
+		if device.State != store.DeviceStateAvailable {
+			return ErrDeviceNotAvailable
+		}
+		if err := s.Transitions.Check(device.State, store.DeviceStateInUse); err != nil {
+			return err
+		}
+		if err := checkNoReservationDuring(ctx, tx, tenantID, id, checkout.DueAt); err != nil {
+			return err
+		}
+
+		inUse := store.DeviceStateInUse
+		deviceUpdated, err = tx.PatchDevice(ctx, tenantID, id, device.Version, store.DevicePatch{State: &inUse})
+		if err != nil {
+			return err
+		}
+
+		assignment, err = tx.CreateAssignment(ctx, tenantID, store.Assignment{
+			DeviceID: id,
+			Assignee: checkout.Assignee,
+			DueAt:    checkout.DueAt,
+			Note:     checkout.Note,
+		})
+		if err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, tenantID, store.DeviceEventCheckedOut, id, &device, &deviceUpdated)
+	})
+	if err != nil {
+		return store.Device{}, store.Assignment{}, err
+	}
+	return deviceUpdated, assignment, nil
+}
+
+// CheckinDevice takes a checked out device back: it closes its assignment
+// and makes the device available again.
+func (s *DeviceService) CheckinDevice(ctx context.Context, id int32) (store.Device, store.Assignment, error) {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.Device{}, store.Assignment{}, err
+	}
+
+	var (
+		deviceUpdated store.Device
+		assignment    store.Assignment
+	)
+	err = s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		device, err := tx.GetDeviceByIDForUpdate(ctx, tenantID, id)
+		if err != nil {
+			return deviceError(err)
+		}
+
+		if err := s.authorize(ctx, auth.ScopeDevicesWrite, device.Brand); err != nil {
+			return err
+		}
+
+		open, err := tx.GetOpenAssignment(ctx, tenantID, id)
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrDeviceNotCheckedOut
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.Transitions.Check(device.State, store.DeviceStateAvailable); err != nil {
+			return err
+		}
+
+		available := store.DeviceStateAvailable
+		deviceUpdated, err = tx.PatchDevice(ctx, tenantID, id, device.Version, store.DevicePatch{State: &available})
+		if err != nil {
+			return err
+		}
+
+		assignment, err = tx.CloseAssignment(ctx, tenantID, open.ID)
+		if err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, tenantID, store.DeviceEventCheckedIn, id, &device, &deviceUpdated)
+	})
+	if err != nil {
+		return store.Device{}, store.Assignment{}, err
+	}
+	return deviceUpdated, assignment, nil
+}
+
+// ListAssignments pages through the assignments matching the filter, latest
+// checkout first, skipping the devices the caller may not read.
+func (s *DeviceService) ListAssignments(ctx context.Context, filter store.AssignmentFilter) (store.AssignmentPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultPageLimit
+	}
+	if filter.Limit > MaxPageLimit {
+		filter.Limit = MaxPageLimit
+	}
+
+	if err := filter.ValidateCursor(); err != nil {
+		return store.AssignmentPage{}, err
+	}
+
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.AssignmentPage{}, err
+	}
+
+	brands := store.DeviceFilter{Brands: filter.Brands}
+	readable, err := s.restrictToReadable(ctx, &brands)
+	if err != nil {
+		return store.AssignmentPage{}, err
+	}
+	if !readable {
+		return store.AssignmentPage{Assignments: []store.Assignment{}}, nil
+	}
+	filter.Brands = brands.Brands
+
+	return s.Store.ListAssignments(ctx, tenantID, filter)
+}
+
+// checkNotCheckedOut keeps a checked out device from leaving in-use other
+// than through a checkin, which would leave its assignment open.
+func checkNotCheckedOut(ctx context.Context, tx store.DeviceStore, tenantID string, device store.Device, state store.DeviceState) error {
+	if device.State != store.DeviceStateInUse || state == store.DeviceStateInUse {
+		return nil
+	}
+
+	_, err := tx.GetOpenAssignment(ctx, tenantID, device.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrDeviceCheckedOut
+}
+
+// checkNotReserved keeps a device held by an active reservation from leaving
+// in-use before the reservation ends or is canceled, which would let someone
+// else take it during the slot.
+func checkNotReserved(ctx context.Context, tx store.DeviceStore, tenantID string, device store.Device, state store.DeviceState) error {
+	if device.State != store.DeviceStateInUse || state == store.DeviceStateInUse {
+		return nil
+	}
+
+	page, err := tx.ListReservations(ctx, tenantID, store.ReservationFilter{
+		DeviceID: device.ID,
+		Statuses: []store.ReservationStatus{store.ReservationActive},
+		Limit:    1,
+	})
+	if err != nil {
+		return err
+	}
+	if len(page.Reservations) > 0 {
+		return ErrDeviceReserved
+	}
+	return nil
+}
+
+// checkNoReservationDuring refuses a checkout running until dueAt, or
+// open-ended when nil, while a reservation of the device is active or starts
+// before the device is due back.
+func checkNoReservationDuring(ctx context.Context, tx store.DeviceStore, tenantID string, deviceID int32, dueAt *time.Time) error {
+	page, err := tx.ListReservations(ctx, tenantID, store.ReservationFilter{
+		DeviceID:     deviceID,
+		Statuses:     []store.ReservationStatus{store.ReservationActive, store.ReservationScheduled, store.ReservationDelayed},
+		StartsBefore: dueAt,
+		Limit:        1,
+	})
+	if err != nil {
+		return err
+	}
+	if len(page.Reservations) > 0 {
+		return ErrReservationConflict
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	requestIDKey
+	tenantKey
+)
+
+// WithActor returns a context recording who is making the change, for the
+// audit trail.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+// WithRequestID returns a context recording the request that caused the
+// change, for the audit trail.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+func RequestIDFrom(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// recordEvent writes an audit event through tx, so it commits or rolls back
+// together with the change it describes.
+func recordEvent(ctx context.Context, tx store.DeviceStore, tenantID string, eventType store.DeviceEventType, id int32, oldDevice, newDevice *store.Device) error {
+	_, err := tx.CreateDeviceEvent(ctx, tenantID, newEvent(ctx, eventType, id, oldDevice, newDevice))
+	return err
+}
+
+func newEvent(ctx context.Context, eventType store.DeviceEventType, id int32, oldDevice, newDevice *store.Device) store.DeviceEvent {
+	return store.DeviceEvent{
+		DeviceID:  id,
+		Type:      eventType,
+		Old:       oldDevice,
+		New:       newDevice,
+		Actor:     ActorFrom(ctx),
+		RequestID: RequestIDFrom(ctx),
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+// ErrBatchRolledBack is reported for the items of an atomic batch that were
+// not applied because another item failed.
+var ErrBatchRolledBack = errors.New("batch rolled back because another operation failed")
+
+type BatchOp string
+
+const (
+	BatchCreate BatchOp = "create"
+	BatchUpdate BatchOp = "update"
+	BatchPatch  BatchOp = "patch"
+	BatchDelete BatchOp = "delete"
+)
+
+// BatchOperation is one item of a batch. ID and Version are ignored when
+// creating, and Version zero skips the version check like a missing If-Match.
+type BatchOperation struct {
+	Op      BatchOp
+	ID      int32
+	Version int32
+	Name    string
+	Brand   string
+	State   store.DeviceState
+	// Patch replaces Name, Brand and State for patch operations.
+	Patch store.DevicePatch
+}
+
+// versions is the precondition of the operation, none for Version zero.
+func (op BatchOperation) versions() []int32 {
+	if op.Version == 0 {
+		return nil
+	}
+	return []int32{op.Version}
+}
+
+// BatchResult holds the outcome of one operation: the device written, the id
+// deleted, or the error that stopped it.
+type BatchResult struct {
+	Device    store.Device
+	DeletedID int32
+	Err       error
+}
+
+// RunBatch applies every operation in order and reports each one on its own.
+// Without atomic, a failed operation does not stop the others. With atomic,
+// the whole batch runs in one transaction: the first failure rolls it back and
+// every other item is reported as ErrBatchRolledBack. It returns whether the
+// changes were committed.
+func (s *DeviceService) RunBatch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, bool) {
+	results := make([]BatchResult, len(ops))
+	if !atomic {
+		committed := false
+		for i, op := range ops {
+			results[i] = s.runBatchOperation(ctx, op)
+			committed = committed || results[i].Err == nil
+		}
+		return results, committed
+	}
+
+	failed := -1
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		for i := range results {
+			results[i] = BatchResult{Err: err}
+		}
+		return results, false
+	}
+	err = s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		txService := &DeviceService{Store: tx, Transitions: s.Transitions, Access: s.Access}
+		for i, op := range ops {
+			results[i] = txService.runBatchOperation(ctx, op)
+			if results[i].Err != nil {
+				failed = i
+				return results[i].Err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		return results, true
+	}
+
+	for i := range results {
+		if i != failed {
+			results[i] = BatchResult{Err: ErrBatchRolledBack}
+		}
+	}
+	if failed == -1 {
+		// The commit itself failed; report it on every item.
+		for i := range results {
+			results[i] = BatchResult{Err: err}
+		}
+	}
+	return results, false
+}
+
+func (s *DeviceService) runBatchOperation(ctx context.Context, op BatchOperation) BatchResult {
+	var result BatchResult
+	switch op.Op {
+	case BatchCreate:
+		result.Device, result.Err = s.CreateDevice(ctx, op.Name, op.Brand, op.State)
+	case BatchUpdate:
+		result.Device, result.Err = s.UpdateDevice(ctx, op.ID, op.versions(), op.Name, op.Brand, op.State)
+	case BatchPatch:
+		result.Device, result.Err = s.PatchDevice(ctx, op.ID, op.versions(), op.Patch)
+	case BatchDelete:
+		result.DeletedID, result.Err = s.DeleteDevice(ctx, op.ID)
+	default:
+		result.Err = errors.New("unknown batch operation " + string(op.Op))
+	}
+	return result
+}
@@ -3,7 +3,9 @@ package services
 import (
 	"context"
 	"errors"
+	"slices"
 
+	"github.com/danielllmuniz/devices-api/internal/auth"
 	"github.com/danielllmuniz/devices-api/internal/store"
 )
 
@@ -11,52 +13,180 @@ var (
 	ErrDeviceInUse         = errors.New("device is currently in use and cannot be modified or deleted")
 	ErrCannotUpdateCreated = errors.New("creation time cannot be updated")
 	ErrDeviceNotFound      = errors.New("device not found")
+	ErrVersionMismatch     = errors.New("device was modified, version does not match")
+	ErrDeviceNotDeleted    = errors.New("device is not deleted")
+)
+
+const (
+	DefaultPageLimit int32 = 50
+	MaxPageLimit     int32 = 500
 )
 
 type DeviceService struct {
-	Store store.DeviceStore
+	Store       store.DeviceStore
+	Transitions Transitions
+	// Access, when set, limits every call to the brands the caller holds a
+	// grant on: lists skip the others, reads report them as not found and
+	// changes fail with ErrForbidden.
+	Access *AccessService
 }
 
 func NewDeviceService(store store.DeviceStore) *DeviceService {
-	return &DeviceService{Store: store}
+	return &DeviceService{Store: store, Transitions: DefaultTransitions}
 }
 
 func (s *DeviceService) CreateDevice(ctx context.Context, name, brand string, state store.DeviceState) (store.Device, error) {
-	device, err := s.Store.CreateDevice(ctx, name, brand, state)
+	if err := s.authorize(ctx, auth.ScopeDevicesWrite, brand); err != nil {
+		return store.Device{}, err
+	}
+
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.Device{}, err
+	}
+
+	var device store.Device
+	err = s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		var err error
+		device, err = tx.CreateDevice(ctx, tenantID, name, brand, state)
+		if err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, tenantID, store.DeviceEventCreated, device.ID, nil, &device)
+	})
 	if err != nil {
 		return store.Device{}, err
 	}
 	return device, nil
 }
 
-func (s *DeviceService) UpdateDevice(ctx context.Context, id int32, name, brand string, state store.DeviceState) (store.Device, error) {
-	device, err := s.Store.GetDeviceByID(ctx, id)
+// UpdateDevice applies the change only if the device is still at one of
+// versions; nil versions skip that precondition. The in-use rule is checked against the row
+// locked inside the same transaction as the write, so a concurrent change
+// cannot slip past it.
+func (s *DeviceService) UpdateDevice(ctx context.Context, id int32, versions []int32, name, brand string, state store.DeviceState) (store.Device, error) {
+	tenantID, err := tenantOf(ctx)
 	if err != nil {
-		return store.Device{}, ErrDeviceNotFound
+		return store.Device{}, err
 	}
 
-	if device.State == store.DeviceStateInUse && (name != device.Name || brand != device.Brand) {
-		return store.Device{}, ErrDeviceInUse
-	}
+	var deviceUpdated store.Device
+	err = s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		device, err := tx.GetDeviceByIDForUpdate(ctx, tenantID, id)
+		if err != nil {
+			return deviceError(err)
+		}
 
-	deviceUpdated, err := s.Store.UpdateDevice(ctx, id, name, brand, state)
+		if err := s.authorize(ctx, auth.ScopeDevicesWrite, device.Brand, brand); err != nil {
+			return err
+		}
+
+		if versions != nil && !slices.Contains(versions, device.Version) {
+			return ErrVersionMismatch
+		}
+
+		if err := s.Transitions.Check(device.State, state); err != nil {
+			return err
+		}
+
+		if err := checkNotCheckedOut(ctx, tx, tenantID, device, state); err != nil {
+			return err
+		}
+		if err := checkNotReserved(ctx, tx, tenantID, device, state); err != nil {
+			return err
+		}
+
+		if device.State == store.DeviceStateInUse && (name != device.Name || brand != device.Brand) {
+			return ErrDeviceInUse
+		}
+
+		deviceUpdated, err = tx.UpdateDevice(ctx, tenantID, id, device.Version, name, brand, state)
+		if errors.Is(err, store.ErrVersionConflict) {
+			return ErrVersionMismatch
+		}
+		if err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, tenantID, store.DeviceEventUpdated, id, &device, &deviceUpdated)
+	})
 	if err != nil {
 		return store.Device{}, err
 	}
 	return deviceUpdated, nil
 }
 
-func (s *DeviceService) PatchDevice(ctx context.Context, id int32, name, brand string, state store.DeviceState) (store.Device, error) {
-	device, err := s.Store.GetDeviceByID(ctx, id)
+// PatchDevice applies patch, following the same version rules as
+// UpdateDevice.
+func (s *DeviceService) PatchDevice(ctx context.Context, id int32, versions []int32, patch store.DevicePatch) (store.Device, error) {
+	return s.PatchDeviceFunc(ctx, id, versions, func(store.Device) (store.DevicePatch, error) {
+		return patch, nil
+	})
+}
+
+// PatchDeviceFunc is PatchDevice for patches that depend on the current
+// device, like RFC 6902 ones: fn computes the patch from the device as locked
+// for the write. A patch that changes nothing writes nothing.
+func (s *DeviceService) PatchDeviceFunc(ctx context.Context, id int32, versions []int32, fn func(store.Device) (store.DevicePatch, error)) (store.Device, error) {
+	tenantID, err := tenantOf(ctx)
 	if err != nil {
-		return store.Device{}, ErrDeviceNotFound
+		return store.Device{}, err
 	}
 
-	if device.State == store.DeviceStateInUse && (name != device.Name || brand != device.Brand) {
-		return store.Device{}, ErrDeviceInUse
-	}
+	var deviceUpdated store.Device
+	err = s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		device, err := tx.GetDeviceByIDForUpdate(ctx, tenantID, id)
+		if err != nil {
+			return deviceError(err)
+		}
+
+		if err := s.authorize(ctx, auth.ScopeDevicesWrite, device.Brand); err != nil {
+			return err
+		}
+
+		if versions != nil && !slices.Contains(versions, device.Version) {
+			return ErrVersionMismatch
+		}
+
+		patch, err := fn(device)
+		if err != nil {
+			return err
+		}
+		if patch.IsEmpty() {
+			deviceUpdated = device
+			return nil
+		}
+
+		if patch.Brand != nil {
+			if err := s.authorize(ctx, auth.ScopeDevicesWrite, *patch.Brand); err != nil {
+				return err
+			}
+		}
+
+		if patch.State != nil {
+			if err := s.Transitions.Check(device.State, *patch.State); err != nil {
+				return err
+			}
+			if err := checkNotCheckedOut(ctx, tx, tenantID, device, *patch.State); err != nil {
+				return err
+			}
+			if err := checkNotReserved(ctx, tx, tenantID, device, *patch.State); err != nil {
+				return err
+			}
+		}
 
-	deviceUpdated, err := s.Store.PatchDevice(ctx, id, name, brand, state)
+		if device.State == store.DeviceStateInUse && ((patch.Name != nil && *patch.Name != device.Name) || (patch.Brand != nil && *patch.Brand != device.Brand)) {
+			return ErrDeviceInUse
+		}
+
+		deviceUpdated, err = tx.PatchDevice(ctx, tenantID, id, device.Version, patch)
+		if errors.Is(err, store.ErrVersionConflict) {
+			return ErrVersionMismatch
+		}
+		if err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, tenantID, store.DeviceEventPatched, id, &device, &deviceUpdated)
+	})
 	if err != nil {
 		return store.Device{}, err
 	}
@@ -64,50 +194,200 @@ func (s *DeviceService) PatchDevice(ctx context.Context, id int32, name, brand s
 }
 
 func (s *DeviceService) GetDeviceByID(ctx context.Context, id int32) (store.Device, error) {
-	device, err := s.Store.GetDeviceByID(ctx, id)
+	tenantID, err := tenantOf(ctx)
 	if err != nil {
-		return store.Device{}, ErrDeviceNotFound
+		return store.Device{}, err
+	}
+
+	device, err := s.Store.GetDeviceByID(ctx, tenantID, id)
+	if err != nil {
+		return store.Device{}, deviceError(err)
+	}
+	if err := s.canRead(ctx, device); err != nil {
+		return store.Device{}, err
 	}
 	return device, nil
 }
 
-func (s *DeviceService) GetAllDevices(ctx context.Context, brand string, state store.DeviceState) ([]store.Device, error) {
+// GetDeviceTransitions returns the device with the states it can move to next.
+func (s *DeviceService) GetDeviceTransitions(ctx context.Context, id int32) (store.Device, []store.DeviceState, error) {
+	device, err := s.GetDeviceByID(ctx, id)
+	if err != nil {
+		return store.Device{}, nil, err
+	}
+	return device, s.Transitions.Allowed(device.State), nil
+}
 
-	if brand != "" && state != "" {
-		devices, err := s.Store.GetDevicesByBrandAndState(ctx, brand, state)
-		if err != nil {
-			return nil, err
+func (s *DeviceService) ListDevices(ctx context.Context, filter store.DeviceFilter) (store.DevicePage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultPageLimit
+	}
+	if filter.Limit > MaxPageLimit {
+		filter.Limit = MaxPageLimit
+	}
+
+	if err := filter.ValidateCursor(); err != nil {
+		return store.DevicePage{}, err
+	}
+
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.DevicePage{}, err
+	}
+
+	readable, err := s.restrictToReadable(ctx, &filter)
+	if err != nil {
+		return store.DevicePage{}, err
+	}
+	if !readable {
+		return store.DevicePage{Devices: []store.Device{}}, nil
+	}
+
+	devices, err := s.Store.ListDevices(ctx, tenantID, filter)
+	if err != nil {
+		return store.DevicePage{}, err
+	}
+	return devices, nil
+}
+
+// ExportDevices streams every device matching the filter to fn.
+func (s *DeviceService) ExportDevices(ctx context.Context, filter store.DeviceFilter, fn func(store.Device) error) error {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	readable, err := s.restrictToReadable(ctx, &filter)
+	if err != nil || !readable {
+		return err
+	}
+	return s.Store.ExportDevices(ctx, tenantID, filter, fn)
+}
+
+// ListDeviceEvents pages through the history of a device, newest first. The
+// history outlives the device, so only a device without any event is reported
+// as not found.
+func (s *DeviceService) ListDeviceEvents(ctx context.Context, filter store.DeviceEventFilter) (store.DeviceEventPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultPageLimit
+	}
+	if filter.Limit > MaxPageLimit {
+		filter.Limit = MaxPageLimit
+	}
+
+	if err := filter.ValidateCursor(); err != nil {
+		return store.DeviceEventPage{}, err
+	}
+
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.DeviceEventPage{}, err
+	}
+
+	events, err := s.Store.ListDeviceEvents(ctx, tenantID, filter)
+	if err != nil {
+		return store.DeviceEventPage{}, err
+	}
+	if len(events.Events) == 0 && filter.After == nil {
+		return store.DeviceEventPage{}, ErrDeviceNotFound
+	}
+
+	if s.Access != nil && len(events.Events) > 0 {
+		// The newest event holds the latest brand of the device, even once
+		// it is deleted or purged.
+		newest := events.Events[0]
+		if filter.After != nil {
+			first, err := s.Store.ListDeviceEvents(ctx, tenantID, store.DeviceEventFilter{DeviceID: filter.DeviceID, Limit: 1})
+			if err != nil {
+				return store.DeviceEventPage{}, err
+			}
+			newest = first.Events[0]
 		}
-		return devices, nil
-	} else if brand != "" {
-		devices, err := s.Store.GetDevicesByBrand(ctx, brand)
+		snapshot := newest.New
+		if snapshot == nil {
+			snapshot = newest.Old
+		}
+		if snapshot != nil {
+			if err := s.canRead(ctx, *snapshot); err != nil {
+				return store.DeviceEventPage{}, err
+			}
+		}
+	}
+	return events, nil
+}
+
+func (s *DeviceService) DeleteDevice(ctx context.Context, id int32) (int32, error) {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var deletedID int32
+	err = s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		device, err := tx.GetDeviceByIDForUpdate(ctx, tenantID, id)
 		if err != nil {
-			return nil, err
+			return deviceError(err)
+		}
+
+		if err := s.authorize(ctx, auth.ScopeDevicesDelete, device.Brand); err != nil {
+			return err
 		}
-		return devices, nil
-	} else if state != "" {
-		devices, err := s.Store.GetDevicesByState(ctx, state)
+
+		if device.State == store.DeviceStateInUse {
+			return ErrDeviceInUse
+		}
+
+		deletedID, err = tx.DeleteDevice(ctx, tenantID, id)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		return devices, nil
-	}
-	devices, err := s.Store.GetAllDevices(ctx)
+		return recordEvent(ctx, tx, tenantID, store.DeviceEventDeleted, id, &device, nil)
+	})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	return devices, nil
+	return deletedID, nil
 }
 
-func (s *DeviceService) DeleteDevice(ctx context.Context, id int32) (int32, error) {
-	device, err := s.Store.GetDeviceByID(ctx, id)
+// RestoreDevice undoes a soft delete, as long as the device was not purged
+// yet.
+func (s *DeviceService) RestoreDevice(ctx context.Context, id int32) (store.Device, error) {
+	tenantID, err := tenantOf(ctx)
 	if err != nil {
-		return 0, ErrDeviceNotFound
+		return store.Device{}, err
 	}
 
-	if device.State == store.DeviceStateInUse {
-		return 0, ErrDeviceInUse
+	var restored store.Device
+	err = s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		var err error
+		restored, err = tx.RestoreDevice(ctx, tenantID, id)
+		if errors.Is(err, store.ErrNotFound) {
+			if _, err := tx.GetDeviceByID(ctx, tenantID, id); err != nil {
+				return deviceError(err)
+			}
+			return ErrDeviceNotDeleted
+		}
+		if err != nil {
+			return err
+		}
+		// Deleted devices cannot be read, so the brand is only known now;
+		// failing rolls the restore back.
+		if err := s.authorize(ctx, auth.ScopeDevicesWrite, restored.Brand); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, tenantID, store.DeviceEventRestored, id, nil, &restored)
+	})
+	if err != nil {
+		return store.Device{}, err
 	}
+	return restored, nil
+}
 
-	return s.Store.DeleteDevice(ctx, id)
+// deviceError reports a missing device as ErrDeviceNotFound and passes every
+// other store error through, so an outage is not mistaken for a 404.
+func deviceError(err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrDeviceNotFound
+	}
+	return err
 }
@@ -2,17 +2,24 @@ package services
 
 import (
 	"context"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/danielllmuniz/devices-api/internal/auth"
 	"github.com/danielllmuniz/devices-api/internal/store"
 	"github.com/danielllmuniz/devices-api/internal/store/mockstore"
 	"github.com/stretchr/testify/assert"
 )
 
 // setupTest consolidates the common test setup steps into a single helper.
+// testTenant is the tenant of the context returned by setupTest.
+const testTenant = "acme"
+
 func setupTest(t *testing.T) (context.Context, store.DeviceStore, *DeviceService) {
 	t.Helper()
-	ctx := context.Background()
+	ctx := WithTenant(context.Background(), testTenant)
 	mock := mockstore.NewMockDeviceStore()
 	svc := NewDeviceService(mock)
 	return ctx, mock, svc
@@ -41,7 +48,7 @@ func TestUpdateDevice(t *testing.T) {
 	assert.NoError(t, err)
 
 	t.Run("It_should_be_able_to_update_a_device_available", func(t *testing.T) {
-		deviceUpdated, err := svc.UpdateDevice(ctx, device.ID, "Device Updated", "Brand", store.DeviceStateInactive)
+		deviceUpdated, err := svc.UpdateDevice(ctx, device.ID, nil, "Device Updated", "Brand", store.DeviceStateInactive)
 		assert.NoError(t, err)
 		assert.Equal(t, "Device Updated", deviceUpdated.Name)
 		assert.Equal(t, store.DeviceStateInactive, deviceUpdated.State)
@@ -49,7 +56,7 @@ func TestUpdateDevice(t *testing.T) {
 	})
 
 	t.Run("It_should_be_able_to_update_a_device_inactive", func(t *testing.T) {
-		deviceUpdated, err := svc.UpdateDevice(ctx, device.ID, "Device Updated", "Brand2", store.DeviceStateAvailable)
+		deviceUpdated, err := svc.UpdateDevice(ctx, device.ID, nil, "Device Updated", "Brand2", store.DeviceStateAvailable)
 		assert.NoError(t, err)
 		assert.Equal(t, "Device Updated", deviceUpdated.Name)
 		assert.Equal(t, store.DeviceStateAvailable, deviceUpdated.State)
@@ -57,34 +64,62 @@ func TestUpdateDevice(t *testing.T) {
 	})
 
 	t.Run("It_should_not_be_able_to_update_name_if_device_in_use_state", func(t *testing.T) {
-		_, err := svc.UpdateDevice(ctx, device.ID, "Device Updated", "Brand3", store.DeviceStateInUse)
+		_, err := svc.UpdateDevice(ctx, device.ID, nil, "Device Updated", "Brand3", store.DeviceStateInUse)
 		assert.NoError(t, err)
 
-		_, err = svc.UpdateDevice(ctx, device.ID, "Device Updated2", "Brand3", store.DeviceStateInUse)
+		_, err = svc.UpdateDevice(ctx, device.ID, nil, "Device Updated2", "Brand3", store.DeviceStateInUse)
 		assert.ErrorIs(t, err, ErrDeviceInUse)
 	})
 
 	t.Run("It_should_not_be_able_to_update_brand_if_device_in_use_state", func(t *testing.T) {
-		_, err := svc.UpdateDevice(ctx, device.ID, "Device Updated", "Brand3", store.DeviceStateInUse)
+		_, err := svc.UpdateDevice(ctx, device.ID, nil, "Device Updated", "Brand3", store.DeviceStateInUse)
 		assert.NoError(t, err)
 
-		_, err = svc.UpdateDevice(ctx, device.ID, "Device Updated", "Brand4", store.DeviceStateInUse)
+		_, err = svc.UpdateDevice(ctx, device.ID, nil, "Device Updated", "Brand4", store.DeviceStateInUse)
 		assert.ErrorIs(t, err, ErrDeviceInUse)
 	})
 
 	t.Run("It_should_be_able_to_update_state_if_device_in_use_state", func(t *testing.T) {
-		_, err := svc.UpdateDevice(ctx, device.ID, "Device Updated", "Brand3", store.DeviceStateInUse)
+		_, err := svc.UpdateDevice(ctx, device.ID, nil, "Device Updated", "Brand3", store.DeviceStateInUse)
 		assert.NoError(t, err)
 
-		deviceUpdated, err := svc.UpdateDevice(ctx, device.ID, "Device Updated", "Brand3", store.DeviceStateInactive)
+		deviceUpdated, err := svc.UpdateDevice(ctx, device.ID, nil, "Device Updated", "Brand3", store.DeviceStateInactive)
 		assert.NoError(t, err)
 		assert.Equal(t, store.DeviceStateInactive, deviceUpdated.State)
 	})
 
 	t.Run("It_should_not_be_able_to_update_a_device_that_does_not_exist", func(t *testing.T) {
-		_, err := svc.UpdateDevice(ctx, 999, "Device D", "BrandZ", store.DeviceStateAvailable)
+		_, err := svc.UpdateDevice(ctx, 999, nil, "Device D", "BrandZ", store.DeviceStateAvailable)
 		assert.ErrorIs(t, err, ErrDeviceNotFound)
 	})
+
+	t.Run("It_should_be_able_to_update_a_device_at_the_expected_version", func(t *testing.T) {
+		current, err := svc.GetDeviceByID(ctx, device.ID)
+		assert.NoError(t, err)
+
+		deviceUpdated, err := svc.UpdateDevice(ctx, device.ID, []int32{current.Version}, "Device Updated", "Brand3", store.DeviceStateAvailable)
+		assert.NoError(t, err)
+		assert.Equal(t, current.Version+1, deviceUpdated.Version)
+	})
+
+	t.Run("It_should_not_be_able_to_update_a_device_at_a_stale_version", func(t *testing.T) {
+		_, err := svc.UpdateDevice(ctx, device.ID, []int32{1}, "Device Updated", "Brand3", store.DeviceStateInactive)
+		assert.ErrorIs(t, err, ErrVersionMismatch)
+	})
+
+	t.Run("It_should_be_able_to_update_a_device_at_any_of_the_expected_versions", func(t *testing.T) {
+		current, err := svc.GetDeviceByID(ctx, device.ID)
+		assert.NoError(t, err)
+
+		deviceUpdated, err := svc.UpdateDevice(ctx, device.ID, []int32{1, current.Version}, "Device Updated", "Brand3", store.DeviceStateInactive)
+		assert.NoError(t, err)
+		assert.Equal(t, current.Version+1, deviceUpdated.Version)
+	})
+
+	t.Run("It_should_not_be_able_to_update_a_device_when_no_version_is_expected", func(t *testing.T) {
+		_, err := svc.UpdateDevice(ctx, device.ID, []int32{}, "Device Updated", "Brand3", store.DeviceStateAvailable)
+		assert.ErrorIs(t, err, ErrVersionMismatch)
+	})
 }
 
 func TestPatchDevice(t *testing.T) {
@@ -94,7 +129,7 @@ func TestPatchDevice(t *testing.T) {
 	assert.NoError(t, err)
 
 	t.Run("It_should_be_able_to_patch_a_device_available", func(t *testing.T) {
-		deviceUpdated, err := svc.PatchDevice(ctx, device.ID, "Device Updated", "Brand", store.DeviceStateInactive)
+		deviceUpdated, err := svc.PatchDevice(ctx, device.ID, nil, devicePatch("Device Updated", "Brand", store.DeviceStateInactive))
 		assert.NoError(t, err)
 		assert.Equal(t, "Device Updated", deviceUpdated.Name)
 		assert.Equal(t, store.DeviceStateInactive, deviceUpdated.State)
@@ -102,7 +137,7 @@ func TestPatchDevice(t *testing.T) {
 	})
 
 	t.Run("It_should_be_able_to_patch_a_device_inactive", func(t *testing.T) {
-		deviceUpdated, err := svc.PatchDevice(ctx, device.ID, "Device Updated", "Brand2", store.DeviceStateAvailable)
+		deviceUpdated, err := svc.PatchDevice(ctx, device.ID, nil, devicePatch("Device Updated", "Brand2", store.DeviceStateAvailable))
 		assert.NoError(t, err)
 		assert.Equal(t, "Device Updated", deviceUpdated.Name)
 		assert.Equal(t, store.DeviceStateAvailable, deviceUpdated.State)
@@ -110,40 +145,45 @@ func TestPatchDevice(t *testing.T) {
 	})
 
 	t.Run("It_should_not_be_able_to_patch_name_if_device_in_use_state", func(t *testing.T) {
-		_, err := svc.PatchDevice(ctx, device.ID, "Device Updated", "Brand3", store.DeviceStateInUse)
+		_, err := svc.PatchDevice(ctx, device.ID, nil, devicePatch("Device Updated", "Brand3", store.DeviceStateInUse))
 		assert.NoError(t, err)
 
-		_, err = svc.PatchDevice(ctx, device.ID, "Device Updated2", "Brand3", store.DeviceStateInUse)
+		_, err = svc.PatchDevice(ctx, device.ID, nil, devicePatch("Device Updated2", "Brand3", store.DeviceStateInUse))
 		assert.ErrorIs(t, err, ErrDeviceInUse)
 	})
 
 	t.Run("It_should_not_be_able_to_patch_brand_if_device_in_use_state", func(t *testing.T) {
-		_, err := svc.PatchDevice(ctx, device.ID, "Device Updated", "Brand3", store.DeviceStateInUse)
+		_, err := svc.PatchDevice(ctx, device.ID, nil, devicePatch("Device Updated", "Brand3", store.DeviceStateInUse))
 		assert.NoError(t, err)
 
-		_, err = svc.PatchDevice(ctx, device.ID, "Device Updated", "Brand4", store.DeviceStateInUse)
+		_, err = svc.PatchDevice(ctx, device.ID, nil, devicePatch("Device Updated", "Brand4", store.DeviceStateInUse))
 		assert.ErrorIs(t, err, ErrDeviceInUse)
 	})
 
 	t.Run("It_should_be_able_to_patch_state_if_device_in_use_state", func(t *testing.T) {
-		_, err := svc.PatchDevice(ctx, device.ID, "Device Updated", "Brand3", store.DeviceStateInUse)
+		_, err := svc.PatchDevice(ctx, device.ID, nil, devicePatch("Device Updated", "Brand3", store.DeviceStateInUse))
 		assert.NoError(t, err)
 
-		deviceUpdated, err := svc.PatchDevice(ctx, device.ID, "Device Updated", "Brand3", store.DeviceStateInactive)
+		deviceUpdated, err := svc.PatchDevice(ctx, device.ID, nil, devicePatch("Device Updated", "Brand3", store.DeviceStateInactive))
 		assert.NoError(t, err)
 		assert.Equal(t, store.DeviceStateInactive, deviceUpdated.State)
 	})
 
 	t.Run("It_should_not_be_able_to_patch_a_device_that_does_not_exist", func(t *testing.T) {
-		_, err := svc.PatchDevice(ctx, 999, "Device D", "BrandZ", store.DeviceStateAvailable)
+		_, err := svc.PatchDevice(ctx, 999, nil, devicePatch("Device D", "BrandZ", store.DeviceStateAvailable))
 		assert.ErrorIs(t, err, ErrDeviceNotFound)
 	})
 
+	t.Run("It_should_not_be_able_to_patch_a_device_at_a_stale_version", func(t *testing.T) {
+		_, err := svc.PatchDevice(ctx, device.ID, []int32{1}, devicePatch("", "", store.DeviceStateAvailable))
+		assert.ErrorIs(t, err, ErrVersionMismatch)
+	})
+
 	t.Run("It_should_be_able_to_update_only_name", func(t *testing.T) {
 		deviceTest, err := svc.CreateDevice(ctx, "Name1", "BrandShouldNotChange", store.DeviceStateAvailable)
 		assert.NoError(t, err)
 
-		deviceUpdated, err := svc.PatchDevice(ctx, deviceTest.ID, "NameShouldUpdate", "", "")
+		deviceUpdated, err := svc.PatchDevice(ctx, deviceTest.ID, nil, devicePatch("NameShouldUpdate", "", ""))
 		assert.NoError(t, err)
 		assert.Equal(t, "NameShouldUpdate", deviceUpdated.Name)
 		assert.Equal(t, "BrandShouldNotChange", deviceUpdated.Brand)
@@ -154,12 +194,46 @@ func TestPatchDevice(t *testing.T) {
 		deviceTest, err := svc.CreateDevice(ctx, "NameShouldNotChange", "Brand1", store.DeviceStateAvailable)
 		assert.NoError(t, err)
 
-		deviceUpdated, err := svc.PatchDevice(ctx, deviceTest.ID, "", "BrandShouldUpdate", "")
+		deviceUpdated, err := svc.PatchDevice(ctx, deviceTest.ID, nil, devicePatch("", "BrandShouldUpdate", ""))
 		assert.NoError(t, err)
 		assert.Equal(t, "NameShouldNotChange", deviceUpdated.Name)
 		assert.Equal(t, "BrandShouldUpdate", deviceUpdated.Brand)
 		assert.Equal(t, store.DeviceStateAvailable, deviceUpdated.State)
 	})
+
+	t.Run("It_should_be_able_to_update_only_the_state_of_a_device_in_use", func(t *testing.T) {
+		deviceTest, err := svc.CreateDevice(ctx, "Device In Use", "BrandX", store.DeviceStateInUse)
+		assert.NoError(t, err)
+
+		deviceUpdated, err := svc.PatchDevice(ctx, deviceTest.ID, nil, devicePatch("", "", store.DeviceStateAvailable))
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceStateAvailable, deviceUpdated.State)
+	})
+
+	t.Run("It_should_compute_the_patch_from_the_current_device", func(t *testing.T) {
+		deviceTest, err := svc.CreateDevice(ctx, "Device", "BrandX", store.DeviceStateAvailable)
+		assert.NoError(t, err)
+
+		deviceUpdated, err := svc.PatchDeviceFunc(ctx, deviceTest.ID, nil, func(current store.Device) (store.DevicePatch, error) {
+			return devicePatch(current.Name+" v2", "", ""), nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "Device v2", deviceUpdated.Name)
+		assert.Equal(t, int32(2), deviceUpdated.Version)
+	})
+
+	t.Run("It_should_not_write_an_empty_patch", func(t *testing.T) {
+		deviceTest, err := svc.CreateDevice(ctx, "Device", "BrandX", store.DeviceStateAvailable)
+		assert.NoError(t, err)
+
+		deviceUpdated, err := svc.PatchDevice(ctx, deviceTest.ID, nil, store.DevicePatch{})
+		assert.NoError(t, err)
+		assert.Equal(t, deviceTest, deviceUpdated)
+
+		events, err := svc.ListDeviceEvents(ctx, store.DeviceEventFilter{DeviceID: deviceTest.ID})
+		assert.NoError(t, err)
+		assert.Len(t, events.Events, 1)
+	})
 }
 
 func TestGetDeviceByID(t *testing.T) {
@@ -207,7 +281,327 @@ func TestDeleteDevice(t *testing.T) {
 	})
 }
 
-func TestGetAllDevices(t *testing.T) {
+func TestSoftDelete(t *testing.T) {
+	ctx, _, svc := setupTest(t)
+
+	device, err := svc.CreateDevice(ctx, "Device", "BrandY", store.DeviceStateAvailable)
+	assert.NoError(t, err)
+	_, err = svc.DeleteDevice(ctx, device.ID)
+	assert.NoError(t, err)
+
+	t.Run("It_should_hide_deleted_devices", func(t *testing.T) {
+		_, err := svc.GetDeviceByID(ctx, device.ID)
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+		_, err = svc.PatchDevice(ctx, device.ID, nil, devicePatch("Renamed", "", ""))
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+		_, err = svc.DeleteDevice(ctx, device.ID)
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+		page, err := svc.ListDevices(ctx, store.DeviceFilter{})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Devices)
+	})
+
+	t.Run("It_should_list_deleted_devices_on_request", func(t *testing.T) {
+		page, err := svc.ListDevices(ctx, store.DeviceFilter{IncludeDeleted: true})
+		assert.NoError(t, err)
+		assert.Len(t, page.Devices, 1)
+		assert.NotNil(t, page.Devices[0].DeletedAt)
+	})
+
+	t.Run("It_should_be_able_to_restore_a_device", func(t *testing.T) {
+		restored, err := svc.RestoreDevice(ctx, device.ID)
+		assert.NoError(t, err)
+		assert.Nil(t, restored.DeletedAt)
+
+		_, err = svc.GetDeviceByID(ctx, device.ID)
+		assert.NoError(t, err)
+
+		_, err = svc.RestoreDevice(ctx, device.ID)
+		assert.ErrorIs(t, err, ErrDeviceNotDeleted)
+
+		_, err = svc.RestoreDevice(ctx, 999)
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+		page, err := svc.ListDeviceEvents(ctx, store.DeviceEventFilter{DeviceID: device.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceEventRestored, page.Events[0].Type)
+	})
+
+	t.Run("It_should_purge_devices_deleted_before_the_retention", func(t *testing.T) {
+		_, err := svc.DeleteDevice(ctx, device.ID)
+		assert.NoError(t, err)
+
+		purged, err := svc.PurgeDeletedDevices(ctx, time.Hour)
+		assert.NoError(t, err)
+		assert.Zero(t, purged)
+
+		purged, err = svc.PurgeDeletedDevices(ctx, -time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), purged)
+
+		_, err = svc.RestoreDevice(ctx, device.ID)
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+	})
+}
+
+func TestStateTransitions(t *testing.T) {
+	ctx, _, svc := setupTest(t)
+
+	device, err := svc.CreateDevice(ctx, "Device", "BrandY", store.DeviceStateInactive)
+	assert.NoError(t, err)
+
+	t.Run("It_should_not_be_able_to_use_an_inactive_device_directly", func(t *testing.T) {
+		_, err := svc.PatchDevice(ctx, device.ID, nil, devicePatch("", "", store.DeviceStateInUse))
+		assert.ErrorIs(t, err, ErrIllegalTransition)
+
+		var illegal *IllegalTransitionError
+		assert.ErrorAs(t, err, &illegal)
+		assert.Equal(t, []store.DeviceState{store.DeviceStateAvailable}, illegal.Allowed)
+
+		_, err = svc.UpdateDevice(ctx, device.ID, nil, "Device", "BrandY", store.DeviceStateInUse)
+		assert.ErrorIs(t, err, ErrIllegalTransition)
+	})
+
+	t.Run("It_should_be_able_to_reactivate_and_then_use_a_device", func(t *testing.T) {
+		_, err := svc.PatchDevice(ctx, device.ID, nil, devicePatch("", "", store.DeviceStateAvailable))
+		assert.NoError(t, err)
+
+		deviceUpdated, err := svc.PatchDevice(ctx, device.ID, nil, devicePatch("", "", store.DeviceStateInUse))
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceStateInUse, deviceUpdated.State)
+	})
+
+	t.Run("It_should_list_the_next_states_of_a_device", func(t *testing.T) {
+		_, transitions, err := svc.GetDeviceTransitions(ctx, device.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []store.DeviceState{store.DeviceStateAvailable, store.DeviceStateInactive}, transitions)
+	})
+
+	t.Run("It_should_enforce_a_custom_transition_table", func(t *testing.T) {
+		transitions, err := LoadTransitions(strings.NewReader(`{"in-use": ["available"], "available": ["in-use"]}`))
+		assert.NoError(t, err)
+
+		custom := NewDeviceService(svc.Store)
+		custom.Transitions = transitions
+
+		_, err = custom.PatchDevice(ctx, device.ID, nil, devicePatch("", "", store.DeviceStateInactive))
+		assert.ErrorIs(t, err, ErrIllegalTransition)
+
+		_, err = LoadTransitions(strings.NewReader(`{"in-use": ["broken"]}`))
+		assert.Error(t, err)
+	})
+}
+
+func TestDeviceEvents(t *testing.T) {
+	ctx, _, svc := setupTest(t)
+	ctx = WithRequestID(WithActor(ctx, "alice"), "req-1")
+
+	device, err := svc.CreateDevice(ctx, "Device A", "BrandX", store.DeviceStateAvailable)
+	assert.NoError(t, err)
+	patched, err := svc.PatchDevice(ctx, device.ID, nil, devicePatch("", "", store.DeviceStateInUse))
+	assert.NoError(t, err)
+
+	t.Run("It_should_record_every_change_newest_first", func(t *testing.T) {
+		page, err := svc.ListDeviceEvents(ctx, store.DeviceEventFilter{DeviceID: device.ID})
+		assert.NoError(t, err)
+		assert.Len(t, page.Events, 2)
+
+		event := page.Events[0]
+		assert.Equal(t, store.DeviceEventPatched, event.Type)
+		assert.Equal(t, store.DeviceStateAvailable, event.Old.State)
+		assert.Equal(t, patched, *event.New)
+		assert.Equal(t, "alice", event.Actor)
+		assert.Equal(t, "req-1", event.RequestID)
+
+		assert.Equal(t, store.DeviceEventCreated, page.Events[1].Type)
+		assert.Nil(t, page.Events[1].Old)
+	})
+
+	t.Run("It_should_not_record_a_refused_change", func(t *testing.T) {
+		_, err := svc.DeleteDevice(ctx, device.ID)
+		assert.ErrorIs(t, err, ErrDeviceInUse)
+
+		page, err := svc.ListDeviceEvents(ctx, store.DeviceEventFilter{DeviceID: device.ID})
+		assert.NoError(t, err)
+		assert.Len(t, page.Events, 2)
+	})
+
+	t.Run("It_should_keep_the_history_of_deleted_devices", func(t *testing.T) {
+		_, err := svc.UpdateDevice(ctx, device.ID, nil, "Device A", "BrandX", store.DeviceStateAvailable)
+		assert.NoError(t, err)
+		_, err = svc.DeleteDevice(ctx, device.ID)
+		assert.NoError(t, err)
+
+		page, err := svc.ListDeviceEvents(ctx, store.DeviceEventFilter{DeviceID: device.ID, Limit: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceEventDeleted, page.Events[0].Type)
+		assert.Nil(t, page.Events[0].New)
+		assert.NotNil(t, page.NextCursor)
+
+		var types []store.DeviceEventType
+		for page.NextCursor != nil {
+			page, err = svc.ListDeviceEvents(ctx, store.DeviceEventFilter{DeviceID: device.ID, Limit: 1, After: page.NextCursor})
+			assert.NoError(t, err)
+			types = append(types, page.Events[0].Type)
+		}
+		assert.Equal(t, []store.DeviceEventType{store.DeviceEventUpdated, store.DeviceEventPatched, store.DeviceEventCreated}, types)
+	})
+
+	t.Run("It_should_not_find_the_history_of_an_unknown_device", func(t *testing.T) {
+		_, err := svc.ListDeviceEvents(ctx, store.DeviceEventFilter{DeviceID: 99})
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+		_, err = svc.ListDeviceEvents(ctx, store.DeviceEventFilter{DeviceID: device.ID, After: &store.Cursor{Sort: "-created_at"}})
+		assert.ErrorIs(t, err, store.ErrInvalidCursor)
+	})
+}
+
+func TestRunBatch(t *testing.T) {
+	ctx, _, svc := setupTest(t)
+
+	inUse, err := svc.CreateDevice(ctx, "Device A", "BrandX", store.DeviceStateInUse)
+	assert.NoError(t, err)
+
+	t.Run("It_should_report_each_operation_on_its_own", func(t *testing.T) {
+		results, committed := svc.RunBatch(ctx, []BatchOperation{
+			{Op: BatchCreate, Name: "Device B", Brand: "BrandY", State: store.DeviceStateAvailable},
+			{Op: BatchDelete, ID: inUse.ID},
+			{Op: BatchPatch, ID: 2, Patch: devicePatch("", "", store.DeviceStateInactive)},
+		}, false)
+		assert.True(t, committed)
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, "Device B", results[0].Device.Name)
+		assert.ErrorIs(t, results[1].Err, ErrDeviceInUse)
+		assert.NoError(t, results[2].Err)
+		assert.Equal(t, store.DeviceStateInactive, results[2].Device.State)
+	})
+
+	t.Run("It_should_roll_back_an_atomic_batch_when_an_operation_fails", func(t *testing.T) {
+		results, committed := svc.RunBatch(ctx, []BatchOperation{
+			{Op: BatchCreate, Name: "Device C", Brand: "BrandZ", State: store.DeviceStateAvailable},
+			{Op: BatchDelete, ID: inUse.ID},
+			{Op: BatchDelete, ID: 2},
+		}, true)
+		assert.False(t, committed)
+		assert.ErrorIs(t, results[0].Err, ErrBatchRolledBack)
+		assert.ErrorIs(t, results[1].Err, ErrDeviceInUse)
+		assert.ErrorIs(t, results[2].Err, ErrBatchRolledBack)
+
+		page, err := svc.ListDevices(ctx, store.DeviceFilter{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Devices, 2)
+	})
+
+	t.Run("It_should_commit_an_atomic_batch", func(t *testing.T) {
+		results, committed := svc.RunBatch(ctx, []BatchOperation{
+			{Op: BatchCreate, Name: "Device C", Brand: "BrandZ", State: store.DeviceStateAvailable},
+			{Op: BatchDelete, ID: 2},
+		}, true)
+		assert.True(t, committed)
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, int32(2), results[1].DeletedID)
+	})
+}
+
+func TestImportDevices(t *testing.T) {
+	ctx, _, svc := setupTest(t)
+
+	t.Run("It_should_import_devices_in_batches", func(t *testing.T) {
+		devices := make([]store.Device, ImportBatchSize+1)
+		for i := range devices {
+			devices[i] = store.Device{Name: "Device", Brand: "BrandX", State: store.DeviceStateAvailable}
+		}
+
+		imported, err := svc.ImportDevices(ctx, devices)
+		assert.NoError(t, err)
+		assert.Len(t, imported, ImportBatchSize+1)
+		assert.Equal(t, int32(ImportBatchSize+1), imported[ImportBatchSize].ID)
+
+		page, err := svc.ListDeviceEvents(ctx, store.DeviceEventFilter{DeviceID: imported[ImportBatchSize].ID})
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceEventCreated, page.Events[0].Type)
+	})
+
+	t.Run("It_should_import_nothing_when_a_batch_fails", func(t *testing.T) {
+		devices := []store.Device{
+			{Name: "Device", Brand: "BrandX", State: store.DeviceStateAvailable},
+			{Name: "Device", Brand: "BrandX", State: "broken"},
+		}
+
+		_, err := svc.ImportDevices(ctx, devices)
+		assert.Error(t, err)
+
+		page, err := svc.ListDevices(ctx, store.DeviceFilter{Limit: MaxPageLimit})
+		assert.NoError(t, err)
+		assert.Len(t, page.Devices, int(MaxPageLimit))
+		assert.Equal(t, int32(ImportBatchSize+1), page.Devices[0].ID)
+	})
+}
+
+func TestStoreUnavailable(t *testing.T) {
+	ctx := WithTenant(context.Background(), testTenant)
+	mock := mockstore.NewMockDeviceStore()
+	svc := NewDeviceService(mock)
+
+	device, err := svc.CreateDevice(ctx, "Device", "BrandY", store.DeviceStateAvailable)
+	assert.NoError(t, err)
+
+	mock.FailWith(store.ErrUnavailable)
+
+	t.Run("It_should_not_report_an_outage_as_a_missing_device_on_get", func(t *testing.T) {
+		_, err := svc.GetDeviceByID(ctx, device.ID)
+		assert.ErrorIs(t, err, store.ErrUnavailable)
+		assert.NotErrorIs(t, err, ErrDeviceNotFound)
+	})
+
+	t.Run("It_should_not_report_an_outage_as_a_missing_device_on_update", func(t *testing.T) {
+		_, err := svc.UpdateDevice(ctx, device.ID, nil, "Device", "BrandY", store.DeviceStateInactive)
+		assert.ErrorIs(t, err, store.ErrUnavailable)
+	})
+
+	t.Run("It_should_not_report_an_outage_as_a_missing_device_on_delete", func(t *testing.T) {
+		_, err := svc.DeleteDevice(ctx, device.ID)
+		assert.ErrorIs(t, err, store.ErrUnavailable)
+	})
+}
+
+func TestDeleteDeviceRacingStateChange(t *testing.T) {
+	ctx, _, svc := setupTest(t)
+
+	for i := 0; i < 20; i++ {
+		device, err := svc.CreateDevice(ctx, "Device", "BrandY", store.DeviceStateAvailable)
+		assert.NoError(t, err)
+
+		var (
+			wg                  sync.WaitGroup
+			patchErr, deleteErr error
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, patchErr = svc.PatchDevice(ctx, device.ID, nil, devicePatch("Device", "BrandY", store.DeviceStateInUse))
+		}()
+		go func() {
+			defer wg.Done()
+			_, deleteErr = svc.DeleteDevice(ctx, device.ID)
+		}()
+		wg.Wait()
+
+		// Exactly one of them wins: either the device was deleted before it
+		// went in use, or it went in use and the delete was refused.
+		if deleteErr == nil {
+			assert.ErrorIs(t, patchErr, ErrDeviceNotFound)
+		} else {
+			assert.ErrorIs(t, deleteErr, ErrDeviceInUse)
+			assert.NoError(t, patchErr)
+		}
+	}
+}
+
+func TestListDevices(t *testing.T) {
 	ctx, _, svc := setupTest(t)
 
 	_, _ = svc.CreateDevice(ctx, "Device1", "BrandY", store.DeviceStateAvailable)
@@ -219,26 +613,679 @@ func TestGetAllDevices(t *testing.T) {
 	_, _ = svc.CreateDevice(ctx, "Device7", "BrandY", store.DeviceStateInactive)
 
 	t.Run("It_should_be_able_to_get_all_devices", func(t *testing.T) {
-		devices, err := svc.GetAllDevices(ctx, "", "")
+		devices, err := svc.ListDevices(ctx, store.DeviceFilter{})
 		assert.NoError(t, err)
-		assert.Len(t, devices, 7)
+		assert.Len(t, devices.Devices, 7)
 	})
 
 	t.Run("It_should_be_able_to_get_all_devices_by_brand", func(t *testing.T) {
-		devices, err := svc.GetAllDevices(ctx, "BrandY", "")
+		devices, err := svc.ListDevices(ctx, store.DeviceFilter{Brands: []string{"BrandY"}})
 		assert.NoError(t, err)
-		assert.Len(t, devices, 5)
+		assert.Len(t, devices.Devices, 5)
 	})
 
 	t.Run("It_should_be_able_to_get_all_devices_by_state", func(t *testing.T) {
-		devices, err := svc.GetAllDevices(ctx, "", store.DeviceStateInactive)
+		devices, err := svc.ListDevices(ctx, store.DeviceFilter{States: []store.DeviceState{store.DeviceStateInactive}})
 		assert.NoError(t, err)
-		assert.Len(t, devices, 2)
+		assert.Len(t, devices.Devices, 2)
 	})
 
 	t.Run("It_should_be_able_to_get_all_devices_by_brand_and_state", func(t *testing.T) {
-		devices, err := svc.GetAllDevices(ctx, "BrandY", store.DeviceStateAvailable)
+		devices, err := svc.ListDevices(ctx, store.DeviceFilter{
+			Brands: []string{"BrandY"},
+			States: []store.DeviceState{store.DeviceStateAvailable},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, devices.Devices, 3)
+	})
+
+	t.Run("It_should_be_able_to_get_devices_by_several_states", func(t *testing.T) {
+		devices, err := svc.ListDevices(ctx, store.DeviceFilter{
+			States: []store.DeviceState{store.DeviceStateInUse, store.DeviceStateInactive},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, devices.Devices, 4)
+	})
+
+	t.Run("It_should_be_able_to_get_devices_by_several_brands_ignoring_case", func(t *testing.T) {
+		devices, err := svc.ListDevices(ctx, store.DeviceFilter{Brands: []string{"brandx", "BRANDY"}})
+		assert.NoError(t, err)
+		assert.Len(t, devices.Devices, 7)
+	})
+
+	t.Run("It_should_be_able_to_get_devices_by_name_substring", func(t *testing.T) {
+		devices, err := svc.ListDevices(ctx, store.DeviceFilter{NameContains: "ice7"})
+		assert.NoError(t, err)
+		assert.Len(t, devices.Devices, 1)
+		assert.Equal(t, "Device7", devices.Devices[0].Name)
+	})
+
+	t.Run("It_should_be_able_to_get_devices_by_creation_range", func(t *testing.T) {
+		all, err := svc.ListDevices(ctx, store.DeviceFilter{Sort: []store.SortField{{Field: store.SortByCreatedAt}}})
+		assert.NoError(t, err)
+
+		after := all.Devices[1].CreatedAt
+		before := all.Devices[5].CreatedAt
+		devices, err := svc.ListDevices(ctx, store.DeviceFilter{CreatedAfter: &after, CreatedBefore: &before})
+		assert.NoError(t, err)
+		assert.Len(t, devices.Devices, 3)
+	})
+
+	t.Run("It_should_be_able_to_sort_by_several_fields", func(t *testing.T) {
+		sort, err := store.ParseSort("brand,-name")
+		assert.NoError(t, err)
+
+		devices, err := svc.ListDevices(ctx, store.DeviceFilter{Sort: sort})
+		assert.NoError(t, err)
+
+		var names []string
+		for _, device := range devices.Devices {
+			names = append(names, device.Name)
+		}
+		assert.Equal(t, []string{"Device5", "Device4", "Device7", "Device6", "Device3", "Device2", "Device1"}, names)
+	})
+}
+
+func TestListDevicesPagination(t *testing.T) {
+	ctx, _, svc := setupTest(t)
+
+	for _, name := range []string{"Device C", "Device A", "Device B", "Device A", "Device C"} {
+		_, err := svc.CreateDevice(ctx, name, "BrandY", store.DeviceStateAvailable)
+		assert.NoError(t, err)
+	}
+
+	t.Run("It_should_be_able_to_walk_all_pages_with_the_cursor", func(t *testing.T) {
+		var ids []int32
+		filter := store.DeviceFilter{Limit: 2}
+		for {
+			devices, err := svc.ListDevices(ctx, filter)
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, len(devices.Devices), 2)
+			for _, device := range devices.Devices {
+				ids = append(ids, device.ID)
+			}
+			if devices.NextCursor == nil {
+				break
+			}
+			filter.After = devices.NextCursor
+		}
+		assert.Equal(t, []int32{5, 4, 3, 2, 1}, ids)
+	})
+
+	t.Run("It_should_be_able_to_walk_pages_sorted_by_name", func(t *testing.T) {
+		var ids []int32
+		filter := store.DeviceFilter{Limit: 2, Sort: []store.SortField{{Field: store.SortByName}}}
+		for {
+			devices, err := svc.ListDevices(ctx, filter)
+			assert.NoError(t, err)
+			for _, device := range devices.Devices {
+				ids = append(ids, device.ID)
+			}
+			if devices.NextCursor == nil {
+				break
+			}
+			filter.After = devices.NextCursor
+		}
+		assert.Equal(t, []int32{2, 4, 3, 1, 5}, ids)
+	})
+
+	t.Run("It_should_use_the_default_limit_when_not_informed", func(t *testing.T) {
+		devices, err := svc.ListDevices(ctx, store.DeviceFilter{})
+		assert.NoError(t, err)
+		assert.Len(t, devices.Devices, 5)
+		assert.Nil(t, devices.NextCursor)
+	})
+
+	t.Run("It_should_not_accept_a_cursor_issued_for_another_sort", func(t *testing.T) {
+		devices, err := svc.ListDevices(ctx, store.DeviceFilter{Limit: 2})
+		assert.NoError(t, err)
+
+		_, err = svc.ListDevices(ctx, store.DeviceFilter{
+			Limit: 2,
+			Sort:  []store.SortField{{Field: store.SortByName}},
+			After: devices.NextCursor,
+		})
+		assert.ErrorIs(t, err, store.ErrInvalidCursor)
+	})
+}
+
+// devicePatch builds a patch from the old string arguments, where the empty
+// string leaves the field unchanged.
+func devicePatch(name, brand string, state store.DeviceState) store.DevicePatch {
+	var patch store.DevicePatch
+	if name != "" {
+		patch.Name = &name
+	}
+	if brand != "" {
+		patch.Brand = &brand
+	}
+	if state != "" {
+		patch.State = &state
+	}
+	return patch
+}
+
+func TestIdempotencyService(t *testing.T) {
+	ctx := context.Background()
+	idempotencyStore := mockstore.NewMockIdempotencyStore()
+	svc := NewIdempotencyService(idempotencyStore)
+
+	t.Run("It_should_replay_a_completed_request", func(t *testing.T) {
+		stored, err := svc.Begin(ctx, "key-1", "request")
+		assert.NoError(t, err)
+		assert.Nil(t, stored)
+
+		_, err = svc.Begin(ctx, "key-1", "request")
+		assert.ErrorIs(t, err, ErrIdempotencyKeyInProgress)
+
+		assert.NoError(t, svc.Complete(ctx, "key-1", 201, "application/json", []byte(`{"id":1}`)))
+		stored, err = svc.Begin(ctx, "key-1", "request")
 		assert.NoError(t, err)
-		assert.Len(t, devices, 3)
+		assert.Equal(t, 201, stored.StatusCode)
+		assert.Equal(t, []byte(`{"id":1}`), stored.Body)
+
+		_, err = svc.Begin(ctx, "key-1", "other request")
+		assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+	})
+
+	t.Run("It_should_let_a_released_key_be_claimed_again", func(t *testing.T) {
+		_, err := svc.Begin(ctx, "key-2", "request")
+		assert.NoError(t, err)
+		assert.NoError(t, svc.Release(ctx, "key-2"))
+
+		stored, err := svc.Begin(ctx, "key-2", "request")
+		assert.NoError(t, err)
+		assert.Nil(t, stored)
+	})
+
+	t.Run("It_should_let_a_retry_take_over_a_key_past_its_lease", func(t *testing.T) {
+		abandoned := NewIdempotencyService(idempotencyStore)
+		abandoned.Lease = -time.Second
+
+		_, err := abandoned.Begin(ctx, "key-4", "request")
+		assert.NoError(t, err)
+
+		stored, err := svc.Begin(ctx, "key-4", "request")
+		assert.NoError(t, err)
+		assert.Nil(t, stored)
+
+		// The response is then kept for the TTL, not the lease.
+		abandoned.Lease = DefaultIdempotencyLease
+		assert.NoError(t, abandoned.Complete(ctx, "key-4", 201, "application/json", nil))
+		stored, err = svc.Begin(ctx, "key-4", "request")
+		assert.NoError(t, err)
+		assert.Equal(t, 201, stored.StatusCode)
+	})
+
+	t.Run("It_should_forget_expired_keys", func(t *testing.T) {
+		expiring := NewIdempotencyService(idempotencyStore)
+		expiring.TTL = -time.Second
+
+		_, err := expiring.Begin(ctx, "key-3", "request")
+		assert.NoError(t, err)
+		assert.NoError(t, expiring.Complete(ctx, "key-3", 201, "application/json", nil))
+
+		stored, err := svc.Begin(ctx, "key-3", "other request")
+		assert.NoError(t, err)
+		assert.Nil(t, stored)
+
+		purged, err := idempotencyStore.PurgeExpiredIdempotencyKeys(ctx, time.Now().Add(2*DefaultIdempotencyTTL))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), purged)
+	})
+}
+
+func TestBrandAccess(t *testing.T) {
+	ctx, mock, svc := setupTest(t)
+	acme, err := svc.CreateDevice(ctx, "Phone", "Acme", store.DeviceStateAvailable)
+	assert.NoError(t, err)
+	globex, err := svc.CreateDevice(ctx, "Tablet", "Globex", store.DeviceStateAvailable)
+	assert.NoError(t, err)
+
+	access := NewAccessService(mockstore.NewMockAccessStore())
+	svc.Access = access
+	repairer, err := access.CreateRole(ctx, "repairer", []string{auth.ScopeDevicesRead, auth.ScopeDevicesWrite})
+	assert.NoError(t, err)
+	_, err = access.CreateGrant(ctx, "contractor", repairer.ID, "acme")
+	assert.NoError(t, err)
+
+	contractor := auth.WithPrincipal(ctx, auth.Principal{Subject: "contractor"})
+
+	t.Run("It_should_list_only_the_granted_brands", func(t *testing.T) {
+		page, err := svc.ListDevices(contractor, store.DeviceFilter{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Devices, 1)
+		assert.Equal(t, acme.ID, page.Devices[0].ID)
+
+		page, err = svc.ListDevices(contractor, store.DeviceFilter{Brands: []string{"Globex"}})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Devices)
+
+		var exported []store.Device
+		err = svc.ExportDevices(contractor, store.DeviceFilter{}, func(device store.Device) error {
+			exported = append(exported, device)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Len(t, exported, 1)
+	})
+
+	t.Run("It_should_hide_devices_of_other_brands", func(t *testing.T) {
+		_, err := svc.GetDeviceByID(contractor, globex.ID)
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+		_, err = svc.ListDeviceEvents(contractor, store.DeviceEventFilter{DeviceID: globex.ID})
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+		_, err = svc.GetDeviceByID(contractor, acme.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("It_should_forbid_changes_outside_the_grants", func(t *testing.T) {
+		_, err := svc.CreateDevice(contractor, "Laptop", "Globex", store.DeviceStateAvailable)
+		assert.ErrorIs(t, err, ErrForbidden)
+
+		_, err = svc.UpdateDevice(contractor, globex.ID, nil, "Tablet", "Globex", store.DeviceStateInactive)
+		assert.ErrorIs(t, err, ErrForbidden)
+
+		brand := "Globex"
+		_, err = svc.PatchDevice(contractor, acme.ID, nil, store.DevicePatch{Brand: &brand})
+		assert.ErrorIs(t, err, ErrForbidden)
+
+		_, err = svc.ImportDevices(contractor, []store.Device{{Name: "Phone", Brand: "Acme"}, {Name: "Tablet", Brand: "Globex"}})
+		assert.ErrorIs(t, err, ErrForbidden)
+
+		// The role does not grant devices:delete, even on Acme.
+		_, err = svc.DeleteDevice(contractor, acme.ID)
+		assert.ErrorIs(t, err, ErrForbidden)
+
+		device, err := mock.GetDeviceByID(ctx, testTenant, acme.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Acme", device.Brand)
 	})
+
+	t.Run("It_should_allow_changes_within_the_grants", func(t *testing.T) {
+		state := store.DeviceStateInactive
+		_, err := svc.PatchDevice(contractor, acme.ID, nil, store.DevicePatch{State: &state})
+		assert.NoError(t, err)
+
+		_, err = svc.CreateDevice(contractor, "Watch", "ACME", store.DeviceStateAvailable)
+		assert.NoError(t, err)
+	})
+
+	t.Run("It_should_not_restrict_calls_without_a_principal", func(t *testing.T) {
+		page, err := svc.ListDevices(ctx, store.DeviceFilter{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Devices, 3)
+	})
+
+	t.Run("It_should_restrict_nothing_with_a_grant_on_every_brand", func(t *testing.T) {
+		_, err := access.CreateGrant(ctx, "auditor", repairer.ID, "")
+		assert.NoError(t, err)
+
+		page, err := svc.ListDevices(auth.WithPrincipal(ctx, auth.Principal{Subject: "auditor"}), store.DeviceFilter{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Devices, 3)
+	})
+}
+
+func TestTenantIsolation(t *testing.T) {
+	ctx, _, svc := setupTest(t)
+	globex := WithTenant(context.Background(), "globex")
+
+	device, err := svc.CreateDevice(ctx, "Phone", "Acme", store.DeviceStateAvailable)
+	assert.NoError(t, err)
+
+	t.Run("It_should_require_a_tenant", func(t *testing.T) {
+		_, err := svc.CreateDevice(context.Background(), "Phone", "Acme", store.DeviceStateAvailable)
+		assert.ErrorIs(t, err, ErrTenantRequired)
+
+		_, err = svc.ListDevices(context.Background(), store.DeviceFilter{})
+		assert.ErrorIs(t, err, ErrTenantRequired)
+
+		results, committed := svc.RunBatch(context.Background(), []BatchOperation{{Op: BatchDelete, ID: device.ID}}, true)
+		assert.False(t, committed)
+		assert.ErrorIs(t, results[0].Err, ErrTenantRequired)
+	})
+
+	t.Run("It_should_hide_the_devices_of_other_tenants", func(t *testing.T) {
+		page, err := svc.ListDevices(globex, store.DeviceFilter{})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Devices)
+
+		_, err = svc.GetDeviceByID(globex, device.ID)
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+		_, err = svc.ListDeviceEvents(globex, store.DeviceEventFilter{DeviceID: device.ID})
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+		_, err = svc.DeleteDevice(globex, device.ID)
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+		_, err = svc.GetDeviceByID(ctx, device.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("It_should_purge_every_tenant", func(t *testing.T) {
+		other, err := svc.CreateDevice(globex, "Tablet", "Globex", store.DeviceStateAvailable)
+		assert.NoError(t, err)
+		_, err = svc.DeleteDevice(globex, other.ID)
+		assert.NoError(t, err)
+		_, err = svc.DeleteDevice(ctx, device.ID)
+		assert.NoError(t, err)
+
+		purged, err := svc.PurgeDeletedDevices(context.Background(), -time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), purged)
+	})
+}
+
+func TestCheckoutDevice(t *testing.T) {
+	ctx, mock, svc := setupTest(t)
+
+	phone, _ := mock.CreateDevice(ctx, testTenant, "Phone", "Acme", store.DeviceStateAvailable)
+	tablet, _ := mock.CreateDevice(ctx, testTenant, "Tablet", "Acme", store.DeviceStateInactive)
+	laptop, _ := mock.CreateDevice(ctx, testTenant, "Laptop", "Globex", store.DeviceStateAvailable)
+
+	t.Run("It_should_check_out_an_available_device", func(t *testing.T) {
+		due := time.Now().Add(time.Hour)
+		device, assignment, err := svc.CheckoutDevice(ctx, phone.ID, Checkout{Assignee: "alice", DueAt: &due, Note: "on call"})
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceStateInUse, device.State)
+		assert.Equal(t, phone.Version+1, device.Version)
+		assert.Equal(t, "alice", assignment.Assignee)
+		assert.Equal(t, "on call", assignment.Note)
+		assert.Nil(t, assignment.CheckedInAt)
+
+		events, err := svc.ListDeviceEvents(ctx, store.DeviceEventFilter{DeviceID: phone.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceEventCheckedOut, events.Events[0].Type)
+	})
+
+	t.Run("It_should_not_check_out_a_device_that_is_not_available", func(t *testing.T) {
+		_, _, err := svc.CheckoutDevice(ctx, phone.ID, Checkout{Assignee: "bob"})
+		assert.ErrorIs(t, err, ErrDeviceNotAvailable)
+
+		_, _, err = svc.CheckoutDevice(ctx, tablet.ID, Checkout{Assignee: "bob"})
+		assert.ErrorIs(t, err, ErrDeviceNotAvailable)
+
+		_, _, err = svc.CheckoutDevice(ctx, 99, Checkout{Assignee: "bob"})
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+	})
+
+	t.Run("It_should_keep_a_checked_out_device_in_use", func(t *testing.T) {
+		_, err := svc.UpdateDevice(ctx, phone.ID, nil, "Phone", "Acme", store.DeviceStateAvailable)
+		assert.ErrorIs(t, err, ErrDeviceCheckedOut)
+
+		inactive := store.DeviceStateInactive
+		_, err = svc.PatchDevice(ctx, phone.ID, nil, store.DevicePatch{State: &inactive})
+		assert.ErrorIs(t, err, ErrDeviceCheckedOut)
+	})
+
+	t.Run("It_should_list_what_an_assignee_holds", func(t *testing.T) {
+		_, _, err := svc.CheckoutDevice(ctx, laptop.ID, Checkout{Assignee: "bob"})
+		assert.NoError(t, err)
+
+		page, err := svc.ListAssignments(ctx, store.AssignmentFilter{Assignee: "alice", Open: true})
+		assert.NoError(t, err)
+		assert.Len(t, page.Assignments, 1)
+		assert.Equal(t, phone.ID, page.Assignments[0].DeviceID)
+		assert.Equal(t, "Phone", page.Assignments[0].Device.Name)
+	})
+
+	t.Run("It_should_list_overdue_checkouts", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		_, err := mock.CreateAssignment(ctx, testTenant, store.Assignment{DeviceID: tablet.ID, Assignee: "carol", DueAt: &past})
+		assert.NoError(t, err)
+
+		page, err := svc.ListAssignments(ctx, store.AssignmentFilter{Overdue: true})
+		assert.NoError(t, err)
+		assert.Len(t, page.Assignments, 1)
+		assert.Equal(t, "carol", page.Assignments[0].Assignee)
+	})
+
+	t.Run("It_should_check_a_device_back_in", func(t *testing.T) {
+		device, assignment, err := svc.CheckinDevice(ctx, phone.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceStateAvailable, device.State)
+		assert.Equal(t, "alice", assignment.Assignee)
+		assert.NotNil(t, assignment.CheckedInAt)
+
+		_, _, err = svc.CheckinDevice(ctx, phone.ID)
+		assert.ErrorIs(t, err, ErrDeviceNotCheckedOut)
+
+		page, err := svc.ListAssignments(ctx, store.AssignmentFilter{Assignee: "alice", Open: true})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Assignments)
+
+		page, err = svc.ListAssignments(ctx, store.AssignmentFilter{Assignee: "alice"})
+		assert.NoError(t, err)
+		assert.Len(t, page.Assignments, 1)
+	})
+
+	t.Run("It_should_list_only_the_assignments_of_readable_brands", func(t *testing.T) {
+		access := NewAccessService(mockstore.NewMockAccessStore())
+		role, _ := access.CreateRole(ctx, "reader", []string{auth.ScopeDevicesRead})
+		_, err := access.CreateGrant(ctx, "alice", role.ID, "Globex")
+		assert.NoError(t, err)
+		restricted := &DeviceService{Store: mock, Transitions: DefaultTransitions, Access: access}
+
+		alice := auth.WithPrincipal(ctx, auth.Principal{Subject: "alice", Scopes: auth.Scopes})
+		page, err := restricted.ListAssignments(alice, store.AssignmentFilter{Open: true})
+		assert.NoError(t, err)
+		assert.Len(t, page.Assignments, 1)
+		assert.Equal(t, laptop.ID, page.Assignments[0].DeviceID)
+	})
+}
+
+func TestReservations(t *testing.T) {
+	ctx, mock, svc := setupTest(t)
+	ctx = WithActor(ctx, "alice")
+
+	phone, _ := mock.CreateDevice(ctx, testTenant, "Phone", "Acme", store.DeviceStateAvailable)
+	tablet, _ := mock.CreateDevice(ctx, testTenant, "Tablet", "Acme", store.DeviceStateAvailable)
+	laptop, _ := mock.CreateDevice(ctx, testTenant, "Laptop", "Acme", store.DeviceStateAvailable)
+
+	now := time.Now()
+	var current store.Reservation
+
+	t.Run("It_should_reserve_a_slot", func(t *testing.T) {
+		var err error
+		current, err = svc.CreateReservation(ctx, phone.ID, store.Reservation{StartsAt: now, EndsAt: now.Add(time.Hour), Note: "demo"})
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", current.ReservedBy)
+		assert.Equal(t, store.ReservationScheduled, current.Status)
+
+		_, err = svc.CreateReservation(ctx, 99, store.Reservation{StartsAt: now, EndsAt: now.Add(time.Hour)})
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+	})
+
+	t.Run("It_should_not_reserve_an_overlapping_slot", func(t *testing.T) {
+		_, err := svc.CreateReservation(ctx, phone.ID, store.Reservation{StartsAt: now.Add(30 * time.Minute), EndsAt: now.Add(2 * time.Hour)})
+		assert.ErrorIs(t, err, ErrReservationConflict)
+
+		// Slots are half-open, so the next one may start as this one ends.
+		_, err = svc.CreateReservation(ctx, phone.ID, store.Reservation{StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour)})
+		assert.NoError(t, err)
+
+		page, err := svc.ListReservations(ctx, store.ReservationFilter{DeviceID: phone.ID})
+		assert.NoError(t, err)
+		assert.Len(t, page.Reservations, 2)
+	})
+
+	t.Run("It_should_start_a_reservation_when_its_slot_starts", func(t *testing.T) {
+		started, ended, err := svc.AdvanceReservations(ctx, now.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, started)
+		assert.Equal(t, 0, ended)
+
+		device, err := svc.GetDeviceByID(ctx, phone.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceStateInUse, device.State)
+
+		events, err := svc.ListDeviceEvents(ctx, store.DeviceEventFilter{DeviceID: phone.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceEventReservationStarted, events.Events[0].Type)
+		assert.Equal(t, "alice", events.Events[0].Actor)
+	})
+
+	t.Run("It_should_hand_the_device_over_between_back_to_back_slots", func(t *testing.T) {
+		started, ended, err := svc.AdvanceReservations(ctx, now.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, started)
+		assert.Equal(t, 1, ended)
+
+		page, err := svc.ListReservations(ctx, store.ReservationFilter{DeviceID: phone.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, store.ReservationCompleted, page.Reservations[0].Status)
+		assert.Equal(t, store.ReservationActive, page.Reservations[1].Status)
+		current = page.Reservations[1]
+	})
+
+	t.Run("It_should_keep_a_reserved_device_in_use", func(t *testing.T) {
+		_, err := svc.UpdateDevice(ctx, phone.ID, nil, "Phone", "Acme", store.DeviceStateAvailable)
+		assert.ErrorIs(t, err, ErrDeviceReserved)
+
+		_, err = svc.PatchDevice(ctx, phone.ID, nil, devicePatch("", "", store.DeviceStateInactive))
+		assert.ErrorIs(t, err, ErrDeviceReserved)
+
+		_, _, err = svc.CheckoutDevice(ctx, phone.ID, Checkout{Assignee: "bob"})
+		assert.ErrorIs(t, err, ErrDeviceNotAvailable)
+
+		device, err := svc.GetDeviceByID(ctx, phone.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceStateInUse, device.State)
+	})
+
+	t.Run("It_should_release_the_device_when_an_active_reservation_is_canceled", func(t *testing.T) {
+		canceled, err := svc.CancelReservation(ctx, phone.ID, current.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, store.ReservationCanceled, canceled.Status)
+
+		device, err := svc.GetDeviceByID(ctx, phone.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceStateAvailable, device.State)
+
+		_, err = svc.CancelReservation(ctx, phone.ID, current.ID)
+		assert.ErrorIs(t, err, ErrReservationEnded)
+		_, err = svc.CancelReservation(ctx, tablet.ID, current.ID)
+		assert.ErrorIs(t, err, ErrReservationNotFound)
+	})
+
+	t.Run("It_should_not_check_out_a_device_into_a_reservation", func(t *testing.T) {
+		_, err := svc.CreateReservation(ctx, laptop.ID, store.Reservation{StartsAt: now.Add(3 * time.Hour), EndsAt: now.Add(4 * time.Hour)})
+		assert.NoError(t, err)
+
+		_, _, err = svc.CheckoutDevice(ctx, laptop.ID, Checkout{Assignee: "bob"})
+		assert.ErrorIs(t, err, ErrReservationConflict)
+
+		overlapping := now.Add(3*time.Hour + 30*time.Minute)
+		_, _, err = svc.CheckoutDevice(ctx, laptop.ID, Checkout{Assignee: "bob", DueAt: &overlapping})
+		assert.ErrorIs(t, err, ErrReservationConflict)
+
+		before := now.Add(2 * time.Hour)
+		device, _, err := svc.CheckoutDevice(ctx, laptop.ID, Checkout{Assignee: "bob", DueAt: &before})
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceStateInUse, device.State)
+	})
+
+	t.Run("It_should_expire_a_slot_the_device_was_never_free_for", func(t *testing.T) {
+		// Checked out before the slot was booked, the device is not
+		// available when it starts.
+		_, _, err := svc.CheckoutDevice(ctx, tablet.ID, Checkout{Assignee: "bob"})
+		assert.NoError(t, err)
+		reservation, err := svc.CreateReservation(ctx, tablet.ID, store.Reservation{StartsAt: now, EndsAt: now.Add(time.Hour)})
+		assert.NoError(t, err)
+
+		started, _, err := svc.AdvanceReservations(ctx, now.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, started)
+
+		// The reserver can tell the slot started without the device.
+		page, err := svc.ListReservations(ctx, store.ReservationFilter{DeviceID: tablet.ID, Statuses: []store.ReservationStatus{store.ReservationDelayed}})
+		assert.NoError(t, err)
+		assert.Len(t, page.Reservations, 1)
+
+		_, _, err = svc.AdvanceReservations(ctx, now.Add(2*time.Hour))
+		assert.NoError(t, err)
+
+		page, err = svc.ListReservations(ctx, store.ReservationFilter{DeviceID: tablet.ID, Statuses: []store.ReservationStatus{store.ReservationExpired}})
+		assert.NoError(t, err)
+		assert.Len(t, page.Reservations, 1)
+		assert.Equal(t, reservation.ID, page.Reservations[0].ID)
+
+		device, err := svc.GetDeviceByID(ctx, tablet.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, store.DeviceStateInUse, device.State)
+	})
+
+	t.Run("It_should_start_a_delayed_reservation_once_the_device_is_free", func(t *testing.T) {
+		camera, _ := mock.CreateDevice(ctx, testTenant, "Camera", "Acme", store.DeviceStateAvailable)
+		_, _, err := svc.CheckoutDevice(ctx, camera.ID, Checkout{Assignee: "bob"})
+		assert.NoError(t, err)
+		reservation, err := svc.CreateReservation(ctx, camera.ID, store.Reservation{StartsAt: now, EndsAt: now.Add(time.Hour)})
+		assert.NoError(t, err)
+
+		started, _, err := svc.AdvanceReservations(ctx, now.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, started)
+
+		_, _, err = svc.CheckinDevice(ctx, camera.ID)
+		assert.NoError(t, err)
+
+		started, _, err = svc.AdvanceReservations(ctx, now.Add(2*time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, started)
+
+		page, err := svc.ListReservations(ctx, store.ReservationFilter{DeviceID: camera.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, reservation.ID, page.Reservations[0].ID)
+		assert.Equal(t, store.ReservationActive, page.Reservations[0].Status)
+	})
+}
+
+func TestAccessService(t *testing.T) {
+	ctx := WithTenant(context.Background(), testTenant)
+	access := NewAccessService(mockstore.NewMockAccessStore())
+
+	role, err := access.CreateRole(ctx, "viewer", []string{auth.ScopeDevicesRead})
+	assert.NoError(t, err)
+	_, err = access.CreateRole(ctx, "viewer", nil)
+	assert.ErrorIs(t, err, ErrRoleExists)
+
+	_, err = access.UpdateRole(ctx, 99, nil)
+	assert.ErrorIs(t, err, ErrRoleNotFound)
+
+	grant, err := access.CreateGrant(ctx, "jane", role.ID, "Acme")
+	assert.NoError(t, err)
+	assert.Equal(t, "viewer", grant.Role)
+	_, err = access.CreateGrant(ctx, "jane", role.ID, "ACME")
+	assert.ErrorIs(t, err, ErrGrantExists)
+	_, err = access.CreateGrant(ctx, "jane", 99, "Acme")
+	assert.ErrorIs(t, err, ErrRoleNotFound)
+
+	// Roles and grants are invisible to the other tenants.
+	globex := WithTenant(context.Background(), "globex")
+	roles, err := access.ListRoles(globex)
+	assert.NoError(t, err)
+	assert.Empty(t, roles)
+	_, err = access.CreateRole(globex, "viewer", []string{auth.ScopeDevicesRead})
+	assert.NoError(t, err)
+	_, err = access.CreateGrant(globex, "jane", role.ID, "")
+	assert.ErrorIs(t, err, ErrRoleNotFound)
+	assert.ErrorIs(t, access.DeleteGrant(globex, grant.ID), ErrGrantNotFound)
+	jane := auth.WithPrincipal(globex, auth.Principal{Subject: "jane", Scopes: auth.Scopes})
+	brands, err := access.BrandAccess(jane, auth.ScopeDevicesRead)
+	assert.NoError(t, err)
+	assert.False(t, brands.All)
+	assert.Empty(t, brands.Brands)
+	_, err = access.ListRoles(context.Background())
+	assert.ErrorIs(t, err, ErrTenantRequired)
+
+	// Deleting a role takes its grants with it.
+	assert.NoError(t, access.DeleteRole(ctx, role.ID))
+	grants, err := access.ListGrants(ctx, "jane")
+	assert.NoError(t, err)
+	assert.Empty(t, grants)
+	assert.ErrorIs(t, access.DeleteGrant(ctx, grant.ID), ErrGrantNotFound)
 }
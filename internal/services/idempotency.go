@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used for a different request")
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+const (
+	// DefaultIdempotencyTTL is how long responses are kept for replay.
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// DefaultIdempotencyLease is how long a request holds its key before a
+	// retry may take it over, should it never complete or release it, as when
+	// the process dies.
+	DefaultIdempotencyLease = time.Minute
+)
+
+type IdempotencyService struct {
+	Store store.IdempotencyStore
+	TTL   time.Duration
+	Lease time.Duration
+}
+
+func NewIdempotencyService(store store.IdempotencyStore) *IdempotencyService {
+	return &IdempotencyService{Store: store, TTL: DefaultIdempotencyTTL, Lease: DefaultIdempotencyLease}
+}
+
+// Begin claims key for the request identified by fingerprint, for the length
+// of the lease. It returns nil when the request should run, or the stored
+// response when the same request already completed under key.
+func (s *IdempotencyService) Begin(ctx context.Context, key, fingerprint string) (*store.IdempotencyKey, error) {
+	holder, claimed, err := s.Store.ClaimIdempotencyKey(ctx, key, fingerprint, time.Now().Add(s.Lease))
+	if err != nil {
+		return nil, err
+	}
+	if claimed {
+		return nil, nil
+	}
+
+	if holder.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !holder.Completed() {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return &holder, nil
+}
+
+// Complete stores the response to replay for key, for the TTL.
+func (s *IdempotencyService) Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	return s.Store.CompleteIdempotencyKey(ctx, key, statusCode, contentType, body, time.Now().Add(s.TTL))
+}
+
+// Release gives up a key whose request did not produce a response worth
+// replaying, so that it can be retried.
+func (s *IdempotencyService) Release(ctx context.Context, key string) error {
+	return s.Store.ReleaseIdempotencyKey(ctx, key)
+}
+
+// RunPurger removes expired keys right away and then every interval, until
+// ctx is done, like DeviceService.RunPurger.
+func (s *IdempotencyService) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.Store.PurgeExpiredIdempotencyKeys(ctx, time.Now())
+		if err != nil {
+			fmt.Println("purge expired idempotency keys:", err)
+		} else if purged > 0 {
+			fmt.Printf("Purged %d expired idempotency keys\n", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
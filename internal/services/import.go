@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"slices"
+
+	"github.com/danielllmuniz/devices-api/internal/auth"
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+// ImportBatchSize is the number of devices sent to the store at once.
+const ImportBatchSize = 1000
+
+// ImportDevices creates the devices in batches of ImportBatchSize, recording
+// a creation event for each. The whole import is one transaction: either
+// every device is created or none is.
+func (s *DeviceService) ImportDevices(ctx context.Context, devices []store.Device) ([]store.Device, error) {
+	brands := make([]string, len(devices))
+	for i, device := range devices {
+		brands[i] = device.Brand
+	}
+	if err := s.authorize(ctx, auth.ScopeDevicesWrite, brands...); err != nil {
+		return nil, err
+	}
+
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var imported []store.Device
+	err = s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		imported = make([]store.Device, 0, len(devices))
+		for batch := range slices.Chunk(devices, ImportBatchSize) {
+			created, err := tx.CreateDevices(ctx, tenantID, batch)
+			if err != nil {
+				return err
+			}
+
+			events := make([]store.DeviceEvent, len(created))
+			for i := range created {
+				events[i] = newEvent(ctx, store.DeviceEventCreated, created[i].ID, nil, &created[i])
+			}
+			if err := tx.CreateDeviceEvents(ctx, tenantID, events); err != nil {
+				return err
+			}
+			imported = append(imported, created...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return imported, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PurgeDeletedDevices removes for good the devices of every tenant soft
+// deleted more than retention ago. Their history is kept.
+func (s *DeviceService) PurgeDeletedDevices(ctx context.Context, retention time.Duration) (int64, error) {
+	tenants, err := s.Store.ListTenants(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deletedBefore := time.Now().Add(-retention)
+	var purged int64
+	for _, tenantID := range tenants {
+		n, err := s.Store.PurgeDeletedDevices(ctx, tenantID, deletedBefore)
+		if err != nil {
+			return purged, fmt.Errorf("tenant %s: %w", tenantID, err)
+		}
+		purged += n
+	}
+	return purged, nil
+}
+
+// RunPurger purges deleted devices right away and then every interval, until
+// ctx is done. Failures are logged and retried on the next tick.
+func (s *DeviceService) RunPurger(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeDeletedDevices(ctx, retention)
+		if err != nil {
+			fmt.Println("purge deleted devices:", err)
+		} else if purged > 0 {
+			fmt.Printf("Purged %d deleted devices\n", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
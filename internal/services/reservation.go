@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/danielllmuniz/devices-api/internal/auth"
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+var (
+	ErrReservationConflict = errors.New("the slot overlaps another reservation of the device")
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrReservationEnded    = errors.New("reservation has already ended")
+	ErrDeviceReserved      = errors.New("device is reserved, cancel the reservation to change its state")
+)
+
+// CreateReservation books the slot of reservation on a device for the actor
+// of ctx. Only its slot and note are used.
+func (s *DeviceService) CreateReservation(ctx context.Context, deviceID int32, reservation store.Reservation) (store.Reservation, error) {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.Reservation{}, err
+	}
+
+	var created store.Reservation
+	err = s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		device, err := tx.GetDeviceByIDForUpdate(ctx, tenantID, deviceID)
+		if err != nil {
+			return deviceError(err)
+		}
+
+		if err := s.authorize(ctx, auth.ScopeDevicesWrite, device.Brand); err != nil {
+			return err
+		}
+
+		created, err = tx.CreateReservation(ctx, tenantID, store.Reservation{
+			DeviceID:   deviceID,
+			ReservedBy: ActorFrom(ctx),
+			StartsAt:   reservation.StartsAt,
+			EndsAt:     reservation.EndsAt,
+			Note:       reservation.Note,
+		})
+		if errors.Is(err, store.ErrOverlap) {
+			return ErrReservationConflict
+		}
+		return err
+	})
+	if err != nil {
+		return store.Reservation{}, err
+	}
+	return created, nil
+}
+
+// ListReservations pages through the reservations of the device in
+// filter.DeviceID, earliest slot first.
+func (s *DeviceService) ListReservations(ctx context.Context, filter store.ReservationFilter) (store.ReservationPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultPageLimit
+	}
+	if filter.Limit > MaxPageLimit {
+		filter.Limit = MaxPageLimit
+	}
+
+	if err := filter.ValidateCursor(); err != nil {
+		return store.ReservationPage{}, err
+	}
+
+	// Checks that the device exists and can be read.
+	if _, err := s.GetDeviceByID(ctx, filter.DeviceID); err != nil {
+		return store.ReservationPage{}, err
+	}
+
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.ReservationPage{}, err
+	}
+	return s.Store.ListReservations(ctx, tenantID, filter)
+}
+
+// CancelReservation frees the slot of a reservation that has not ended. An
+// active reservation ends right away, handing the device back like the end
+// of its slot would.
+func (s *DeviceService) CancelReservation(ctx context.Context, deviceID, id int32) (store.Reservation, error) {
+	tenantID, err := tenantOf(ctx)
+	if err != nil {
+		return store.Reservation{}, err
+	}
+
+	var canceled store.Reservation
+	err = s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		device, err := tx.GetDeviceByIDForUpdate(ctx, tenantID, deviceID)
+		if err != nil {
+			return deviceError(err)
+		}
+
+		if err := s.authorize(ctx, auth.ScopeDevicesWrite, device.Brand); err != nil {
+			return err
+		}
+
+		reservation, err := tx.GetReservationForUpdate(ctx, tenantID, id)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && reservation.DeviceID != deviceID) {
+			return ErrReservationNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		switch reservation.Status {
+		case store.ReservationScheduled, store.ReservationDelayed:
+		case store.ReservationActive:
+			if err := s.releaseDevice(ctx, tx, tenantID, device); err != nil {
+				return err
+			}
+		default:
+			return ErrReservationEnded
+		}
+
+		canceled, err = tx.SetReservationStatus(ctx, tenantID, id, store.ReservationCanceled)
+		return err
+	})
+	if err != nil {
+		return store.Reservation{}, err
+	}
+	return canceled, nil
+}
+
+// releaseDevice makes the device of a reservation that ended available
+// again. A device that left in-use in the meantime, or was checked out, is
+// left alone.
+func (s *DeviceService) releaseDevice(ctx context.Context, tx store.DeviceStore, tenantID string, device store.Device) error {
+	if device.State != store.DeviceStateInUse || s.Transitions.Check(device.State, store.DeviceStateAvailable) != nil {
+		return nil
+	}
+
+	_, err := tx.GetOpenAssignment(ctx, tenantID, device.ID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	available := store.DeviceStateAvailable
+	released, err := tx.PatchDevice(ctx, tenantID, device.ID, device.Version, store.DevicePatch{State: &available})
+	if err != nil {
+		return err
+	}
+	return recordEvent(ctx, tx, tenantID, store.DeviceEventReservationEnded, device.ID, &device, &released)
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+// AdvanceReservations moves the reservations of every tenant along as of now:
+// those whose slot ended are completed, handing their device back, and those
+// whose slot started put their device in use. A reservation whose device is
+// not available at the start is delayed, which the reserver can see, and
+// retried on the next call until its slot ends, when it expires. Each reservation is handled in its own transaction
+// and skipped if another replica got to it first. It returns how many
+// reservations were started and ended.
+func (s *DeviceService) AdvanceReservations(ctx context.Context, now time.Time) (started, ended int, err error) {
+	tenants, err := s.Store.ListTenants(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var errs []error
+	for _, tenantID := range tenants {
+		// Ending first lets back to back slots hand the device over at once.
+		err := s.eachReservation(ctx, tenantID, store.ReservationFilter{Statuses: []store.ReservationStatus{store.ReservationActive}, EndsBefore: &now}, func(reservation store.Reservation) error {
+			ok, err := s.endReservation(ctx, tenantID, reservation)
+			if ok {
+				ended++
+			}
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenantID, err))
+		}
+
+		err = s.eachReservation(ctx, tenantID, store.ReservationFilter{Statuses: []store.ReservationStatus{store.ReservationScheduled, store.ReservationDelayed}, StartsBefore: &now}, func(reservation store.Reservation) error {
+			ok, err := s.startReservation(ctx, tenantID, reservation, now)
+			if ok {
+				started++
+			}
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenantID, err))
+		}
+	}
+	return started, ended, errors.Join(errs...)
+}
+
+// eachReservation calls fn for every reservation of tenantID matching filter.
+// A failure of fn does not stop the others.
+func (s *DeviceService) eachReservation(ctx context.Context, tenantID string, filter store.ReservationFilter, fn func(store.Reservation) error) error {
+	filter.Limit = MaxPageLimit
+
+	var errs []error
+	for {
+		page, err := s.Store.ListReservations(ctx, tenantID, filter)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		for _, reservation := range page.Reservations {
+			if err := fn(reservation); err != nil {
+				errs = append(errs, fmt.Errorf("reservation %d: %w", reservation.ID, err))
+			}
+		}
+		if page.NextCursor == nil {
+			return errors.Join(errs...)
+		}
+		filter.After = page.NextCursor
+	}
+}
+
+func (s *DeviceService) startReservation(ctx context.Context, tenantID string, reservation store.Reservation, now time.Time) (bool, error) {
+	ctx = WithActor(ctx, reservation.ReservedBy)
+
+	started, delayed := false, ""
+	err := s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		// The device is locked before the reservation, like cancellations
+		// do, so that the two cannot deadlock.
+		device, err := tx.GetDeviceByIDForUpdate(ctx, tenantID, reservation.DeviceID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		deviceFound := err == nil
+
+		reservation, err := tx.GetReservationForUpdate(ctx, tenantID, reservation.ID)
+		if err != nil || (reservation.Status != store.ReservationScheduled && reservation.Status != store.ReservationDelayed) {
+			return err
+		}
+
+		if !reservation.EndsAt.After(now) {
+			_, err := tx.SetReservationStatus(ctx, tenantID, reservation.ID, store.ReservationExpired)
+			return err
+		}
+
+		if !deviceFound || device.State != store.DeviceStateAvailable || s.Transitions.Check(device.State, store.DeviceStateInUse) != nil {
+			if reservation.Status == store.ReservationDelayed {
+				return nil
+			}
+			delayed = "the device was deleted"
+			if deviceFound {
+				delayed = "the device is " + string(device.State)
+			}
+			_, err := tx.SetReservationStatus(ctx, tenantID, reservation.ID, store.ReservationDelayed)
+			return err
+		}
+
+		inUse := store.DeviceStateInUse
+		deviceUpdated, err := tx.PatchDevice(ctx, tenantID, device.ID, device.Version, store.DevicePatch{State: &inUse})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.SetReservationStatus(ctx, tenantID, reservation.ID, store.ReservationActive); err != nil {
+			return err
+		}
+		started = true
+		return recordEvent(ctx, tx, tenantID, store.DeviceEventReservationStarted, device.ID, &device, &deviceUpdated)
+	})
+	if err == nil && delayed != "" {
+		fmt.Printf("Delayed reservation %d of tenant %s: %s\n", reservation.ID, tenantID, delayed)
+	}
+	return started && err == nil, err
+}
+
+func (s *DeviceService) endReservation(ctx context.Context, tenantID string, reservation store.Reservation) (bool, error) {
+	ctx = WithActor(ctx, reservation.ReservedBy)
+
+	ended := false
+	err := s.Store.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		device, err := tx.GetDeviceByIDForUpdate(ctx, tenantID, reservation.DeviceID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		deviceFound := err == nil
+
+		reservation, err := tx.GetReservationForUpdate(ctx, tenantID, reservation.ID)
+		if err != nil || reservation.Status != store.ReservationActive {
+			return err
+		}
+
+		if deviceFound {
+			if err := s.releaseDevice(ctx, tx, tenantID, device); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.SetReservationStatus(ctx, tenantID, reservation.ID, store.ReservationCompleted); err != nil {
+			return err
+		}
+		ended = true
+		return nil
+	})
+	return ended && err == nil, err
+}
+
+// RunReservationScheduler advances the reservations right away and then
+// every interval, until ctx is done. Failures are logged and retried on the
+// next tick.
+func (s *DeviceService) RunReservationScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		started, ended, err := s.AdvanceReservations(ctx, time.Now())
+		if err != nil {
+			fmt.Println("advance reservations:", err)
+		}
+		if started > 0 || ended > 0 {
+			fmt.Printf("Started %d and ended %d reservations\n", started, ended)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTenantRequired is returned by device calls made without a tenant in the
+// context. There is no fallback, so a caller that lost it sees nothing
+// rather than the devices of another tenant.
+var ErrTenantRequired = errors.New("tenant is required")
+
+// WithTenant returns a context whose device calls only see and change the
+// devices of tenantID.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenantID)
+}
+
+func TenantFrom(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantKey).(string)
+	return tenantID
+}
+
+func tenantOf(ctx context.Context) (string, error) {
+	tenantID := TenantFrom(ctx)
+	if tenantID == "" {
+		return "", ErrTenantRequired
+	}
+	return tenantID, nil
+}
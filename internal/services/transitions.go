@@ -0,0 +1,100 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+var ErrIllegalTransition = errors.New("illegal state transition")
+
+// IllegalTransitionError is returned when a device is asked to move to a
+// state its current state does not lead to. It matches ErrIllegalTransition.
+type IllegalTransitionError struct {
+	From    store.DeviceState
+	To      store.DeviceState
+	Allowed []store.DeviceState
+}
+
+func (e *IllegalTransitionError) Error() string {
+	allowed := make([]string, len(e.Allowed))
+	for i, state := range e.Allowed {
+		allowed[i] = string(state)
+	}
+	if len(allowed) == 0 {
+		return fmt.Sprintf("%s: %s devices cannot change state", ErrIllegalTransition, e.From)
+	}
+	return fmt.Sprintf("%s: %s devices can only move to %s", ErrIllegalTransition, e.From, strings.Join(allowed, ", "))
+}
+
+func (e *IllegalTransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// Transitions lists, for each state, the states a device may move to next.
+// Staying in the same state is always allowed.
+type Transitions map[store.DeviceState][]store.DeviceState
+
+// DefaultTransitions requires inactive devices to be made available again
+// before they can be used.
+var DefaultTransitions = Transitions{
+	store.DeviceStateAvailable: {store.DeviceStateInUse, store.DeviceStateInactive},
+	store.DeviceStateInUse:     {store.DeviceStateAvailable, store.DeviceStateInactive},
+	store.DeviceStateInactive:  {store.DeviceStateAvailable},
+}
+
+func (t Transitions) Allowed(from store.DeviceState) []store.DeviceState {
+	return t[from]
+}
+
+// Check returns an *IllegalTransitionError if from cannot move to to.
+func (t Transitions) Check(from, to store.DeviceState) error {
+	if from == to || slices.Contains(t[from], to) {
+		return nil
+	}
+	return &IllegalTransitionError{From: from, To: to, Allowed: t.Allowed(from)}
+}
+
+// LoadTransitions reads a transition table from JSON, e.g.
+//
+//	{"available": ["in-use", "inactive"], "inactive": ["available"]}
+//
+// States missing from the table cannot move anywhere.
+func LoadTransitions(r io.Reader) (Transitions, error) {
+	var transitions Transitions
+	if err := json.NewDecoder(r).Decode(&transitions); err != nil {
+		return nil, fmt.Errorf("decode transitions: %w", err)
+	}
+
+	for from, targets := range transitions {
+		if !isDeviceState(from) {
+			return nil, fmt.Errorf("transitions: unknown state %q", from)
+		}
+		for _, to := range targets {
+			if !isDeviceState(to) {
+				return nil, fmt.Errorf("transitions: unknown state %q in %q", to, from)
+			}
+		}
+	}
+	return transitions, nil
+}
+
+func LoadTransitionsFile(path string) (Transitions, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadTransitions(f)
+}
+
+func isDeviceState(state store.DeviceState) bool {
+	return state == store.DeviceStateAvailable || state == store.DeviceStateInUse || state == store.DeviceStateInactive
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Role is a named set of permissions, such as "devices:read".
+type Role struct {
+	ID          int32     `json:"id"`
+	Name        string    `json:"name"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Grant gives a subject the permissions of a role, on the devices of Brand
+// or, when Brand is empty, on every device.
+type Grant struct {
+	ID        int32     `json:"id"`
+	Subject   string    `json:"subject"`
+	RoleID    int32     `json:"role_id"`
+	Role      string    `json:"role"`
+	Brand     string    `json:"brand,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BrandAccess is what a subject may do something to: every device when All
+// is set, otherwise the devices of Brands.
+type BrandAccess struct {
+	All    bool
+	Brands []string
+}
+
+// AccessStore keeps the roles and grants of every tenant apart: each call
+// only sees and writes those of tenantID.
+type AccessStore interface {
+	// CreateRole returns ErrConflict when the name is taken.
+	CreateRole(ctx context.Context, tenantID, name string, permissions []string) (Role, error)
+	ListRoles(ctx context.Context, tenantID string) ([]Role, error)
+	// UpdateRole replaces the permissions of the role, or returns
+	// ErrNotFound.
+	UpdateRole(ctx context.Context, tenantID string, id int32, permissions []string) (Role, error)
+	// DeleteRole removes the role and its grants, or returns ErrNotFound.
+	DeleteRole(ctx context.Context, tenantID string, id int32) error
+	// CreateGrant returns ErrConflict when the subject already has the role
+	// on the brand, and ErrNotFound when the role does not exist.
+	CreateGrant(ctx context.Context, tenantID, subject string, roleID int32, brand string) (Grant, error)
+	// ListGrants lists the grants of subject, or every grant when subject is
+	// empty.
+	ListGrants(ctx context.Context, tenantID, subject string) ([]Grant, error)
+	DeleteGrant(ctx context.Context, tenantID string, id int32) error
+	// GetBrandAccess returns where the grants of subject hold permission.
+	GetBrandAccess(ctx context.Context, tenantID, subject, permission string) (BrandAccess, error)
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// APIKey is a key clients authenticate with. Only a hash of the secret is
+// stored; Prefix identifies the key and is shown in listings. The key only
+// acts for TenantID.
+type APIKey struct {
+	ID        int32
+	TenantID  string
+	Name      string
+	Prefix    string
+	Hash      []byte
+	Scopes    []string
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+func (k APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// APIKeyStore keeps the keys of every tenant apart, except for
+// GetAPIKeyByPrefix, which finds the key before the tenant is known.
+type APIKeyStore interface {
+	// CreateAPIKey stores key in the tenant of key.TenantID.
+	CreateAPIKey(ctx context.Context, key APIKey) (APIKey, error)
+	// GetAPIKeyByPrefix returns the key with the given prefix, revoked or
+	// not and whatever its tenant, or ErrNotFound.
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (APIKey, error)
+	ListAPIKeys(ctx context.Context, tenantID string) ([]APIKey, error)
+	// RevokeAPIKey marks the key as revoked, or returns ErrNotFound when
+	// there is no such key still active.
+	RevokeAPIKey(ctx context.Context, tenantID string, id int32) error
+}
@@ -0,0 +1,67 @@
+package store
+
+import "time"
+
+// Assignment records that a device was checked out to an assignee. It stays
+// open, with CheckedInAt nil, until the device is checked back in; a device
+// has at most one open assignment.
+type Assignment struct {
+	ID           int32      `json:"id"`
+	DeviceID     int32      `json:"device_id"`
+	Assignee     string     `json:"assignee"`
+	DueAt        *time.Time `json:"due_at"`
+	Note         string     `json:"note"`
+	CheckedOutAt time.Time  `json:"checked_out_at"`
+	CheckedInAt  *time.Time `json:"checked_in_at"`
+	// Device is the assigned device as it is now. Only lists fill it in.
+	Device *Device `json:"device,omitempty"`
+}
+
+// Overdue reports whether the device is still out after its due date.
+func (a Assignment) Overdue(now time.Time) bool {
+	return a.CheckedInAt == nil && a.DueAt != nil && a.DueAt.Before(now)
+}
+
+// assignmentCursorSort marks cursors handed out by the assignment lists,
+// which always list the latest checkouts first.
+const assignmentCursorSort = "-checked_out"
+
+// AssignmentFilter selects assignments; zero fields match everything.
+type AssignmentFilter struct {
+	Assignee string
+	// Open keeps only the assignments of devices that are still out.
+	Open bool
+	// Overdue keeps only the open assignments past their due date.
+	Overdue bool
+	// Brands keeps only the assignments of devices of these brands, compared
+	// case-insensitively like the device list does.
+	Brands []string
+	Limit  int32
+	After  *Cursor
+}
+
+func (f AssignmentFilter) ValidateCursor() error {
+	if f.After != nil && (f.After.Sort != assignmentCursorSort || len(f.After.Values) != 0) {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+type AssignmentPage struct {
+	Assignments []Assignment
+	NextCursor  *Cursor
+}
+
+// NewAssignmentPage builds a page from up to filter.Limit+1 assignments, like
+// NewDevicePage.
+func NewAssignmentPage(assignments []Assignment, filter AssignmentFilter) AssignmentPage {
+	if int32(len(assignments)) <= filter.Limit {
+		return AssignmentPage{Assignments: assignments}
+	}
+
+	assignments = assignments[:filter.Limit]
+	return AssignmentPage{
+		Assignments: assignments,
+		NextCursor:  &Cursor{Sort: assignmentCursorSort, ID: assignments[len(assignments)-1].ID},
+	}
+}
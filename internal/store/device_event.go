@@ -0,0 +1,74 @@
+package store
+
+import "time"
+
+type DeviceEventType string
+
+const (
+	DeviceEventCreated  DeviceEventType = "created"
+	DeviceEventUpdated  DeviceEventType = "updated"
+	DeviceEventPatched  DeviceEventType = "patched"
+	DeviceEventDeleted  DeviceEventType = "deleted"
+	DeviceEventRestored DeviceEventType = "restored"
+	// DeviceEventCheckedOut and DeviceEventCheckedIn record the state
+	// changes made by checkouts and checkins.
+	DeviceEventCheckedOut DeviceEventType = "checked_out"
+	DeviceEventCheckedIn  DeviceEventType = "checked_in"
+	// DeviceEventReservationStarted and DeviceEventReservationEnded record
+	// the state changes made by the reservation scheduler.
+	DeviceEventReservationStarted DeviceEventType = "reservation_started"
+	DeviceEventReservationEnded   DeviceEventType = "reservation_ended"
+)
+
+// DeviceEventTypes lists every event type, in the order of the Postgres
+// enum.
+var DeviceEventTypes = []DeviceEventType{DeviceEventCreated, DeviceEventUpdated, DeviceEventPatched, DeviceEventDeleted, DeviceEventRestored, DeviceEventCheckedOut, DeviceEventCheckedIn, DeviceEventReservationStarted, DeviceEventReservationEnded}
+
+// DeviceEvent records one change to a device. Old is nil for creations and
+// New is nil for deletions.
+type DeviceEvent struct {
+	ID        int32           `json:"id"`
+	DeviceID  int32           `json:"device_id"`
+	Type      DeviceEventType `json:"type"`
+	Old       *Device         `json:"old"`
+	New       *Device         `json:"new"`
+	Actor     string          `json:"actor"`
+	RequestID string          `json:"request_id"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// eventCursorSort marks cursors handed out by the history endpoint, which
+// always lists the newest events first.
+const eventCursorSort = "-id"
+
+type DeviceEventFilter struct {
+	DeviceID int32
+	Limit    int32
+	After    *Cursor
+}
+
+func (f DeviceEventFilter) ValidateCursor() error {
+	if f.After != nil && (f.After.Sort != eventCursorSort || len(f.After.Values) != 0) {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+type DeviceEventPage struct {
+	Events     []DeviceEvent
+	NextCursor *Cursor
+}
+
+// NewDeviceEventPage builds a page from up to filter.Limit+1 events, like
+// NewDevicePage.
+func NewDeviceEventPage(events []DeviceEvent, filter DeviceEventFilter) DeviceEventPage {
+	if int32(len(events)) <= filter.Limit {
+		return DeviceEventPage{Events: events}
+	}
+
+	events = events[:filter.Limit]
+	return DeviceEventPage{
+		Events:     events,
+		NextCursor: &Cursor{Sort: eventCursorSort, ID: events[len(events)-1].ID},
+	}
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSort = errors.New("invalid sort")
+
+const (
+	SortByCreatedAt = "created_at"
+	SortByName      = "name"
+	SortByBrand     = "brand"
+	SortByState     = "state"
+)
+
+var SortableFields = []string{SortByCreatedAt, SortByName, SortByBrand, SortByState}
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// DefaultSort lists the newest devices first.
+var DefaultSort = []SortField{{Field: SortByCreatedAt, Desc: true}}
+
+// ParseSort parses a comma separated list of fields such as
+// "-created_at,name", where a leading "-" means descending order.
+func ParseSort(s string) ([]SortField, error) {
+	var fields []SortField
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		field := SortField{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if !isSortable(field.Field) || seen[field.Field] {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSort, part)
+		}
+		seen[field.Field] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func FormatSort(fields []SortField) string {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = field.Field
+		if field.Desc {
+			parts[i] = "-" + field.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func isSortable(field string) bool {
+	for _, sortable := range SortableFields {
+		if field == sortable {
+			return true
+		}
+	}
+	return false
+}
+
+// DeviceFilter describes which devices to list and in which order. Empty
+// fields do not restrict the result. Brands match case-insensitively and
+// NameContains is a case-insensitive substring match.
+type DeviceFilter struct {
+	Brands        []string
+	States        []DeviceState
+	NameContains  string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Sort          []SortField
+	Limit         int32
+	After         *Cursor
+	// IncludeDeleted also lists soft deleted devices.
+	IncludeDeleted bool
+}
+
+// OrderBy returns the effective sort, always ending with the id so the order
+// is stable. The id follows the direction of the last sort field.
+func (f DeviceFilter) OrderBy() []SortField {
+	fields := f.Sort
+	if len(fields) == 0 {
+		fields = DefaultSort
+	}
+	return append(append([]SortField{}, fields...), SortField{Field: "id", Desc: fields[len(fields)-1].Desc})
+}
+
+// CursorFor returns the cursor pointing right after device.
+func (f DeviceFilter) CursorFor(device Device) Cursor {
+	sort := f.Sort
+	if len(sort) == 0 {
+		sort = DefaultSort
+	}
+
+	values := make([]string, len(sort))
+	for i, field := range sort {
+		values[i] = SortValue(device, field.Field)
+	}
+	return Cursor{Sort: FormatSort(sort), Values: values, ID: device.ID}
+}
+
+// ValidateCursor checks the cursor was issued for the same sort.
+func (f DeviceFilter) ValidateCursor() error {
+	if f.After == nil {
+		return nil
+	}
+
+	sort := f.Sort
+	if len(sort) == 0 {
+		sort = DefaultSort
+	}
+	if f.After.Sort != FormatSort(sort) || len(f.After.Values) != len(sort) {
+		return ErrInvalidCursor
+	}
+	for i, field := range sort {
+		if field.Field == SortByCreatedAt {
+			if _, err := time.Parse(time.RFC3339Nano, f.After.Values[i]); err != nil {
+				return ErrInvalidCursor
+			}
+		}
+	}
+	return nil
+}
+
+// SortValue returns the textual value of a sortable field, as stored in
+// cursors.
+func SortValue(device Device, field string) string {
+	switch field {
+	case SortByName:
+		return device.Name
+	case SortByBrand:
+		return device.Brand
+	case SortByState:
+		return string(device.State)
+	default:
+		return device.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
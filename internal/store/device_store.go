@@ -13,22 +13,95 @@ const (
 	DeviceStateInactive  DeviceState = "inactive"
 )
 
+// DefaultTenant owns the devices created before tenants were introduced,
+// and every device when the API runs without authentication.
+const DefaultTenant = "default"
+
 type Device struct {
 	ID        int32       `json:"id"`
 	Name      string      `json:"name"`
 	Brand     string      `json:"brand"`
 	State     DeviceState `json:"state"`
 	CreatedAt time.Time   `json:"created_at"`
+	Version   int32       `json:"version"`
+	// DeletedAt is set once the device is soft deleted.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// DevicePatch is a partial update: nil fields are left unchanged.
+type DevicePatch struct {
+	Name  *string
+	Brand *string
+	State *DeviceState
+}
+
+// IsEmpty reports whether the patch changes nothing.
+func (p DevicePatch) IsEmpty() bool {
+	return p.Name == nil && p.Brand == nil && p.State == nil
 }
 
+// DeviceStore keeps the devices of every tenant apart: each call only sees
+// and writes the devices and events of tenantID.
 type DeviceStore interface {
-	CreateDevice(ctx context.Context, name, brand string, state DeviceState) (Device, error)
-	UpdateDevice(ctx context.Context, id int32, name, brand string, state DeviceState) (Device, error)
-	PatchDevice(ctx context.Context, id int32, name, brand string, state DeviceState) (Device, error)
-	GetDeviceByID(ctx context.Context, id int32) (Device, error)
-	GetAllDevices(ctx context.Context) ([]Device, error)
-	GetDevicesByBrand(ctx context.Context, brand string) ([]Device, error)
-	GetDevicesByState(ctx context.Context, state DeviceState) ([]Device, error)
-	GetDevicesByBrandAndState(ctx context.Context, brand string, state DeviceState) ([]Device, error)
-	DeleteDevice(ctx context.Context, id int32) (int32, error)
+	CreateDevice(ctx context.Context, tenantID, name, brand string, state DeviceState) (Device, error)
+	// CreateDevices inserts many devices at once, taking only their name,
+	// brand and state, and returns them in the same order.
+	CreateDevices(ctx context.Context, tenantID string, devices []Device) ([]Device, error)
+	UpdateDevice(ctx context.Context, tenantID string, id, version int32, name, brand string, state DeviceState) (Device, error)
+	PatchDevice(ctx context.Context, tenantID string, id, version int32, patch DevicePatch) (Device, error)
+	GetDeviceByID(ctx context.Context, tenantID string, id int32) (Device, error)
+	// GetDeviceByIDForUpdate reads the device and keeps it locked against
+	// concurrent writers until the surrounding transaction ends.
+	GetDeviceByIDForUpdate(ctx context.Context, tenantID string, id int32) (Device, error)
+	ListDevices(ctx context.Context, tenantID string, filter DeviceFilter) (DevicePage, error)
+	// ExportDevices calls fn for every device matching the filter, in its sort
+	// order, without holding them all in memory. The limit and cursor of the
+	// filter are ignored. It stops at the first error returned by fn.
+	ExportDevices(ctx context.Context, tenantID string, filter DeviceFilter, fn func(Device) error) error
+	// DeleteDevice soft deletes the device: it is hidden from reads until
+	// restored or purged.
+	DeleteDevice(ctx context.Context, tenantID string, id int32) (int32, error)
+	// RestoreDevice undoes a soft delete. It returns ErrNotFound unless the
+	// device exists and is deleted.
+	RestoreDevice(ctx context.Context, tenantID string, id int32) (Device, error)
+	// PurgeDeletedDevices removes for good the devices deleted before the
+	// given time and returns how many were removed.
+	PurgeDeletedDevices(ctx context.Context, tenantID string, deletedBefore time.Time) (int64, error)
+	// ListTenants returns every tenant that ever had a device, for the jobs
+	// that go over all of them.
+	ListTenants(ctx context.Context) ([]string, error)
+	CreateDeviceEvent(ctx context.Context, tenantID string, event DeviceEvent) (DeviceEvent, error)
+	CreateDeviceEvents(ctx context.Context, tenantID string, events []DeviceEvent) error
+	// ListDeviceEvents returns the events of a device, newest first.
+	ListDeviceEvents(ctx context.Context, tenantID string, filter DeviceEventFilter) (DeviceEventPage, error)
+	// CreateAssignment opens an assignment of a device, taking only its
+	// device id, assignee, due date and note. It fails with ErrConflict when
+	// the device already has an open one.
+	CreateAssignment(ctx context.Context, tenantID string, assignment Assignment) (Assignment, error)
+	// GetOpenAssignment returns the open assignment of a device, or
+	// ErrNotFound when it is not checked out.
+	GetOpenAssignment(ctx context.Context, tenantID string, deviceID int32) (Assignment, error)
+	// CloseAssignment checks the assignment in. It returns ErrNotFound unless
+	// the assignment exists and is open.
+	CloseAssignment(ctx context.Context, tenantID string, id int32) (Assignment, error)
+	// ListAssignments returns the matching assignments with their device,
+	// latest checkout first.
+	ListAssignments(ctx context.Context, tenantID string, filter AssignmentFilter) (AssignmentPage, error)
+	// CreateReservation books the slot of a reservation, taking only its
+	// device id, reserver, slot and note. It fails with ErrOverlap when the
+	// slot overlaps a reservation of the device that was not canceled or
+	// expired.
+	CreateReservation(ctx context.Context, tenantID string, reservation Reservation) (Reservation, error)
+	// GetReservationForUpdate reads the reservation and keeps it locked until
+	// the surrounding transaction ends.
+	GetReservationForUpdate(ctx context.Context, tenantID string, id int32) (Reservation, error)
+	SetReservationStatus(ctx context.Context, tenantID string, id int32, status ReservationStatus) (Reservation, error)
+	// ListReservations returns the matching reservations, earliest slot
+	// first.
+	ListReservations(ctx context.Context, tenantID string, filter ReservationFilter) (ReservationPage, error)
+	// WithTx runs fn as a single unit of work on the devices of tenantID. The
+	// store handed to fn is bound to the transaction, which commits if fn
+	// returns nil and rolls back otherwise. Calling WithTx on that store
+	// nests through a savepoint.
+	WithTx(ctx context.Context, tenantID string, fn func(DeviceStore) error) error
 }
@@ -0,0 +1,18 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Store implementations translate driver errors into these, so callers can
+// tell a missing row from a failing database.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("conflict")
+	ErrUnavailable = errors.New("store unavailable")
+)
+
+// ErrVersionConflict is returned when a write expected a version of the
+// device that is no longer the current one.
+var ErrVersionConflict = fmt.Errorf("device version conflict: %w", ErrConflict)
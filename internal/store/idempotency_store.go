@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// IdempotencyKey remembers the response to a request sent with an
+// Idempotency-Key header. Until the request completes StatusCode is zero and
+// ExpiresAt ends the lease of the request on the key.
+type IdempotencyKey struct {
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+func (k IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
+
+type IdempotencyStore interface {
+	// ClaimIdempotencyKey records key as in progress until leaseUntil for the
+	// request with the given fingerprint, taking it over if it expired. When
+	// the key is held, it returns the holder and claimed false.
+	ClaimIdempotencyKey(ctx context.Context, key, fingerprint string, leaseUntil time.Time) (holder IdempotencyKey, claimed bool, err error)
+	// CompleteIdempotencyKey stores the response to replay for key until
+	// expiresAt.
+	CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte, expiresAt time.Time) error
+	// ReleaseIdempotencyKey drops a key still in progress, so the request can
+	// be retried.
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	// PurgeExpiredIdempotencyKeys removes the keys expired by the given time
+	// and returns how many were removed.
+	PurgeExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
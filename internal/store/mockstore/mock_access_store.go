@@ -0,0 +1,216 @@
+package mockstore
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+type MockAccessStore struct {
+	mu    sync.Mutex
+	roles []store.Role
+	// roleTenants holds the tenant of each role and grantTenants that of
+	// each grant, like the tenant_id columns of the Postgres store.
+	roleTenants  []string
+	grants       []store.Grant
+	grantTenants []string
+	nextRoleID   int32
+	nextGrantID  int32
+	err          error
+}
+
+func NewMockAccessStore() *MockAccessStore {
+	return &MockAccessStore{nextRoleID: 1, nextGrantID: 1}
+}
+
+// FailWith makes every following call return err. Pass nil to recover.
+func (m *MockAccessStore) FailWith(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.err = err
+}
+
+func (m *MockAccessStore) CreateRole(ctx context.Context, tenantID, name string, permissions []string) (store.Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.Role{}, m.err
+	}
+	for i, role := range m.roles {
+		if m.roleTenants[i] == tenantID && role.Name == name {
+			return store.Role{}, store.ErrConflict
+		}
+	}
+
+	role := store.Role{
+		ID:          m.nextRoleID,
+		Name:        name,
+		Permissions: slices.Clone(permissions),
+		CreatedAt:   time.Now().Round(0),
+	}
+	m.nextRoleID++
+	m.roles = append(m.roles, role)
+	m.roleTenants = append(m.roleTenants, tenantID)
+	return role, nil
+}
+
+func (m *MockAccessStore) ListRoles(ctx context.Context, tenantID string) ([]store.Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return nil, m.err
+	}
+	var roles []store.Role
+	for i, role := range m.roles {
+		if m.roleTenants[i] == tenantID {
+			roles = append(roles, role)
+		}
+	}
+	slices.SortFunc(roles, func(a, b store.Role) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return roles, nil
+}
+
+func (m *MockAccessStore) UpdateRole(ctx context.Context, tenantID string, id int32, permissions []string) (store.Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.Role{}, m.err
+	}
+	i := m.role(tenantID, id)
+	if i < 0 {
+		return store.Role{}, store.ErrNotFound
+	}
+	m.roles[i].Permissions = slices.Clone(permissions)
+	return m.roles[i], nil
+}
+
+func (m *MockAccessStore) DeleteRole(ctx context.Context, tenantID string, id int32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+	i := m.role(tenantID, id)
+	if i < 0 {
+		return store.ErrNotFound
+	}
+	m.roles = slices.Delete(m.roles, i, i+1)
+	m.roleTenants = slices.Delete(m.roleTenants, i, i+1)
+	for j := len(m.grants) - 1; j >= 0; j-- {
+		if m.grants[j].RoleID == id {
+			m.deleteGrant(j)
+		}
+	}
+	return nil
+}
+
+func (m *MockAccessStore) CreateGrant(ctx context.Context, tenantID, subject string, roleID int32, brand string) (store.Grant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.Grant{}, m.err
+	}
+	i := m.role(tenantID, roleID)
+	if i < 0 {
+		return store.Grant{}, store.ErrNotFound
+	}
+	for j, grant := range m.grants {
+		if m.grantTenants[j] == tenantID && grant.Subject == subject && grant.RoleID == roleID && strings.EqualFold(grant.Brand, brand) {
+			return store.Grant{}, store.ErrConflict
+		}
+	}
+
+	grant := store.Grant{
+		ID:        m.nextGrantID,
+		Subject:   subject,
+		RoleID:    roleID,
+		Role:      m.roles[i].Name,
+		Brand:     brand,
+		CreatedAt: time.Now().Round(0),
+	}
+	m.nextGrantID++
+	m.grants = append(m.grants, grant)
+	m.grantTenants = append(m.grantTenants, tenantID)
+	return grant, nil
+}
+
+func (m *MockAccessStore) ListGrants(ctx context.Context, tenantID, subject string) ([]store.Grant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return nil, m.err
+	}
+	var grants []store.Grant
+	for i, grant := range m.grants {
+		if m.grantTenants[i] == tenantID && (subject == "" || grant.Subject == subject) {
+			grants = append(grants, grant)
+		}
+	}
+	return grants, nil
+}
+
+func (m *MockAccessStore) DeleteGrant(ctx context.Context, tenantID string, id int32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+	i := slices.IndexFunc(m.grants, func(grant store.Grant) bool { return grant.ID == id })
+	if i < 0 || m.grantTenants[i] != tenantID {
+		return store.ErrNotFound
+	}
+	m.deleteGrant(i)
+	return nil
+}
+
+func (m *MockAccessStore) GetBrandAccess(ctx context.Context, tenantID, subject, permission string) (store.BrandAccess, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.BrandAccess{}, m.err
+	}
+	var access store.BrandAccess
+	for i, grant := range m.grants {
+		if m.grantTenants[i] != tenantID || grant.Subject != subject {
+			continue
+		}
+		role := m.role(tenantID, grant.RoleID)
+		if !slices.Contains(m.roles[role].Permissions, permission) {
+			continue
+		}
+		if grant.Brand == "" {
+			return store.BrandAccess{All: true}, nil
+		}
+		access.Brands = append(access.Brands, grant.Brand)
+	}
+	return access, nil
+}
+
+// role returns the index of the role id of tenantID, or -1.
+func (m *MockAccessStore) role(tenantID string, id int32) int {
+	i := slices.IndexFunc(m.roles, func(role store.Role) bool { return role.ID == id })
+	if i < 0 || m.roleTenants[i] != tenantID {
+		return -1
+	}
+	return i
+}
+
+func (m *MockAccessStore) deleteGrant(i int) {
+	m.grants = slices.Delete(m.grants, i, i+1)
+	m.grantTenants = slices.Delete(m.grantTenants, i, i+1)
+}
@@ -0,0 +1,100 @@
+package mockstore
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+type MockAPIKeyStore struct {
+	mu     sync.Mutex
+	keys   []store.APIKey
+	nextID int32
+	err    error
+}
+
+func NewMockAPIKeyStore() *MockAPIKeyStore {
+	return &MockAPIKeyStore{nextID: 1}
+}
+
+// FailWith makes every following call return err. Pass nil to recover.
+func (m *MockAPIKeyStore) FailWith(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.err = err
+}
+
+func (m *MockAPIKeyStore) CreateAPIKey(ctx context.Context, key store.APIKey) (store.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.APIKey{}, m.err
+	}
+	for _, existing := range m.keys {
+		if existing.Prefix == key.Prefix {
+			return store.APIKey{}, store.ErrConflict
+		}
+	}
+
+	key.ID = m.nextID
+	key.Hash = slices.Clone(key.Hash)
+	key.Scopes = slices.Clone(key.Scopes)
+	key.CreatedAt = time.Now().Round(0)
+	key.RevokedAt = nil
+	m.nextID++
+	m.keys = append(m.keys, key)
+	return key, nil
+}
+
+func (m *MockAPIKeyStore) GetAPIKeyByPrefix(ctx context.Context, prefix string) (store.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.APIKey{}, m.err
+	}
+	for _, key := range m.keys {
+		if key.Prefix == prefix {
+			return key, nil
+		}
+	}
+	return store.APIKey{}, store.ErrNotFound
+}
+
+func (m *MockAPIKeyStore) ListAPIKeys(ctx context.Context, tenantID string) ([]store.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return nil, m.err
+	}
+	var keys []store.APIKey
+	for _, key := range m.keys {
+		if key.TenantID == tenantID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *MockAPIKeyStore) RevokeAPIKey(ctx context.Context, tenantID string, id int32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+	for i, key := range m.keys {
+		if key.ID == id && key.TenantID == tenantID && !key.Revoked() {
+			now := time.Now().Round(0)
+			m.keys[i].RevokedAt = &now
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
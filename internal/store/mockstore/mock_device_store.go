@@ -1,155 +1,721 @@
 package mockstore
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/danielllmuniz/devices-api/internal/store"
 )
 
 type MockDeviceStore struct {
 	mu      sync.Mutex
+	txMu    sync.Mutex
 	devices map[int32]store.Device
-	nextID  int32
+	// tenants holds the tenant of each device and eventTenants the tenant
+	// of each event, like the tenant_id columns of the Postgres store.
+	tenants      map[int32]string
+	nextID       int32
+	events       []store.DeviceEvent
+	eventTenants []string
+	nextEventID  int32
+	// assignments are indexed by id - 1, so closing one updates it in place.
+	assignments       []store.Assignment
+	assignmentTenants []string
+	// reservations are indexed by id - 1 like assignments.
+	reservations       []store.Reservation
+	reservationTenants []string
+	err                error
 }
 
 func NewMockDeviceStore() *MockDeviceStore {
 	return &MockDeviceStore{
-		devices: make(map[int32]store.Device),
-		nextID:  1,
+		devices:     make(map[int32]store.Device),
+		tenants:     make(map[int32]string),
+		nextID:      1,
+		nextEventID: 1,
 	}
 }
 
-func (m *MockDeviceStore) CreateDevice(ctx context.Context, name, brand string, state store.DeviceState) (store.Device, error) {
+// FailWith makes every following call return err, e.g. store.ErrUnavailable
+// to simulate a database outage. Pass nil to recover.
+func (m *MockDeviceStore) FailWith(err error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.err = err
+}
+
+// device returns the device with id if it belongs to tenantID, which is all
+// the row level security of the Postgres store lets through.
+func (m *MockDeviceStore) device(tenantID string, id int32) (store.Device, bool) {
+	device, ok := m.devices[id]
+	if !ok || m.tenants[id] != tenantID {
+		return store.Device{}, false
+	}
+	return device, true
+}
+
+func (m *MockDeviceStore) CreateDevice(ctx context.Context, tenantID, name, brand string, state store.DeviceState) (store.Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.Device{}, m.err
+	}
+
 	if state != store.DeviceStateAvailable && state != store.DeviceStateInUse && state != store.DeviceStateInactive {
 		return store.Device{}, errors.New("invalid state")
 	}
 
 	device := store.Device{
-		ID:    m.nextID,
-		Name:  name,
-		Brand: brand,
-		State: state,
+		ID:        m.nextID,
+		Name:      name,
+		Brand:     brand,
+		State:     state,
+		CreatedAt: time.Now().Round(0),
+		Version:   1,
 	}
 	m.devices[m.nextID] = device
+	m.tenants[m.nextID] = tenantID
 	m.nextID++
 
 	return device, nil
 }
 
-func (m *MockDeviceStore) UpdateDevice(ctx context.Context, id int32, name, brand string, state store.DeviceState) (store.Device, error) {
+func (m *MockDeviceStore) CreateDevices(ctx context.Context, tenantID string, devices []store.Device) ([]store.Device, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, ok := m.devices[id]; !ok {
-		return store.Device{}, errors.New("device not found")
+	if m.err != nil {
+		return nil, m.err
 	}
 
-	device := store.Device{
-		ID:    id,
-		Name:  name,
-		Brand: brand,
-		State: state,
+	for _, device := range devices {
+		if device.State != store.DeviceStateAvailable && device.State != store.DeviceStateInUse && device.State != store.DeviceStateInactive {
+			return nil, errors.New("invalid state")
+		}
+	}
+
+	createdAt := time.Now().Round(0)
+	created := make([]store.Device, len(devices))
+	for i, device := range devices {
+		created[i] = store.Device{
+			ID:        m.nextID,
+			Name:      device.Name,
+			Brand:     device.Brand,
+			State:     device.State,
+			CreatedAt: createdAt,
+			Version:   1,
+		}
+		m.devices[m.nextID] = created[i]
+		m.tenants[m.nextID] = tenantID
+		m.nextID++
+	}
+	return created, nil
+}
+
+func (m *MockDeviceStore) UpdateDevice(ctx context.Context, tenantID string, id, version int32, name, brand string, state store.DeviceState) (store.Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.Device{}, m.err
+	}
+
+	device, ok := m.device(tenantID, id)
+	if !ok || device.DeletedAt != nil {
+		return store.Device{}, store.ErrNotFound
+	}
+	if device.Version != version {
+		return store.Device{}, store.ErrVersionConflict
 	}
+
+	device.Name = name
+	device.Brand = brand
+	device.State = state
+	device.Version++
 	m.devices[id] = device
 	return device, nil
 }
 
-func (m *MockDeviceStore) PatchDevice(ctx context.Context, id int32, name, brand string, state store.DeviceState) (store.Device, error) {
+func (m *MockDeviceStore) PatchDevice(ctx context.Context, tenantID string, id, version int32, patch store.DevicePatch) (store.Device, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	device, ok := m.devices[id]
-	if !ok {
-		return store.Device{}, errors.New("device not found")
+	if m.err != nil {
+		return store.Device{}, m.err
 	}
 
-	if name != "" {
-		device.Name = name
+	device, ok := m.device(tenantID, id)
+	if !ok || device.DeletedAt != nil {
+		return store.Device{}, store.ErrNotFound
 	}
-	if brand != "" {
-		device.Brand = brand
+	if device.Version != version {
+		return store.Device{}, store.ErrVersionConflict
 	}
-	if state != "" {
-		device.State = state
+
+	if patch.Name != nil {
+		device.Name = *patch.Name
+	}
+	if patch.Brand != nil {
+		device.Brand = *patch.Brand
 	}
+	if patch.State != nil {
+		device.State = *patch.State
+	}
+	device.Version++
 	m.devices[id] = device
 
 	return device, nil
 }
 
-func (m *MockDeviceStore) GetDeviceByID(ctx context.Context, id int32) (store.Device, error) {
+func (m *MockDeviceStore) GetDeviceByID(ctx context.Context, tenantID string, id int32) (store.Device, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	device, ok := m.devices[id]
-	if !ok {
-		return store.Device{}, errors.New("device not found")
+	if m.err != nil {
+		return store.Device{}, m.err
+	}
+
+	device, ok := m.device(tenantID, id)
+	if !ok || device.DeletedAt != nil {
+		return store.Device{}, store.ErrNotFound
 	}
 	return device, nil
 }
 
-func (m *MockDeviceStore) GetAllDevices(ctx context.Context) ([]store.Device, error) {
+func (m *MockDeviceStore) GetDeviceByIDForUpdate(ctx context.Context, tenantID string, id int32) (store.Device, error) {
+	return m.GetDeviceByID(ctx, tenantID, id)
+}
+
+// ListDevices mirrors the SQL built by the Postgres store: filters are
+// combined with AND and the keyset cursor resumes right after the last device
+// of the previous page.
+func (m *MockDeviceStore) ListDevices(ctx context.Context, tenantID string, filter store.DeviceFilter) (store.DevicePage, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.err != nil {
+		return store.DevicePage{}, m.err
+	}
+
+	orderBy := filter.OrderBy()
+
 	var result []store.Device
-	for _, device := range m.devices {
+	for id, device := range m.devices {
+		if m.tenants[id] != tenantID || !matchesFilter(device, filter) {
+			continue
+		}
+		if filter.After != nil && !afterCursor(device, orderBy, *filter.After) {
+			continue
+		}
 		result = append(result, device)
 	}
-	return result, nil
+
+	sort.Slice(result, func(i, j int) bool {
+		for _, field := range orderBy {
+			if c := compareField(result[i], field.Field, sortValue(result[j], field.Field)); c != 0 {
+				return (c < 0) != field.Desc
+			}
+		}
+		return false
+	})
+
+	if int32(len(result)) > filter.Limit+1 {
+		result = result[:filter.Limit+1]
+	}
+	return store.NewDevicePage(result, filter), nil
+}
+
+// ExportDevices lists every matching device at once; the mock has nothing
+// to stream from.
+func (m *MockDeviceStore) ExportDevices(ctx context.Context, tenantID string, filter store.DeviceFilter, fn func(store.Device) error) error {
+	filter.Limit = math.MaxInt32 - 1
+	filter.After = nil
+	page, err := m.ListDevices(ctx, tenantID, filter)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range page.Devices {
+		if err := fn(device); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (m *MockDeviceStore) GetDevicesByBrand(ctx context.Context, brand string) ([]store.Device, error) {
+func matchesFilter(device store.Device, filter store.DeviceFilter) bool {
+	if !filter.IncludeDeleted && device.DeletedAt != nil {
+		return false
+	}
+	if len(filter.Brands) > 0 && !slices.ContainsFunc(filter.Brands, func(brand string) bool {
+		return strings.EqualFold(brand, device.Brand)
+	}) {
+		return false
+	}
+	if len(filter.States) > 0 && !slices.Contains(filter.States, device.State) {
+		return false
+	}
+	if filter.NameContains != "" && !strings.Contains(strings.ToLower(device.Name), strings.ToLower(filter.NameContains)) {
+		return false
+	}
+	if filter.CreatedAfter != nil && !device.CreatedAt.After(*filter.CreatedAfter) {
+		return false
+	}
+	if filter.CreatedBefore != nil && !device.CreatedAt.Before(*filter.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+func afterCursor(device store.Device, orderBy []store.SortField, cursor store.Cursor) bool {
+	values := append(append([]string{}, cursor.Values...), strconv.Itoa(int(cursor.ID)))
+	for i, field := range orderBy {
+		if c := compareField(device, field.Field, values[i]); c != 0 {
+			return (c > 0) != field.Desc
+		}
+	}
+	return false
+}
+
+func sortValue(device store.Device, field string) string {
+	if field == "id" {
+		return strconv.Itoa(int(device.ID))
+	}
+	return store.SortValue(device, field)
+}
+
+// compareField compares a device field against the textual value kept in
+// cursors, returning -1, 0 or +1.
+func compareField(device store.Device, field, value string) int {
+	switch field {
+	case "id":
+		id, _ := strconv.Atoi(value)
+		return cmp.Compare(int(device.ID), id)
+	case store.SortByCreatedAt:
+		createdAt, _ := time.Parse(time.RFC3339Nano, value)
+		return device.CreatedAt.Compare(createdAt)
+	default:
+		return cmp.Compare(store.SortValue(device, field), value)
+	}
+}
+
+func (m *MockDeviceStore) DeleteDevice(ctx context.Context, tenantID string, id int32) (int32, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	var result []store.Device
-	for _, device := range m.devices {
-		if device.Brand == brand {
-			result = append(result, device)
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	device, ok := m.device(tenantID, id)
+	if !ok || device.DeletedAt != nil {
+		return 0, store.ErrNotFound
+	}
+
+	deletedAt := time.Now().Round(0)
+	device.DeletedAt = &deletedAt
+	device.Version++
+	m.devices[id] = device
+	return id, nil
+}
+
+func (m *MockDeviceStore) RestoreDevice(ctx context.Context, tenantID string, id int32) (store.Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.Device{}, m.err
+	}
+
+	device, ok := m.device(tenantID, id)
+	if !ok || device.DeletedAt == nil {
+		return store.Device{}, store.ErrNotFound
+	}
+
+	device.DeletedAt = nil
+	device.Version++
+	m.devices[id] = device
+	return device, nil
+}
+
+func (m *MockDeviceStore) PurgeDeletedDevices(ctx context.Context, tenantID string, deletedBefore time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	var purged int64
+	for id, device := range m.devices {
+		if m.tenants[id] == tenantID && device.DeletedAt != nil && device.DeletedAt.Before(deletedBefore) {
+			delete(m.devices, id)
+			delete(m.tenants, id)
+			purged++
 		}
 	}
-	return result, nil
+	return purged, nil
 }
 
-func (m *MockDeviceStore) GetDevicesByState(ctx context.Context, state store.DeviceState) ([]store.Device, error) {
+func (m *MockDeviceStore) ListTenants(ctx context.Context) ([]string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	var result []store.Device
-	for _, device := range m.devices {
-		if device.State == state {
-			result = append(result, device)
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	tenants := slices.Sorted(maps.Values(m.tenants))
+	return slices.Compact(tenants), nil
+}
+
+func (m *MockDeviceStore) CreateDeviceEvent(ctx context.Context, tenantID string, event store.DeviceEvent) (store.DeviceEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.DeviceEvent{}, m.err
+	}
+
+	event.ID = m.nextEventID
+	event.CreatedAt = time.Now().Round(0)
+	m.events = append(m.events, event)
+	m.eventTenants = append(m.eventTenants, tenantID)
+	m.nextEventID++
+
+	return event, nil
+}
+
+func (m *MockDeviceStore) CreateDeviceEvents(ctx context.Context, tenantID string, events []store.DeviceEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+
+	createdAt := time.Now().Round(0)
+	for _, event := range events {
+		event.ID = m.nextEventID
+		event.CreatedAt = createdAt
+		m.events = append(m.events, event)
+		m.eventTenants = append(m.eventTenants, tenantID)
+		m.nextEventID++
+	}
+	return nil
+}
+
+func (m *MockDeviceStore) ListDeviceEvents(ctx context.Context, tenantID string, filter store.DeviceEventFilter) (store.DeviceEventPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.DeviceEventPage{}, m.err
+	}
+
+	var result []store.DeviceEvent
+	for i, event := range slices.Backward(m.events) {
+		if event.DeviceID != filter.DeviceID || m.eventTenants[i] != tenantID {
+			continue
+		}
+		if filter.After != nil && event.ID >= filter.After.ID {
+			continue
+		}
+		result = append(result, event)
+		if int32(len(result)) > filter.Limit {
+			break
 		}
 	}
-	return result, nil
+	return store.NewDeviceEventPage(result, filter), nil
 }
 
-func (m *MockDeviceStore) GetDevicesByBrandAndState(ctx context.Context, brand string, state store.DeviceState) ([]store.Device, error) {
+func (m *MockDeviceStore) CreateAssignment(ctx context.Context, tenantID string, assignment store.Assignment) (store.Assignment, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	var result []store.Device
-	for _, device := range m.devices {
-		if device.Brand == brand && device.State == state {
-			result = append(result, device)
+	if m.err != nil {
+		return store.Assignment{}, m.err
+	}
+
+	if _, ok := m.device(tenantID, assignment.DeviceID); !ok {
+		return store.Assignment{}, store.ErrConflict
+	}
+	if _, ok := m.openAssignment(tenantID, assignment.DeviceID); ok {
+		return store.Assignment{}, store.ErrConflict
+	}
+
+	created := store.Assignment{
+		ID:           int32(len(m.assignments) + 1),
+		DeviceID:     assignment.DeviceID,
+		Assignee:     assignment.Assignee,
+		DueAt:        assignment.DueAt,
+		Note:         assignment.Note,
+		CheckedOutAt: time.Now().Round(0),
+	}
+	m.assignments = append(m.assignments, created)
+	m.assignmentTenants = append(m.assignmentTenants, tenantID)
+	return created, nil
+}
+
+func (m *MockDeviceStore) openAssignment(tenantID string, deviceID int32) (store.Assignment, bool) {
+	for i, assignment := range m.assignments {
+		if assignment.DeviceID == deviceID && assignment.CheckedInAt == nil && m.assignmentTenants[i] == tenantID {
+			return assignment, true
 		}
 	}
-	return result, nil
+	return store.Assignment{}, false
 }
 
-func (m *MockDeviceStore) DeleteDevice(ctx context.Context, id int32) (int32, error) {
+func (m *MockDeviceStore) GetOpenAssignment(ctx context.Context, tenantID string, deviceID int32) (store.Assignment, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, ok := m.devices[id]; !ok {
-		return 0, errors.New("device not found")
+	if m.err != nil {
+		return store.Assignment{}, m.err
 	}
-	delete(m.devices, id)
-	return id, nil
+
+	assignment, ok := m.openAssignment(tenantID, deviceID)
+	if !ok {
+		return store.Assignment{}, store.ErrNotFound
+	}
+	return assignment, nil
+}
+
+func (m *MockDeviceStore) CloseAssignment(ctx context.Context, tenantID string, id int32) (store.Assignment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.Assignment{}, m.err
+	}
+
+	i := int(id) - 1
+	if i < 0 || i >= len(m.assignments) || m.assignmentTenants[i] != tenantID || m.assignments[i].CheckedInAt != nil {
+		return store.Assignment{}, store.ErrNotFound
+	}
+
+	checkedInAt := time.Now().Round(0)
+	m.assignments[i].CheckedInAt = &checkedInAt
+	return m.assignments[i], nil
+}
+
+func (m *MockDeviceStore) ListAssignments(ctx context.Context, tenantID string, filter store.AssignmentFilter) (store.AssignmentPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.AssignmentPage{}, m.err
+	}
+
+	now := time.Now()
+	var result []store.Assignment
+	for i, assignment := range slices.Backward(m.assignments) {
+		device, ok := m.devices[assignment.DeviceID]
+		if !ok || m.assignmentTenants[i] != tenantID {
+			continue
+		}
+		if filter.Assignee != "" && assignment.Assignee != filter.Assignee {
+			continue
+		}
+		if (filter.Open && assignment.CheckedInAt != nil) || (filter.Overdue && !assignment.Overdue(now)) {
+			continue
+		}
+		if len(filter.Brands) > 0 && !slices.ContainsFunc(filter.Brands, func(brand string) bool {
+			return strings.EqualFold(brand, device.Brand)
+		}) {
+			continue
+		}
+		if filter.After != nil && assignment.ID >= filter.After.ID {
+			continue
+		}
+		assignment.Device = &device
+		result = append(result, assignment)
+		if int32(len(result)) > filter.Limit {
+			break
+		}
+	}
+	return store.NewAssignmentPage(result, filter), nil
+}
+
+// CreateReservation refuses overlapping slots like the exclusion constraint
+// of the Postgres store, which ignores canceled and expired reservations.
+func (m *MockDeviceStore) CreateReservation(ctx context.Context, tenantID string, reservation store.Reservation) (store.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.Reservation{}, m.err
+	}
+
+	if _, ok := m.device(tenantID, reservation.DeviceID); !ok {
+		return store.Reservation{}, store.ErrConflict
+	}
+	if !reservation.StartsAt.Before(reservation.EndsAt) {
+		return store.Reservation{}, errors.New("invalid slot")
+	}
+	for _, other := range m.reservations {
+		if other.DeviceID != reservation.DeviceID || other.Status == store.ReservationCanceled || other.Status == store.ReservationExpired {
+			continue
+		}
+		if other.StartsAt.Before(reservation.EndsAt) && reservation.StartsAt.Before(other.EndsAt) {
+			return store.Reservation{}, store.ErrOverlap
+		}
+	}
+
+	created := store.Reservation{
+		ID:         int32(len(m.reservations) + 1),
+		DeviceID:   reservation.DeviceID,
+		ReservedBy: reservation.ReservedBy,
+		StartsAt:   reservation.StartsAt,
+		EndsAt:     reservation.EndsAt,
+		Note:       reservation.Note,
+		Status:     store.ReservationScheduled,
+		CreatedAt:  time.Now().Round(0),
+	}
+	m.reservations = append(m.reservations, created)
+	m.reservationTenants = append(m.reservationTenants, tenantID)
+	return created, nil
+}
+
+func (m *MockDeviceStore) reservation(tenantID string, id int32) (int, bool) {
+	i := int(id) - 1
+	if i < 0 || i >= len(m.reservations) || m.reservationTenants[i] != tenantID {
+		return 0, false
+	}
+	if _, ok := m.devices[m.reservations[i].DeviceID]; !ok {
+		return 0, false
+	}
+	return i, true
+}
+
+func (m *MockDeviceStore) GetReservationForUpdate(ctx context.Context, tenantID string, id int32) (store.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.Reservation{}, m.err
+	}
+
+	i, ok := m.reservation(tenantID, id)
+	if !ok {
+		return store.Reservation{}, store.ErrNotFound
+	}
+	return m.reservations[i], nil
+}
+
+func (m *MockDeviceStore) SetReservationStatus(ctx context.Context, tenantID string, id int32, status store.ReservationStatus) (store.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.Reservation{}, m.err
+	}
+
+	i, ok := m.reservation(tenantID, id)
+	if !ok {
+		return store.Reservation{}, store.ErrNotFound
+	}
+	m.reservations[i].Status = status
+	return m.reservations[i], nil
+}
+
+func (m *MockDeviceStore) ListReservations(ctx context.Context, tenantID string, filter store.ReservationFilter) (store.ReservationPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.ReservationPage{}, m.err
+	}
+
+	afterStartsAt := filter.AfterStartsAt()
+	var result []store.Reservation
+	for i, reservation := range m.reservations {
+		if _, ok := m.reservation(tenantID, int32(i+1)); !ok {
+			continue
+		}
+		if (filter.DeviceID != 0 && reservation.DeviceID != filter.DeviceID) ||
+			(filter.ReservedBy != "" && reservation.ReservedBy != filter.ReservedBy) ||
+			(len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, reservation.Status)) ||
+			(filter.StartsBefore != nil && reservation.StartsAt.After(*filter.StartsBefore)) ||
+			(filter.EndsBefore != nil && reservation.EndsAt.After(*filter.EndsBefore)) {
+			continue
+		}
+		if afterStartsAt != nil {
+			if c := reservation.StartsAt.Compare(*afterStartsAt); c < 0 || c == 0 && reservation.ID <= filter.After.ID {
+				continue
+			}
+		}
+		result = append(result, reservation)
+	}
+
+	slices.SortFunc(result, func(a, b store.Reservation) int {
+		if c := a.StartsAt.Compare(b.StartsAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if int32(len(result)) > filter.Limit+1 {
+		result = result[:filter.Limit+1]
+	}
+	return store.NewReservationPage(result, filter), nil
+}
+
+// WithTx serializes transactions, which is the strongest form of the row
+// locks taken by the Postgres store, and restores the previous state when fn
+// fails.
+func (m *MockDeviceStore) WithTx(ctx context.Context, tenantID string, fn func(store.DeviceStore) error) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	return m.runTx(fn)
+}
+
+func (m *MockDeviceStore) runTx(fn func(store.DeviceStore) error) error {
+	m.mu.Lock()
+	devices := maps.Clone(m.devices)
+	tenants := maps.Clone(m.tenants)
+	nextID := m.nextID
+	events := len(m.events)
+	nextEventID := m.nextEventID
+	assignments := slices.Clone(m.assignments)
+	reservations := slices.Clone(m.reservations)
+	m.mu.Unlock()
+
+	if err := fn(&mockTx{m}); err != nil {
+		m.mu.Lock()
+		m.devices = devices
+		m.tenants = tenants
+		m.nextID = nextID
+		m.events = m.events[:events]
+		m.eventTenants = m.eventTenants[:events]
+		m.nextEventID = nextEventID
+		m.assignments = assignments
+		m.assignmentTenants = m.assignmentTenants[:len(assignments)]
+		m.reservations = reservations
+		m.reservationTenants = m.reservationTenants[:len(reservations)]
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// mockTx is the store bound to a running transaction; nested calls to WithTx
+// behave like savepoints.
+type mockTx struct {
+	*MockDeviceStore
+}
+
+func (t *mockTx) WithTx(ctx context.Context, tenantID string, fn func(store.DeviceStore) error) error {
+	return t.runTx(fn)
 }
@@ -2,7 +2,9 @@ package mockstore
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/danielllmuniz/devices-api/internal/store"
 	"github.com/stretchr/testify/assert"
@@ -11,22 +13,23 @@ import (
 func TestMockDeviceStore(t *testing.T) {
 	ctx := context.Background()
 	mockStore := NewMockDeviceStore()
+	const tenant = "acme"
 
 	t.Run("CreateDevice", func(t *testing.T) {
-		device, err := mockStore.CreateDevice(ctx, "Device A", "BrandX", "available")
+		device, err := mockStore.CreateDevice(ctx, tenant, "Device A", "BrandX", "available")
 		assert.NoError(t, err)
 		assert.Equal(t, int32(1), device.ID)
 		assert.Equal(t, "Device A", device.Name)
 		assert.Equal(t, "BrandX", device.Brand)
 		assert.Equal(t, store.DeviceState("available"), device.State)
 
-		device, err = mockStore.CreateDevice(ctx, "Device A", "BrandX", "123")
+		device, err = mockStore.CreateDevice(ctx, tenant, "Device A", "BrandX", "123")
 		assert.Error(t, err)
 		assert.Empty(t, device)
 	})
 
 	t.Run("GetDeviceByID", func(t *testing.T) {
-		device, err := mockStore.GetDeviceByID(ctx, 1)
+		device, err := mockStore.GetDeviceByID(ctx, tenant, 1)
 		assert.NoError(t, err)
 		assert.Equal(t, "Device A", device.Name)
 		assert.Equal(t, "BrandX", device.Brand)
@@ -34,63 +37,232 @@ func TestMockDeviceStore(t *testing.T) {
 	})
 
 	t.Run("UpdateDevice", func(t *testing.T) {
-		updated, err := mockStore.UpdateDevice(ctx, 1, "Device A+", "BrandX", "inactive")
+		updated, err := mockStore.UpdateDevice(ctx, tenant, 1, 1, "Device A+", "BrandX", "inactive")
 		assert.NoError(t, err)
 		assert.Equal(t, "Device A+", updated.Name)
 		assert.Equal(t, store.DeviceState("inactive"), updated.State)
 
-		updated, err = mockStore.UpdateDevice(ctx, 10, "", "", "")
+		updated, err = mockStore.UpdateDevice(ctx, tenant, 10, 1, "", "", "")
 		assert.Error(t, err)
 		assert.Empty(t, updated)
 	})
 
 	t.Run("PatchDevice", func(t *testing.T) {
-		patched, err := mockStore.PatchDevice(ctx, 1, "Device A+", "BrandY", "in-use")
+		patched, err := mockStore.PatchDevice(ctx, tenant, 1, 2, devicePatch("Device A+", "BrandY", "in-use"))
 		assert.NoError(t, err)
 		assert.Equal(t, "BrandY", patched.Brand)
 		assert.Equal(t, "Device A+", patched.Name)
 		assert.Equal(t, store.DeviceState("in-use"), patched.State)
 
-		patched, err = mockStore.PatchDevice(ctx, 10, "", "", "")
+		patched, err = mockStore.PatchDevice(ctx, tenant, 10, 1, devicePatch("", "", ""))
 		assert.Error(t, err)
 		assert.Empty(t, patched)
 	})
 
-	t.Run("GetAllDevices", func(t *testing.T) {
-		_, _ = mockStore.CreateDevice(ctx, "Device B", "BrandX", "inactive")
-		devices, err := mockStore.GetAllDevices(ctx)
+	t.Run("StaleVersion", func(t *testing.T) {
+		device, err := mockStore.GetDeviceByID(ctx, tenant, 1)
 		assert.NoError(t, err)
-		assert.Len(t, devices, 2)
+		assert.Equal(t, int32(3), device.Version)
+
+		_, err = mockStore.UpdateDevice(ctx, tenant, 1, 2, "Device A+", "BrandY", "in-use")
+		assert.ErrorIs(t, err, store.ErrVersionConflict)
+
+		_, err = mockStore.PatchDevice(ctx, tenant, 1, 2, devicePatch("Device A+", "", ""))
+		assert.ErrorIs(t, err, store.ErrVersionConflict)
+	})
+
+	t.Run("ListDevices", func(t *testing.T) {
+		_, _ = mockStore.CreateDevice(ctx, tenant, "Device B", "BrandX", "inactive")
+		devices, err := mockStore.ListDevices(ctx, tenant, store.DeviceFilter{Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, devices.Devices, 2)
 	})
 
-	t.Run("GetDevicesByBrand", func(t *testing.T) {
-		devices, err := mockStore.GetDevicesByBrand(ctx, "BrandX")
+	t.Run("ListDevicesByBrand", func(t *testing.T) {
+		devices, err := mockStore.ListDevices(ctx, tenant, store.DeviceFilter{Brands: []string{"BrandX"}, Limit: 10})
 		assert.NoError(t, err)
-		assert.Len(t, devices, 1)
+		assert.Len(t, devices.Devices, 1)
 	})
 
-	t.Run("GetDevicesByState", func(t *testing.T) {
-		devices, err := mockStore.GetDevicesByState(ctx, "inactive")
+	t.Run("ListDevicesByState", func(t *testing.T) {
+		devices, err := mockStore.ListDevices(ctx, tenant, store.DeviceFilter{States: []store.DeviceState{"inactive"}, Limit: 10})
 		assert.NoError(t, err)
-		assert.Len(t, devices, 1)
+		assert.Len(t, devices.Devices, 1)
 	})
 
-	t.Run("GetDevicesByStateAndBrand", func(t *testing.T) {
-		devices, err := mockStore.GetDevicesByBrandAndState(ctx, "BrandX", "inactive")
+	t.Run("ListDevicesByStateAndBrand", func(t *testing.T) {
+		devices, err := mockStore.ListDevices(ctx, tenant, store.DeviceFilter{
+			Brands: []string{"BrandX"},
+			States: []store.DeviceState{"inactive"},
+			Limit:  10,
+		})
 		assert.NoError(t, err)
-		assert.Len(t, devices, 1)
+		assert.Len(t, devices.Devices, 1)
+	})
+
+	t.Run("ListDevicesPage", func(t *testing.T) {
+		page, err := mockStore.ListDevices(ctx, tenant, store.DeviceFilter{Limit: 1})
+		assert.NoError(t, err)
+		assert.Len(t, page.Devices, 1)
+		assert.Equal(t, int32(2), page.Devices[0].ID)
+		assert.NotNil(t, page.NextCursor)
+
+		page, err = mockStore.ListDevices(ctx, tenant, store.DeviceFilter{Limit: 1, After: page.NextCursor})
+		assert.NoError(t, err)
+		assert.Len(t, page.Devices, 1)
+		assert.Equal(t, int32(1), page.Devices[0].ID)
+		assert.Nil(t, page.NextCursor)
 	})
 
 	t.Run("DeleteDevice", func(t *testing.T) {
-		deletedID, err := mockStore.DeleteDevice(ctx, 1)
+		deletedID, err := mockStore.DeleteDevice(ctx, tenant, 1)
 		assert.NoError(t, err)
 		assert.Equal(t, int32(1), deletedID)
 
-		_, err = mockStore.GetDeviceByID(ctx, 1)
-		assert.Error(t, err)
+		_, err = mockStore.GetDeviceByID(ctx, tenant, 1)
+		assert.ErrorIs(t, err, store.ErrNotFound)
 
-		deletedID, err = mockStore.DeleteDevice(ctx, 10)
+		deletedID, err = mockStore.DeleteDevice(ctx, tenant, 10)
 		assert.Error(t, err)
 		assert.Equal(t, int32(0), deletedID)
 	})
+
+	t.Run("WithTxRollback", func(t *testing.T) {
+		errBoom := errors.New("boom")
+		err := mockStore.WithTx(ctx, tenant, func(tx store.DeviceStore) error {
+			_, err := tx.CreateDevice(ctx, tenant, "Device C", "BrandZ", "available")
+			assert.NoError(t, err)
+			return errBoom
+		})
+		assert.ErrorIs(t, err, errBoom)
+
+		devices, err := mockStore.ListDevices(ctx, tenant, store.DeviceFilter{Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, devices.Devices, 1)
+	})
+
+	t.Run("WithTxRollbackEvents", func(t *testing.T) {
+		errBoom := errors.New("boom")
+		err := mockStore.WithTx(ctx, tenant, func(tx store.DeviceStore) error {
+			_, err := tx.CreateDeviceEvent(ctx, tenant, store.DeviceEvent{DeviceID: 2, Type: store.DeviceEventDeleted})
+			assert.NoError(t, err)
+			return errBoom
+		})
+		assert.ErrorIs(t, err, errBoom)
+
+		events, err := mockStore.ListDeviceEvents(ctx, tenant, store.DeviceEventFilter{DeviceID: 2, Limit: 10})
+		assert.NoError(t, err)
+		assert.Empty(t, events.Events)
+	})
+
+	t.Run("WithTxRollbackAssignments", func(t *testing.T) {
+		errBoom := errors.New("boom")
+		err := mockStore.WithTx(ctx, tenant, func(tx store.DeviceStore) error {
+			_, err := tx.CreateAssignment(ctx, tenant, store.Assignment{DeviceID: 2, Assignee: "alice"})
+			assert.NoError(t, err)
+			return errBoom
+		})
+		assert.ErrorIs(t, err, errBoom)
+
+		_, err = mockStore.GetOpenAssignment(ctx, tenant, 2)
+		assert.ErrorIs(t, err, store.ErrNotFound)
+	})
+
+	t.Run("Assignments", func(t *testing.T) {
+		assignment, err := mockStore.CreateAssignment(ctx, tenant, store.Assignment{DeviceID: 2, Assignee: "alice"})
+		assert.NoError(t, err)
+		_, err = mockStore.CreateAssignment(ctx, tenant, store.Assignment{DeviceID: 2, Assignee: "bob"})
+		assert.ErrorIs(t, err, store.ErrConflict)
+
+		closed, err := mockStore.CloseAssignment(ctx, tenant, assignment.ID)
+		assert.NoError(t, err)
+		assert.NotNil(t, closed.CheckedInAt)
+		_, err = mockStore.CloseAssignment(ctx, tenant, assignment.ID)
+		assert.ErrorIs(t, err, store.ErrNotFound)
+
+		assignments, err := mockStore.ListAssignments(ctx, tenant, store.AssignmentFilter{Assignee: "alice", Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, assignments.Assignments, 1)
+		assert.Equal(t, int32(2), assignments.Assignments[0].Device.ID)
+	})
+
+	t.Run("Reservations", func(t *testing.T) {
+		start := time.Now()
+		reservation, err := mockStore.CreateReservation(ctx, tenant, store.Reservation{DeviceID: 2, ReservedBy: "alice", StartsAt: start, EndsAt: start.Add(time.Hour)})
+		assert.NoError(t, err)
+		_, err = mockStore.CreateReservation(ctx, tenant, store.Reservation{DeviceID: 2, ReservedBy: "bob", StartsAt: start.Add(time.Minute), EndsAt: start.Add(2 * time.Hour)})
+		assert.ErrorIs(t, err, store.ErrOverlap)
+		assert.ErrorIs(t, err, store.ErrConflict)
+
+		// A canceled reservation frees its slot.
+		_, err = mockStore.SetReservationStatus(ctx, tenant, reservation.ID, store.ReservationCanceled)
+		assert.NoError(t, err)
+		_, err = mockStore.CreateReservation(ctx, tenant, store.Reservation{DeviceID: 2, ReservedBy: "bob", StartsAt: start.Add(time.Minute), EndsAt: start.Add(2 * time.Hour)})
+		assert.NoError(t, err)
+
+		reservations, err := mockStore.ListReservations(ctx, tenant, store.ReservationFilter{DeviceID: 2, Statuses: []store.ReservationStatus{store.ReservationScheduled}, Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, reservations.Reservations, 1)
+		assert.Equal(t, "bob", reservations.Reservations[0].ReservedBy)
+	})
+
+	t.Run("WithTxCommit", func(t *testing.T) {
+		err := mockStore.WithTx(ctx, tenant, func(tx store.DeviceStore) error {
+			_, err := tx.CreateDevice(ctx, tenant, "Device C", "BrandZ", "available")
+			return err
+		})
+		assert.NoError(t, err)
+
+		devices, err := mockStore.ListDevices(ctx, tenant, store.DeviceFilter{Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, devices.Devices, 2)
+	})
+
+	t.Run("TenantIsolation", func(t *testing.T) {
+		other, err := mockStore.CreateDevice(ctx, "globex", "Device D", "BrandZ", "available")
+		assert.NoError(t, err)
+
+		_, err = mockStore.GetDeviceByID(ctx, tenant, other.ID)
+		assert.ErrorIs(t, err, store.ErrNotFound)
+		_, err = mockStore.DeleteDevice(ctx, tenant, other.ID)
+		assert.ErrorIs(t, err, store.ErrNotFound)
+
+		devices, err := mockStore.ListDevices(ctx, "globex", store.DeviceFilter{Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, devices.Devices, 1)
+
+		tenants, err := mockStore.ListTenants(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"acme", "globex"}, tenants)
+	})
+
+	t.Run("FailWith", func(t *testing.T) {
+		mockStore.FailWith(store.ErrUnavailable)
+
+		_, err := mockStore.GetDeviceByID(ctx, tenant, 2)
+		assert.ErrorIs(t, err, store.ErrUnavailable)
+
+		_, err = mockStore.ListDevices(ctx, tenant, store.DeviceFilter{Limit: 10})
+		assert.ErrorIs(t, err, store.ErrUnavailable)
+
+		mockStore.FailWith(nil)
+		_, err = mockStore.GetDeviceByID(ctx, tenant, 2)
+		assert.NoError(t, err)
+	})
+}
+
+// devicePatch builds a patch from the old string arguments, where the empty
+// string leaves the field unchanged.
+func devicePatch(name, brand string, state store.DeviceState) store.DevicePatch {
+	var patch store.DevicePatch
+	if name != "" {
+		patch.Name = &name
+	}
+	if brand != "" {
+		patch.Brand = &brand
+	}
+	if state != "" {
+		patch.State = &state
+	}
+	return patch
 }
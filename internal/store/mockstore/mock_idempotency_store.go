@@ -0,0 +1,105 @@
+package mockstore
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+type MockIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]store.IdempotencyKey
+	err  error
+}
+
+func NewMockIdempotencyStore() *MockIdempotencyStore {
+	return &MockIdempotencyStore{
+		keys: make(map[string]store.IdempotencyKey),
+	}
+}
+
+// FailWith makes every following call return err. Pass nil to recover.
+func (m *MockIdempotencyStore) FailWith(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.err = err
+}
+
+func (m *MockIdempotencyStore) ClaimIdempotencyKey(ctx context.Context, key, fingerprint string, leaseUntil time.Time) (store.IdempotencyKey, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return store.IdempotencyKey{}, false, m.err
+	}
+
+	now := time.Now().Round(0)
+	if holder, ok := m.keys[key]; ok && holder.ExpiresAt.After(now) {
+		return holder, false, nil
+	}
+
+	claimed := store.IdempotencyKey{
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   leaseUntil,
+	}
+	m.keys[key] = claimed
+	return claimed, true, nil
+}
+
+func (m *MockIdempotencyStore) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+
+	stored, ok := m.keys[key]
+	if !ok {
+		return nil
+	}
+	stored.StatusCode = statusCode
+	stored.ContentType = contentType
+	stored.Body = slices.Clone(body)
+	stored.ExpiresAt = expiresAt
+	m.keys[key] = stored
+	return nil
+}
+
+func (m *MockIdempotencyStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+
+	if stored, ok := m.keys[key]; ok && !stored.Completed() {
+		delete(m.keys, key)
+	}
+	return nil
+}
+
+func (m *MockIdempotencyStore) PurgeExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	var purged int64
+	for key, stored := range m.keys {
+		if !stored.ExpiresAt.After(now) {
+			delete(m.keys, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
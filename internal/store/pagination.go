@@ -0,0 +1,57 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points at the last device of a page. It carries the values of the
+// sort fields for that device plus its id, which breaks ties, so the next
+// page starts right after it.
+type Cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	ID     int32    `json:"id"`
+}
+
+// Encode returns the opaque representation handed out to clients.
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+type DevicePage struct {
+	Devices    []Device
+	NextCursor *Cursor
+}
+
+// NewDevicePage builds a page from up to filter.Limit+1 devices; the extra
+// device only signals that another page exists and is not returned.
+func NewDevicePage(devices []Device, filter DeviceFilter) DevicePage {
+	if int32(len(devices)) <= filter.Limit {
+		return DevicePage{Devices: devices}
+	}
+
+	devices = devices[:filter.Limit]
+	cursor := filter.CursorFor(devices[len(devices)-1])
+	return DevicePage{
+		Devices:    devices,
+		NextCursor: &cursor,
+	}
+}
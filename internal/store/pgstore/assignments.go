@@ -0,0 +1,107 @@
+package pgstore
+
+import (
+	"context"
+	"strings"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+func (s *PGDeviceStore) CreateAssignment(ctx context.Context, tenantID string, assignment store.Assignment) (store.Assignment, error) {
+	var created Assignment
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		created, err = q.CreateAssignment(ctx, CreateAssignmentParams{
+			DeviceID: assignment.DeviceID,
+			Assignee: assignment.Assignee,
+			DueAt:    assignment.DueAt,
+			Note:     assignment.Note,
+		})
+		return mapError(err)
+	})
+	if err != nil {
+		return store.Assignment{}, err
+	}
+	return toStoreAssignment(created), nil
+}
+
+func (s *PGDeviceStore) GetOpenAssignment(ctx context.Context, tenantID string, deviceID int32) (store.Assignment, error) {
+	var assignment Assignment
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		assignment, err = q.GetOpenAssignment(ctx, deviceID)
+		return mapError(err)
+	})
+	if err != nil {
+		return store.Assignment{}, err
+	}
+	return toStoreAssignment(assignment), nil
+}
+
+func (s *PGDeviceStore) CloseAssignment(ctx context.Context, tenantID string, id int32) (store.Assignment, error) {
+	var assignment Assignment
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		assignment, err = q.CloseAssignment(ctx, id)
+		return mapError(err)
+	})
+	if err != nil {
+		return store.Assignment{}, err
+	}
+	return toStoreAssignment(assignment), nil
+}
+
+func (s *PGDeviceStore) ListAssignments(ctx context.Context, tenantID string, filter store.AssignmentFilter) (store.AssignmentPage, error) {
+	var before int32
+	if filter.After != nil {
+		before = filter.After.ID
+	}
+	brands := make([]string, len(filter.Brands))
+	for i, brand := range filter.Brands {
+		brands[i] = strings.ToLower(brand)
+	}
+
+	var rows []ListAssignmentsRow
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		rows, err = q.ListAssignments(ctx, ListAssignmentsParams{
+			Assignee: filter.Assignee,
+			Open:     filter.Open,
+			Overdue:  filter.Overdue,
+			Brands:   brands,
+			Before:   before,
+			MaxRows:  filter.Limit + 1,
+		})
+		return mapError(err)
+	})
+	if err != nil {
+		return store.AssignmentPage{}, err
+	}
+
+	result := make([]store.Assignment, len(rows))
+	for i, row := range rows {
+		result[i] = toStoreAssignment(row.Assignment)
+		result[i].Device = &store.Device{
+			ID:        row.Device.ID,
+			Name:      row.Device.Name,
+			Brand:     row.Device.Brand,
+			State:     store.DeviceState(row.Device.State),
+			CreatedAt: row.Device.CreatedAt,
+			Version:   row.Device.Version,
+			DeletedAt: row.Device.DeletedAt,
+		}
+	}
+	return store.NewAssignmentPage(result, filter), nil
+}
+
+func toStoreAssignment(assignment Assignment) store.Assignment {
+	return store.Assignment{
+		ID:           assignment.ID,
+		DeviceID:     assignment.DeviceID,
+		Assignee:     assignment.Assignee,
+		DueAt:        assignment.DueAt,
+		Note:         assignment.Note,
+		CheckedOutAt: assignment.CheckedOutAt,
+		CheckedInAt:  assignment.CheckedInAt,
+	}
+}
@@ -0,0 +1,34 @@
+package pgstore
+
+import (
+	"fmt"
+	"os"
+)
+
+// ConnStringFromEnv builds the connection string from the DATABASE_*
+// environment variables. It connects as the owner of the tables, for
+// migrations and administration.
+func ConnStringFromEnv() string {
+	return connString(os.Getenv("DATABASE_USER"), os.Getenv("DATABASE_PASSWORD"))
+}
+
+// AppConnStringFromEnv builds the connection string the API serves requests
+// with. It logs in as DATABASE_APP_USER, a member of the devices_app role that
+// row level security applies to, and falls back to DATABASE_USER when unset.
+func AppConnStringFromEnv() string {
+	user := os.Getenv("DATABASE_APP_USER")
+	if user == "" {
+		return ConnStringFromEnv()
+	}
+	return connString(user, os.Getenv("DATABASE_APP_PASSWORD"))
+}
+
+func connString(user, password string) string {
+	return fmt.Sprintf("user=%s password=%s host=%s port=%s dbname=%s",
+		user,
+		password,
+		os.Getenv("DATABASE_HOST"),
+		os.Getenv("DATABASE_PORT"),
+		os.Getenv("DATABASE_NAME"),
+	)
+}
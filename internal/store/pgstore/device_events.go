@@ -0,0 +1,140 @@
+package pgstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+func (s *PGDeviceStore) CreateDeviceEvent(ctx context.Context, tenantID string, event store.DeviceEvent) (store.DeviceEvent, error) {
+	oldValue, err := marshalDevice(event.Old)
+	if err != nil {
+		return store.DeviceEvent{}, err
+	}
+	newValue, err := marshalDevice(event.New)
+	if err != nil {
+		return store.DeviceEvent{}, err
+	}
+
+	var created DeviceEvent
+	err = s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		created, err = q.CreateDeviceEvent(ctx, CreateDeviceEventParams{
+			DeviceID:  event.DeviceID,
+			Type:      DeviceEventType(event.Type),
+			OldValue:  oldValue,
+			NewValue:  newValue,
+			Actor:     event.Actor,
+			RequestID: event.RequestID,
+		})
+		return mapError(err)
+	})
+	if err != nil {
+		return store.DeviceEvent{}, err
+	}
+	return toStoreEvent(created)
+}
+
+func (s *PGDeviceStore) CreateDeviceEvents(ctx context.Context, tenantID string, events []store.DeviceEvent) error {
+	rows := CreateDeviceEventsParams{
+		TenantID:   tenantID,
+		DeviceIds:  make([]int32, len(events)),
+		Types:      make([]string, len(events)),
+		OldValues:  make([][]byte, len(events)),
+		NewValues:  make([][]byte, len(events)),
+		Actors:     make([]string, len(events)),
+		RequestIds: make([]string, len(events)),
+	}
+	for i, event := range events {
+		oldValue, err := marshalDevice(event.Old)
+		if err != nil {
+			return err
+		}
+		newValue, err := marshalDevice(event.New)
+		if err != nil {
+			return err
+		}
+		rows.DeviceIds[i] = event.DeviceID
+		rows.Types[i] = string(event.Type)
+		rows.OldValues[i] = oldValue
+		rows.NewValues[i] = newValue
+		rows.Actors[i] = event.Actor
+		rows.RequestIds[i] = event.RequestID
+	}
+
+	return s.scoped(ctx, tenantID, func(q *Queries) error {
+		return mapError(q.CreateDeviceEvents(ctx, rows))
+	})
+}
+
+func (s *PGDeviceStore) ListDeviceEvents(ctx context.Context, tenantID string, filter store.DeviceEventFilter) (store.DeviceEventPage, error) {
+	var before int32
+	if filter.After != nil {
+		before = filter.After.ID
+	}
+
+	var events []DeviceEvent
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		events, err = q.ListDeviceEvents(ctx, ListDeviceEventsParams{
+			DeviceID: filter.DeviceID,
+			Before:   before,
+			MaxRows:  filter.Limit + 1,
+		})
+		return mapError(err)
+	})
+	if err != nil {
+		return store.DeviceEventPage{}, err
+	}
+
+	result := make([]store.DeviceEvent, 0, len(events))
+	for _, event := range events {
+		e, err := toStoreEvent(event)
+		if err != nil {
+			return store.DeviceEventPage{}, err
+		}
+		result = append(result, e)
+	}
+	return store.NewDeviceEventPage(result, filter), nil
+}
+
+// marshalDevice stores a device snapshot as JSONB; a nil device is NULL.
+func marshalDevice(device *store.Device) ([]byte, error) {
+	if device == nil {
+		return nil, nil
+	}
+	return json.Marshal(device)
+}
+
+func unmarshalDevice(raw []byte) (*store.Device, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var device store.Device
+	if err := json.Unmarshal(raw, &device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+func toStoreEvent(event DeviceEvent) (store.DeviceEvent, error) {
+	oldDevice, err := unmarshalDevice(event.OldValue)
+	if err != nil {
+		return store.DeviceEvent{}, err
+	}
+	newDevice, err := unmarshalDevice(event.NewValue)
+	if err != nil {
+		return store.DeviceEvent{}, err
+	}
+	return store.DeviceEvent{
+		ID:        event.ID,
+		DeviceID:  event.DeviceID,
+		Type:      store.DeviceEventType(event.Type),
+		Old:       oldDevice,
+		New:       newDevice,
+		Actor:     event.Actor,
+		RequestID: event.RequestID,
+		CreatedAt: event.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,127 @@
+package pgstore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+const listDevicesColumns = "id, name, brand, state, created_at, version, deleted_at"
+
+// sortColumns maps sortable fields to their column and the cast applied to
+// cursor values compared against it.
+var sortColumns = map[string]struct {
+	column string
+	cast   string
+}{
+	store.SortByCreatedAt: {"created_at", "timestamptz"},
+	store.SortByName:      {"name", "text"},
+	store.SortByBrand:     {"brand", "text"},
+	store.SortByState:     {"state", "device_state"},
+	"id":                  {"id", "int"},
+}
+
+// buildListDevicesQuery turns a filter into a SELECT on devices. Column names
+// only ever come from sortColumns; every value is passed as a parameter. A
+// zero limit selects every matching device.
+func buildListDevicesQuery(filter store.DeviceFilter) (string, []any) {
+	var (
+		where []string
+		args  []any
+	)
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !filter.IncludeDeleted {
+		where = append(where, "deleted_at IS NULL")
+	}
+
+	if len(filter.Brands) > 0 {
+		brands := make([]string, len(filter.Brands))
+		for i, brand := range filter.Brands {
+			brands[i] = strings.ToLower(brand)
+		}
+		where = append(where, fmt.Sprintf("LOWER(brand) = ANY(%s::text[])", arg(brands)))
+	}
+
+	if len(filter.States) > 0 {
+		states := make([]string, len(filter.States))
+		for i, state := range filter.States {
+			states[i] = string(state)
+		}
+		where = append(where, fmt.Sprintf("state = ANY(%s::device_state[])", arg(states)))
+	}
+
+	if filter.NameContains != "" {
+		where = append(where, fmt.Sprintf("name ILIKE '%%' || %s::text || '%%'", arg(escapeLike(filter.NameContains))))
+	}
+
+	if filter.CreatedAfter != nil {
+		where = append(where, fmt.Sprintf("created_at > %s", arg(*filter.CreatedAfter)))
+	}
+
+	if filter.CreatedBefore != nil {
+		where = append(where, fmt.Sprintf("created_at < %s", arg(*filter.CreatedBefore)))
+	}
+
+	orderBy := filter.OrderBy()
+
+	if filter.After != nil {
+		values := append(append([]any{}, toAny(filter.After.Values)...), filter.After.ID)
+
+		// Keyset condition for mixed directions:
+		// (a > x) OR (a = x AND b < y) OR (a = x AND b = y AND id < z) ...
+		var alternatives []string
+		for i, field := range orderBy {
+			var terms []string
+			for j := 0; j < i; j++ {
+				col := sortColumns[orderBy[j].Field]
+				terms = append(terms, fmt.Sprintf("%s = %s::%s", col.column, arg(values[j]), col.cast))
+			}
+
+			op := ">"
+			if field.Desc {
+				op = "<"
+			}
+			col := sortColumns[field.Field]
+			terms = append(terms, fmt.Sprintf("%s %s %s::%s", col.column, op, arg(values[i]), col.cast))
+			alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+		}
+		where = append(where, "("+strings.Join(alternatives, " OR ")+")")
+	}
+
+	var query strings.Builder
+	query.WriteString("SELECT " + listDevicesColumns + "\nFROM devices")
+	if len(where) > 0 {
+		query.WriteString("\nWHERE " + strings.Join(where, "\n  AND "))
+	}
+
+	order := make([]string, len(orderBy))
+	for i, field := range orderBy {
+		order[i] = sortColumns[field.Field].column
+		if field.Desc {
+			order[i] += " DESC"
+		}
+	}
+	query.WriteString("\nORDER BY " + strings.Join(order, ", "))
+	if filter.Limit > 0 {
+		query.WriteString("\nLIMIT " + arg(filter.Limit+1))
+	}
+
+	return query.String(), args
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func toAny(values []string) []any {
+	result := make([]any, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
@@ -0,0 +1,132 @@
+package pgstore
+
+import (
+	"testing"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildListDevicesQuery(t *testing.T) {
+	const selectDevices = "SELECT id, name, brand, state, created_at, version, deleted_at\nFROM devices\n"
+
+	tests := []struct {
+		name      string
+		filter    store.DeviceFilter
+		wantQuery string
+		wantArgs  []any
+	}{
+		{
+			name:      "Default sort",
+			filter:    store.DeviceFilter{Limit: 20},
+			wantQuery: selectDevices + "WHERE deleted_at IS NULL\nORDER BY created_at DESC, id DESC\nLIMIT $1",
+			wantArgs:  []any{int32(21)},
+		},
+		{
+			name:      "Mixed directions",
+			filter:    store.DeviceFilter{Sort: []store.SortField{{Field: store.SortByBrand}, {Field: store.SortByCreatedAt, Desc: true}}, IncludeDeleted: true},
+			wantQuery: selectDevices + "ORDER BY brand, created_at DESC, id DESC",
+		},
+		{
+			name: "Filters together",
+			filter: store.DeviceFilter{
+				Brands:       []string{"Apple", "SAMSUNG"},
+				States:       []store.DeviceState{store.DeviceStateAvailable, store.DeviceStateInUse},
+				NameContains: "Pro",
+				Limit:        10,
+			},
+			wantQuery: selectDevices + "WHERE deleted_at IS NULL\n" +
+				"  AND LOWER(brand) = ANY($1::text[])\n" +
+				"  AND state = ANY($2::device_state[])\n" +
+				"  AND name ILIKE '%' || $3::text || '%'\n" +
+				"ORDER BY created_at DESC, id DESC\nLIMIT $4",
+			wantArgs: []any{[]string{"apple", "samsung"}, []string{"available", "in-use"}, "Pro", int32(11)},
+		},
+		{
+			name: "Cursor on created_at",
+			filter: store.DeviceFilter{
+				Sort:  []store.SortField{{Field: store.SortByCreatedAt}},
+				After: &store.Cursor{Values: []string{"2024-01-02T03:04:05Z"}, ID: 7},
+			},
+			wantQuery: selectDevices + "WHERE deleted_at IS NULL\n" +
+				"  AND ((created_at > $1::timestamptz) OR (created_at = $2::timestamptz AND id > $3::int))\n" +
+				"ORDER BY created_at, id",
+			wantArgs: []any{"2024-01-02T03:04:05Z", "2024-01-02T03:04:05Z", int32(7)},
+		},
+		{
+			name: "Cursor on name",
+			filter: store.DeviceFilter{
+				Sort:  []store.SortField{{Field: store.SortByName, Desc: true}},
+				After: &store.Cursor{Values: []string{"Pixel"}, ID: 7},
+			},
+			wantQuery: selectDevices + "WHERE deleted_at IS NULL\n" +
+				"  AND ((name < $1::text) OR (name = $2::text AND id < $3::int))\n" +
+				"ORDER BY name DESC, id DESC",
+			wantArgs: []any{"Pixel", "Pixel", int32(7)},
+		},
+		{
+			name: "Cursor on brand",
+			filter: store.DeviceFilter{
+				Sort:  []store.SortField{{Field: store.SortByBrand}},
+				After: &store.Cursor{Values: []string{"Google"}, ID: 7},
+			},
+			wantQuery: selectDevices + "WHERE deleted_at IS NULL\n" +
+				"  AND ((brand > $1::text) OR (brand = $2::text AND id > $3::int))\n" +
+				"ORDER BY brand, id",
+			wantArgs: []any{"Google", "Google", int32(7)},
+		},
+		{
+			name: "Cursor on state",
+			filter: store.DeviceFilter{
+				Sort:  []store.SortField{{Field: store.SortByState}},
+				After: &store.Cursor{Values: []string{"in-use"}, ID: 7},
+			},
+			wantQuery: selectDevices + "WHERE deleted_at IS NULL\n" +
+				"  AND ((state > $1::device_state) OR (state = $2::device_state AND id > $3::int))\n" +
+				"ORDER BY state, id",
+			wantArgs: []any{"in-use", "in-use", int32(7)},
+		},
+		{
+			name: "Cursor with mixed directions",
+			filter: store.DeviceFilter{
+				Sort:  []store.SortField{{Field: store.SortByState}, {Field: store.SortByName, Desc: true}},
+				Limit: 5,
+				After: &store.Cursor{Values: []string{"available", "Pixel"}, ID: 9},
+			},
+			wantQuery: selectDevices + "WHERE deleted_at IS NULL\n" +
+				"  AND ((state > $1::device_state)" +
+				" OR (state = $2::device_state AND name < $3::text)" +
+				" OR (state = $4::device_state AND name = $5::text AND id < $6::int))\n" +
+				"ORDER BY state, name DESC, id DESC\nLIMIT $7",
+			wantArgs: []any{"available", "available", "Pixel", "available", "Pixel", int32(9), int32(6)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := buildListDevicesQuery(tt.filter)
+			assert.Equal(t, tt.wantQuery, query)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"Plain", "Pixel", "Pixel"},
+		{"Percent", "100%", `100\%`},
+		{"Underscore", "a_b", `a\_b`},
+		{"Backslash", `C:\dir`, `C:\\dir`},
+		{"All together", `\%_`, `\\\%\_`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, escapeLike(tt.in))
+		})
+	}
+}
@@ -7,12 +7,15 @@ package pgstore
 
 import (
 	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const createDevice = `-- name: CreateDevice :one
 INSERT INTO devices (name, brand, state)
 VALUES ($1, $2, $3)
-RETURNING id, name, brand, state, created_at
+RETURNING id, name, brand, state, created_at, version, deleted_at, tenant_id
 `
 
 type CreateDeviceParams struct {
@@ -30,13 +33,46 @@ func (q *Queries) CreateDevice(ctx context.Context, arg CreateDeviceParams) (Dev
 		&i.Brand,
 		&i.State,
 		&i.CreatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.TenantID,
 	)
 	return i, err
 }
 
+const createDevices = `-- name: CreateDevices :exec
+INSERT INTO devices (tenant_id, id, name, brand, state, created_at)
+SELECT $1::text, d.id, d.name, d.brand, d.state::device_state, d.created_at
+FROM unnest($2::int[], $3::text[], $4::text[], $5::text[], $6::timestamptz[])
+    AS d (id, name, brand, state, created_at)
+`
+
+type CreateDevicesParams struct {
+	TenantID   string      `json:"tenant_id"`
+	Ids        []int32     `json:"ids"`
+	Names      []string    `json:"names"`
+	Brands     []string    `json:"brands"`
+	States     []string    `json:"states"`
+	CreatedAts []time.Time `json:"created_ats"`
+}
+
+func (q *Queries) CreateDevices(ctx context.Context, arg CreateDevicesParams) error {
+	_, err := q.db.Exec(ctx, createDevices,
+		arg.TenantID,
+		arg.Ids,
+		arg.Names,
+		arg.Brands,
+		arg.States,
+		arg.CreatedAts,
+	)
+	return err
+}
+
 const deleteDevice = `-- name: DeleteDevice :one
-DELETE FROM devices
-WHERE id = $1
+UPDATE devices
+SET deleted_at = now(),
+    version = version + 1
+WHERE id = $1 AND deleted_at IS NULL
 RETURNING id
 `
 
@@ -46,42 +82,10 @@ func (q *Queries) DeleteDevice(ctx context.Context, id int32) (int32, error) {
 	return id, err
 }
 
-const getAllDevices = `-- name: GetAllDevices :many
-SELECT id, name, brand, state, created_at
-FROM devices
-ORDER BY created_at DESC
-`
-
-func (q *Queries) GetAllDevices(ctx context.Context) ([]Device, error) {
-	rows, err := q.db.Query(ctx, getAllDevices)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []Device
-	for rows.Next() {
-		var i Device
-		if err := rows.Scan(
-			&i.ID,
-			&i.Name,
-			&i.Brand,
-			&i.State,
-			&i.CreatedAt,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-
 const getDeviceById = `-- name: GetDeviceById :one
-SELECT id, name, brand, state, created_at
+SELECT id, name, brand, state, created_at, version, deleted_at, tenant_id
 FROM devices
-WHERE id = $1
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetDeviceById(ctx context.Context, id int32) (Device, error) {
@@ -93,104 +97,56 @@ func (q *Queries) GetDeviceById(ctx context.Context, id int32) (Device, error) {
 		&i.Brand,
 		&i.State,
 		&i.CreatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.TenantID,
 	)
 	return i, err
 }
 
-const getDevicesByBrand = `-- name: GetDevicesByBrand :many
-SELECT id, name, brand, state, created_at
+const getDeviceByIdForUpdate = `-- name: GetDeviceByIdForUpdate :one
+SELECT id, name, brand, state, created_at, version, deleted_at, tenant_id
 FROM devices
-WHERE LOWER(brand) = LOWER($1)
-ORDER BY created_at DESC
+WHERE id = $1 AND deleted_at IS NULL
+FOR UPDATE
 `
 
-func (q *Queries) GetDevicesByBrand(ctx context.Context, lower string) ([]Device, error) {
-	rows, err := q.db.Query(ctx, getDevicesByBrand, lower)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []Device
-	for rows.Next() {
-		var i Device
-		if err := rows.Scan(
-			&i.ID,
-			&i.Name,
-			&i.Brand,
-			&i.State,
-			&i.CreatedAt,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+func (q *Queries) GetDeviceByIdForUpdate(ctx context.Context, id int32) (Device, error) {
+	row := q.db.QueryRow(ctx, getDeviceByIdForUpdate, id)
+	var i Device
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Brand,
+		&i.State,
+		&i.CreatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.TenantID,
+	)
+	return i, err
 }
 
-const getDevicesByBrandAndState = `-- name: GetDevicesByBrandAndState :many
-SELECT id, name, brand, state, created_at
-FROM devices
-WHERE LOWER(brand) = LOWER($1) AND state = $2
-ORDER BY created_at DESC
+const nextDeviceIDs = `-- name: NextDeviceIDs :many
+SELECT nextval('devices_id_seq')::int AS id, now()::timestamptz AS created_at
+FROM generate_series(1, $1::int)
 `
 
-type GetDevicesByBrandAndStateParams struct {
-	Lower string      `json:"lower"`
-	State DeviceState `json:"state"`
+type NextDeviceIDsRow struct {
+	ID        int32     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
-func (q *Queries) GetDevicesByBrandAndState(ctx context.Context, arg GetDevicesByBrandAndStateParams) ([]Device, error) {
-	rows, err := q.db.Query(ctx, getDevicesByBrandAndState, arg.Lower, arg.State)
+func (q *Queries) NextDeviceIDs(ctx context.Context, count int32) ([]NextDeviceIDsRow, error) {
+	rows, err := q.db.Query(ctx, nextDeviceIDs, count)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Device
+	var items []NextDeviceIDsRow
 	for rows.Next() {
-		var i Device
-		if err := rows.Scan(
-			&i.ID,
-			&i.Name,
-			&i.Brand,
-			&i.State,
-			&i.CreatedAt,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-
-const getDevicesByState = `-- name: GetDevicesByState :many
-SELECT id, name, brand, state, created_at
-FROM devices
-WHERE state = $1
-ORDER BY created_at DESC
-`
-
-func (q *Queries) GetDevicesByState(ctx context.Context, state DeviceState) ([]Device, error) {
-	rows, err := q.db.Query(ctx, getDevicesByState, state)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []Device
-	for rows.Next() {
-		var i Device
-		if err := rows.Scan(
-			&i.ID,
-			&i.Name,
-			&i.Brand,
-			&i.State,
-			&i.CreatedAt,
-		); err != nil {
+		var i NextDeviceIDsRow
+		if err := rows.Scan(&i.ID, &i.CreatedAt); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -203,26 +159,29 @@ func (q *Queries) GetDevicesByState(ctx context.Context, state DeviceState) ([]D
 
 const patchDevice = `-- name: PatchDevice :one
 UPDATE devices
-SET name = COALESCE(NULLIF($2, ''), name),
-    brand = COALESCE(NULLIF($3, ''), brand),
-    state = CASE WHEN $4 = '' THEN state ELSE $4::device_state END
-WHERE id = $1
-RETURNING id, name, brand, state, created_at
+SET name = COALESCE($1, name),
+    brand = COALESCE($2, brand),
+    state = COALESCE($3::device_state, state),
+    version = version + 1
+WHERE id = $4 AND version = $5 AND deleted_at IS NULL
+RETURNING id, name, brand, state, created_at, version, deleted_at, tenant_id
 `
 
 type PatchDeviceParams struct {
-	ID      int32       `json:"id"`
-	Column2 interface{} `json:"column_2"`
-	Column3 interface{} `json:"column_3"`
-	Column4 interface{} `json:"column_4"`
+	Name    pgtype.Text     `json:"name"`
+	Brand   pgtype.Text     `json:"brand"`
+	State   NullDeviceState `json:"state"`
+	ID      int32           `json:"id"`
+	Version int32           `json:"version"`
 }
 
 func (q *Queries) PatchDevice(ctx context.Context, arg PatchDeviceParams) (Device, error) {
 	row := q.db.QueryRow(ctx, patchDevice,
+		arg.Name,
+		arg.Brand,
+		arg.State,
 		arg.ID,
-		arg.Column2,
-		arg.Column3,
-		arg.Column4,
+		arg.Version,
 	)
 	var i Device
 	err := row.Scan(
@@ -231,6 +190,46 @@ func (q *Queries) PatchDevice(ctx context.Context, arg PatchDeviceParams) (Devic
 		&i.Brand,
 		&i.State,
 		&i.CreatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const purgeDeletedDevices = `-- name: PurgeDeletedDevices :execrows
+DELETE FROM devices
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeDeletedDevices(ctx context.Context, deletedAt time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeDeletedDevices, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const restoreDevice = `-- name: RestoreDevice :one
+UPDATE devices
+SET deleted_at = NULL,
+    version = version + 1
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING id, name, brand, state, created_at, version, deleted_at, tenant_id
+`
+
+func (q *Queries) RestoreDevice(ctx context.Context, id int32) (Device, error) {
+	row := q.db.QueryRow(ctx, restoreDevice, id)
+	var i Device
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Brand,
+		&i.State,
+		&i.CreatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.TenantID,
 	)
 	return i, err
 }
@@ -239,16 +238,18 @@ const updateDevice = `-- name: UpdateDevice :one
 UPDATE devices
 SET name = $2,
     brand = $3,
-    state = $4
-WHERE id = $1
-RETURNING id, name, brand, state, created_at
+    state = $4,
+    version = version + 1
+WHERE id = $1 AND version = $5 AND deleted_at IS NULL
+RETURNING id, name, brand, state, created_at, version, deleted_at, tenant_id
 `
 
 type UpdateDeviceParams struct {
-	ID    int32       `json:"id"`
-	Name  string      `json:"name"`
-	Brand string      `json:"brand"`
-	State DeviceState `json:"state"`
+	ID      int32       `json:"id"`
+	Name    string      `json:"name"`
+	Brand   string      `json:"brand"`
+	State   DeviceState `json:"state"`
+	Version int32       `json:"version"`
 }
 
 func (q *Queries) UpdateDevice(ctx context.Context, arg UpdateDeviceParams) (Device, error) {
@@ -257,6 +258,7 @@ func (q *Queries) UpdateDevice(ctx context.Context, arg UpdateDeviceParams) (Dev
 		arg.Name,
 		arg.Brand,
 		arg.State,
+		arg.Version,
 	)
 	var i Device
 	err := row.Scan(
@@ -265,6 +267,9 @@ func (q *Queries) UpdateDevice(ctx context.Context, arg UpdateDeviceParams) (Dev
 		&i.Brand,
 		&i.State,
 		&i.CreatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.TenantID,
 	)
 	return i, err
 }
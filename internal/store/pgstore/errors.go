@@ -0,0 +1,70 @@
+package pgstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SQLSTATE codes and classes that map onto store errors.
+const (
+	uniqueViolation      = "23505"
+	foreignKeyViolation  = "23503"
+	exclusionViolation   = "23P01"
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+	adminShutdown        = "57P01"
+	crashShutdown        = "57P02"
+	cannotConnectNow     = "57P03"
+
+	classConnectionException   = "08"
+	classInsufficientResources = "53"
+)
+
+// mapError translates pgx errors into the store error they stand for,
+// keeping the original error in the chain for logging.
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store.ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == exclusionViolation:
+			return fmt.Errorf("%w: %w", store.ErrOverlap, err)
+		case pgErr.Code == uniqueViolation,
+			pgErr.Code == foreignKeyViolation,
+			pgErr.Code == serializationFailure,
+			pgErr.Code == deadlockDetected:
+			return fmt.Errorf("%w: %w", store.ErrConflict, err)
+		case pgErr.Code == adminShutdown,
+			pgErr.Code == crashShutdown,
+			pgErr.Code == cannotConnectNow,
+			pgErr.Code[:2] == classConnectionException,
+			pgErr.Code[:2] == classInsufficientResources:
+			return fmt.Errorf("%w: %w", store.ErrUnavailable, err)
+		}
+		return err
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	if errors.As(err, &connectErr) ||
+		errors.As(err, &netErr) ||
+		pgconn.Timeout(err) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", store.ErrUnavailable, err)
+	}
+
+	return err
+}
@@ -0,0 +1,6 @@
+-- Write your migrate up statements here
+ALTER TABLE devices ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+---- create above / drop below ----
+ALTER TABLE devices DROP COLUMN IF EXISTS version;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,19 @@
+-- Write your migrate up statements here
+CREATE TYPE device_event_type AS ENUM ('created', 'updated', 'patched', 'deleted');
+-- device_id has no foreign key: events outlive the devices they describe.
+CREATE TABLE device_events (
+    id SERIAL PRIMARY KEY,
+    device_id INTEGER NOT NULL,
+    type device_event_type NOT NULL,
+    old_value JSONB,
+    new_value JSONB,
+    actor TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX device_events_device_id_idx ON device_events (device_id, id DESC);
+---- create above / drop below ----
+DROP TABLE IF EXISTS device_events;
+DROP TYPE IF EXISTS device_event_type;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+ALTER TABLE devices ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX devices_deleted_at_idx ON devices (deleted_at) WHERE deleted_at IS NOT NULL;
+ALTER TYPE device_event_type ADD VALUE 'restored';
+---- create above / drop below ----
+-- Postgres cannot drop an enum value; 'restored' stays on device_event_type.
+DROP INDEX IF EXISTS devices_deleted_at_idx;
+ALTER TABLE devices DROP COLUMN IF EXISTS deleted_at;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
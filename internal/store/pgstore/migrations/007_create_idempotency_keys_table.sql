@@ -0,0 +1,16 @@
+-- Write your migrate up statements here
+-- status_code stays NULL while the first request holding the key runs.
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    status_code INTEGER,
+    content_type TEXT NOT NULL DEFAULT '',
+    body BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+---- create above / drop below ----
+DROP TABLE IF EXISTS idempotency_keys;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
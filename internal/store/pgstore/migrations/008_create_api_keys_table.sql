@@ -0,0 +1,16 @@
+-- Write your migrate up statements here
+-- key_hash is the SHA-256 of the secret part of the key; the key itself is
+-- only shown once, when it is created.
+CREATE TABLE api_keys (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL UNIQUE,
+    key_hash BYTEA NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+---- create above / drop below ----
+DROP TABLE IF EXISTS api_keys;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,22 @@
+-- Write your migrate up statements here
+CREATE TABLE roles (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    permissions TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+-- A NULL brand grants the role on every brand. Brands match case-insensitively,
+-- like the brand filter of the device list.
+CREATE TABLE grants (
+    id SERIAL PRIMARY KEY,
+    subject TEXT NOT NULL,
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    brand TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX grants_subject_role_brand_idx ON grants (subject, role_id, LOWER(COALESCE(brand, '')));
+---- create above / drop below ----
+DROP TABLE IF EXISTS grants;
+DROP TABLE IF EXISTS roles;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
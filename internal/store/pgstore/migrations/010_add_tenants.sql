@@ -0,0 +1,56 @@
+-- Write your migrate up statements here
+-- tenants lists every tenant that ever had a device, for the jobs that go over
+-- all of them: row level security keeps devices from being read across
+-- tenants, even to find out which tenants there are.
+CREATE TABLE tenants (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+INSERT INTO tenants (id) VALUES ('default');
+
+-- Existing rows go to the default tenant. New rows take the tenant the store
+-- set for the transaction, and fail to insert when it set none.
+ALTER TABLE devices ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE devices ALTER COLUMN tenant_id SET DEFAULT current_setting('app.tenant_id');
+ALTER TABLE device_events ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE device_events ALTER COLUMN tenant_id SET DEFAULT current_setting('app.tenant_id');
+CREATE INDEX devices_tenant_id_created_at_id_idx ON devices (tenant_id, created_at DESC, id DESC);
+
+CREATE FUNCTION register_device_tenant() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO tenants (id) VALUES (NEW.tenant_id) ON CONFLICT DO NOTHING;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER devices_register_tenant
+    BEFORE INSERT ON devices
+    FOR EACH ROW EXECUTE FUNCTION register_device_tenant();
+
+-- Rows are only visible to, and can only be written by, transactions that set
+-- app.tenant_id to their tenant. An unset app.tenant_id is NULL or, once set
+-- earlier in the session, empty, and matches no row. FORCE applies the
+-- policies to the owner of the tables too; superusers and roles with
+-- BYPASSRLS still skip them, so the API must not connect as one.
+ALTER TABLE devices ENABLE ROW LEVEL SECURITY;
+ALTER TABLE devices FORCE ROW LEVEL SECURITY;
+CREATE POLICY devices_tenant_isolation ON devices
+    USING (tenant_id = current_setting('app.tenant_id', true));
+ALTER TABLE device_events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE device_events FORCE ROW LEVEL SECURITY;
+CREATE POLICY device_events_tenant_isolation ON device_events
+    USING (tenant_id = current_setting('app.tenant_id', true));
+---- create above / drop below ----
+DROP POLICY IF EXISTS device_events_tenant_isolation ON device_events;
+ALTER TABLE device_events NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE device_events DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS devices_tenant_isolation ON devices;
+ALTER TABLE devices NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE devices DISABLE ROW LEVEL SECURITY;
+DROP TRIGGER IF EXISTS devices_register_tenant ON devices;
+DROP FUNCTION IF EXISTS register_device_tenant();
+DROP INDEX IF EXISTS devices_tenant_id_created_at_id_idx;
+ALTER TABLE device_events DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE devices DROP COLUMN IF EXISTS tenant_id;
+DROP TABLE IF EXISTS tenants;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
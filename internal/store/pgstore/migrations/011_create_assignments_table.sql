@@ -0,0 +1,29 @@
+-- Write your migrate up statements here
+ALTER TYPE device_event_type ADD VALUE 'checked_out';
+ALTER TYPE device_event_type ADD VALUE 'checked_in';
+-- Assignments go with their device when it is purged. Like devices, they take
+-- the tenant the store set for the transaction.
+CREATE TABLE assignments (
+    id SERIAL PRIMARY KEY,
+    device_id INTEGER NOT NULL REFERENCES devices (id) ON DELETE CASCADE,
+    assignee TEXT NOT NULL,
+    due_at TIMESTAMPTZ,
+    note TEXT NOT NULL DEFAULT '',
+    checked_out_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    checked_in_at TIMESTAMPTZ,
+    tenant_id TEXT NOT NULL DEFAULT current_setting('app.tenant_id')
+);
+-- A device is checked out to one assignee at a time.
+CREATE UNIQUE INDEX assignments_open_device_id_idx ON assignments (device_id) WHERE checked_in_at IS NULL;
+CREATE INDEX assignments_tenant_id_assignee_idx ON assignments (tenant_id, assignee, id DESC);
+CREATE INDEX assignments_overdue_idx ON assignments (tenant_id, due_at) WHERE checked_in_at IS NULL;
+ALTER TABLE assignments ENABLE ROW LEVEL SECURITY;
+ALTER TABLE assignments FORCE ROW LEVEL SECURITY;
+CREATE POLICY assignments_tenant_isolation ON assignments
+    USING (tenant_id = current_setting('app.tenant_id', true));
+---- create above / drop below ----
+-- Postgres cannot drop an enum value; 'checked_out' and 'checked_in' stay on
+-- device_event_type.
+DROP TABLE IF EXISTS assignments;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
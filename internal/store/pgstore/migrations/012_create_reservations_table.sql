@@ -0,0 +1,39 @@
+-- Write your migrate up statements here
+-- btree_gist lets the exclusion constraint compare device ids with = next to
+-- the && of the slots. It is a trusted extension, so the owner of the database
+-- can create it.
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+ALTER TYPE device_event_type ADD VALUE 'reservation_started';
+ALTER TYPE device_event_type ADD VALUE 'reservation_ended';
+CREATE TYPE reservation_status AS ENUM ('scheduled', 'active', 'completed', 'canceled', 'expired');
+CREATE TABLE reservations (
+    id SERIAL PRIMARY KEY,
+    device_id INTEGER NOT NULL REFERENCES devices (id) ON DELETE CASCADE,
+    reserved_by TEXT NOT NULL DEFAULT '',
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    status reservation_status NOT NULL DEFAULT 'scheduled',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    tenant_id TEXT NOT NULL DEFAULT current_setting('app.tenant_id'),
+    CONSTRAINT reservations_slot_check CHECK (starts_at < ends_at),
+    -- The slots of a device cannot overlap, except with the canceled and
+    -- expired reservations, which no longer hold theirs.
+    CONSTRAINT reservations_no_overlap EXCLUDE USING gist (
+        device_id WITH =,
+        tstzrange(starts_at, ends_at) WITH &&
+    ) WHERE (status IN ('scheduled', 'active', 'completed'))
+);
+CREATE INDEX reservations_tenant_id_starts_at_id_idx ON reservations (tenant_id, starts_at, id);
+CREATE INDEX reservations_pending_idx ON reservations (tenant_id, status, starts_at) WHERE status IN ('scheduled', 'active');
+ALTER TABLE reservations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE reservations FORCE ROW LEVEL SECURITY;
+CREATE POLICY reservations_tenant_isolation ON reservations
+    USING (tenant_id = current_setting('app.tenant_id', true));
+---- create above / drop below ----
+-- Postgres cannot drop an enum value; 'reservation_started' and
+-- 'reservation_ended' stay on device_event_type. btree_gist is left installed.
+DROP TABLE IF EXISTS reservations;
+DROP TYPE IF EXISTS reservation_status;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,28 @@
+-- Write your migrate up statements here
+-- devices_app holds what the API needs to serve requests and nothing more: it
+-- owns no table and cannot bypass row level security, so the tenant policies
+-- apply to it. The API logs in as a member of it (DATABASE_APP_USER), while
+-- migrations keep running as the owner of the tables. Roles are shared by the
+-- whole cluster, so it is only created when missing.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'devices_app') THEN
+        CREATE ROLE devices_app NOLOGIN NOBYPASSRLS;
+    END IF;
+END
+$$;
+GRANT USAGE ON SCHEMA public TO devices_app;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO devices_app;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO devices_app;
+REVOKE ALL ON schema_version FROM devices_app;
+-- Tables and sequences created by later migrations are granted too.
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO devices_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO devices_app;
+---- create above / drop below ----
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE USAGE, SELECT ON SEQUENCES FROM devices_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE SELECT, INSERT, UPDATE, DELETE ON TABLES FROM devices_app;
+REVOKE ALL ON ALL SEQUENCES IN SCHEMA public FROM devices_app;
+REVOKE ALL ON ALL TABLES IN SCHEMA public FROM devices_app;
+REVOKE USAGE ON SCHEMA public FROM devices_app;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
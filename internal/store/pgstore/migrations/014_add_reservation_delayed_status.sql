@@ -0,0 +1,30 @@
+-- Write your migrate up statements here
+-- A reservation whose slot started while its device was not available is
+-- delayed until the device frees up or the slot ends. The new value cannot be
+-- used in the transaction that adds it, so the constraint and index name the
+-- statuses that no longer hold a slot instead.
+ALTER TYPE reservation_status ADD VALUE 'delayed' AFTER 'scheduled';
+ALTER TABLE reservations DROP CONSTRAINT reservations_no_overlap;
+ALTER TABLE reservations ADD CONSTRAINT reservations_no_overlap EXCLUDE USING gist (
+    device_id WITH =,
+    tstzrange(starts_at, ends_at) WITH &&
+) WHERE (status NOT IN ('canceled', 'expired'));
+DROP INDEX reservations_pending_idx;
+CREATE INDEX reservations_pending_idx ON reservations (tenant_id, status, starts_at) WHERE status NOT IN ('completed', 'canceled', 'expired');
+---- create above / drop below ----
+-- Postgres cannot drop an enum value; 'delayed' stays on reservation_status.
+-- Delayed reservations go back to scheduled, which the scheduler retries the
+-- same way. The owner only sees every tenant with row level security not
+-- forced.
+ALTER TABLE reservations NO FORCE ROW LEVEL SECURITY;
+UPDATE reservations SET status = 'scheduled' WHERE status = 'delayed';
+ALTER TABLE reservations FORCE ROW LEVEL SECURITY;
+DROP INDEX reservations_pending_idx;
+CREATE INDEX reservations_pending_idx ON reservations (tenant_id, status, starts_at) WHERE status IN ('scheduled', 'active');
+ALTER TABLE reservations DROP CONSTRAINT reservations_no_overlap;
+ALTER TABLE reservations ADD CONSTRAINT reservations_no_overlap EXCLUDE USING gist (
+    device_id WITH =,
+    tstzrange(starts_at, ends_at) WITH &&
+) WHERE (status IN ('scheduled', 'active', 'completed'));
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
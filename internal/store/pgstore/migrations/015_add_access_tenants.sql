@@ -0,0 +1,46 @@
+-- Write your migrate up statements here
+-- Roles and grants belong to a tenant like devices do, so that the admins of
+-- one tenant neither see nor change those of another, and a subject granted
+-- a brand in one tenant holds nothing in the others. Existing rows go to the
+-- default tenant.
+ALTER TABLE roles ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE roles ALTER COLUMN tenant_id SET DEFAULT current_setting('app.tenant_id');
+ALTER TABLE roles DROP CONSTRAINT roles_name_key;
+ALTER TABLE roles ADD CONSTRAINT roles_tenant_id_name_key UNIQUE (tenant_id, name);
+ALTER TABLE roles ADD CONSTRAINT roles_tenant_id_id_key UNIQUE (tenant_id, id);
+
+-- Foreign keys are checked without the policies, so the grant names its
+-- tenant in the key to keep it from pointing at the role of another tenant.
+ALTER TABLE grants ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE grants ALTER COLUMN tenant_id SET DEFAULT current_setting('app.tenant_id');
+ALTER TABLE grants DROP CONSTRAINT grants_role_id_fkey;
+ALTER TABLE grants ADD CONSTRAINT grants_role_id_fkey FOREIGN KEY (tenant_id, role_id) REFERENCES roles (tenant_id, id) ON DELETE CASCADE;
+DROP INDEX grants_subject_role_brand_idx;
+CREATE UNIQUE INDEX grants_subject_role_brand_idx ON grants (tenant_id, subject, role_id, LOWER(COALESCE(brand, '')));
+
+ALTER TABLE roles ENABLE ROW LEVEL SECURITY;
+ALTER TABLE roles FORCE ROW LEVEL SECURITY;
+CREATE POLICY roles_tenant_isolation ON roles
+    USING (tenant_id = current_setting('app.tenant_id', true));
+ALTER TABLE grants ENABLE ROW LEVEL SECURITY;
+ALTER TABLE grants FORCE ROW LEVEL SECURITY;
+CREATE POLICY grants_tenant_isolation ON grants
+    USING (tenant_id = current_setting('app.tenant_id', true));
+---- create above / drop below ----
+DROP POLICY IF EXISTS grants_tenant_isolation ON grants;
+ALTER TABLE grants NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE grants DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS roles_tenant_isolation ON roles;
+ALTER TABLE roles NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE roles DISABLE ROW LEVEL SECURITY;
+DROP INDEX IF EXISTS grants_subject_role_brand_idx;
+CREATE UNIQUE INDEX grants_subject_role_brand_idx ON grants (subject, role_id, LOWER(COALESCE(brand, '')));
+ALTER TABLE grants DROP CONSTRAINT grants_role_id_fkey;
+ALTER TABLE grants ADD CONSTRAINT grants_role_id_fkey FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE;
+ALTER TABLE grants DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE roles DROP CONSTRAINT roles_tenant_id_id_key;
+ALTER TABLE roles DROP CONSTRAINT roles_tenant_id_name_key;
+ALTER TABLE roles ADD CONSTRAINT roles_name_key UNIQUE (name);
+ALTER TABLE roles DROP COLUMN IF EXISTS tenant_id;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,21 @@
+-- Write your migrate up statements here
+-- An API key acts for the tenant it was created in and no other. Keys are
+-- looked up by prefix before the tenant of the request is known, so a second
+-- policy lets the transaction that sets app.api_key_prefix read that one key.
+-- Existing keys go to the default tenant.
+ALTER TABLE api_keys ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ALTER COLUMN tenant_id SET DEFAULT current_setting('app.tenant_id');
+ALTER TABLE api_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE api_keys FORCE ROW LEVEL SECURITY;
+CREATE POLICY api_keys_tenant_isolation ON api_keys
+    USING (tenant_id = current_setting('app.tenant_id', true));
+CREATE POLICY api_keys_prefix_lookup ON api_keys FOR SELECT
+    USING (prefix = current_setting('app.api_key_prefix', true));
+---- create above / drop below ----
+DROP POLICY IF EXISTS api_keys_prefix_lookup ON api_keys;
+DROP POLICY IF EXISTS api_keys_tenant_isolation ON api_keys;
+ALTER TABLE api_keys NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE api_keys DISABLE ROW LEVEL SECURITY;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS tenant_id;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,143 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/tern/v2/migrate"
+)
+
+// files holds the tern migrations, so binaries carry the schema they expect.
+//
+//go:embed *.sql
+var files embed.FS
+
+// VersionTable is where the schema version is recorded. It is the default of
+// the tern CLI, so databases it migrated carry on from their version.
+const VersionTable = "public.schema_version"
+
+// lockID identifies the advisory lock held for a whole command, so that
+// replicas migrating at startup run one after the other and a redo is not
+// interleaved with another migration.
+const lockID = int64(7_352_104_889_210_417)
+
+var ErrNothingToRedo = errors.New("no migration has been applied")
+
+// Runner applies the embedded migrations over a single connection.
+type Runner struct {
+	conn     *pgx.Conn
+	migrator *migrate.Migrator
+}
+
+// MigrationStatus is a migration and whether the database has it.
+type MigrationStatus struct {
+	Version int32
+	Name    string
+	Applied bool
+}
+
+type Status struct {
+	Current    int32
+	Latest     int32
+	Migrations []MigrationStatus
+}
+
+// NewRunner loads the migrations and creates the version table if needed.
+func NewRunner(ctx context.Context, conn *pgx.Conn) (*Runner, error) {
+	migrator, err := migrate.NewMigrator(ctx, conn, VersionTable)
+	if err != nil {
+		return nil, fmt.Errorf("create migrator: %w", err)
+	}
+	if err := migrator.LoadMigrations(files); err != nil {
+		return nil, fmt.Errorf("load migrations: %w", err)
+	}
+	migrator.OnStart = func(sequence int32, name, direction, _ string) {
+		fmt.Printf("Migrating %s %d %s\n", direction, sequence, name)
+	}
+	return &Runner{conn: conn, migrator: migrator}, nil
+}
+
+// Up applies every pending migration.
+func (r *Runner) Up(ctx context.Context) error {
+	return r.locked(ctx, func() error {
+		return r.migrator.Migrate(ctx)
+	})
+}
+
+// Down reverts the last steps migrations.
+func (r *Runner) Down(ctx context.Context, steps int32) error {
+	if steps < 1 {
+		return fmt.Errorf("steps must be at least 1, got %d", steps)
+	}
+	return r.locked(ctx, func() error {
+		current, err := r.migrator.GetCurrentVersion(ctx)
+		if err != nil {
+			return err
+		}
+		return r.migrator.MigrateTo(ctx, current-steps)
+	})
+}
+
+// Goto migrates up or down to version; 0 reverts everything.
+func (r *Runner) Goto(ctx context.Context, version int32) error {
+	return r.locked(ctx, func() error {
+		return r.migrator.MigrateTo(ctx, version)
+	})
+}
+
+// Redo reverts the last applied migration and applies it again.
+func (r *Runner) Redo(ctx context.Context) error {
+	return r.locked(ctx, func() error {
+		current, err := r.migrator.GetCurrentVersion(ctx)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			return ErrNothingToRedo
+		}
+		if err := r.migrator.MigrateTo(ctx, current-1); err != nil {
+			return err
+		}
+		return r.migrator.MigrateTo(ctx, current)
+	})
+}
+
+func (r *Runner) Status(ctx context.Context) (Status, error) {
+	current, err := r.migrator.GetCurrentVersion(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+	return status(r.migrator.Migrations, current), nil
+}
+
+func status(migrations []*migrate.Migration, current int32) Status {
+	s := Status{Current: current}
+	for _, migration := range migrations {
+		s.Migrations = append(s.Migrations, MigrationStatus{
+			Version: migration.Sequence,
+			Name:    migration.Name,
+			Applied: migration.Sequence <= current,
+		})
+		s.Latest = migration.Sequence
+	}
+	return s
+}
+
+// locked runs fn holding the runner's advisory lock. pg_advisory_lock waits
+// for the holder, so a second replica starting up blocks until the first is
+// done and then finds nothing left to apply.
+func (r *Runner) locked(ctx context.Context, fn func() error) (err error) {
+	if _, err := r.conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// The lock is released with the session anyway if this fails.
+		if _, unlockErr := r.conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", lockID); err == nil && unlockErr != nil {
+			err = fmt.Errorf("release migration lock: %w", unlockErr)
+		}
+	}()
+	return fn()
+}
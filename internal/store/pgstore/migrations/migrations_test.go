@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/tern/v2/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadMigrations parses the embedded files the way NewRunner does, without a
+// database.
+func loadMigrations(t *testing.T) []*migrate.Migration {
+	migrator, err := migrate.NewMigrator(context.Background(), nil, VersionTable)
+	require.NoError(t, err)
+	require.NoError(t, migrator.LoadMigrations(files))
+	return migrator.Migrations
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations := loadMigrations(t)
+	require.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.Equal(t, int32(i+1), migration.Sequence)
+		assert.NotEmpty(t, strings.TrimSpace(migration.UpSQL), migration.Name)
+		// Every migration can be reverted, so down and redo always work.
+		assert.NotEmpty(t, strings.TrimSpace(migration.DownSQL), migration.Name)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	migrations := loadMigrations(t)
+
+	s := status(migrations, 2)
+	assert.Equal(t, int32(2), s.Current)
+	assert.Equal(t, int32(len(migrations)), s.Latest)
+	require.Len(t, s.Migrations, len(migrations))
+	assert.True(t, s.Migrations[1].Applied)
+	assert.False(t, s.Migrations[2].Applied)
+	assert.Equal(t, "001_create_devices_table.sql", s.Migrations[0].Name)
+}
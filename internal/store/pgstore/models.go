@@ -8,8 +8,59 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type DeviceEventType string
+
+const (
+	DeviceEventTypeCreated            DeviceEventType = "created"
+	DeviceEventTypeUpdated            DeviceEventType = "updated"
+	DeviceEventTypePatched            DeviceEventType = "patched"
+	DeviceEventTypeDeleted            DeviceEventType = "deleted"
+	DeviceEventTypeRestored           DeviceEventType = "restored"
+	DeviceEventTypeCheckedOut         DeviceEventType = "checked_out"
+	DeviceEventTypeCheckedIn          DeviceEventType = "checked_in"
+	DeviceEventTypeReservationStarted DeviceEventType = "reservation_started"
+	DeviceEventTypeReservationEnded   DeviceEventType = "reservation_ended"
 )
 
+func (e *DeviceEventType) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = DeviceEventType(s)
+	case string:
+		*e = DeviceEventType(s)
+	default:
+		return fmt.Errorf("unsupported scan type for DeviceEventType: %T", src)
+	}
+	return nil
+}
+
+type NullDeviceEventType struct {
+	DeviceEventType DeviceEventType `json:"device_event_type"`
+	Valid           bool            `json:"valid"` // Valid is true if DeviceEventType is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullDeviceEventType) Scan(value interface{}) error {
+	if value == nil {
+		ns.DeviceEventType, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.DeviceEventType.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullDeviceEventType) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.DeviceEventType), nil
+}
+
 type DeviceState string
 
 const (
@@ -53,10 +104,137 @@ func (ns NullDeviceState) Value() (driver.Value, error) {
 	return string(ns.DeviceState), nil
 }
 
+type ReservationStatus string
+
+const (
+	ReservationStatusScheduled ReservationStatus = "scheduled"
+	ReservationStatusDelayed   ReservationStatus = "delayed"
+	ReservationStatusActive    ReservationStatus = "active"
+	ReservationStatusCompleted ReservationStatus = "completed"
+	ReservationStatusCanceled  ReservationStatus = "canceled"
+	ReservationStatusExpired   ReservationStatus = "expired"
+)
+
+func (e *ReservationStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = ReservationStatus(s)
+	case string:
+		*e = ReservationStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for ReservationStatus: %T", src)
+	}
+	return nil
+}
+
+type NullReservationStatus struct {
+	ReservationStatus ReservationStatus `json:"reservation_status"`
+	Valid             bool              `json:"valid"` // Valid is true if ReservationStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullReservationStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.ReservationStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.ReservationStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullReservationStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.ReservationStatus), nil
+}
+
+type ApiKey struct {
+	ID        int32      `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	KeyHash   []byte     `json:"key_hash"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	TenantID  string     `json:"tenant_id"`
+}
+
+type Assignment struct {
+	ID           int32      `json:"id"`
+	DeviceID     int32      `json:"device_id"`
+	Assignee     string     `json:"assignee"`
+	DueAt        *time.Time `json:"due_at"`
+	Note         string     `json:"note"`
+	CheckedOutAt time.Time  `json:"checked_out_at"`
+	CheckedInAt  *time.Time `json:"checked_in_at"`
+	TenantID     string     `json:"tenant_id"`
+}
+
 type Device struct {
 	ID        int32       `json:"id"`
 	Name      string      `json:"name"`
 	Brand     string      `json:"brand"`
 	State     DeviceState `json:"state"`
 	CreatedAt time.Time   `json:"created_at"`
+	Version   int32       `json:"version"`
+	DeletedAt *time.Time  `json:"deleted_at"`
+	TenantID  string      `json:"tenant_id"`
+}
+
+type DeviceEvent struct {
+	ID        int32           `json:"id"`
+	DeviceID  int32           `json:"device_id"`
+	Type      DeviceEventType `json:"type"`
+	OldValue  []byte          `json:"old_value"`
+	NewValue  []byte          `json:"new_value"`
+	Actor     string          `json:"actor"`
+	RequestID string          `json:"request_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	TenantID  string          `json:"tenant_id"`
+}
+
+type Grant struct {
+	ID        int32       `json:"id"`
+	Subject   string      `json:"subject"`
+	RoleID    int32       `json:"role_id"`
+	Brand     pgtype.Text `json:"brand"`
+	CreatedAt time.Time   `json:"created_at"`
+	TenantID  string      `json:"tenant_id"`
+}
+
+type IdempotencyKey struct {
+	Key         string      `json:"key"`
+	Fingerprint string      `json:"fingerprint"`
+	StatusCode  pgtype.Int4 `json:"status_code"`
+	ContentType string      `json:"content_type"`
+	Body        []byte      `json:"body"`
+	CreatedAt   time.Time   `json:"created_at"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+}
+
+type Reservation struct {
+	ID         int32             `json:"id"`
+	DeviceID   int32             `json:"device_id"`
+	ReservedBy string            `json:"reserved_by"`
+	StartsAt   time.Time         `json:"starts_at"`
+	EndsAt     time.Time         `json:"ends_at"`
+	Note       string            `json:"note"`
+	Status     ReservationStatus `json:"status"`
+	CreatedAt  time.Time         `json:"created_at"`
+	TenantID   string            `json:"tenant_id"`
+}
+
+type Role struct {
+	ID          int32     `json:"id"`
+	Name        string    `json:"name"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	TenantID    string    `json:"tenant_id"`
+}
+
+type Tenant struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,181 @@
+package pgstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PGAccessStore struct {
+	Queries *Queries
+	db      txBeginner
+}
+
+func NewPGAccessStore(db *pgxpool.Pool) *PGAccessStore {
+	return &PGAccessStore{
+		Queries: New(db),
+		db:      db,
+	}
+}
+
+// scoped calls fn with queries that the row level security policies confine
+// to the roles and grants of tenantID.
+func (s *PGAccessStore) scoped(ctx context.Context, tenantID string, fn func(*Queries) error) error {
+	return inTenant(ctx, s.db, s.Queries, tenantID, fn)
+}
+
+func (s *PGAccessStore) CreateRole(ctx context.Context, tenantID, name string, permissions []string) (store.Role, error) {
+	var role Role
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		role, err = q.CreateRole(ctx, CreateRoleParams{Name: name, Permissions: permissions})
+		return mapError(err)
+	})
+	if err != nil {
+		return store.Role{}, err
+	}
+	return toStoreRole(role), nil
+}
+
+func (s *PGAccessStore) ListRoles(ctx context.Context, tenantID string) ([]store.Role, error) {
+	var roles []Role
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		roles, err = q.ListRoles(ctx)
+		return mapError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]store.Role, len(roles))
+	for i, role := range roles {
+		result[i] = toStoreRole(role)
+	}
+	return result, nil
+}
+
+func (s *PGAccessStore) UpdateRole(ctx context.Context, tenantID string, id int32, permissions []string) (store.Role, error) {
+	var role Role
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		role, err = q.UpdateRole(ctx, UpdateRoleParams{ID: id, Permissions: permissions})
+		return mapError(err)
+	})
+	if err != nil {
+		return store.Role{}, err
+	}
+	return toStoreRole(role), nil
+}
+
+func (s *PGAccessStore) DeleteRole(ctx context.Context, tenantID string, id int32) error {
+	return s.scoped(ctx, tenantID, func(q *Queries) error {
+		deleted, err := q.DeleteRole(ctx, id)
+		if err != nil {
+			return mapError(err)
+		}
+		if deleted == 0 {
+			return store.ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *PGAccessStore) CreateGrant(ctx context.Context, tenantID, subject string, roleID int32, brand string) (store.Grant, error) {
+	var grant CreateGrantRow
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		grant, err = q.CreateGrant(ctx, CreateGrantParams{
+			Subject: subject,
+			RoleID:  roleID,
+			Brand:   pgtype.Text{String: brand, Valid: brand != ""},
+		})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			return fmt.Errorf("%w: role %d", store.ErrNotFound, roleID)
+		}
+		return mapError(err)
+	})
+	if err != nil {
+		return store.Grant{}, err
+	}
+	return store.Grant{
+		ID:        grant.ID,
+		Subject:   grant.Subject,
+		RoleID:    grant.RoleID,
+		Role:      grant.Role,
+		Brand:     grant.Brand.String,
+		CreatedAt: grant.CreatedAt,
+	}, nil
+}
+
+func (s *PGAccessStore) ListGrants(ctx context.Context, tenantID, subject string) ([]store.Grant, error) {
+	var grants []ListGrantsRow
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		grants, err = q.ListGrants(ctx, pgtype.Text{String: subject, Valid: subject != ""})
+		return mapError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]store.Grant, len(grants))
+	for i, grant := range grants {
+		result[i] = store.Grant{
+			ID:        grant.ID,
+			Subject:   grant.Subject,
+			RoleID:    grant.RoleID,
+			Role:      grant.Role,
+			Brand:     grant.Brand.String,
+			CreatedAt: grant.CreatedAt,
+		}
+	}
+	return result, nil
+}
+
+func (s *PGAccessStore) DeleteGrant(ctx context.Context, tenantID string, id int32) error {
+	return s.scoped(ctx, tenantID, func(q *Queries) error {
+		deleted, err := q.DeleteGrant(ctx, id)
+		if err != nil {
+			return mapError(err)
+		}
+		if deleted == 0 {
+			return store.ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *PGAccessStore) GetBrandAccess(ctx context.Context, tenantID, subject, permission string) (store.BrandAccess, error) {
+	var brands []pgtype.Text
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		brands, err = q.ListGrantedBrands(ctx, ListGrantedBrandsParams{Subject: subject, Permission: permission})
+		return mapError(err)
+	})
+	if err != nil {
+		return store.BrandAccess{}, err
+	}
+
+	var access store.BrandAccess
+	for _, brand := range brands {
+		if !brand.Valid {
+			return store.BrandAccess{All: true}, nil
+		}
+		access.Brands = append(access.Brands, brand.String)
+	}
+	return access, nil
+}
+
+func toStoreRole(role Role) store.Role {
+	return store.Role{
+		ID:          role.ID,
+		Name:        role.Name,
+		Permissions: role.Permissions,
+		CreatedAt:   role.CreatedAt,
+	}
+}
@@ -0,0 +1,104 @@
+package pgstore
+
+import (
+	"context"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PGAPIKeyStore struct {
+	Queries *Queries
+	db      txBeginner
+}
+
+func NewPGAPIKeyStore(db *pgxpool.Pool) *PGAPIKeyStore {
+	return &PGAPIKeyStore{
+		Queries: New(db),
+		db:      db,
+	}
+}
+
+func (s *PGAPIKeyStore) CreateAPIKey(ctx context.Context, key store.APIKey) (store.APIKey, error) {
+	var created ApiKey
+	err := inTenant(ctx, s.db, s.Queries, key.TenantID, func(q *Queries) error {
+		var err error
+		created, err = q.CreateAPIKey(ctx, CreateAPIKeyParams{
+			Name:    key.Name,
+			Prefix:  key.Prefix,
+			KeyHash: key.Hash,
+			Scopes:  key.Scopes,
+		})
+		return mapError(err)
+	})
+	if err != nil {
+		return store.APIKey{}, err
+	}
+	return toStoreAPIKey(created), nil
+}
+
+// GetAPIKeyByPrefix reads the key in a transaction of its own, which the
+// api_keys_prefix_lookup policy lets see the one key of prefix.
+func (s *PGAPIKeyStore) GetAPIKeyByPrefix(ctx context.Context, prefix string) (store.APIKey, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return store.APIKey{}, mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	queries := s.Queries.WithTx(tx)
+	if err := queries.SetAPIKeyPrefix(ctx, prefix); err != nil {
+		return store.APIKey{}, mapError(err)
+	}
+	key, err := queries.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		return store.APIKey{}, mapError(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return store.APIKey{}, mapError(err)
+	}
+	return toStoreAPIKey(key), nil
+}
+
+func (s *PGAPIKeyStore) ListAPIKeys(ctx context.Context, tenantID string) ([]store.APIKey, error) {
+	var keys []ApiKey
+	err := inTenant(ctx, s.db, s.Queries, tenantID, func(q *Queries) error {
+		var err error
+		keys, err = q.ListAPIKeys(ctx)
+		return mapError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]store.APIKey, len(keys))
+	for i, key := range keys {
+		result[i] = toStoreAPIKey(key)
+	}
+	return result, nil
+}
+
+func (s *PGAPIKeyStore) RevokeAPIKey(ctx context.Context, tenantID string, id int32) error {
+	return inTenant(ctx, s.db, s.Queries, tenantID, func(q *Queries) error {
+		revoked, err := q.RevokeAPIKey(ctx, id)
+		if err != nil {
+			return mapError(err)
+		}
+		if revoked == 0 {
+			return store.ErrNotFound
+		}
+		return nil
+	})
+}
+
+func toStoreAPIKey(key ApiKey) store.APIKey {
+	return store.APIKey{
+		ID:        key.ID,
+		TenantID:  key.TenantID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Hash:      key.KeyHash,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
@@ -2,14 +2,55 @@ package pgstore
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type PGDeviceStore struct {
 	Queries *Queries
-	db      *pgxpool.Pool
+	db      txBeginner
+	// tenantID is the tenant the transaction of a store handed out by WithTx
+	// was set up for. It is empty on the store over the pool.
+	tenantID string
+}
+
+// errTenantMismatch is returned when a store bound to the transaction of one
+// tenant is asked for the devices of another.
+var errTenantMismatch = errors.New("transaction is bound to another tenant")
+
+// txBeginner is satisfied by both *pgxpool.Pool and pgx.Tx, where Begin
+// starts a savepoint.
+type txBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// inTenant calls fn with queries on a transaction of db in which the row
+// level security policies confine every table to tenantID.
+func inTenant(ctx context.Context, db txBeginner, queries *Queries, tenantID string, fn func(*Queries) error) error {
+	if tenantID == "" {
+		return errTenantMismatch
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	queries = queries.WithTx(tx)
+	if err := queries.SetTenant(ctx, tenantID); err != nil {
+		return mapError(err)
+	}
+	if err := fn(queries); err != nil {
+		return err
+	}
+	return mapError(tx.Commit(ctx))
 }
 
 func NewPGDeviceStore(db *pgxpool.Pool) *PGDeviceStore {
@@ -19,11 +60,31 @@ func NewPGDeviceStore(db *pgxpool.Pool) *PGDeviceStore {
 	}
 }
 
-func (s *PGDeviceStore) CreateDevice(ctx context.Context, name, brand string, state store.DeviceState) (store.Device, error) {
-	device, err := s.Queries.CreateDevice(ctx, CreateDeviceParams{
-		Name:  name,
-		Brand: brand,
-		State: DeviceState(state),
+// scoped calls fn with queries that the row level security policies confine
+// to tenantID. Outside of WithTx each call gets a transaction of its own, as
+// the tenant setting only lasts as long as the transaction it was made in.
+func (s *PGDeviceStore) scoped(ctx context.Context, tenantID string, fn func(*Queries) error) error {
+	if s.tenantID != "" {
+		if tenantID != s.tenantID {
+			return errTenantMismatch
+		}
+		return fn(s.Queries)
+	}
+	return s.WithTx(ctx, tenantID, func(tx store.DeviceStore) error {
+		return fn(tx.(*PGDeviceStore).Queries)
+	})
+}
+
+func (s *PGDeviceStore) CreateDevice(ctx context.Context, tenantID, name, brand string, state store.DeviceState) (store.Device, error) {
+	var device Device
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		device, err = q.CreateDevice(ctx, CreateDeviceParams{
+			Name:  name,
+			Brand: brand,
+			State: DeviceState(state),
+		})
+		return mapError(err)
 	})
 	if err != nil {
 		return store.Device{}, err
@@ -34,15 +95,83 @@ func (s *PGDeviceStore) CreateDevice(ctx context.Context, name, brand string, st
 		Brand:     device.Brand,
 		State:     store.DeviceState(device.State),
 		CreatedAt: device.CreatedAt,
+		Version:   device.Version,
+		DeletedAt: device.DeletedAt,
 	}, nil
 }
 
-func (s *PGDeviceStore) UpdateDevice(ctx context.Context, id int32, name, brand string, state store.DeviceState) (store.Device, error) {
-	device, err := s.Queries.UpdateDevice(ctx, UpdateDeviceParams{
-		ID:    id,
-		Name:  name,
-		Brand: brand,
-		State: DeviceState(state),
+// CreateDevices reserves the ids up front so the rows can be inserted in a
+// single statement from arrays, which does not return anything back. COPY
+// would be faster but is refused on tables with row level security.
+func (s *PGDeviceStore) CreateDevices(ctx context.Context, tenantID string, devices []store.Device) ([]store.Device, error) {
+	if len(devices) == 0 {
+		return nil, nil
+	}
+
+	var created []store.Device
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		created, err = insertDevices(ctx, q, tenantID, devices)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func insertDevices(ctx context.Context, q *Queries, tenantID string, devices []store.Device) ([]store.Device, error) {
+	ids, err := q.NextDeviceIDs(ctx, int32(len(devices)))
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	rows := CreateDevicesParams{
+		TenantID:   tenantID,
+		Ids:        make([]int32, len(devices)),
+		Names:      make([]string, len(devices)),
+		Brands:     make([]string, len(devices)),
+		States:     make([]string, len(devices)),
+		CreatedAts: make([]time.Time, len(devices)),
+	}
+	created := make([]store.Device, len(devices))
+	for i, device := range devices {
+		rows.Ids[i] = ids[i].ID
+		rows.Names[i] = device.Name
+		rows.Brands[i] = device.Brand
+		rows.States[i] = string(device.State)
+		rows.CreatedAts[i] = ids[i].CreatedAt
+		created[i] = store.Device{
+			ID:        ids[i].ID,
+			Name:      device.Name,
+			Brand:     device.Brand,
+			State:     device.State,
+			CreatedAt: ids[i].CreatedAt,
+			Version:   1,
+		}
+	}
+
+	if err := q.CreateDevices(ctx, rows); err != nil {
+		return nil, mapError(err)
+	}
+	return created, nil
+}
+
+func (s *PGDeviceStore) UpdateDevice(ctx context.Context, tenantID string, id, version int32, name, brand string, state store.DeviceState) (store.Device, error) {
+	var device Device
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		device, err = q.UpdateDevice(ctx, UpdateDeviceParams{
+			ID:      id,
+			Name:    name,
+			Brand:   brand,
+			State:   DeviceState(state),
+			Version: version,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return store.ErrVersionConflict
+		}
+		return mapError(err)
 	})
 	if err != nil {
 		return store.Device{}, err
@@ -53,15 +182,31 @@ func (s *PGDeviceStore) UpdateDevice(ctx context.Context, id int32, name, brand
 		Brand:     device.Brand,
 		State:     store.DeviceState(device.State),
 		CreatedAt: device.CreatedAt,
+		Version:   device.Version,
+		DeletedAt: device.DeletedAt,
 	}, nil
 }
 
-func (s *PGDeviceStore) PatchDevice(ctx context.Context, id int32, name, brand string, state store.DeviceState) (store.Device, error) {
-	device, err := s.Queries.PatchDevice(ctx, PatchDeviceParams{
-		ID:      id,
-		Column2: name,
-		Column3: brand,
-		Column4: DeviceState(state),
+func (s *PGDeviceStore) PatchDevice(ctx context.Context, tenantID string, id, version int32, patch store.DevicePatch) (store.Device, error) {
+	params := PatchDeviceParams{ID: id, Version: version}
+	if patch.Name != nil {
+		params.Name = pgtype.Text{String: *patch.Name, Valid: true}
+	}
+	if patch.Brand != nil {
+		params.Brand = pgtype.Text{String: *patch.Brand, Valid: true}
+	}
+	if patch.State != nil {
+		params.State = NullDeviceState{DeviceState: DeviceState(*patch.State), Valid: true}
+	}
+
+	var device Device
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		device, err = q.PatchDevice(ctx, params)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return store.ErrVersionConflict
+		}
+		return mapError(err)
 	})
 	if err != nil {
 		return store.Device{}, err
@@ -72,11 +217,18 @@ func (s *PGDeviceStore) PatchDevice(ctx context.Context, id int32, name, brand s
 		Brand:     device.Brand,
 		State:     store.DeviceState(device.State),
 		CreatedAt: device.CreatedAt,
+		Version:   device.Version,
+		DeletedAt: device.DeletedAt,
 	}, nil
 }
 
-func (s *PGDeviceStore) GetDeviceByID(ctx context.Context, id int32) (store.Device, error) {
-	device, err := s.Queries.GetDeviceById(ctx, id)
+func (s *PGDeviceStore) GetDeviceByID(ctx context.Context, tenantID string, id int32) (store.Device, error) {
+	var device Device
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		device, err = q.GetDeviceById(ctx, id)
+		return mapError(err)
+	})
 	if err != nil {
 		return store.Device{}, err
 	}
@@ -86,92 +238,198 @@ func (s *PGDeviceStore) GetDeviceByID(ctx context.Context, id int32) (store.Devi
 		Brand:     device.Brand,
 		State:     store.DeviceState(device.State),
 		CreatedAt: device.CreatedAt,
+		Version:   device.Version,
+		DeletedAt: device.DeletedAt,
 	}, nil
 }
 
-func (s *PGDeviceStore) GetAllDevices(ctx context.Context) ([]store.Device, error) {
-	devices, err := s.Queries.GetAllDevices(ctx)
+func (s *PGDeviceStore) GetDeviceByIDForUpdate(ctx context.Context, tenantID string, id int32) (store.Device, error) {
+	var device Device
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		device, err = q.GetDeviceByIdForUpdate(ctx, id)
+		return mapError(err)
+	})
 	if err != nil {
-		return nil, err
+		return store.Device{}, err
 	}
+	return store.Device{
+		ID:        device.ID,
+		Name:      device.Name,
+		Brand:     device.Brand,
+		State:     store.DeviceState(device.State),
+		CreatedAt: device.CreatedAt,
+		Version:   device.Version,
+		DeletedAt: device.DeletedAt,
+	}, nil
+}
+
+func (s *PGDeviceStore) ListDevices(ctx context.Context, tenantID string, filter store.DeviceFilter) (store.DevicePage, error) {
+	query, args := buildListDevicesQuery(filter)
 
 	var result []store.Device
-	for _, d := range devices {
-		result = append(result, store.Device{
-			ID:        d.ID,
-			Name:      d.Name,
-			Brand:     d.Brand,
-			State:     store.DeviceState(d.State),
-			CreatedAt: d.CreatedAt,
-		})
-	}
-	return result, nil
-}
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		rows, err := q.db.Query(ctx, query, args...)
+		if err != nil {
+			return mapError(err)
+		}
+		defer rows.Close()
 
-func (s *PGDeviceStore) GetDevicesByBrand(ctx context.Context, brand string) ([]store.Device, error) {
-	devices, err := s.Queries.GetDevicesByBrand(ctx, brand)
+		for rows.Next() {
+			var d Device
+			if err := rows.Scan(&d.ID, &d.Name, &d.Brand, &d.State, &d.CreatedAt, &d.Version, &d.DeletedAt); err != nil {
+				return mapError(err)
+			}
+			result = append(result, store.Device{
+				ID:        d.ID,
+				Name:      d.Name,
+				Brand:     d.Brand,
+				State:     store.DeviceState(d.State),
+				CreatedAt: d.CreatedAt,
+				Version:   d.Version,
+				DeletedAt: d.DeletedAt,
+			})
+		}
+		return mapError(rows.Err())
+	})
 	if err != nil {
-		return nil, err
+		return store.DevicePage{}, err
 	}
+	return store.NewDevicePage(result, filter), nil
+}
 
-	var result []store.Device
-	for _, d := range devices {
-		result = append(result, store.Device{
-			ID:        d.ID,
-			Name:      d.Name,
-			Brand:     d.Brand,
-			State:     store.DeviceState(d.State),
-			CreatedAt: d.CreatedAt,
-		})
-	}
-	return result, nil
+// exportFetchSize is the number of rows fetched from the export cursor at once.
+const exportFetchSize = 1000
+
+// ExportDevices reads the devices through a server side cursor, so neither
+// the database nor the client has to hold the whole result at once.
+func (s *PGDeviceStore) ExportDevices(ctx context.Context, tenantID string, filter store.DeviceFilter, fn func(store.Device) error) error {
+	filter.Limit = 0
+	filter.After = nil
+	query, args := buildListDevicesQuery(filter)
+
+	return s.WithTx(ctx, tenantID, func(txStore store.DeviceStore) error {
+		db := txStore.(*PGDeviceStore).Queries.db
+		if _, err := db.Exec(ctx, "DECLARE devices_export NO SCROLL CURSOR FOR "+query, args...); err != nil {
+			return mapError(err)
+		}
+
+		for {
+			rows, err := db.Query(ctx, fmt.Sprintf("FETCH FORWARD %d FROM devices_export", exportFetchSize))
+			if err != nil {
+				return mapError(err)
+			}
+
+			fetched := 0
+			for rows.Next() {
+				fetched++
+				var d Device
+				if err := rows.Scan(&d.ID, &d.Name, &d.Brand, &d.State, &d.CreatedAt, &d.Version, &d.DeletedAt); err != nil {
+					rows.Close()
+					return mapError(err)
+				}
+				if err := fn(store.Device{
+					ID:        d.ID,
+					Name:      d.Name,
+					Brand:     d.Brand,
+					State:     store.DeviceState(d.State),
+					CreatedAt: d.CreatedAt,
+					Version:   d.Version,
+					DeletedAt: d.DeletedAt,
+				}); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return mapError(err)
+			}
+			if fetched < exportFetchSize {
+				return nil
+			}
+		}
+	})
 }
 
-func (s *PGDeviceStore) GetDevicesByState(ctx context.Context, state store.DeviceState) ([]store.Device, error) {
-	devices, err := s.Queries.GetDevicesByState(ctx, DeviceState(state))
+func (s *PGDeviceStore) DeleteDevice(ctx context.Context, tenantID string, id int32) (int32, error) {
+	var deletedID int32
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		deletedID, err = q.DeleteDevice(ctx, id)
+		return mapError(err)
+	})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	return deletedID, nil
+}
 
-	var result []store.Device
-	for _, d := range devices {
-		result = append(result, store.Device{
-			ID:        d.ID,
-			Name:      d.Name,
-			Brand:     d.Brand,
-			State:     store.DeviceState(d.State),
-			CreatedAt: d.CreatedAt,
-		})
+func (s *PGDeviceStore) RestoreDevice(ctx context.Context, tenantID string, id int32) (store.Device, error) {
+	var device Device
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		device, err = q.RestoreDevice(ctx, id)
+		return mapError(err)
+	})
+	if err != nil {
+		return store.Device{}, err
 	}
-	return result, nil
+	return store.Device{
+		ID:        device.ID,
+		Name:      device.Name,
+		Brand:     device.Brand,
+		State:     store.DeviceState(device.State),
+		CreatedAt: device.CreatedAt,
+		Version:   device.Version,
+		DeletedAt: device.DeletedAt,
+	}, nil
 }
 
-func (s *PGDeviceStore) GetDevicesByBrandAndState(ctx context.Context, brand string, state store.DeviceState) ([]store.Device, error) {
-	devices, err := s.Queries.GetDevicesByBrandAndState(ctx, GetDevicesByBrandAndStateParams{
-		Lower: brand,
-		State: DeviceState(state),
+func (s *PGDeviceStore) PurgeDeletedDevices(ctx context.Context, tenantID string, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		purged, err = q.PurgeDeletedDevices(ctx, deletedBefore)
+		return mapError(err)
 	})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	return purged, nil
+}
 
-	var result []store.Device
-	for _, d := range devices {
-		result = append(result, store.Device{
-			ID:        d.ID,
-			Name:      d.Name,
-			Brand:     d.Brand,
-			State:     store.DeviceState(d.State),
-			CreatedAt: d.CreatedAt,
-		})
+func (s *PGDeviceStore) ListTenants(ctx context.Context) ([]string, error) {
+	tenants, err := s.Queries.ListTenants(ctx)
+	if err != nil {
+		return nil, mapError(err)
 	}
-	return result, nil
+	return tenants, nil
 }
 
-func (s *PGDeviceStore) DeleteDevice(ctx context.Context, id int32) (int32, error) {
-	deletedID, err := s.Queries.DeleteDevice(ctx, id)
+// WithTx sets app.tenant_id for the transaction, which the row level security
+// policies of devices and device_events compare tenant_id against. Nested
+// transactions are savepoints of one already set up for tenantID.
+func (s *PGDeviceStore) WithTx(ctx context.Context, tenantID string, fn func(store.DeviceStore) error) error {
+	if tenantID == "" || (s.tenantID != "" && tenantID != s.tenantID) {
+		return errTenantMismatch
+	}
+
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return 0, err
+		return mapError(err)
 	}
-	return deletedID, nil
+	defer tx.Rollback(ctx)
+
+	queries := s.Queries.WithTx(tx)
+	if s.tenantID == "" {
+		if err := queries.SetTenant(ctx, tenantID); err != nil {
+			return mapError(err)
+		}
+	}
+
+	if err := fn(&PGDeviceStore{Queries: queries, db: tx, tenantID: tenantID}); err != nil {
+		return err
+	}
+	return mapError(tx.Commit(ctx))
 }
@@ -0,0 +1,84 @@
+package pgstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PGIdempotencyStore struct {
+	Queries *Queries
+}
+
+func NewPGIdempotencyStore(db *pgxpool.Pool) *PGIdempotencyStore {
+	return &PGIdempotencyStore{
+		Queries: New(db),
+	}
+}
+
+// ClaimIdempotencyKey tries the claim twice: the holder it then looks up may
+// have expired and been purged in between.
+func (s *PGIdempotencyStore) ClaimIdempotencyKey(ctx context.Context, key, fingerprint string, leaseUntil time.Time) (store.IdempotencyKey, bool, error) {
+	for range 2 {
+		claimed, err := s.Queries.ClaimIdempotencyKey(ctx, ClaimIdempotencyKeyParams{
+			Key:         key,
+			Fingerprint: fingerprint,
+			ExpiresAt:   leaseUntil,
+		})
+		if err == nil {
+			return toStoreIdempotencyKey(claimed), true, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return store.IdempotencyKey{}, false, mapError(err)
+		}
+
+		holder, err := s.Queries.GetIdempotencyKey(ctx, key)
+		if err == nil {
+			return toStoreIdempotencyKey(holder), false, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return store.IdempotencyKey{}, false, mapError(err)
+		}
+	}
+	return store.IdempotencyKey{}, false, store.ErrConflict
+}
+
+func (s *PGIdempotencyStore) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte, expiresAt time.Time) error {
+	err := s.Queries.CompleteIdempotencyKey(ctx, CompleteIdempotencyKeyParams{
+		Key:         key,
+		StatusCode:  pgtype.Int4{Int32: int32(statusCode), Valid: true},
+		ContentType: contentType,
+		Body:        body,
+		ExpiresAt:   expiresAt,
+	})
+	return mapError(err)
+}
+
+func (s *PGIdempotencyStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	return mapError(s.Queries.ReleaseIdempotencyKey(ctx, key))
+}
+
+func (s *PGIdempotencyStore) PurgeExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	purged, err := s.Queries.PurgeExpiredIdempotencyKeys(ctx, now)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return purged, nil
+}
+
+func toStoreIdempotencyKey(key IdempotencyKey) store.IdempotencyKey {
+	return store.IdempotencyKey{
+		Key:         key.Key,
+		Fingerprint: key.Fingerprint,
+		StatusCode:  int(key.StatusCode.Int32),
+		ContentType: key.ContentType,
+		Body:        key.Body,
+		CreatedAt:   key.CreatedAt,
+		ExpiresAt:   key.ExpiresAt,
+	}
+}
@@ -0,0 +1,46 @@
+-- name: CreateRole :one
+INSERT INTO roles (name, permissions)
+VALUES ($1, $2)
+RETURNING id, name, permissions, created_at, tenant_id;
+
+-- name: ListRoles :many
+SELECT id, name, permissions, created_at, tenant_id
+FROM roles
+ORDER BY name;
+
+-- name: UpdateRole :one
+UPDATE roles
+SET permissions = $2
+WHERE id = $1
+RETURNING id, name, permissions, created_at, tenant_id;
+
+-- name: DeleteRole :execrows
+DELETE FROM roles
+WHERE id = $1;
+
+-- name: CreateGrant :one
+WITH inserted AS (
+    INSERT INTO grants (subject, role_id, brand)
+    VALUES ($1, $2, $3)
+    RETURNING id, subject, role_id, brand, created_at
+)
+SELECT inserted.id, inserted.subject, inserted.role_id, roles.name AS role, inserted.brand, inserted.created_at
+FROM inserted
+JOIN roles ON roles.id = inserted.role_id;
+
+-- name: ListGrants :many
+SELECT grants.id, grants.subject, grants.role_id, roles.name AS role, grants.brand, grants.created_at
+FROM grants
+JOIN roles ON roles.id = grants.role_id
+WHERE sqlc.narg('subject')::text IS NULL OR grants.subject = sqlc.narg('subject')
+ORDER BY grants.subject, grants.id;
+
+-- name: DeleteGrant :execrows
+DELETE FROM grants
+WHERE id = $1;
+
+-- name: ListGrantedBrands :many
+SELECT DISTINCT grants.brand
+FROM grants
+JOIN roles ON roles.id = grants.role_id
+WHERE grants.subject = sqlc.arg('subject') AND sqlc.arg('permission')::text = ANY(roles.permissions);
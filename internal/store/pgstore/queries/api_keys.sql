@@ -0,0 +1,22 @@
+-- name: SetAPIKeyPrefix :exec
+SELECT set_config('app.api_key_prefix', sqlc.arg(prefix)::text, true);
+
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (name, prefix, key_hash, scopes)
+VALUES ($1, $2, $3, $4)
+RETURNING id, name, prefix, key_hash, scopes, created_at, revoked_at, tenant_id;
+
+-- name: GetAPIKeyByPrefix :one
+SELECT id, name, prefix, key_hash, scopes, created_at, revoked_at, tenant_id
+FROM api_keys
+WHERE prefix = $1;
+
+-- name: ListAPIKeys :many
+SELECT id, name, prefix, key_hash, scopes, created_at, revoked_at, tenant_id
+FROM api_keys
+ORDER BY id;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = now()
+WHERE id = $1 AND revoked_at IS NULL;
@@ -0,0 +1,27 @@
+-- name: CreateAssignment :one
+INSERT INTO assignments (device_id, assignee, due_at, note)
+VALUES ($1, $2, $3, $4)
+RETURNING id, device_id, assignee, due_at, note, checked_out_at, checked_in_at, tenant_id;
+
+-- name: GetOpenAssignment :one
+SELECT id, device_id, assignee, due_at, note, checked_out_at, checked_in_at, tenant_id
+FROM assignments
+WHERE device_id = $1 AND checked_in_at IS NULL;
+
+-- name: CloseAssignment :one
+UPDATE assignments
+SET checked_in_at = now()
+WHERE id = $1 AND checked_in_at IS NULL
+RETURNING id, device_id, assignee, due_at, note, checked_out_at, checked_in_at, tenant_id;
+
+-- name: ListAssignments :many
+SELECT sqlc.embed(assignments), sqlc.embed(devices)
+FROM assignments
+JOIN devices ON devices.id = assignments.device_id
+WHERE (sqlc.arg(assignee)::text = '' OR assignments.assignee = sqlc.arg(assignee)::text)
+  AND (NOT sqlc.arg(open)::bool OR assignments.checked_in_at IS NULL)
+  AND (NOT sqlc.arg(overdue)::bool OR (assignments.checked_in_at IS NULL AND assignments.due_at < now()))
+  AND (cardinality(sqlc.arg(brands)::text[]) = 0 OR LOWER(devices.brand) = ANY(sqlc.arg(brands)::text[]))
+  AND (sqlc.arg(before)::int = 0 OR assignments.id < sqlc.arg(before)::int)
+ORDER BY assignments.id DESC
+LIMIT sqlc.arg(max_rows);
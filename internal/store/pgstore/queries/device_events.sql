@@ -0,0 +1,18 @@
+-- name: CreateDeviceEvent :one
+INSERT INTO device_events (device_id, type, old_value, new_value, actor, request_id)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, device_id, type, old_value, new_value, actor, request_id, created_at, tenant_id;
+
+-- name: ListDeviceEvents :many
+SELECT id, device_id, type, old_value, new_value, actor, request_id, created_at, tenant_id
+FROM device_events
+WHERE device_id = sqlc.arg(device_id)
+  AND (sqlc.arg(before)::int = 0 OR id < sqlc.arg(before)::int)
+ORDER BY id DESC
+LIMIT sqlc.arg(max_rows);
+
+-- name: CreateDeviceEvents :exec
+INSERT INTO device_events (tenant_id, device_id, type, old_value, new_value, actor, request_id)
+SELECT sqlc.arg(tenant_id)::text, e.device_id, e.type::device_event_type, e.old_value, e.new_value, e.actor, e.request_id
+FROM unnest(sqlc.arg(device_ids)::int[], sqlc.arg(types)::text[], sqlc.arg(old_values)::jsonb[], sqlc.arg(new_values)::jsonb[], sqlc.arg(actors)::text[], sqlc.arg(request_ids)::text[])
+    AS e (device_id, type, old_value, new_value, actor, request_id);
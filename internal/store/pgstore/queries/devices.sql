@@ -1,52 +1,61 @@
 -- name: CreateDevice :one
 INSERT INTO devices (name, brand, state)
 VALUES ($1, $2, $3)
-RETURNING id, name, brand, state, created_at;
+RETURNING id, name, brand, state, created_at, version, deleted_at, tenant_id;
 
 -- name: UpdateDevice :one
 UPDATE devices
 SET name = $2,
     brand = $3,
-    state = $4
-WHERE id = $1
-RETURNING id, name, brand, state, created_at;
+    state = $4,
+    version = version + 1
+WHERE id = $1 AND version = $5 AND deleted_at IS NULL
+RETURNING id, name, brand, state, created_at, version, deleted_at, tenant_id;
 
 -- name: PatchDevice :one
 UPDATE devices
-SET name = COALESCE(NULLIF($2, ''), name),
-    brand = COALESCE(NULLIF($3, ''), brand),
-    state = CASE WHEN $4 = '' THEN state ELSE $4::device_state END
-WHERE id = $1
-RETURNING id, name, brand, state, created_at;
+SET name = COALESCE(sqlc.narg('name'), name),
+    brand = COALESCE(sqlc.narg('brand'), brand),
+    state = COALESCE(sqlc.narg('state')::device_state, state),
+    version = version + 1
+WHERE id = sqlc.arg('id') AND version = sqlc.arg('version') AND deleted_at IS NULL
+RETURNING id, name, brand, state, created_at, version, deleted_at, tenant_id;
 
 -- name: GetDeviceById :one
-SELECT id, name, brand, state, created_at
+SELECT id, name, brand, state, created_at, version, deleted_at, tenant_id
 FROM devices
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL;
 
--- name: GetAllDevices :many
-SELECT id, name, brand, state, created_at
+-- name: GetDeviceByIdForUpdate :one
+SELECT id, name, brand, state, created_at, version, deleted_at, tenant_id
 FROM devices
-ORDER BY created_at DESC;
--- name: GetDevicesByBrand :many
-SELECT id, name, brand, state, created_at
-FROM devices
-WHERE LOWER(brand) = LOWER($1)
-ORDER BY created_at DESC;
+WHERE id = $1 AND deleted_at IS NULL
+FOR UPDATE;
 
--- name: GetDevicesByState :many
-SELECT id, name, brand, state, created_at
-FROM devices
-WHERE state = $1
-ORDER BY created_at DESC;
+-- name: DeleteDevice :one
+UPDATE devices
+SET deleted_at = now(),
+    version = version + 1
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id;
 
--- name: GetDevicesByBrandAndState :many
-SELECT id, name, brand, state, created_at
-FROM devices
-WHERE LOWER(brand) = LOWER($1) AND state = $2
-ORDER BY created_at DESC;
+-- name: RestoreDevice :one
+UPDATE devices
+SET deleted_at = NULL,
+    version = version + 1
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING id, name, brand, state, created_at, version, deleted_at, tenant_id;
 
--- name: DeleteDevice :one
+-- name: PurgeDeletedDevices :execrows
 DELETE FROM devices
-WHERE id = $1
-RETURNING id;
\ No newline at end of file
+WHERE deleted_at < $1;
+
+-- name: NextDeviceIDs :many
+SELECT nextval('devices_id_seq')::int AS id, now()::timestamptz AS created_at
+FROM generate_series(1, sqlc.arg(count)::int);
+
+-- name: CreateDevices :exec
+INSERT INTO devices (tenant_id, id, name, brand, state, created_at)
+SELECT sqlc.arg(tenant_id)::text, d.id, d.name, d.brand, d.state::device_state, d.created_at
+FROM unnest(sqlc.arg(ids)::int[], sqlc.arg(names)::text[], sqlc.arg(brands)::text[], sqlc.arg(states)::text[], sqlc.arg(created_ats)::timestamptz[])
+    AS d (id, name, brand, state, created_at);
@@ -0,0 +1,33 @@
+-- name: ClaimIdempotencyKey :one
+INSERT INTO idempotency_keys (key, fingerprint, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (key) DO UPDATE
+SET fingerprint = EXCLUDED.fingerprint,
+    status_code = NULL,
+    content_type = '',
+    body = NULL,
+    created_at = now(),
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at <= now()
+RETURNING key, fingerprint, status_code, content_type, body, created_at, expires_at;
+
+-- name: GetIdempotencyKey :one
+SELECT key, fingerprint, status_code, content_type, body, created_at, expires_at
+FROM idempotency_keys
+WHERE key = $1;
+
+-- name: CompleteIdempotencyKey :exec
+UPDATE idempotency_keys
+SET status_code = $2,
+    content_type = $3,
+    body = $4,
+    expires_at = $5
+WHERE key = $1;
+
+-- name: ReleaseIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE key = $1 AND status_code IS NULL;
+
+-- name: PurgeExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at <= $1;
@@ -0,0 +1,28 @@
+-- name: CreateReservation :one
+INSERT INTO reservations (device_id, reserved_by, starts_at, ends_at, note)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, device_id, reserved_by, starts_at, ends_at, note, status, created_at, tenant_id;
+
+-- name: GetReservationForUpdate :one
+SELECT id, device_id, reserved_by, starts_at, ends_at, note, status, created_at, tenant_id
+FROM reservations
+WHERE id = $1
+FOR UPDATE;
+
+-- name: SetReservationStatus :one
+UPDATE reservations
+SET status = $2
+WHERE id = $1
+RETURNING id, device_id, reserved_by, starts_at, ends_at, note, status, created_at, tenant_id;
+
+-- name: ListReservations :many
+SELECT id, device_id, reserved_by, starts_at, ends_at, note, status, created_at, tenant_id
+FROM reservations
+WHERE (sqlc.arg(device_id)::int = 0 OR device_id = sqlc.arg(device_id)::int)
+  AND (sqlc.arg(reserved_by)::text = '' OR reserved_by = sqlc.arg(reserved_by)::text)
+  AND (cardinality(sqlc.arg(statuses)::text[]) = 0 OR status::text = ANY(sqlc.arg(statuses)::text[]))
+  AND (sqlc.narg(starts_before)::timestamptz IS NULL OR starts_at <= sqlc.narg(starts_before)::timestamptz)
+  AND (sqlc.narg(ends_before)::timestamptz IS NULL OR ends_at <= sqlc.narg(ends_before)::timestamptz)
+  AND (sqlc.narg(after_starts_at)::timestamptz IS NULL OR (starts_at, id) > (sqlc.narg(after_starts_at)::timestamptz, sqlc.arg(after_id)::int))
+ORDER BY starts_at, id
+LIMIT sqlc.arg(max_rows);
@@ -0,0 +1,7 @@
+-- name: SetTenant :exec
+SELECT set_config('app.tenant_id', sqlc.arg(tenant_id)::text, true);
+
+-- name: ListTenants :many
+SELECT id
+FROM tenants
+ORDER BY id;
@@ -0,0 +1,104 @@
+package pgstore
+
+import (
+	"context"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+)
+
+func (s *PGDeviceStore) CreateReservation(ctx context.Context, tenantID string, reservation store.Reservation) (store.Reservation, error) {
+	var created Reservation
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		created, err = q.CreateReservation(ctx, CreateReservationParams{
+			DeviceID:   reservation.DeviceID,
+			ReservedBy: reservation.ReservedBy,
+			StartsAt:   reservation.StartsAt,
+			EndsAt:     reservation.EndsAt,
+			Note:       reservation.Note,
+		})
+		return mapError(err)
+	})
+	if err != nil {
+		return store.Reservation{}, err
+	}
+	return toStoreReservation(created), nil
+}
+
+func (s *PGDeviceStore) GetReservationForUpdate(ctx context.Context, tenantID string, id int32) (store.Reservation, error) {
+	var reservation Reservation
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		reservation, err = q.GetReservationForUpdate(ctx, id)
+		return mapError(err)
+	})
+	if err != nil {
+		return store.Reservation{}, err
+	}
+	return toStoreReservation(reservation), nil
+}
+
+func (s *PGDeviceStore) SetReservationStatus(ctx context.Context, tenantID string, id int32, status store.ReservationStatus) (store.Reservation, error) {
+	var reservation Reservation
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		reservation, err = q.SetReservationStatus(ctx, SetReservationStatusParams{
+			ID:     id,
+			Status: ReservationStatus(status),
+		})
+		return mapError(err)
+	})
+	if err != nil {
+		return store.Reservation{}, err
+	}
+	return toStoreReservation(reservation), nil
+}
+
+func (s *PGDeviceStore) ListReservations(ctx context.Context, tenantID string, filter store.ReservationFilter) (store.ReservationPage, error) {
+	var afterID int32
+	if filter.After != nil {
+		afterID = filter.After.ID
+	}
+	statuses := make([]string, len(filter.Statuses))
+	for i, status := range filter.Statuses {
+		statuses[i] = string(status)
+	}
+
+	var reservations []Reservation
+	err := s.scoped(ctx, tenantID, func(q *Queries) error {
+		var err error
+		reservations, err = q.ListReservations(ctx, ListReservationsParams{
+			DeviceID:      filter.DeviceID,
+			ReservedBy:    filter.ReservedBy,
+			Statuses:      statuses,
+			StartsBefore:  filter.StartsBefore,
+			EndsBefore:    filter.EndsBefore,
+			AfterStartsAt: filter.AfterStartsAt(),
+			AfterID:       afterID,
+			MaxRows:       filter.Limit + 1,
+		})
+		return mapError(err)
+	})
+	if err != nil {
+		return store.ReservationPage{}, err
+	}
+
+	result := make([]store.Reservation, len(reservations))
+	for i, reservation := range reservations {
+		result[i] = toStoreReservation(reservation)
+	}
+	return store.NewReservationPage(result, filter), nil
+}
+
+func toStoreReservation(reservation Reservation) store.Reservation {
+	return store.Reservation{
+		ID:         reservation.ID,
+		DeviceID:   reservation.DeviceID,
+		ReservedBy: reservation.ReservedBy,
+		StartsAt:   reservation.StartsAt,
+		EndsAt:     reservation.EndsAt,
+		Note:       reservation.Note,
+		Status:     store.ReservationStatus(reservation.Status),
+		CreatedAt:  reservation.CreatedAt,
+	}
+}
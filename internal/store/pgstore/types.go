@@ -0,0 +1,22 @@
+package pgstore
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// customTypes are the enums pgx has to know to send them in the binary
+// format COPY uses.
+var customTypes = []string{"device_state", "_device_state", "device_event_type", "_device_event_type"}
+
+// RegisterTypes loads the custom types into the connection's type map. Use it
+// as the AfterConnect hook of the pool.
+func RegisterTypes(ctx context.Context, conn *pgx.Conn) error {
+	types, err := conn.LoadTypes(ctx, customTypes)
+	if err != nil {
+		return err
+	}
+	conn.TypeMap().RegisterTypes(types)
+	return nil
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+type ReservationStatus string
+
+// A reservation is scheduled until its slot starts, when the scheduler puts
+// the device in use and makes it active. It is completed once the slot ends.
+// A reservation whose device is not available when its slot starts is
+// delayed until it is, and expired if the slot ends first.
+const (
+	ReservationScheduled ReservationStatus = "scheduled"
+	ReservationDelayed   ReservationStatus = "delayed"
+	ReservationActive    ReservationStatus = "active"
+	ReservationCompleted ReservationStatus = "completed"
+	ReservationCanceled  ReservationStatus = "canceled"
+	ReservationExpired   ReservationStatus = "expired"
+)
+
+var ReservationStatuses = []ReservationStatus{ReservationScheduled, ReservationDelayed, ReservationActive, ReservationCompleted, ReservationCanceled, ReservationExpired}
+
+// ErrOverlap is returned when a reservation would overlap another one of the
+// same device.
+var ErrOverlap = fmt.Errorf("overlapping reservation: %w", ErrConflict)
+
+// Reservation holds a device for the slot [StartsAt, EndsAt). Canceled and
+// expired reservations free their slot.
+type Reservation struct {
+	ID         int32             `json:"id"`
+	DeviceID   int32             `json:"device_id"`
+	ReservedBy string            `json:"reserved_by"`
+	StartsAt   time.Time         `json:"starts_at"`
+	EndsAt     time.Time         `json:"ends_at"`
+	Note       string            `json:"note"`
+	Status     ReservationStatus `json:"status"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// reservationCursorSort marks cursors handed out by the reservation lists,
+// which always list the earliest slots first.
+const reservationCursorSort = "starts_at"
+
+// ReservationFilter selects reservations; zero fields match everything.
+type ReservationFilter struct {
+	DeviceID   int32
+	ReservedBy string
+	Statuses   []ReservationStatus
+	// StartsBefore and EndsBefore keep the reservations whose slot starts,
+	// or ends, at or before the given time.
+	StartsBefore *time.Time
+	EndsBefore   *time.Time
+	Limit        int32
+	After        *Cursor
+}
+
+func (f ReservationFilter) ValidateCursor() error {
+	if f.After == nil {
+		return nil
+	}
+	if f.After.Sort != reservationCursorSort || len(f.After.Values) != 1 {
+		return ErrInvalidCursor
+	}
+	if _, err := time.Parse(time.RFC3339Nano, f.After.Values[0]); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// AfterStartsAt returns the start of the slot the cursor points at, or nil
+// without a cursor. The cursor must have been validated.
+func (f ReservationFilter) AfterStartsAt() *time.Time {
+	if f.After == nil {
+		return nil
+	}
+	startsAt, _ := time.Parse(time.RFC3339Nano, f.After.Values[0])
+	return &startsAt
+}
+
+type ReservationPage struct {
+	Reservations []Reservation
+	NextCursor   *Cursor
+}
+
+// NewReservationPage builds a page from up to filter.Limit+1 reservations,
+// like NewDevicePage.
+func NewReservationPage(reservations []Reservation, filter ReservationFilter) ReservationPage {
+	if int32(len(reservations)) <= filter.Limit {
+		return ReservationPage{Reservations: reservations}
+	}
+
+	reservations = reservations[:filter.Limit]
+	last := reservations[len(reservations)-1]
+	return ReservationPage{
+		Reservations: reservations,
+		NextCursor: &Cursor{
+			Sort:   reservationCursorSort,
+			Values: []string{last.StartsAt.UTC().Format(time.RFC3339Nano)},
+			ID:     last.ID,
+		},
+	}
+}
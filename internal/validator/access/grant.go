@@ -0,0 +1,26 @@
+package access
+
+import (
+	"context"
+
+	"github.com/danielllmuniz/devices-api/internal/validator"
+)
+
+// CreateGrantReq gives Subject, the sub of a JWT or "api-key:<name>", the
+// role on the devices of Brand, or on every device when Brand is empty.
+type CreateGrantReq struct {
+	Subject string `json:"subject" schema:"required,minLength=1,maxLength=255"`
+	RoleID  int32  `json:"role_id" schema:"required"`
+	Brand   string `json:"brand,omitempty" schema:"maxLength=255"`
+}
+
+func (req CreateGrantReq) Valid(ctx context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	eval.CheckField(validator.NotBlank(req.Subject), "subject", "Subject is required")
+	eval.CheckField(validator.MaxChars(req.Subject, 255), "subject", "Subject must be at most 255 characters")
+	eval.CheckField(req.RoleID > 0, "role_id", "Role id is required")
+	eval.CheckField(validator.MaxChars(req.Brand, 255), "brand", "Brand must be at most 255 characters")
+
+	return eval
+}
@@ -0,0 +1,48 @@
+package access
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/danielllmuniz/devices-api/internal/services"
+	"github.com/danielllmuniz/devices-api/internal/validator"
+)
+
+type CreateRoleReq struct {
+	Name        string   `json:"name" schema:"required,minLength=3,maxLength=100"`
+	Permissions []string `json:"permissions" schema:"required"`
+}
+
+func (req CreateRoleReq) Valid(ctx context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	eval.CheckField(validator.NotBlank(req.Name), "name", "Name is required")
+	eval.CheckField(validator.MinChars(req.Name, 3) && validator.MaxChars(req.Name, 100), "name", "Name must be between 3 and 100 characters")
+	checkPermissions(&eval, req.Permissions)
+
+	return eval
+}
+
+type UpdateRoleReq struct {
+	Permissions []string `json:"permissions" schema:"required"`
+}
+
+func (req UpdateRoleReq) Valid(ctx context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	checkPermissions(&eval, req.Permissions)
+
+	return eval
+}
+
+// checkPermissions accepts an empty list, for a role that grants nothing
+// until it is updated, but not a missing one.
+func checkPermissions(eval *validator.Evaluator, permissions []string) {
+	eval.CheckField(permissions != nil, "permissions", "Permissions are required")
+	for i, permission := range permissions {
+		eval.CheckField(slices.Contains(services.Permissions, permission), "permissions", fmt.Sprintf("Permission must be one of %s", strings.Join(services.Permissions, ", ")))
+		eval.CheckField(!slices.Contains(permissions[:i], permission), "permissions", fmt.Sprintf("Permission %q is repeated", permission))
+	}
+}
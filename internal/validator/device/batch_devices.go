@@ -0,0 +1,92 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/danielllmuniz/devices-api/internal/services"
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/danielllmuniz/devices-api/internal/validator"
+)
+
+// MaxBatchOperations caps the size of a single batch.
+const MaxBatchOperations = 500
+
+type BatchDevicesReq struct {
+	Operations []BatchOperationReq `json:"operations" schema:"required,minItems=1,maxItems=500"`
+}
+
+func (req BatchDevicesReq) Valid(ctx context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	eval.CheckField(len(req.Operations) > 0, "operations", "At least one operation must be informed")
+	eval.CheckField(len(req.Operations) <= MaxBatchOperations, "operations", fmt.Sprintf("At most %d operations can be sent at once", MaxBatchOperations))
+
+	return eval
+}
+
+// BatchOperationReq is one item of a batch. Device holds the body the single
+// device endpoint for the same operation takes.
+type BatchOperationReq struct {
+	Op      services.BatchOp `json:"op" schema:"required,enum=create|update|patch|delete"`
+	ID      int32            `json:"id"`
+	Version int32            `json:"version"`
+	Device  json.RawMessage  `json:"device"`
+}
+
+// Operation validates the item with the validator of the matching single
+// device request and converts it for DeviceService.RunBatch.
+func (req BatchOperationReq) Operation(ctx context.Context) (services.BatchOperation, validator.Evaluator) {
+	op := services.BatchOperation{Op: req.Op, ID: req.ID, Version: req.Version}
+
+	var eval validator.Evaluator
+	switch req.Op {
+	case services.BatchCreate:
+		var device CreateDeviceReq
+		if eval = decodeBatchDevice(ctx, req.Device, &device); len(eval) == 0 {
+			op.Name, op.Brand, op.State = device.Name, device.Brand, device.State
+		}
+	case services.BatchUpdate:
+		var device UpdateDeviceReq
+		if eval = decodeBatchDevice(ctx, req.Device, &device); len(eval) == 0 {
+			op.Name, op.Brand, op.State = device.Name, device.Brand, store.DeviceState(device.State)
+		}
+	case services.BatchPatch:
+		var device PatchDeviceReq
+		if eval = decodeBatchDevice(ctx, req.Device, &device); len(eval) == 0 {
+			op.Patch = device.Patch()
+		}
+	case services.BatchDelete:
+	default:
+		eval.AddFieldError("op", "Op must be 'create', 'update', 'patch' or 'delete'")
+		return op, eval
+	}
+
+	if req.Op != services.BatchCreate {
+		eval.CheckField(req.ID > 0, "id", "Id is required")
+	}
+	return op, eval
+}
+
+func decodeBatchDevice[T validator.Validator](ctx context.Context, raw json.RawMessage, device *T) validator.Evaluator {
+	var eval validator.Evaluator
+	if len(raw) == 0 {
+		eval.AddFieldError("device", "Device is required")
+		return eval
+	}
+	// The request body is decoded strictly, so are the devices it embeds.
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(device); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			eval.AddFieldError("device."+strings.Trim(field, `"`), "Unknown field")
+			return eval
+		}
+		eval.AddFieldError("device", "Device must be a JSON object")
+		return eval
+	}
+	return (*device).Valid(ctx)
+}
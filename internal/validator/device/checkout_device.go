@@ -0,0 +1,29 @@
+package device
+
+import (
+	"context"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/validator"
+)
+
+// CheckoutDeviceReq hands a device to Assignee, the id of the person or team
+// taking it, until DueAt if set.
+type CheckoutDeviceReq struct {
+	Assignee string     `json:"assignee" schema:"required,minLength=1,maxLength=255"`
+	DueAt    *time.Time `json:"due_at,omitempty"`
+	Note     string     `json:"note,omitempty" schema:"maxLength=1000"`
+}
+
+func (req CheckoutDeviceReq) Valid(ctx context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	eval.CheckField(validator.NotBlank(req.Assignee), "assignee", "Assignee is required")
+	eval.CheckField(validator.MaxChars(req.Assignee, 255), "assignee", "Assignee must be at most 255 characters")
+	if req.DueAt != nil {
+		eval.CheckField(req.DueAt.After(time.Now()), "due_at", "Due date must be in the future")
+	}
+	eval.CheckField(validator.MaxChars(req.Note, 1000), "note", "Note must be at most 1000 characters")
+
+	return eval
+}
@@ -8,9 +8,9 @@ import (
 )
 
 type CreateDeviceReq struct {
-	Name  string            `json:"name"`
-	Brand string            `json:"brand"`
-	State store.DeviceState `json:"state"`
+	Name  string            `json:"name" schema:"required,minLength=3,maxLength=255"`
+	Brand string            `json:"brand" schema:"required,minLength=3,maxLength=255"`
+	State store.DeviceState `json:"state" schema:"required,enum=available|in-use|inactive"`
 }
 
 func (req CreateDeviceReq) Valid(ctx context.Context) validator.Evaluator {
@@ -0,0 +1,90 @@
+package device
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/danielllmuniz/devices-api/internal/validator"
+)
+
+// MaxImportRows caps the number of devices in a single import.
+const MaxImportRows = 10000
+
+var importColumns = []string{"name", "brand", "state"}
+
+// RowProblem reports why a CSV row was rejected. Row is the line number in
+// the file, the header being line 1.
+type RowProblem struct {
+	Row    int                 `json:"row"`
+	Errors validator.Evaluator `json:"errors"`
+}
+
+// ParseDevicesCSV reads devices from a CSV file whose header names the name,
+// brand and state columns, in any order. Each row is validated like a
+// CreateDeviceReq; rows that fail are reported and left out. The error is set
+// only when the file as a whole cannot be read.
+func ParseDevicesCSV(ctx context.Context, r io.Reader) ([]CreateDeviceReq, []RowProblem, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, errors.New("csv is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read csv header: %w", err)
+	}
+
+	positions := make(map[string]int)
+	for i, column := range header {
+		positions[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range importColumns {
+		if _, ok := positions[column]; !ok {
+			return nil, nil, fmt.Errorf("csv header must have the columns %s", strings.Join(importColumns, ", "))
+		}
+	}
+
+	var (
+		devices  []CreateDeviceReq
+		problems []RowProblem
+	)
+	for rows := 0; ; rows++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("read csv: %w", err)
+		}
+		if rows == MaxImportRows {
+			return nil, nil, fmt.Errorf("csv must have at most %d rows", MaxImportRows)
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(record) != len(header) {
+			var eval validator.Evaluator
+			eval.AddFieldError("row", fmt.Sprintf("Row must have %d fields", len(header)))
+			problems = append(problems, RowProblem{Row: line, Errors: eval})
+			continue
+		}
+
+		device := CreateDeviceReq{
+			Name:  record[positions["name"]],
+			Brand: record[positions["brand"]],
+			State: store.DeviceState(record[positions["state"]]),
+		}
+		if eval := device.Valid(ctx); len(eval) > 0 {
+			problems = append(problems, RowProblem{Row: line, Errors: eval})
+			continue
+		}
+		devices = append(devices, device)
+	}
+	return devices, problems, nil
+}
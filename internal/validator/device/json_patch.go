@@ -0,0 +1,138 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/danielllmuniz/devices-api/internal/validator"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+var (
+	ErrPatchTestFailed    = errors.New("patch test failed")
+	ErrPatchNotApplicable = errors.New("patch cannot be applied to the device")
+)
+
+var jsonPatchOps = []string{"add", "remove", "replace", "move", "copy", "test"}
+
+// ParseJSONPatch decodes a JSON Patch (RFC 6902) and checks that every
+// operation is well formed.
+func ParseJSONPatch(body []byte) (jsonpatch.Patch, error) {
+	patch, err := jsonpatch.DecodePatch(body)
+	if err != nil {
+		return nil, fmt.Errorf("body must be an array of JSON Patch operations: %w", err)
+	}
+
+	for i, op := range patch {
+		if !slices.Contains(jsonPatchOps, op.Kind()) {
+			return nil, fmt.Errorf("operation %d: op must be one of 'add', 'remove', 'replace', 'move', 'copy' or 'test'", i)
+		}
+		if _, err := op.Path(); err != nil {
+			return nil, fmt.Errorf("operation %d: path is required", i)
+		}
+	}
+	return patch, nil
+}
+
+// patchDocument is the device as JSON Patch operations see it. id,
+// created_at and version can be tested but not changed.
+type patchDocument struct {
+	ID        int32             `json:"id"`
+	Name      string            `json:"name"`
+	Brand     string            `json:"brand"`
+	State     store.DeviceState `json:"state"`
+	CreatedAt json.RawMessage   `json:"created_at"`
+	Version   int32             `json:"version"`
+}
+
+var readOnlyPatchFields = map[string]string{
+	"id":         "Id cannot be changed",
+	"created_at": "Created at cannot be changed",
+	"version":    "Version cannot be changed",
+}
+
+// ApplyJSONPatch applies patch to device and returns the fields it changed,
+// validated like a merge patch. A patch that fails a test operation returns
+// ErrPatchTestFailed, one that cannot be applied ErrPatchNotApplicable.
+func ApplyJSONPatch(ctx context.Context, patch jsonpatch.Patch, device store.Device) (store.DevicePatch, validator.Evaluator, error) {
+	createdAt, err := json.Marshal(device.CreatedAt)
+	if err != nil {
+		return store.DevicePatch{}, nil, err
+	}
+	original, err := json.Marshal(patchDocument{
+		ID:        device.ID,
+		Name:      device.Name,
+		Brand:     device.Brand,
+		State:     device.State,
+		CreatedAt: createdAt,
+		Version:   device.Version,
+	})
+	if err != nil {
+		return store.DevicePatch{}, nil, err
+	}
+
+	patched, err := patch.Apply(original)
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return store.DevicePatch{}, nil, fmt.Errorf("%w: %v", ErrPatchTestFailed, err)
+	}
+	if err != nil {
+		return store.DevicePatch{}, nil, fmt.Errorf("%w: %v", ErrPatchNotApplicable, err)
+	}
+
+	var before, after map[string]json.RawMessage
+	if err := json.Unmarshal(original, &before); err != nil {
+		return store.DevicePatch{}, nil, err
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return store.DevicePatch{}, nil, fmt.Errorf("%w: the result must be an object", ErrPatchNotApplicable)
+	}
+
+	var eval validator.Evaluator
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			eval.AddFieldError(field, "Unknown field")
+		}
+	}
+	for field, message := range readOnlyPatchFields {
+		eval.CheckField(jsonEqual(before[field], after[field]), field, message)
+	}
+
+	// What changed is a merge patch: removed members become null.
+	var req PatchDeviceReq
+	for field, target := range map[string]*patchField[string]{"name": &req.Name, "brand": &req.Brand, "state": &req.State} {
+		value, ok := after[field]
+		if !ok {
+			value = json.RawMessage("null")
+		}
+		if jsonEqual(before[field], value) {
+			continue
+		}
+		if err := target.UnmarshalJSON(value); err != nil {
+			eval.AddFieldError(field, "Must be a string")
+		}
+	}
+
+	if req.Name.Set || req.Brand.Set || req.State.Set {
+		for field, message := range req.Valid(ctx) {
+			eval.AddFieldError(field, message)
+		}
+	}
+	if len(eval) > 0 {
+		return store.DevicePatch{}, eval, nil
+	}
+	return req.Patch(), nil, nil
+}
+
+// jsonEqual compares two JSON values, ignoring insignificant whitespace.
+func jsonEqual(a, b json.RawMessage) bool {
+	var bufA, bufB bytes.Buffer
+	if json.Compact(&bufA, a) != nil || json.Compact(&bufB, b) != nil {
+		return false
+	}
+	return bytes.Equal(bufA.Bytes(), bufB.Bytes())
+}
@@ -0,0 +1,179 @@
+package device
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/services"
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/danielllmuniz/devices-api/internal/validator"
+)
+
+// ParseListDevicesQuery builds a device filter from the query string of the
+// list endpoint. brand and state accept comma separated or repeated values.
+func ParseListDevicesQuery(query url.Values) (store.DeviceFilter, validator.Evaluator) {
+	var (
+		filter store.DeviceFilter
+		eval   validator.Evaluator
+	)
+
+	filter.Brands = splitValues(query["brand"])
+
+	for _, state := range splitValues(query["state"]) {
+		if !validator.InEnum(state, []any{store.DeviceStateAvailable, store.DeviceStateInUse, store.DeviceStateInactive}) {
+			eval.AddFieldError("state", "State must be 'available', 'in-use' or 'inactive'")
+			break
+		}
+		filter.States = append(filter.States, store.DeviceState(state))
+	}
+
+	filter.NameContains = strings.TrimSpace(query.Get("name"))
+
+	filter.CreatedAfter = parseTime(query.Get("created_after"), "created_after", &eval)
+	filter.CreatedBefore = parseTime(query.Get("created_before"), "created_before", &eval)
+	if filter.CreatedAfter != nil && filter.CreatedBefore != nil {
+		eval.CheckField(filter.CreatedAfter.Before(*filter.CreatedBefore), "created_before", "created_before must be after created_after")
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		fields, err := store.ParseSort(sort)
+		if err != nil {
+			eval.AddFieldError("sort", fmt.Sprintf("sort must be a comma separated list of %s, optionally prefixed with '-'", strings.Join(store.SortableFields, ", ")))
+		}
+		filter.Sort = fields
+	}
+
+	if strIncludeDeleted := query.Get("include_deleted"); strIncludeDeleted != "" {
+		includeDeleted, err := strconv.ParseBool(strIncludeDeleted)
+		if err != nil {
+			eval.AddFieldError("include_deleted", "include_deleted must be true or false")
+		}
+		filter.IncludeDeleted = includeDeleted
+	}
+
+	filter.Limit = parseLimit(query.Get("limit"), &eval)
+	filter.After = parseCursor(query.Get("cursor"), &eval)
+
+	return filter, eval
+}
+
+// ParseListDeviceEventsQuery builds an event filter from the query string of
+// the history endpoint.
+func ParseListDeviceEventsQuery(deviceID int32, query url.Values) (store.DeviceEventFilter, validator.Evaluator) {
+	var eval validator.Evaluator
+
+	filter := store.DeviceEventFilter{
+		DeviceID: deviceID,
+		Limit:    parseLimit(query.Get("limit"), &eval),
+		After:    parseCursor(query.Get("cursor"), &eval),
+	}
+	return filter, eval
+}
+
+func parseLimit(value string, eval *validator.Evaluator) int32 {
+	if value == "" {
+		return 0
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > int(services.MaxPageLimit) {
+		eval.AddFieldError("limit", fmt.Sprintf("limit must be between 1 and %d", services.MaxPageLimit))
+	}
+	return int32(limit)
+}
+
+func parseCursor(value string, eval *validator.Evaluator) *store.Cursor {
+	if value == "" {
+		return nil
+	}
+
+	cursor, err := store.DecodeCursor(value)
+	if err != nil {
+		eval.AddFieldError("cursor", "invalid cursor")
+	}
+	return &cursor
+}
+
+func splitValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+func parseTime(value, key string, eval *validator.Evaluator) *time.Time {
+	if value == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		eval.AddFieldError(key, key+" must be an RFC 3339 timestamp")
+		return nil
+	}
+	return &t
+}
+
+// ParseListAssignmentsQuery builds an assignment filter from the query string
+// of the assignment lists. open and overdue are booleans; brand accepts comma
+// separated or repeated values like the device list.
+func ParseListAssignmentsQuery(query url.Values) (store.AssignmentFilter, validator.Evaluator) {
+	var eval validator.Evaluator
+
+	filter := store.AssignmentFilter{
+		Assignee: strings.TrimSpace(query.Get("assignee")),
+		Open:     parseBool(query.Get("open"), "open", &eval),
+		Overdue:  parseBool(query.Get("overdue"), "overdue", &eval),
+		Brands:   splitValues(query["brand"]),
+		Limit:    parseLimit(query.Get("limit"), &eval),
+		After:    parseCursor(query.Get("cursor"), &eval),
+	}
+	return filter, eval
+}
+
+func parseBool(value, key string, eval *validator.Evaluator) bool {
+	if value == "" {
+		return false
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		eval.AddFieldError(key, key+" must be true or false")
+	}
+	return b
+}
+
+// ParseListReservationsQuery builds a reservation filter from the query
+// string of the reservation list. status accepts comma separated or repeated
+// values.
+func ParseListReservationsQuery(deviceID int32, query url.Values) (store.ReservationFilter, validator.Evaluator) {
+	var eval validator.Evaluator
+
+	filter := store.ReservationFilter{
+		DeviceID:   deviceID,
+		ReservedBy: strings.TrimSpace(query.Get("reserved_by")),
+		Limit:      parseLimit(query.Get("limit"), &eval),
+		After:      parseCursor(query.Get("cursor"), &eval),
+	}
+
+	statuses := make([]any, len(store.ReservationStatuses))
+	for i, status := range store.ReservationStatuses {
+		statuses[i] = status
+	}
+	for _, status := range splitValues(query["status"]) {
+		if !validator.InEnum(status, statuses) {
+			eval.AddFieldError("status", "status must be 'scheduled', 'delayed', 'active', 'completed', 'canceled' or 'expired'")
+			break
+		}
+		filter.Statuses = append(filter.Statuses, store.ReservationStatus(status))
+	}
+	return filter, eval
+}
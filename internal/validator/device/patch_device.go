@@ -1,33 +1,93 @@
 package device
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 
+	"github.com/danielllmuniz/devices-api/internal/store"
 	"github.com/danielllmuniz/devices-api/internal/validator"
 )
 
+// PatchDeviceReq is a JSON Merge Patch (RFC 7396) of a device: members left
+// out are unchanged and members set to null would remove the field, which no
+// device field allows.
 type PatchDeviceReq struct {
-	Name  string `json:"name"`
-	Brand string `json:"brand"`
-	State string `json:"state"`
+	Name  patchField[string] `json:"name" schema:"minLength=3,maxLength=255"`
+	Brand patchField[string] `json:"brand" schema:"minLength=3,maxLength=255"`
+	State patchField[string] `json:"state" schema:"enum=available|in-use|inactive"`
+}
+
+// patchField tells a member left out of the patch from one set to null.
+type patchField[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (f *patchField[T]) UnmarshalJSON(data []byte) error {
+	f.Set = true
+	if bytes.Equal(data, []byte("null")) {
+		f.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &f.Value)
+}
+
+func (f patchField[T]) MarshalJSON() ([]byte, error) {
+	if !f.Set || f.Null {
+		return []byte("null"), nil
+	}
+	return json.Marshal(f.Value)
+}
+
+// SchemaValue returns the value the field holds on the wire, for API
+// documentation.
+func (f patchField[T]) SchemaValue() any {
+	var value T
+	return value
+}
+
+// ptr returns the value to patch with, nil when the member was left out.
+func (f patchField[T]) ptr() *T {
+	if !f.Set || f.Null {
+		return nil
+	}
+	return &f.Value
 }
 
 func (req PatchDeviceReq) Valid(ctx context.Context) validator.Evaluator {
 	var eval validator.Evaluator
-	if req.Name == "" && req.Brand == "" && req.State == "" {
+	if !req.Name.Set && !req.Brand.Set && !req.State.Set {
 		eval.AddFieldError("name", "At least one field must be informed")
 		eval.AddFieldError("brand", "At least one field must be informed")
 		eval.AddFieldError("state", "At least one field must be informed")
 		return eval
 	}
-	if req.Name != "" {
-		eval.CheckField(validator.MinChars(req.Name, 3) && validator.MaxChars(req.Name, 255), "name", "Name must be between 3 and 255 characters")
+	if req.Name.Set {
+		eval.CheckField(!req.Name.Null, "name", "Name cannot be removed")
+		eval.CheckField(validator.MinChars(req.Name.Value, 3) && validator.MaxChars(req.Name.Value, 255), "name", "Name must be between 3 and 255 characters")
 	}
-	if req.Brand != "" {
-		eval.CheckField(validator.MinChars(req.Brand, 3) && validator.MaxChars(req.Brand, 255), "brand", "Brand must be between 3 and 255 characters")
+	if req.Brand.Set {
+		eval.CheckField(!req.Brand.Null, "brand", "Brand cannot be removed")
+		eval.CheckField(validator.MinChars(req.Brand.Value, 3) && validator.MaxChars(req.Brand.Value, 255), "brand", "Brand must be between 3 and 255 characters")
 	}
-	if req.State != "" {
-		eval.CheckField(validator.InEnum(req.State, []interface{}{"available", "in-use", "inactive"}), "state", "State must be 'available', 'in-use' or 'inactive")
+	if req.State.Set {
+		eval.CheckField(!req.State.Null, "state", "State cannot be removed")
+		eval.CheckField(validator.InEnum(req.State.Value, []interface{}{"available", "in-use", "inactive"}), "state", "State must be 'available', 'in-use' or 'inactive'")
 	}
 	return eval
 }
+
+// Patch returns the store patch for a valid request.
+func (req PatchDeviceReq) Patch() store.DevicePatch {
+	patch := store.DevicePatch{
+		Name:  req.Name.ptr(),
+		Brand: req.Brand.ptr(),
+	}
+	if state := req.State.ptr(); state != nil {
+		deviceState := store.DeviceState(*state)
+		patch.State = &deviceState
+	}
+	return patch
+}
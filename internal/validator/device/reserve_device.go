@@ -0,0 +1,28 @@
+package device
+
+import (
+	"context"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/validator"
+)
+
+// ReserveDeviceReq books the device for the slot [StartsAt, EndsAt). A slot
+// that already started begins at the next run of the scheduler.
+type ReserveDeviceReq struct {
+	StartsAt time.Time `json:"starts_at" schema:"required"`
+	EndsAt   time.Time `json:"ends_at" schema:"required"`
+	Note     string    `json:"note,omitempty" schema:"maxLength=1000"`
+}
+
+func (req ReserveDeviceReq) Valid(ctx context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	eval.CheckField(!req.StartsAt.IsZero(), "starts_at", "Start is required")
+	eval.CheckField(!req.EndsAt.IsZero(), "ends_at", "End is required")
+	eval.CheckField(req.EndsAt.After(req.StartsAt), "ends_at", "End must be after the start")
+	eval.CheckField(req.EndsAt.After(time.Now()), "ends_at", "End must be in the future")
+	eval.CheckField(validator.MaxChars(req.Note, 1000), "note", "Note must be at most 1000 characters")
+
+	return eval
+}
@@ -0,0 +1,237 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the devices API over HTTP. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	retry      RetryPolicy
+	actor      string
+	token      string
+	tenant     string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends requests through httpClient instead of
+// http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetry replaces DefaultRetryPolicy.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithActor records actor as the author of every change in the device
+// history.
+func WithActor(actor string) Option {
+	return func(c *Client) {
+		c.actor = actor
+	}
+}
+
+// WithToken authenticates every call with token, an API key or a JWT, as a
+// bearer credential.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithTenant sends every call on behalf of tenant. API keys and JWTs carry
+// their tenant, which it may only repeat; it picks the tenant when the server
+// runs without authentication.
+func WithTenant(tenant string) Option {
+	return func(c *Client) {
+		c.tenant = tenant
+	}
+}
+
+// New returns a client for the API served at baseURL, e.g.
+// "http://localhost:8080".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q: scheme and host are required", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    parsed,
+		httpClient: http.DefaultClient,
+		retry:      DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// request is one API call; it is rebuilt for every attempt.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	header      http.Header
+	body        []byte
+	contentType string
+}
+
+// repeatable reports whether sending req twice has the effect of sending it
+// once, so that it can be retried.
+func (req *request) repeatable() bool {
+	return req.method == http.MethodGet || req.header.Get("Idempotency-Key") != ""
+}
+
+func (c *Client) newRequest(method, path string, body any) (*request, error) {
+	req := &request{method: method, path: path, header: http.Header{}}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		req.body = data
+		req.contentType = "application/json"
+	}
+	return req, nil
+}
+
+// do sends req and decodes the response into out.
+func (c *Client) do(ctx context.Context, req *request, out any) error {
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decode %s %s response: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+// send sends req, retrying as the policy allows, and returns the first
+// successful response with its body unread. Error responses are returned as
+// *Error.
+func (c *Client) send(ctx context.Context, req *request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := c.sendOnce(ctx, req)
+		if err == nil && res.StatusCode < 400 {
+			return res, nil
+		}
+
+		retryable := ctx.Err() == nil && req.repeatable()
+		if err == nil {
+			apiErr := readError(res)
+			err, retryable = apiErr, retryable && c.retry.retryableStatus(res.StatusCode, apiErr.Code)
+		}
+		if !retryable || attempt >= c.retry.MaxAttempts {
+			return nil, err
+		}
+
+		wait := c.retry.backoff(attempt)
+		if res != nil {
+			if after, ok := retryAfter(res); ok && after > wait {
+				wait = after
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) sendOnce(ctx context.Context, req *request) (*http.Response, error) {
+	target := c.baseURL.JoinPath(req.path)
+	target.RawQuery = req.query.Encode()
+
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range req.header {
+		httpReq.Header[key] = values
+	}
+	if httpReq.Header.Get("Accept") == "" {
+		httpReq.Header.Set("Accept", "application/json")
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	if c.actor != "" {
+		httpReq.Header.Set("X-Actor", c.actor)
+	}
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.tenant != "" {
+		httpReq.Header.Set("X-Tenant-ID", c.tenant)
+	}
+
+	return c.httpClient.Do(httpReq)
+}
+
+// retryAfter reads a Retry-After header given in seconds.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// newIdempotencyKey returns a random key, so that retried creates are
+// replayed instead of creating the device twice.
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return hex.EncodeToString(key)
+}
+
+// ifMatch formats a device version as the ETag the API sets.
+func ifMatch(version int32) string {
+	return strconv.Quote(strconv.Itoa(int(version)))
+}
+
+// isProblem reports whether contentType is an RFC 7807 problem document.
+func isProblem(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.HasPrefix(mediaType, "application/problem+")
+}
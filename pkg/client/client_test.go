@@ -0,0 +1,275 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danielllmuniz/devices-api/internal/api"
+	"github.com/danielllmuniz/devices-api/internal/services"
+	"github.com/danielllmuniz/devices-api/internal/store"
+	"github.com/danielllmuniz/devices-api/internal/store/mockstore"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer serves the API over the mock stores. wrap, when set, sits in
+// front of the router to disturb the traffic.
+func newTestServer(t *testing.T, wrap func(http.Handler) http.Handler) (*httptest.Server, *mockstore.MockDeviceStore) {
+	mock := mockstore.NewMockDeviceStore()
+	app := api.Api{
+		Router:             chi.NewMux(),
+		DeviceService:      services.NewDeviceService(mock),
+		IdempotencyService: services.NewIdempotencyService(mockstore.NewMockIdempotencyStore()),
+	}
+	app.BindRoutes()
+
+	var handler http.Handler = app.Router
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server, mock
+}
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func newTestClient(t *testing.T, server *httptest.Server, opts ...Option) *Client {
+	c, err := New(server.URL, append([]Option{WithRetry(fastRetry)}, opts...)...)
+	require.NoError(t, err)
+	return c
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("localhost:8080")
+	assert.Error(t, err)
+
+	_, err = New("http://localhost:8080")
+	assert.NoError(t, err)
+}
+
+func TestClientDevices(t *testing.T) {
+	server, _ := newTestServer(t, nil)
+	c := newTestClient(t, server, WithActor("alice"))
+	ctx := context.Background()
+
+	created, err := c.CreateDevice(ctx, CreateDeviceRequest{Name: "Device A", Brand: "BrandX", State: DeviceStateAvailable})
+	require.NoError(t, err)
+	assert.Equal(t, "Device A", created.Name)
+	assert.Equal(t, DeviceStateAvailable, created.State)
+
+	got, err := c.GetDevice(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, got.ID)
+
+	updated, err := c.UpdateDevice(ctx, created.ID, UpdateDeviceRequest{Name: "Device B", Brand: "BrandY", State: "inactive"}, IfVersion(got.Version))
+	require.NoError(t, err)
+	assert.Equal(t, "Device B", updated.Name)
+	assert.Equal(t, DeviceStateInactive, updated.State)
+
+	patched, err := c.PatchDevice(ctx, created.ID, DevicePatch{Brand: ptr("BrandZ")})
+	require.NoError(t, err)
+	assert.Equal(t, "Device B", patched.Name)
+	assert.Equal(t, "BrandZ", patched.Brand)
+
+	_, err = c.PatchDevice(ctx, created.ID, DevicePatch{Name: ptr("Device C")}, IfVersion(got.Version))
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	require.NoError(t, c.DeleteDevice(ctx, created.ID))
+
+	_, err = c.GetDevice(ctx, created.ID)
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, api.CodeDeviceNotFound, apiErr.Code)
+}
+
+func TestClientErrors(t *testing.T) {
+	server, _ := newTestServer(t, nil)
+	c := newTestClient(t, server)
+	ctx := context.Background()
+
+	inUse, err := c.CreateDevice(ctx, CreateDeviceRequest{Name: "Device A", Brand: "BrandX", State: DeviceStateInUse})
+	require.NoError(t, err)
+
+	err = c.DeleteDevice(ctx, inUse.ID)
+	assert.ErrorIs(t, err, ErrDeviceInUse)
+	assert.False(t, errors.Is(err, ErrDeviceNotFound))
+
+	_, err = c.CreateDevice(ctx, CreateDeviceRequest{Name: "A", Brand: "BrandX", State: DeviceStateAvailable})
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	assert.Equal(t, api.CodeValidationFailed, apiErr.Code)
+	assert.Contains(t, apiErr.Errors, "name")
+	assert.Nil(t, apiErr.Unwrap())
+}
+
+func TestErrorCodes(t *testing.T) {
+	// The sentinels mirror those of the API, which the client cannot import.
+	for code, err := range errorsByCode {
+		known := api.ErrorForCode(code)
+		if assert.NotNil(t, known, "Expected the API to report code %s", code) {
+			assert.Equal(t, known.Error(), err.Error(), code)
+		}
+	}
+}
+
+func TestClientListDevices(t *testing.T) {
+	server, _ := newTestServer(t, nil)
+	c := newTestClient(t, server)
+	ctx := context.Background()
+
+	for i := range 5 {
+		_, err := c.CreateDevice(ctx, CreateDeviceRequest{Name: fmt.Sprintf("Device %d", i), Brand: "BrandX", State: DeviceStateAvailable})
+		require.NoError(t, err)
+	}
+	_, err := c.CreateDevice(ctx, CreateDeviceRequest{Name: "Other", Brand: "BrandY", State: DeviceStateAvailable})
+	require.NoError(t, err)
+
+	filter := DeviceFilter{Brands: []string{"BrandX"}, Limit: 2}
+
+	var pages, devices int
+	for page, err := range c.ListDevices(ctx, filter) {
+		require.NoError(t, err)
+		pages++
+		devices += len(page)
+	}
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, 5, devices)
+
+	pages = 0
+	for range c.ListDevices(ctx, filter) {
+		pages++
+		break
+	}
+	assert.Equal(t, 1, pages)
+
+	now := time.Now()
+	pages = 0
+	for _, err := range c.ListDevices(ctx, DeviceFilter{CreatedAfter: &now, CreatedBefore: ptr(now.Add(-time.Hour))}) {
+		pages++
+		var apiErr *Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, api.CodeInvalidQuery, apiErr.Code)
+	}
+	assert.Equal(t, 1, pages)
+}
+
+func TestClientRetry(t *testing.T) {
+	// The first `failures` calls find the database down.
+	var calls, failures atomic.Int32
+	var mock *mockstore.MockDeviceStore
+	server, mock := newTestServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= failures.Load() {
+				mock.FailWith(store.ErrUnavailable)
+				defer mock.FailWith(nil)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	ctx := context.Background()
+
+	failures.Store(2)
+	_, err := newTestClient(t, server).CreateDevice(ctx, CreateDeviceRequest{Name: "Device A", Brand: "BrandX", State: DeviceStateAvailable})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+
+	calls.Store(0)
+	failures.Store(3)
+	_, err = newTestClient(t, server).GetDevice(ctx, 1)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, int32(3), calls.Load())
+
+	calls.Store(0)
+	failures.Store(1)
+	_, err = newTestClient(t, server, WithRetry(NoRetry)).GetDevice(ctx, 1)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, int32(1), calls.Load())
+
+	calls.Store(0)
+	failures.Store(0)
+	_, err = newTestClient(t, server).GetDevice(ctx, 42)
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+	assert.Equal(t, int32(1), calls.Load(), "Expected client errors not to be retried")
+}
+
+func TestClientRetryCreateIsReplayed(t *testing.T) {
+	// The first response is lost on the way back after the device was
+	// created.
+	var calls atomic.Int32
+	server, mock := newTestServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				next.ServeHTTP(httptest.NewRecorder(), r)
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	c := newTestClient(t, server)
+	ctx := context.Background()
+
+	device, err := c.CreateDevice(ctx, CreateDeviceRequest{Name: "Device A", Brand: "BrandX", State: DeviceStateAvailable})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+
+	devices, err := mock.ListDevices(ctx, store.DefaultTenant, store.DeviceFilter{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, devices.Devices, 1)
+	assert.Equal(t, devices.Devices[0].ID, device.ID)
+}
+
+func TestClientRetryOnlyRepeatsSafeCalls(t *testing.T) {
+	// Every response is lost on the way back after the call went through.
+	var calls atomic.Int32
+	server, _ := newTestServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			next.ServeHTTP(httptest.NewRecorder(), r)
+			w.WriteHeader(http.StatusBadGateway)
+		})
+	})
+	c := newTestClient(t, server)
+	ctx := context.Background()
+
+	err := c.DeleteDevice(ctx, 1)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load(), "Expected a delete not to be retried")
+
+	calls.Store(0)
+	_, err = c.UpdateDevice(ctx, 1, UpdateDeviceRequest{Name: "Device A", Brand: "BrandX", State: DeviceStateAvailable}, IfVersion(1))
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load(), "Expected an update not to be retried")
+
+	calls.Store(0)
+	_, err = c.GetDevice(ctx, 1)
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for attempt := 1; attempt <= 10; attempt++ {
+		wait := policy.backoff(attempt)
+		assert.Positive(t, wait)
+		assert.LessOrEqual(t, wait, 50*time.Millisecond)
+	}
+	assert.LessOrEqual(t, policy.backoff(1), 10*time.Millisecond)
+	assert.Zero(t, NoRetry.backoff(1))
+}
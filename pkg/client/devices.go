@@ -0,0 +1,306 @@
+package client
+
+import (
+	"context"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type DeviceState string
+
+const (
+	DeviceStateAvailable DeviceState = "available"
+	DeviceStateInUse     DeviceState = "in-use"
+	DeviceStateInactive  DeviceState = "inactive"
+)
+
+// Device is a device as the API returns it.
+type Device struct {
+	ID        int32       `json:"id"`
+	Name      string      `json:"name"`
+	Brand     string      `json:"brand"`
+	State     DeviceState `json:"state"`
+	CreatedAt time.Time   `json:"created_at"`
+	Version   int32       `json:"version"`
+	// DeletedAt is set once the device is soft deleted.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type CreateDeviceRequest struct {
+	Name  string      `json:"name"`
+	Brand string      `json:"brand"`
+	State DeviceState `json:"state"`
+}
+
+type UpdateDeviceRequest struct {
+	Name  string      `json:"name"`
+	Brand string      `json:"brand"`
+	State DeviceState `json:"state"`
+}
+
+// DevicePatch is a partial update: nil fields are left unchanged.
+type DevicePatch struct {
+	Name  *string
+	Brand *string
+	State *DeviceState
+}
+
+// IsEmpty reports whether the patch changes nothing.
+func (p DevicePatch) IsEmpty() bool {
+	return p.Name == nil && p.Brand == nil && p.State == nil
+}
+
+// Cursor points at the page following the one it came with. It is opaque;
+// pass it back as DeviceFilter.After.
+type Cursor string
+
+// DeviceFilter describes which devices to list and in which order. Empty
+// fields match every device.
+type DeviceFilter struct {
+	Brands        []string
+	States        []DeviceState
+	NameContains  string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Sort is a comma separated list of fields such as "-created_at,name",
+	// where a leading "-" means descending order.
+	Sort  string
+	Limit int32
+	After *Cursor
+	// IncludeDeleted also lists soft deleted devices.
+	IncludeDeleted bool
+}
+
+// query formats the filter as the query string of the device list.
+func (f DeviceFilter) query() url.Values {
+	query := url.Values{}
+	if len(f.Brands) > 0 {
+		query.Set("brand", strings.Join(f.Brands, ","))
+	}
+	if len(f.States) > 0 {
+		states := make([]string, len(f.States))
+		for i, state := range f.States {
+			states[i] = string(state)
+		}
+		query.Set("state", strings.Join(states, ","))
+	}
+	if f.NameContains != "" {
+		query.Set("name", f.NameContains)
+	}
+	if f.CreatedAfter != nil {
+		query.Set("created_after", f.CreatedAfter.Format(time.RFC3339Nano))
+	}
+	if f.CreatedBefore != nil {
+		query.Set("created_before", f.CreatedBefore.Format(time.RFC3339Nano))
+	}
+	if f.Sort != "" {
+		query.Set("sort", f.Sort)
+	}
+	if f.IncludeDeleted {
+		query.Set("include_deleted", "true")
+	}
+	if f.Limit > 0 {
+		query.Set("limit", strconv.Itoa(int(f.Limit)))
+	}
+	if f.After != nil {
+		query.Set("cursor", string(*f.After))
+	}
+	return query
+}
+
+// RowProblem lists what is wrong with a row of an import, by field.
+type RowProblem struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+// CallOption adjusts a single call.
+type CallOption func(*request)
+
+// IfVersion only applies an update or patch while the device is still at
+// version; otherwise the call fails with ErrVersionMismatch.
+func IfVersion(version int32) CallOption {
+	return func(req *request) {
+		req.header.Set("If-Match", ifMatch(version))
+	}
+}
+
+// IdempotencyKey sets the key of a create instead of a random one, to make
+// it safe to repeat across client restarts.
+func IdempotencyKey(key string) CallOption {
+	return func(req *request) {
+		req.header.Set("Idempotency-Key", key)
+	}
+}
+
+type deviceResponse struct {
+	Device Device `json:"device"`
+}
+
+// ImportReport is the outcome of an import.
+type ImportReport struct {
+	DryRun   bool         `json:"dry_run"`
+	Valid    int          `json:"valid"`
+	Imported int          `json:"imported"`
+	Rejected int          `json:"rejected"`
+	Problems []RowProblem `json:"problems"`
+}
+
+type listDevicesResponse struct {
+	Devices    []Device `json:"devices"`
+	NextCursor *Cursor  `json:"next_cursor"`
+}
+
+func devicePath(id int32) string {
+	return "/api/v1/devices/" + strconv.Itoa(int(id))
+}
+
+func (c *Client) CreateDevice(ctx context.Context, device CreateDeviceRequest, opts ...CallOption) (Device, error) {
+	req, err := c.newRequest(http.MethodPost, "/api/v1/devices", device)
+	if err != nil {
+		return Device{}, err
+	}
+	req.header.Set("Idempotency-Key", newIdempotencyKey())
+	return c.doDevice(ctx, req, opts)
+}
+
+func (c *Client) GetDevice(ctx context.Context, id int32) (Device, error) {
+	req, err := c.newRequest(http.MethodGet, devicePath(id), nil)
+	if err != nil {
+		return Device{}, err
+	}
+	return c.doDevice(ctx, req, nil)
+}
+
+func (c *Client) UpdateDevice(ctx context.Context, id int32, device UpdateDeviceRequest, opts ...CallOption) (Device, error) {
+	req, err := c.newRequest(http.MethodPut, devicePath(id), device)
+	if err != nil {
+		return Device{}, err
+	}
+	return c.doDevice(ctx, req, opts)
+}
+
+// PatchDevice changes the fields set in patch and leaves the others alone.
+func (c *Client) PatchDevice(ctx context.Context, id int32, patch DevicePatch, opts ...CallOption) (Device, error) {
+	body := map[string]any{}
+	if patch.Name != nil {
+		body["name"] = *patch.Name
+	}
+	if patch.Brand != nil {
+		body["brand"] = *patch.Brand
+	}
+	if patch.State != nil {
+		body["state"] = *patch.State
+	}
+
+	req, err := c.newRequest(http.MethodPatch, devicePath(id), body)
+	if err != nil {
+		return Device{}, err
+	}
+	req.contentType = "application/merge-patch+json"
+	return c.doDevice(ctx, req, opts)
+}
+
+func (c *Client) DeleteDevice(ctx context.Context, id int32) error {
+	req, err := c.newRequest(http.MethodDelete, devicePath(id), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, nil)
+}
+
+// ListDevicesPage returns the page of devices matching filter that starts at
+// filter.After, and the cursor of the next page, nil on the last one.
+func (c *Client) ListDevicesPage(ctx context.Context, filter DeviceFilter) ([]Device, *Cursor, error) {
+	req, err := c.newRequest(http.MethodGet, "/api/v1/devices", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.query = filter.query()
+
+	var res listDevicesResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, nil, err
+	}
+	return res.Devices, res.NextCursor, nil
+}
+
+// ListDevices iterates over the pages of devices matching filter, fetching
+// each one as the previous is consumed. Iteration stops after an error.
+func (c *Client) ListDevices(ctx context.Context, filter DeviceFilter) iter.Seq2[[]Device, error] {
+	return func(yield func([]Device, error) bool) {
+		for {
+			devices, next, err := c.ListDevicesPage(ctx, filter)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(devices, nil) || next == nil {
+				return
+			}
+			filter.After = next
+		}
+	}
+}
+
+// ImportDevices creates the devices of a CSV file with name, brand and state
+// columns. Invalid rows are reported and skipped; with dryRun nothing is
+// created.
+func (c *Client) ImportDevices(ctx context.Context, csv io.Reader, dryRun bool) (ImportReport, error) {
+	body, err := io.ReadAll(csv)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	req, err := c.newRequest(http.MethodPost, "/api/v1/devices/import", nil)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	req.body, req.contentType = body, "text/csv"
+	if dryRun {
+		req.query = url.Values{"dry_run": {"true"}}
+	}
+
+	var report ImportReport
+	if err := c.do(ctx, req, &report); err != nil {
+		return ImportReport{}, err
+	}
+	return report, nil
+}
+
+// ExportDevices streams every device matching filter as csv, ndjson or xlsx.
+// filter.Limit and filter.After are ignored. The caller must close the
+// returned reader.
+func (c *Client) ExportDevices(ctx context.Context, format string, filter DeviceFilter) (io.ReadCloser, error) {
+	req, err := c.newRequest(http.MethodGet, "/api/v1/devices/export", nil)
+	if err != nil {
+		return nil, err
+	}
+	filter.Limit, filter.After = 0, nil
+	req.query = filter.query()
+	req.query.Set("format", format)
+	req.header.Set("Accept", "*/*")
+
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (c *Client) doDevice(ctx context.Context, req *request, opts []CallOption) (Device, error) {
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	var res deviceResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return Device{}, err
+	}
+	return res.Device, nil
+}
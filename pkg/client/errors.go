@@ -0,0 +1,101 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// The errors the API reports. An *Error unwraps to the one its problem code
+// stands for, so errors.Is(err, ErrDeviceNotFound) works on any call.
+var (
+	ErrDeviceNotFound      = errors.New("device not found")
+	ErrDeviceInUse         = errors.New("device is currently in use and cannot be modified or deleted")
+	ErrDeviceNotDeleted    = errors.New("device is not deleted")
+	ErrDeviceCheckedOut    = errors.New("device is checked out, check it in to change its state")
+	ErrDeviceReserved      = errors.New("device is reserved, cancel the reservation to change its state")
+	ErrReservationConflict = errors.New("the slot overlaps another reservation of the device")
+	ErrReservationEnded    = errors.New("reservation has already ended")
+	ErrVersionMismatch     = errors.New("device was modified, version does not match")
+	ErrIllegalTransition   = errors.New("illegal state transition")
+	ErrUnauthenticated     = errors.New("authentication required")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrInsufficientScope   = errors.New("insufficient scope")
+	ErrForbidden           = errors.New("forbidden")
+	ErrTenantRequired      = errors.New("tenant is required")
+	ErrConflict            = errors.New("conflict")
+	ErrUnavailable         = errors.New("store unavailable")
+)
+
+// The problem codes of the API the client tells apart.
+const (
+	codeConflict = "conflict"
+)
+
+var errorsByCode = map[string]error{
+	"device_not_found":     ErrDeviceNotFound,
+	"device_in_use":        ErrDeviceInUse,
+	"device_not_deleted":   ErrDeviceNotDeleted,
+	"device_checked_out":   ErrDeviceCheckedOut,
+	"device_reserved":      ErrDeviceReserved,
+	"reservation_conflict": ErrReservationConflict,
+	"reservation_ended":    ErrReservationEnded,
+	"version_mismatch":     ErrVersionMismatch,
+	"illegal_transition":   ErrIllegalTransition,
+	"unauthenticated":      ErrUnauthenticated,
+	"invalid_credentials":  ErrInvalidCredentials,
+	"insufficient_scope":   ErrInsufficientScope,
+	"forbidden":            ErrForbidden,
+	"tenant_required":      ErrTenantRequired,
+	codeConflict:           ErrConflict,
+	"service_unavailable":  ErrUnavailable,
+}
+
+// Problem is the RFC 7807 problem the API answers errors with.
+type Problem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Code     string            `json:"code"`
+	Errors   map[string]string `json:"errors,omitempty"`
+	// Allowed lists the states the device can move to, for illegal
+	// transitions.
+	Allowed []DeviceState `json:"allowed,omitempty"`
+	// Offset is the byte offset in the request body where decoding failed.
+	Offset *int64 `json:"offset,omitempty"`
+}
+
+// Error is an error response of the API.
+type Error struct {
+	StatusCode int
+	Problem
+}
+
+// readError reads the problem of an error response and closes its body.
+func readError(res *http.Response) *Error {
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+
+	apiErr := &Error{StatusCode: res.StatusCode}
+	if !isProblem(res.Header.Get("Content-Type")) || json.Unmarshal(body, &apiErr.Problem) != nil {
+		apiErr.Problem = Problem{Status: res.StatusCode, Title: http.StatusText(res.StatusCode)}
+	}
+	return apiErr
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Title, e.Detail)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Title)
+}
+
+// Unwrap returns the sentinel error of the problem code, such as
+// ErrDeviceNotFound, or nil for codes without one.
+func (e *Error) Unwrap() error {
+	return errorsByCode[e.Code]
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy decides how often and how long apart failed calls are
+// retried. Calls are retried on network errors, 429, 502, 503 and 504
+// responses, and conflicts with a concurrent change, but only when they are
+// safe to repeat: reads, and writes that carry an Idempotency-Key. Other
+// writes are made once, since a lost response does not tell whether they
+// took effect.
+type RetryPolicy struct {
+	// MaxAttempts counts the first call; 1 disables retries.
+	MaxAttempts int
+	// The wait before retry n is random up to MinBackoff * 2^(n-1), capped
+	// at MaxBackoff. A longer Retry-After from the server wins.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  2 * time.Second,
+}
+
+// NoRetry makes every call once.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+func (p RetryPolicy) retryableStatus(status int, code string) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return code == codeConflict
+}
+
+// backoff returns the wait after the given failed attempt, with full jitter.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.MinBackoff <= 0 {
+		return 0
+	}
+	ceiling := p.MinBackoff << (attempt - 1)
+	if ceiling <= 0 || (p.MaxBackoff > 0 && ceiling > p.MaxBackoff) {
+		ceiling = p.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling) + 1
+}